@@ -1,111 +1,118 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/settings"
 )
 
 var (
 	flagNetAddr    string
-	reportInterval *int
-	pollInterval   *int
+	reportInterval = new(int)
+	pollInterval   = new(int)
 	flagLogLevel   string
 	flagKey        string
-	rateLimit      *int
+	rateLimit      = new(int)
 	cryptoKey      string
 	flagConfigFile string
-)
-
-func parseFlags() {
-	flag.StringVar(&flagNetAddr, "a", ":8080", "address and port to run server")
 
-	reportInterval = flag.Int("r", 10, "report interval")
-	pollInterval = flag.Int("p", 2, "poll interval")
-	flag.StringVar(&flagLogLevel, "log", "info", "log level")
-	flag.StringVar(&flagKey, "k", "", "key for hashing data")
-	rateLimit = flag.Int("l", 1, "count of concurrent messages to server")
-	flag.StringVar(&cryptoKey, "crypto-key", "", "public key for asymmetric encryption")
-	flag.StringVar(&flagConfigFile, "c", "", "name of configuration file")
+	flagRetryAttempts    int
+	flagRetryBase        time.Duration
+	flagRetryMax         time.Duration
+	flagRetryJitter      float64
+	flagRetryStatusRules string
+	flagRetryBudget      int
+	flagAgentID          string
 
-	flag.Parse()
+	flagAgentGroup         string
+	flagConfigPollInterval time.Duration
+)
 
-	// для случаев, когда в переменной окружения ADDRESS присутствует непустое значение,
-	// переопределим адрес агента,
-	// даже если он был передан через аргумент командной строки
-	parseEnvironment()
+// loader - загрузчик параметров запуска агента.
+var loader = newLoader()
 
-	// параметры конфигурации переопределяются параметрами из файла конфигурции, даже если они были переданы через аргументы командной строки
-	// или глобальные переменные
-	parseConfigFile()
+// agentArgs - аргументы командной строки агента, которые повторно применяются при перезагрузке конфигурации.
+var agentArgs []string
 
-	config.SetReportInterval(time.Duration(*reportInterval))
-	config.SetPollInterval(time.Duration(*pollInterval))
-	hasher.SetKey(flagKey)
-	config.SetCryptoGrapher(encryption.Initialize(cryptoKey, ""))
+// newLoader - регистрирует параметры запуска агента. Значение каждого параметра определяется с приоритетом
+// значение по умолчанию < файл конфигурации < переменная окружения < флаг командной строки.
+func newLoader() *settings.Loader {
+	l := settings.NewLoader("agent")
+	l.ConfigFile(&flagConfigFile, "CONFIG", "c")
+	l.String(&flagNetAddr, ":8080", "address", "ADDRESS", "a", "address and port to run server")
+	l.Seconds(reportInterval, 10, "report_interval", "REPORT_INTERVAL", "r", "report interval")
+	l.Seconds(pollInterval, 2, "poll_interval", "POLL_INTERVAL", "p", "poll interval")
+	l.String(&flagLogLevel, "info", "log_level", "AGENT_LOG_LEVEL", "log", "log level")
+	l.String(&flagKey, "", "key", "KEY", "k", "key for hashing data").Secret()
+	l.Int(rateLimit, 1, "rate_limit", "RATE_LIMIT", "l", "count of concurrent messages to server")
+	l.String(&cryptoKey, "", "crypto_key", "CRYPTO_KEY", "crypto-key", "public key for asymmetric encryption")
+	l.Int(&flagRetryAttempts, worker.DefaultRetryPolicy.MaxAttempts, "retry_attempts", "RETRY_ATTEMPTS", "retry-attempts", "max attempts to push metrics, including the first one")
+	l.Duration(&flagRetryBase, worker.DefaultRetryPolicy.Base, "retry_base", "RETRY_BASE", "retry-base", "delay before the first retry, doubled for each next retry")
+	l.Duration(&flagRetryMax, worker.DefaultRetryPolicy.Max, "retry_max", "RETRY_MAX", "retry-max", "max delay between retries")
+	l.Float64(&flagRetryJitter, worker.DefaultRetryPolicy.Jitter, "retry_jitter", "RETRY_JITTER", "retry-jitter", "random share of retry delay in [0, 1]")
+	l.String(&flagRetryStatusRules, "", "retry_status_rules", "RETRY_STATUS_RULES", "retry-status-rules", "whether to retry response status codes, e.g. \"500=false,409=true\"")
+	l.Int(&flagRetryBudget, worker.DefaultRetryBudgetMax, "retry_budget", "RETRY_BUDGET", "retry-budget", "max retries in a burst shared by all pushes")
+	l.String(&flagAgentID, "", "agent_id", "AGENT_ID", "agent-id", "agent identifier, used by server for rate limiting instead of agent IP address")
+	l.String(&flagAgentGroup, "", "agent_group", "AGENT_GROUP", "agent-group", "agent group, used by server for choosing agent settings")
+	l.Duration(&flagConfigPollInterval, time.Minute, "config_poll_interval", "CONFIG_POLL_INTERVAL", "config-poll-interval", "interval of requesting agent settings from server, 0 disables requesting")
+	return l
 }
 
-// parseEnvironment - функция для переопределения параметров конфигурации из глобальных переменных.
-func parseEnvironment() {
-	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
-		flagNetAddr = envRunAddr
+func parseFlags() app.Config {
+	agentArgs = os.Args[1:]
+	err := loader.Load(agentArgs)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	if envReportInterval := os.Getenv("REPORT_INTERVAL"); envReportInterval != "" {
-		val, err := strconv.Atoi(envReportInterval)
-		if err != nil {
-			log.Fatalln("Environment variable \"REPORT_INTERVAL\" must be int")
-		}
-		*reportInterval = val
+	// ошибки загрузки и проверки параметров выводятся вместе
+	cfg, cfgErr := agentConfig()
+	if err := errors.Join(err, cfgErr); err != nil {
+		log.Fatalf("invalid configuration:\n%v\n", err)
 	}
-	if envPollInterval := os.Getenv("POLL_INTERVAL"); envPollInterval != "" {
-		val, err := strconv.Atoi(envPollInterval)
-		if err != nil {
-			log.Fatalln("Environment variable \"POLL_INTERVAL\" must be int")
+	// вывод действующей конфигурации без запуска агента
+	if loader.PrintRequested() {
+		if err := loader.Print(os.Stdout); err != nil {
+			log.Fatalf("print configuration error: %v\n", err)
 		}
-		*pollInterval = val
-	}
-	if envLogLevel := os.Getenv("AGENT_LOG_LEVEL"); envLogLevel != "" {
-		flagLogLevel = envLogLevel
-	}
-	if envKey := os.Getenv("KEY"); envKey != "" {
-		flagKey = envKey
-	}
-
-	if envRateLimit := os.Getenv("RATE_LIMIT"); envRateLimit != "" {
-		val, err := strconv.Atoi(envRateLimit)
-		if err != nil {
-			log.Fatalln("Environment variable \"POLL_INTERVAL\" must be int")
-		}
-		*rateLimit = val
-	}
-	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
-		cryptoKey = envCryptoKey
-	}
-	if envConfigFile := os.Getenv("CONFIG"); envConfigFile != "" {
-		flagConfigFile = envConfigFile
+		os.Exit(0)
 	}
+	return cfg
 }
 
-// parseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
-func parseConfigFile() {
-	// елси на указан файл конфигурации, то оставляю параметры запуска без изменения
-	if flagConfigFile == "" {
-		return
+// agentConfig - собирает параметры агента из загруженных параметров запуска и проверяет их.
+func agentConfig() (app.Config, error) {
+	var problems settings.Problems
+	rules, err := worker.ParseStatusRules(flagRetryStatusRules)
+	problems.Add("invalid retry_status_rules", err)
+
+	retry := worker.DefaultRetryPolicy
+	retry.MaxAttempts = flagRetryAttempts
+	retry.Base = flagRetryBase
+	retry.Max = flagRetryMax
+	retry.Jitter = flagRetryJitter
+	retry.StatusRules = rules
+	cfg := app.Config{
+		Address:            flagNetAddr,
+		LogLevel:           flagLogLevel,
+		PollInterval:       time.Duration(*pollInterval) * time.Second,
+		ReportInterval:     time.Duration(*reportInterval) * time.Second,
+		Key:                flagKey,
+		CryptoKey:          cryptoKey,
+		RateLimit:          *rateLimit,
+		Retry:              retry,
+		RetryBudget:        flagRetryBudget,
+		AgentID:            flagAgentID,
+		AgentGroup:         flagAgentGroup,
+		ConfigPollInterval: flagConfigPollInterval,
 	}
-	configs, err := config.ParseConfigFile(flagConfigFile)
-	if err != nil {
-		log.Fatalf("parse config file error: %v\n", err)
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err)
 	}
-
-	// обновляю параметры запуска
-	flagNetAddr = configs.Address
-	*reportInterval = int(configs.ReportInterval.Duration.Seconds())
-	*pollInterval = int(configs.PollInterval.Duration.Seconds())
-	cryptoKey = configs.CryptoKey
+	return cfg, problems.Err()
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
-	"flag"
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
 )
 
 func TestParseFlagsWithFlags(t *testing.T) {
@@ -16,7 +20,6 @@ func TestParseFlagsWithFlags(t *testing.T) {
 	os.Args = []string{"cmd", "-a", ":9000", "-r", "120", "-p", "240", "-log=info", "-l", "3", "-k", "secret", "-crypto-key", "/crypto/key/path"}
 	defer func() { os.Args = originalArgs }()
 
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	parseFlags()
 
 	assert.Equal(t, ":9000", flagNetAddr)
@@ -30,73 +33,55 @@ func TestParseFlagsWithFlags(t *testing.T) {
 
 func TestParseFlagsPriority(t *testing.T) {
 	// Устанавливаем переменные окружения
-	os.Setenv("ADDRESS", ":8000")
-	os.Setenv("REPORT_INTERVAL", "200")
-	os.Setenv("POLL_INTERVAL", "314")
-	os.Setenv("AGENT_LOG_LEVEL", "debug")
-	os.Setenv("RATE_LIMIT", "23")
-	os.Setenv("CRYPTO_KEY", "/secret/crypto/key")
-
-	defer func() {
-		os.Unsetenv("ADDRESS")
-		os.Unsetenv("REPORT_INTERVAL")
-		os.Unsetenv("POLL_INTERVAL")
-		os.Unsetenv("AGENT_LOG_LEVEL")
-		os.Unsetenv("RATE_LIMIT")
-		os.Unsetenv("CRYPTO_KEY")
-	}()
-
-	// Создаём временный конфигурационный файл
-	configFile := "./test_config.json"
+	t.Setenv("ADDRESS", ":8000")
+	t.Setenv("REPORT_INTERVAL", "200")
+	t.Setenv("AGENT_LOG_LEVEL", "debug")
+	t.Setenv("RATE_LIMIT", "23")
+
+	// Создаём временный конфигурационный файл, в котором заданы не все параметры
+	configFile := filepath.Join(t.TempDir(), "config.json")
 	configContent := `{
         "address": "localhost:8082",
         "report_interval": "17s",
         "poll_interval": "9s",
+        "key": "file key",
 		"crypto_key": "/config/file/secret/crypto/key"
     }`
 	err := os.WriteFile(configFile, []byte(configContent), 0644)
 	require.NoError(t, err)
-	defer os.Remove(configFile)
 
 	// Сохраняем оригинальные значения флагов
 	originalArgs := os.Args
-	os.Args = []string{"cmd", "-a", ":9000", "-r", "120", "-p", "240", "-log=info", "-l", "3", "-k", "secret", "-crypto-key",
-		"/crypto/key/path", "-c", "./test_config.json"}
+	os.Args = []string{"cmd", "-a", ":9000", "-l", "3", "-crypto-key", "/crypto/key/path", "-c", configFile}
 	defer func() { os.Args = originalArgs }()
 
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	parseFlags()
 
-	assert.Equal(t, "localhost:8082", flagNetAddr)
-	assert.Equal(t, 17, *reportInterval)
-	assert.Equal(t, 9, *pollInterval)
-	assert.Equal(t, "debug", flagLogLevel)
-	assert.Equal(t, 23, *rateLimit)
-	assert.Equal(t, "secret", flagKey)
-	assert.Equal(t, "/config/file/secret/crypto/key", cryptoKey)
+	assert.Equal(t, ":9000", flagNetAddr)                // флаг имеет приоритет над переменной окружения и файлом
+	assert.Equal(t, 200, *reportInterval)                // переменная окружения имеет приоритет над файлом
+	assert.Equal(t, 9, *pollInterval)                    // файл имеет приоритет над значением по умолчанию
+	assert.Equal(t, "debug", flagLogLevel)               // переменная окружения имеет приоритет над значением по умолчанию
+	assert.Equal(t, 3, *rateLimit)                       // флаг имеет приоритет над переменной окружения
+	assert.Equal(t, "file key", flagKey)                 // файл имеет приоритет над значением по умолчанию
+	assert.Equal(t, "/crypto/key/path", cryptoKey)       // флаг имеет приоритет над файлом
+	assert.Equal(t, time.Minute, flagConfigPollInterval) // незаданный параметр остаётся по умолчанию
 }
 
 func TestParseEnvironment(t *testing.T) {
 	// Устанавливаем переменные окружения
-	os.Setenv("ADDRESS", ":8000")
-	os.Setenv("REPORT_INTERVAL", "200")
-	os.Setenv("POLL_INTERVAL", "314")
-	os.Setenv("AGENT_LOG_LEVEL", "debug")
-	os.Setenv("RATE_LIMIT", "23")
-	os.Setenv("KEY", "secret")
-	os.Setenv("CRYPTO_KEY", "/secret/crypto/key")
-
-	defer func() {
-		os.Unsetenv("ADDRESS")
-		os.Unsetenv("REPORT_INTERVAL")
-		os.Unsetenv("POLL_INTERVAL")
-		os.Unsetenv("AGENT_LOG_LEVEL")
-		os.Unsetenv("RATE_LIMIT")
-		os.Unsetenv("KEY")
-		os.Unsetenv("CRYPTO_KEY")
-	}()
-
-	parseEnvironment()
+	t.Setenv("ADDRESS", ":8000")
+	t.Setenv("REPORT_INTERVAL", "200")
+	t.Setenv("POLL_INTERVAL", "314")
+	t.Setenv("AGENT_LOG_LEVEL", "debug")
+	t.Setenv("RATE_LIMIT", "23")
+	t.Setenv("KEY", "secret")
+	t.Setenv("CRYPTO_KEY", "/secret/crypto/key")
+
+	originalArgs := os.Args
+	os.Args = []string{"cmd"}
+	defer func() { os.Args = originalArgs }()
+
+	parseFlags()
 
 	assert.Equal(t, ":8000", flagNetAddr)
 	assert.Equal(t, 200, *reportInterval)
@@ -108,33 +93,113 @@ func TestParseEnvironment(t *testing.T) {
 }
 
 func TestParseConfigFile(t *testing.T) {
-	reportInterval = new(int)
-	pollInterval = new(int)
-
 	testFlagNetAddr := "localhost:8081"
 	testReportInterval := 21
 	testPollInterval := 3
 	testFlagCryptoKey := "test crypto key"
 
-	createFile := func(name string) {
-		data := fmt.Sprintf("{\"address\": \"%s\",\"report_interval\": \"%ds\",\"poll_interval\": \"%ds\",\"crypto_key\": \"%s\"}",
-			testFlagNetAddr, testReportInterval, testPollInterval, testFlagCryptoKey)
-		f, err := os.Create(name)
-		require.NoError(t, err)
-		_, err = f.Write([]byte(data))
-		require.NoError(t, err)
-	}
-	nameFile := "./test_config.json"
-	createFile(nameFile)
+	nameFile := filepath.Join(t.TempDir(), "config.json")
+	data := fmt.Sprintf(`{"address": "%s","report_interval": "%ds","poll_interval": "%ds","crypto_key": "%s","log_level": "warn","key": "file key","rate_limit": 5}`,
+		testFlagNetAddr, testReportInterval, testPollInterval, testFlagCryptoKey)
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0o600))
+	t.Setenv("CONFIG", nameFile)
+
+	originalArgs := os.Args
+	os.Args = []string{"cmd"}
+	defer func() { os.Args = originalArgs }()
 
-	flagConfigFile = nameFile
-	parseConfigFile()
+	cfg := parseFlags()
 
+	assert.Equal(t, nameFile, flagConfigFile)
 	assert.Equal(t, testFlagNetAddr, flagNetAddr)
 	assert.Equal(t, testReportInterval, *reportInterval)
 	assert.Equal(t, testPollInterval, *pollInterval)
 	assert.Equal(t, testFlagCryptoKey, cryptoKey)
+	assert.Equal(t, "warn", flagLogLevel)
+	assert.Equal(t, "file key", flagKey)
+	assert.Equal(t, 5, cfg.RateLimit)
+	// параметры, которых нет в файле, не сбрасываются в нулевые значения
+	assert.Equal(t, worker.DefaultRetryPolicy.MaxAttempts, flagRetryAttempts)
+	assert.Equal(t, time.Minute, flagConfigPollInterval)
+}
+
+func TestAgentConfigProblems(t *testing.T) {
+	require.NoError(t, loader.Load([]string{"-r", "-5", "-l", "-1", "-retry-jitter", "2", "-log", "loud"}))
+	_, err := agentConfig()
+	require.Error(t, err)
+	// сообщаются все некорректные параметры сразу
+	for _, want := range []string{"report_interval", "rate_limit", "retry", "log_level"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	require.NoError(t, loader.Load(nil))
+	_, err = agentConfig()
+	require.NoError(t, err)
+}
+
+func TestPrintConfig(t *testing.T) {
+	require.NoError(t, loader.Load([]string{"-print-config", "-k", "hash-secret", "-r", "30"}))
+	assert.True(t, loader.PrintRequested())
+
+	var buf bytes.Buffer
+	require.NoError(t, loader.Print(&buf))
+	assert.NotContains(t, buf.String(), "hash-secret")
+	assert.Contains(t, buf.String(), `"key": "REDACTED"`)
+	assert.Contains(t, buf.String(), `"report_interval": "30s"`)
+	require.NoError(t, loader.Load(nil))
+}
 
-	err := os.Remove(nameFile)
+func TestParseRetryFlags(t *testing.T) {
+	originalArgs := os.Args
+	os.Args = []string{"cmd", "-retry-attempts", "6", "-retry-base", "200ms", "-retry-max", "3s", "-retry-jitter", "0.5",
+		"-retry-status-rules", "500=false", "-retry-budget", "4", "-agent-id", "host-1"}
+	defer func() { os.Args = originalArgs }()
+	t.Setenv("RETRY_MAX", "7s")
+
+	cfg := parseFlags()
+
+	policy := cfg.Retry
+	assert.Equal(t, 6, policy.MaxAttempts)
+	assert.Equal(t, 200*time.Millisecond, policy.Base)
+	assert.Equal(t, 3*time.Second, policy.Max) // флаг имеет приоритет над переменной окружения
+	assert.Equal(t, 0.5, policy.Jitter)
+	assert.Equal(t, map[int]bool{500: false}, policy.StatusRules)
+	assert.Equal(t, 4, flagRetryBudget)
+	assert.Equal(t, "host-1", cfg.AgentID)
+
+	// незаданные в файле параметры повторной отправки не переопределяются
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{"address": "localhost:8082", "retry_attempts": 2, "retry_jitter": 0}`), 0644)
 	require.NoError(t, err)
+	os.Args = []string{"cmd", "-retry-base", "200ms", "-retry-budget", "4", "-c", configFile}
+	parseFlags()
+
+	assert.Equal(t, 2, flagRetryAttempts)
+	assert.Equal(t, 0.0, flagRetryJitter)
+	assert.Equal(t, 200*time.Millisecond, flagRetryBase)
+	assert.Equal(t, 4, flagRetryBudget)
+}
+
+func TestParseRemoteConfigFlags(t *testing.T) {
+	originalArgs := os.Args
+	os.Args = []string{"cmd", "-agent-group", "edge", "-config-poll-interval", "30s", "-l", "4"}
+	defer func() { os.Args = originalArgs }()
+	t.Setenv("CONFIG_POLL_INTERVAL", "2m")
+
+	cfg := parseFlags()
+
+	assert.Equal(t, "edge", cfg.AgentGroup)
+	assert.Equal(t, 30*time.Second, flagConfigPollInterval) // флаг имеет приоритет над переменной окружения
+	assert.Equal(t, 4, cfg.RateLimit)
+
+	// нулевой интервал из файла отключает запрос настроек с сервера
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configFile, []byte(`{"address": "localhost:8082", "agent_group": "core", "config_poll_interval": "0s"}`), 0644)
+	require.NoError(t, err)
+	t.Setenv("CONFIG_POLL_INTERVAL", "")
+	os.Args = []string{"cmd", "-c", configFile}
+	parseFlags()
+
+	assert.Equal(t, "core", flagAgentGroup)
+	assert.Equal(t, time.Duration(0), flagConfigPollInterval)
 }
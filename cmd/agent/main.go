@@ -2,96 +2,38 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
-	"time"
 
-	"go.uber.org/zap"
-
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/collecter"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/pusher"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
 )
 
-const shutdownWaitPeriod = 20 * time.Second // таймаут для graceful shutdown
-
 func main() {
+	cfg := parseFlags()
+
 	// вывод глобальной информации о сборке
 	printGlobalInfo(os.Stdout)
 
-	parseFlags()
-
-	metrics := storage.NewMetricsStats()
-	err := run(metrics)
+	agent, err := app.New(cfg)
 	if err != nil {
-		log.Printf("Error initialize agent logger: %v\n", err)
+		log.Fatalf("Error initialize agent: %v\n", err)
+	}
+	if err := run(agent); err != nil {
+		log.Fatalf("Error running agent: %v\n", err)
 	}
 	log.Println("Shutdown the agent gracefully")
 }
 
-// run - будет полезна при инициализации зависимостей агента перед запуском
-func run(metrics *storage.MetricsStats) error {
-	if err := logger.Initialize(flagLogLevel); err != nil {
-		return err
-	}
-	// Добавляю многопоточность
-	var wg sync.WaitGroup
-
-	// Create a context with timeout for graceful shutdown
-	ctx, cancelCtx := context.WithTimeout(context.Background(), shutdownWaitPeriod)
+// run - запускает агента и перезагрузку его конфигурации, пока не поступит сигнал о прерывании.
+func run(agent *app.Agent) error {
+	// Контекст отменяется при получении сигнала прерывания
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
 
-	logger.AgentLog.Info("Running agent", zap.String("address", flagNetAddr), zap.String("rateLimit", fmt.Sprintf("%d", *rateLimit)))
-	wg.Add(1)
-	go collecter.CollectWithTimer(ctx, metrics, &wg)
-	time.Sleep(50 * time.Millisecond)
+	// перечитываю файл конфигурации по сигналу SIGHUP
+	go reloadOnSignal(ctx, agent)
 
-	// Размер буферизованного канала равен количеству количеству одновременно исходящих запросов
-	var pushTasks = make(chan worker.Task, *rateLimit)
-	wg.Add(1)
-	go GeneratePushTasks(ctx, pushTasks, "http://"+flagNetAddr, "updates/", metrics, &wg)
-
-	log.Printf("rateLimit is: %d\n", *rateLimit)
-	// создаю и запускаю воркеры, это и есть пул
-	for w := 0; w < *rateLimit; w++ {
-		wg.Add(1)
-		go worker.DoWork(pushTasks, &wg)
-		logger.AgentLog.Debug("start pushing worker", zap.String("worker", fmt.Sprintf("%d", w)))
-	}
-
-	// Канал для получения сигнала прерывания
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-
-	// Блокирование до тех пор, пока не поступит сигнал о прерывании
-	<-quit
-	log.Println("Shutting down agent...")
-
-	// Закрываю контекст, для остановки функции записи данных в канал для отправки на сервер
-	cancelCtx()
-
-	wg.Wait()
-	return nil
-}
-
-// GeneratePushTasks - генерирует задачи для их выполнения пулом работников.
-func GeneratePushTasks(ctx context.Context, tasks chan<- worker.Task, address, action string, metrics *storage.MetricsStats, wg *sync.WaitGroup) {
-	defer wg.Done()
-	defer close(tasks)
-
-	sleepInterval := config.GetReportInterval() * time.Second
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case tasks <- *worker.NewTask(address, action, metrics, pusher.PrepareAndPushBatch):
-			time.Sleep(sleepInterval)
-		}
-	}
+	return agent.Run(ctx)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
+)
+
+// reloadConfig - повторно загружает параметры запуска с перечитанным файлом конфигурации и применяет параметры, которые
+// можно изменить без перезапуска агента. Параметры, которые требуют перезапуска, остаются прежними. Если новая
+// конфигурация некорректна, не применяется ни один параметр. Настройки сервера по-прежнему переопределяют локальные
+// настройки агента. Возвращает имена применённых параметров и параметров, изменение которых требует перезапуска.
+func reloadConfig(agent *app.Agent) (applied, restart []string, err error) {
+	if flagConfigFile == "" {
+		return nil, nil, errors.New("configuration file is not set")
+	}
+
+	previous := loader.Values()
+	previousConfigFile := flagConfigFile
+	rollback := func() {
+		for key, v := range previous {
+			loader.Restore(key, v)
+		}
+		flagConfigFile = previousConfigFile
+	}
+
+	if err := loader.Load(agentArgs); err != nil {
+		rollback()
+		return nil, nil, err
+	}
+	current := loader.Values()
+	for _, p := range loader.Params() {
+		key := p.Key()
+		if previous[key] == current[key] {
+			continue
+		}
+		if app.RequiresRestart(key) {
+			restart = append(restart, key)
+			loader.Restore(key, previous[key])
+			continue
+		}
+		applied = append(applied, key)
+	}
+
+	cfg, err := agentConfig()
+	if err == nil {
+		err = agent.Reconfigure(cfg)
+	}
+	if err != nil {
+		rollback()
+		return nil, nil, err
+	}
+	return applied, restart, nil
+}
+
+// reloadOnSignal - перезагружает конфигурацию агента agent при получении сигнала SIGHUP, пока не отменён контекст.
+func reloadOnSignal(ctx context.Context, agent *app.Agent) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			applied, restart, err := reloadConfig(agent)
+			if err != nil {
+				agent.Logger().Error("reload configuration error", zap.String("error", error.Error(err)))
+				continue
+			}
+			agent.Logger().Info("configuration reloaded", zap.Strings("applied", applied))
+			if len(restart) > 0 {
+				agent.Logger().Warn("changed settings require restart of the agent", zap.Strings("settings", restart))
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
+)
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(data string) {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	}
+	defer func() {
+		agentArgs = nil
+		require.NoError(t, loader.Load(nil))
+	}()
+
+	// исходная конфигурация агента, параметры из файла переопределяются переменными окружения и флагами
+	write(`{"address": "localhost:8080", "report_interval": "10s", "poll_interval": "2s"}`)
+	t.Setenv("POLL_INTERVAL", "1")
+	agentArgs = []string{"-c", path, "-retry-max", "5s"}
+	require.NoError(t, loader.Load(agentArgs))
+	cfg, err := agentConfig()
+	require.NoError(t, err)
+	agent, err := app.New(cfg)
+	require.NoError(t, err)
+	_, _, err = reloadConfig(agent)
+	require.NoError(t, err)
+
+	// параметры, которые требуют перезапуска, не меняются
+	write(`{"address": "localhost:9090", "report_interval": "20s", "poll_interval": "3s", "key": "secret", "rate_limit": 3,
+		"retry_attempts": 2, "retry_max": "1m", "config_poll_interval": "10s"}`)
+	applied, restart, err := reloadConfig(agent)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"report_interval", "key", "rate_limit", "retry_attempts"}, applied)
+	assert.ElementsMatch(t, []string{"address", "config_poll_interval"}, restart)
+	assert.Equal(t, "localhost:8080", flagNetAddr)
+	assert.Equal(t, time.Minute, flagConfigPollInterval)
+	current := agent.Config()
+	assert.Equal(t, "localhost:8080", current.Address)
+	assert.Equal(t, time.Minute, current.ConfigPollInterval)
+	assert.Equal(t, 20*time.Second, current.ReportInterval)
+	assert.Equal(t, "secret", current.Key)
+	assert.Equal(t, 3, current.RateLimit)
+	assert.Equal(t, 2, current.Retry.MaxAttempts)
+	// переменные окружения и флаги сохраняют приоритет над файлом
+	assert.Equal(t, time.Second, current.PollInterval)
+	assert.Equal(t, 5*time.Second, current.Retry.Max)
+
+	// некорректная конфигурация не применяется
+	write(`{"address": "localhost:8080", "report_interval": "40s", "poll_interval": "2s", "retry_status_rules": "abc"}`)
+	_, _, err = reloadConfig(agent)
+	require.Error(t, err)
+	assert.Equal(t, 20*time.Second, agent.Config().ReportInterval)
+	assert.Equal(t, 20, *reportInterval)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+	"github.com/AntonBezemskiy/go-musthave-metrics/pkg/client"
+)
+
+// defaultImportBatch - количество метрик, которое команда import отправляет на сервер одним запросом.
+const defaultImportBatch = 100
+
+// env - окружение, в котором выполняется команда.
+type env struct {
+	cfg    config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command - команда metricsctl.
+type command struct {
+	name string
+	args string // аргументы команды для справки
+	help string
+	run  func(ctx context.Context, e *env, args []string) error
+}
+
+// commands - команды metricsctl в порядке вывода в справке.
+var commands = []command{
+	{"get", "<type> <name>", "print metric in JSON format", runGet},
+	{"set", "<type> <name> <value>", "update gauge or counter metric", runSet},
+	{"list", "[selector flags]", "print metrics matching selector", runList},
+	{"delete", "[selector flags] [name]", "delete metric by name or metrics matching selector", runDelete},
+	{"export", "[-o file] [selector flags]", "save metrics matching selector to snapshot in JSON format", runExport},
+	{"import", "[-i file] [-batch size]", "send metrics from snapshot to server, counters are added to current values", runImport},
+	{"ping", "", "check server and its storage", runPing},
+	{"keygen", "[-dir path]", "generate RSA key pair private_key.pem and public_key.pem", runKeygen},
+	{"sign", "[-file path] [payload]", "print HashSHA256 of payload signed by configured key", runSign},
+}
+
+// newFlagSet - создаёт набор флагов команды name.
+func (e *env) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("metricsctl "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// parseArgs - разбирает флаги команды и проверяет количество оставшихся аргументов.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := fs.Args()
+	if len(rest) < minArgs || len(rest) > maxArgs {
+		return nil, fmt.Errorf("%s: wrong number of arguments %d", fs.Name(), len(rest))
+	}
+	return rest, nil
+}
+
+// labelsFlag - флаг меток в формате имя:значение, который можно указать несколько раз.
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+":"+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	if !ok || key == "" {
+		return fmt.Errorf("label must be in format name:value, got %s", s)
+	}
+	l[key] = value
+	return nil
+}
+
+// selectorFlags - регистрирует флаги условий отбора метрик.
+func selectorFlags(fs *flag.FlagSet) *client.Selector {
+	s := &client.Selector{Labels: make(map[string]string)}
+	fs.StringVar(&s.Name, "name", "", "exact metric name")
+	fs.StringVar(&s.Type, "type", "", "metric type")
+	fs.StringVar(&s.Prefix, "prefix", "", "prefix of metric name")
+	fs.StringVar(&s.Match, "match", "", "pattern of metric name")
+	fs.Var(labelsFlag(s.Labels), "label", "metric label in format name:value, can be repeated")
+	return s
+}
+
+// isEmpty - проверяет, что не задано ни одного условия отбора.
+func isEmpty(s client.Selector) bool {
+	return s.Name == "" && s.Type == "" && s.Prefix == "" && s.Match == "" && len(s.Labels) == 0
+}
+
+// formatValue - возвращает значение метрики в текстовом виде.
+func formatValue(m client.Metric) string {
+	switch {
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.Histogram != nil:
+		return fmt.Sprintf("count=%d sum=%g", m.Histogram.Count, m.Histogram.Sum)
+	}
+	return ""
+}
+
+// writeJSON - выводит v в формате JSON с отступами.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runGet - выводит метрику в формате JSON.
+func runGet(ctx context.Context, e *env, args []string) error {
+	rest, err := parseArgs(e.newFlagSet("get"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	m, err := c.GetMetric(ctx, rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	return writeJSON(e.stdout, m)
+}
+
+// runSet - обновляет метрику и выводит её значение после обновления. Запрос подписывается и шифруется так же,
+// как запросы агента.
+func runSet(ctx context.Context, e *env, args []string) error {
+	rest, err := parseArgs(e.newFlagSet("set"), args, 3, 3)
+	if err != nil {
+		return err
+	}
+	m, err := builder.Build(rest[0], rest[1], rest[2])
+	if err != nil {
+		return err
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := c.UpdateMetric(ctx, m); err != nil {
+		return err
+	}
+	// сервер возвращает принятое приращение, поэтому значение счётчика запрашивается отдельно
+	m, err = c.GetMetric(ctx, m.MType, m.ID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, formatValue(m))
+	return err
+}
+
+// runList - выводит таблицу метрик, отобранных по условиям.
+func runList(ctx context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("list")
+	selector := selectorFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	metrics, err := c.AllMetrics(ctx, *selector)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tVALUE")
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.MType, m.ID, formatValue(m))
+	}
+	return tw.Flush()
+}
+
+// runDelete - удаляет метрику по имени или метрики, отобранные по условиям, и выводит количество удалённых метрик.
+func runDelete(ctx context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("delete")
+	selector := selectorFlags(fs)
+	rest, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 && isEmpty(*selector) {
+		return errors.New("delete: metric name or selector flags are required")
+	}
+	if len(rest) == 1 && !isEmpty(*selector) {
+		return errors.New("delete: metric name and selector flags can not be used together")
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	var deleted int
+	if len(rest) == 1 {
+		deleted, err = c.DeleteMetric(ctx, rest[0])
+	} else {
+		deleted, err = c.DeleteMetrics(ctx, *selector)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stdout, "deleted %d metrics\n", deleted)
+	return err
+}
+
+// runExport - сохраняет метрики, отобранные по условиям, в снимок в формате JSON.
+func runExport(ctx context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("export")
+	output := fs.String("o", "", "snapshot file, standard output by default")
+	selector := selectorFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	metrics, err := c.AllMetrics(ctx, *selector)
+	if err != nil {
+		return err
+	}
+	// время обновления назначает сервер при импорте
+	for i := range metrics {
+		metrics[i].UpdatedAt = nil
+	}
+	if metrics == nil {
+		metrics = []client.Metric{}
+	}
+
+	if *output == "" {
+		return writeJSON(e.stdout, metrics)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(file, metrics); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stdout, "exported %d metrics to %s\n", len(metrics), *output)
+	return err
+}
+
+// runImport - отправляет на сервер метрики из снимка, сохранённого командой export. Значения метрик типа "counter"
+// прибавляются к текущим значениям на сервере.
+func runImport(ctx context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("import")
+	input := fs.String("i", "", "snapshot file, standard input by default")
+	batch := fs.Int("batch", defaultImportBatch, "count of metrics sent to server in one request")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("import: batch must be positive, got %d", *batch)
+	}
+
+	r := e.stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	var metrics []client.Metric
+	if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+		return fmt.Errorf("import: decode snapshot error: %w", err)
+	}
+
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(metrics); start += *batch {
+		end := min(start+*batch, len(metrics))
+		if err := c.UpdateBatch(ctx, metrics[start:end]); err != nil {
+			return fmt.Errorf("import: %d of %d metrics are imported: %w", start, len(metrics), err)
+		}
+	}
+	_, err = fmt.Fprintf(e.stdout, "imported %d metrics\n", len(metrics))
+	return err
+}
+
+// runPing - проверяет доступность сервера и его хранилища.
+func runPing(ctx context.Context, e *env, args []string) error {
+	if _, err := parseArgs(e.newFlagSet("ping"), args, 0, 0); err != nil {
+		return err
+	}
+	c, err := newClient(e.cfg)
+	if err != nil {
+		return err
+	}
+	if err := c.Ping(ctx); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, "ok")
+	return err
+}
+
+// runKeygen - генерирует пару RSA-ключей: приватный ключ указывается серверу, публичный - агенту и metricsctl.
+func runKeygen(_ context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("keygen")
+	dir := fs.String("dir", ".", "directory to save keys")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	if err := encryption.GenerateKeys(*dir); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(e.stdout, "private key: %s\npublic key: %s\n",
+		filepath.Join(*dir, "private_key.pem"), filepath.Join(*dir, "public_key.pem"))
+	return err
+}
+
+// runSign - выводит подпись HashSHA256 тела запроса, вычисленную ключом из общих параметров. Тело передаётся
+// аргументом, файлом или через стандартный ввод и подписывается без изменений, как несжатое тело запроса агента.
+func runSign(_ context.Context, e *env, args []string) error {
+	fs := e.newFlagSet("sign")
+	file := fs.String("file", "", "file with payload")
+	rest, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if e.cfg.key == "" {
+		return errors.New("sign: key is not configured")
+	}
+	if *file != "" && len(rest) == 1 {
+		return errors.New("sign: payload and file can not be used together")
+	}
+
+	var payload []byte
+	switch {
+	case len(rest) == 1:
+		payload = []byte(rest[0])
+	case *file != "":
+		payload, err = os.ReadFile(*file)
+	default:
+		payload, err = io.ReadAll(e.stdin)
+	}
+	if err != nil {
+		return err
+	}
+	hash, err := repositories.CalkHash(payload, e.cfg.key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, hash)
+	return err
+}
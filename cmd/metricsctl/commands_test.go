@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	serverapp "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// startServer - запускает сервер метрик с ключом подписи и токеном администратора и возвращает общие параметры
+// команд для подключения к нему.
+func startServer(t *testing.T) []string {
+	cfg := serverapp.DefaultConfig()
+	cfg.Key = "secret"
+	cfg.AdminToken = "admin"
+	srv, err := serverapp.New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return []string{"-a", ts.URL, "-k", "secret", "-admin-token", "admin"}
+}
+
+// runCommand - выполняет команду args с общими параметрами common и возвращает её вывод.
+func runCommand(t *testing.T, common []string, stdin string, args ...string) (string, error) {
+	e, stdout := newEnv(stdin)
+	err := run(context.Background(), slices.Concat(common, args), e)
+	return stdout.String(), err
+}
+
+func TestMetricsCommands(t *testing.T) {
+	common := startServer(t)
+
+	out, err := runCommand(t, common, "", "set", "counter", "hits", "3")
+	require.NoError(t, err)
+	assert.Equal(t, "3\n", out)
+	out, err = runCommand(t, common, "", "set", "counter", "hits", "4")
+	require.NoError(t, err)
+	assert.Equal(t, "7\n", out)
+	_, err = runCommand(t, common, "", "set", "gauge", "load", "0.5")
+	require.NoError(t, err)
+	_, err = runCommand(t, common, "", "set", "gauge", "load", "high")
+	require.Error(t, err)
+
+	out, err = runCommand(t, common, "", "get", "gauge", "load")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"value": 0.5`)
+	_, err = runCommand(t, common, "", "get", "gauge")
+	require.Error(t, err)
+
+	out, err = runCommand(t, common, "", "list", "-type", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TYPE     NAME  VALUE", "counter  hits  7"}, strings.Split(strings.TrimSpace(out), "\n"))
+
+	// снимок метрик восстанавливается после удаления
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	out, err = runCommand(t, common, "", "export", "-o", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, "exported 2 metrics to "+snapshot+"\n", out)
+
+	_, err = runCommand(t, common, "", "delete")
+	require.Error(t, err)
+	out, err = runCommand(t, common, "", "delete", "hits")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted 1 metrics\n", out)
+	out, err = runCommand(t, common, "", "delete", "-type", "gauge")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted 1 metrics\n", out)
+
+	data, err := os.ReadFile(snapshot)
+	require.NoError(t, err)
+	out, err = runCommand(t, common, string(data), "import", "-batch", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "imported 2 metrics\n", out)
+	out, err = runCommand(t, common, "", "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "counter  hits  7")
+	assert.Contains(t, out, "gauge    load  0.5")
+
+	// удаление метрик требует токена администратора
+	_, err = runCommand(t, common[:4], "", "delete", "hits")
+	require.Error(t, err)
+
+	// сервер без базы данных не проходит проверку
+	_, err = runCommand(t, common, "", "ping")
+	require.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	payload := `[{"id":"hits","type":"counter","delta":1}]`
+	want, err := repositories.CalkHash([]byte(payload), "secret")
+	require.NoError(t, err)
+
+	out, err := runCommand(t, []string{"-k", "secret"}, "", "sign", payload)
+	require.NoError(t, err)
+	assert.Equal(t, want+"\n", out)
+
+	out, err = runCommand(t, []string{"-k", "secret"}, payload, "sign")
+	require.NoError(t, err)
+	assert.Equal(t, want+"\n", out)
+
+	file := filepath.Join(t.TempDir(), "payload.json")
+	require.NoError(t, os.WriteFile(file, []byte(payload), 0o600))
+	out, err = runCommand(t, []string{"-k", "secret"}, "", "sign", "-file", file)
+	require.NoError(t, err)
+	assert.Equal(t, want+"\n", out)
+
+	_, err = runCommand(t, nil, "", "sign", payload)
+	require.EqualError(t, err, "sign: key is not configured")
+}
+
+func TestKeygen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	out, err := runCommand(t, nil, "", "keygen", "-dir", dir)
+	require.NoError(t, err)
+	assert.Contains(t, out, filepath.Join(dir, "public_key.pem"))
+
+	// сервер расшифровывает запросы, зашифрованные сгенерированным публичным ключом
+	cfg := serverapp.DefaultConfig()
+	cfg.CryptoKey = filepath.Join(dir, "private_key.pem")
+	srv, err := serverapp.New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	out, err = runCommand(t, []string{"-a", ts.URL, "-crypto-key", filepath.Join(dir, "public_key.pem")}, "",
+		"set", "gauge", "load", "1.5")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5\n", out)
+}
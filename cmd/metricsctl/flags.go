@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/settings"
+	"github.com/AntonBezemskiy/go-musthave-metrics/pkg/client"
+)
+
+// config - общие параметры команд metricsctl.
+type config struct {
+	configFile    string
+	address       string
+	key           string
+	cryptoKey     string
+	adminToken    string
+	agentID       string
+	timeout       time.Duration
+	retryAttempts int
+}
+
+// newLoader - регистрирует общие параметры команд. Значение каждого параметра определяется с приоритетом
+// значение по умолчанию < файл конфигурации < переменная окружения < флаг командной строки. Флаги общих параметров
+// указываются перед именем команды.
+func newLoader(cfg *config) *settings.Loader {
+	l := settings.NewLoader("metricsctl")
+	l.ConfigFile(&cfg.configFile, "CONFIG", "c")
+	l.String(&cfg.address, "localhost:8080", "address", "ADDRESS", "a", "address and port of metrics server")
+	l.String(&cfg.key, "", "key", "KEY", "k", "key for hashing data").Secret()
+	l.String(&cfg.cryptoKey, "", "crypto_key", "CRYPTO_KEY", "crypto-key", "public key of server for asymmetric encryption")
+	l.String(&cfg.adminToken, "", "admin_token", "ADMIN_TOKEN", "admin-token", "token for access to administrative endpoints").Secret()
+	l.String(&cfg.agentID, "", "agent_id", "AGENT_ID", "agent-id", "identifier sent to server in each request")
+	l.Duration(&cfg.timeout, client.DefaultTimeout, "timeout", "METRICSCTL_TIMEOUT", "timeout", "timeout of one request to server")
+	l.Int(&cfg.retryAttempts, 1, "retry_attempts", "RETRY_ATTEMPTS", "retry-attempts", "max attempts of request, including the first one")
+	return l
+}
+
+// newClient - создаёт клиента сервера метрик с параметрами cfg.
+func newClient(cfg config) (*client.Client, error) {
+	retry := client.DefaultRetryPolicy
+	retry.MaxAttempts = cfg.retryAttempts
+	return client.New(cfg.address,
+		client.WithKey(cfg.key),
+		client.WithCryptoKey(cfg.cryptoKey),
+		client.WithAdminToken(cfg.adminToken),
+		client.WithAgentID(cfg.agentID),
+		client.WithTimeout(cfg.timeout),
+		client.WithRetryPolicy(retry),
+	)
+}
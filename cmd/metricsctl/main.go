@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+)
+
+func main() {
+	// Контекст отменяется при получении сигнала прерывания
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr})
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatalf("metricsctl: %v\n", err)
+	}
+}
+
+// run - загружает общие параметры из args и выполняет указанную после них команду.
+func run(ctx context.Context, args []string, e *env) error {
+	loader := newLoader(&e.cfg)
+	if err := loader.Load(args); err != nil {
+		return err
+	}
+	// вывод действующей конфигурации без выполнения команды
+	if loader.PrintRequested() {
+		return loader.Print(e.stdout)
+	}
+
+	args = loader.Args()
+	if len(args) == 0 {
+		printUsage(e.stderr)
+		return errors.New("command is not specified")
+	}
+	if args[0] == "help" {
+		printUsage(e.stdout)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, e, args[1:])
+		}
+	}
+	printUsage(e.stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// printUsage - выводит справку по командам.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: metricsctl [flags] <command> [command flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w, "\nRun \"metricsctl -h\" for common flags and \"metricsctl <command> -h\" for command flags.")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEnv - создаёт окружение команды со стандартным вводом stdin.
+func newEnv(stdin string) (*env, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	return &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &bytes.Buffer{}}, &stdout
+}
+
+func TestRun(t *testing.T) {
+	e, stdout := newEnv("")
+	require.NoError(t, run(context.Background(), []string{"help"}, e))
+	assert.Contains(t, stdout.String(), "keygen")
+
+	e, _ = newEnv("")
+	require.EqualError(t, run(context.Background(), nil, e), "command is not specified")
+
+	e, _ = newEnv("")
+	require.EqualError(t, run(context.Background(), []string{"unknown"}, e), `unknown command "unknown"`)
+
+	// вывод конфигурации скрывает секреты
+	e, stdout = newEnv("")
+	require.NoError(t, run(context.Background(), []string{"-a", "localhost:9090", "-k", "secret", "-print-config"}, e))
+	assert.Contains(t, stdout.String(), "localhost:9090")
+	assert.NotContains(t, stdout.String(), "secret")
+
+	// флаги общих параметров указываются перед командой
+	e, stdout = newEnv("")
+	require.NoError(t, run(context.Background(), []string{"-k", "secret", "sign", "payload"}, e))
+	assert.NotEmpty(t, strings.TrimSpace(stdout.String()))
+
+	e, _ = newEnv("")
+	require.ErrorIs(t, run(context.Background(), []string{"get", "-h"}, e), flag.ErrHelp)
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/config"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/encrypt"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/agentconfig"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/settings"
 )
 
 var (
@@ -21,114 +21,117 @@ var (
 	flagFileStoragePath string
 	flagRestore         bool
 	flagDatabaseDsn     string
+	flagReplicaDsn      string
+	flagPoolConfig      pg.PoolConfig
+	flagBoltPath        string
 	flagKey             string
 	flagCryptoKey       string
 	flagConfigFile      string
-)
-
-// Определяют способ хранения метрик.
-const (
-	// SAVEINRAM устанавливает созранение метрик в оперативную память
-	SAVEINRAM = iota
-	// SAVEINRAM устанавливает созранение метрик в файл
-	SAVEINFILE
-	// SAVEINRAM устанавливает созранение метрик в базу данных
-	SAVEINDATABASE
-)
-
-func parseFlags() int {
-	flag.StringVar(&flagNetAddr, "a", ":8080", "address and port to run server")
-	flag.StringVar(&flagLogLevel, "l", "info", "log level")
-	// настройка флагов для хранения метрик в файле
-	flagStoreIntervalTemp := flag.Int("i", 300, "interval of saving metrics to the file")
-	flag.StringVar(&flagFileStoragePath, "f", "", "path address to saving metrics file") // Путь к файлу по умолчанию: ./metrics.json
-	flagRestoreTemp := flag.Bool("r", true, "for define needed of loading metrics from file while server starting")
-	// настройка флагов для хранения метрик в базе данных
-	flag.StringVar(&flagDatabaseDsn, "d", "", "database connection address") // host=localhost user=metrics password=metrics dbname=metricsdb  sslmode=disable
-	flag.StringVar(&flagKey, "k", "", "key for hashing data")
-	flag.StringVar(&flagCryptoKey, "crypto-key", "", "private key for asymmetric encryption")
-	flag.StringVar(&flagConfigFile, "c", "", "name of configuration file")
+	flagAdminToken      string
+	flagMetricsTTL      int
+	flagRetention       rollup.Policy
+	flagRequestTimeout  time.Duration
 
-	flag.Parse()
-	flagStoreInterval = *flagStoreIntervalTemp
-	flagRestore = *flagRestoreTemp
+	flagRateLimit           float64
+	flagRateBurst           int
+	flagMaxConcurrentWrites int
 
-	// параметры конфигурации переопределяются глобальными переменными, даже если они были переданы через аргументы командной строки
-	parseEnvironment()
+	flagAgentConfig string
+)
 
-	// параметры конфигурации переопределяются параметрами из файла конфигурции, даже если они были переданы через аргументы командной строки
-	// или глобальные переменные
-	parseConfigFile()
+// loader - загрузчик параметров запуска сервера.
+var loader = newLoader()
 
-	saver.SetStoreInterval(time.Duration(flagStoreInterval))
-	saver.SetFilestoragePath(flagFileStoragePath)
-	saver.SetRestore(flagRestore)
-	hasher.SetKey(flagKey)
-	encrypt.SetCryptoGrapher(encryption.Initialize("", flagCryptoKey))
+// serverArgs - аргументы командной строки сервера, которые повторно применяются при перезагрузке конфигурации.
+var serverArgs []string
 
-	if flagDatabaseDsn != "" {
-		return SAVEINDATABASE
-	} else if flagFileStoragePath != "" {
-		return SAVEINFILE
-	}
-	return SAVEINRAM
+// newLoader - регистрирует параметры запуска сервера. Значение каждого параметра определяется с приоритетом
+// значение по умолчанию < файл конфигурации < переменная окружения < флаг командной строки.
+func newLoader() *settings.Loader {
+	l := settings.NewLoader("server")
+	l.ConfigFile(&flagConfigFile, "CONFIG", "c")
+	l.String(&flagNetAddr, ":8080", "address", "ADDRESS", "a", "address and port to run server")
+	l.String(&flagLogLevel, "info", "log_level", "SERVER_LOG_LEVEL", "l", "log level")
+	// настройка флагов для хранения метрик в файле
+	l.Seconds(&flagStoreInterval, 300, "store_interval", "STORE_INTERVAL", "i", "interval of saving metrics to the file")
+	l.String(&flagFileStoragePath, "", "store_file", "FILE_STORAGE_PATH", "f", "path address to saving metrics file") // Путь к файлу по умолчанию: ./metrics.json
+	l.Bool(&flagRestore, true, "restore", "RESTORE", "r", "for define needed of loading metrics from file while server starting")
+	// настройка флагов для хранения метрик в базе данных
+	l.String(&flagDatabaseDsn, "", "database_dsn", "DATABASE_DSN", "d", "database connection address").Secret() // host=localhost user=metrics password=metrics dbname=metricsdb  sslmode=disable
+	l.String(&flagReplicaDsn, "", "database_replica_dsn", "DATABASE_REPLICA_DSN", "database-replica-dsn", "read-only replica connection address, used for reading metrics while available").Secret()
+	l.Int(&flagPoolConfig.MaxOpenConns, pg.DefaultPoolConfig.MaxOpenConns, "db_max_open_conns", "DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum number of open connections to the database, 0 is unlimited")
+	l.Int(&flagPoolConfig.MaxIdleConns, pg.DefaultPoolConfig.MaxIdleConns, "db_max_idle_conns", "DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum number of idle connections to the database")
+	l.Duration(&flagPoolConfig.ConnMaxLifetime, pg.DefaultPoolConfig.ConnMaxLifetime, "db_conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of connection to the database, 0 is unlimited")
+	l.Duration(&flagPoolConfig.ConnMaxIdleTime, pg.DefaultPoolConfig.ConnMaxIdleTime, "db_conn_max_idle_time", "DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum idle time of connection to the database, 0 is unlimited")
+	// настройка флага для хранения метрик во встроенной базе данных
+	l.String(&flagBoltPath, "", "bolt_path", "BOLT_PATH", "bolt-path", "path to file of embedded database for saving metrics")
+	l.String(&flagKey, "", "key", "KEY", "k", "key for hashing data").Secret()
+	l.String(&flagCryptoKey, "", "crypto_key", "CRYPTO_KEY", "crypto-key", "private key for asymmetric encryption")
+	l.String(&flagAdminToken, "", "admin_token", "ADMIN_TOKEN", "admin-token", "token for access to administrative endpoints").Secret()
+	l.Seconds(&flagMetricsTTL, 0, "metrics_ttl", "METRICS_TTL", "metrics-ttl", "interval in seconds after which not updated metrics are deleted, 0 disables deleting")
+	l.Duration(&flagRetention.Raw, rollup.DefaultPolicy.Raw, "raw_retention", "RAW_RETENTION", "raw-retention", "retention of raw metric history, 0 keeps forever")
+	l.Duration(&flagRetention.Minute, rollup.DefaultPolicy.Minute, "rollup_1m_retention", "ROLLUP_1M_RETENTION", "rollup-1m-retention", "retention of 1 minute rollups of metric history, 0 keeps forever")
+	l.Duration(&flagRetention.Hour, rollup.DefaultPolicy.Hour, "rollup_1h_retention", "ROLLUP_1H_RETENTION", "rollup-1h-retention", "retention of 1 hour rollups of metric history, 0 keeps forever")
+	l.Duration(&flagRequestTimeout, 10*time.Second, "request_timeout", "REQUEST_TIMEOUT", "request-timeout", "maximum time of request processing, 0 disables limit")
+	l.Float64(&flagRateLimit, 0, "rate_limit", "RATE_LIMIT", "rate-limit", "maximum requests per second from one agent, 0 disables limit")
+	l.Int(&flagRateBurst, 20, "rate_burst", "RATE_BURST", "rate-burst", "maximum burst of requests from one agent above rate limit")
+	l.Int(&flagMaxConcurrentWrites, 0, "max_concurrent_writes", "MAX_CONCURRENT_WRITES", "max-concurrent-writes", "maximum number of concurrently processed write requests, 0 disables limit")
+	l.String(&flagAgentConfig, "", "agent_config", "AGENT_CONFIG", "agent-config", "path to file of settings which the server pushes to agents")
+	return l
 }
 
-// parseEnvironment - функция для переопределения параметров конфигурации из глобальных переменных.
-func parseEnvironment() {
-	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
-		flagNetAddr = envRunAddr
+// parseFlags - загружает параметры запуска сервера. При некорректных параметрах завершает работу с ошибкой.
+func parseFlags() app.Config {
+	serverArgs = os.Args[1:]
+	err := loader.Load(serverArgs)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	if envLogLevel := os.Getenv("SERVER_LOG_LEVEL"); envLogLevel != "" {
-		flagLogLevel = envLogLevel
+	// ошибки загрузки и проверки параметров выводятся вместе
+	cfg, cfgErr := serverConfig()
+	if err := errors.Join(err, cfgErr); err != nil {
+		log.Fatalf("Invalid configuration:\n%v\n", err)
 	}
-	if envStoreInterval := os.Getenv("STORE_INTERVAL"); envStoreInterval != "" {
-		interval, err := strconv.Atoi(envStoreInterval)
-		if err != nil {
-			log.Fatalf("Parse STORE_INTERVAL global variable error: %v\n", err)
+	// вывод действующей конфигурации без запуска сервера
+	if loader.PrintRequested() {
+		if err := loader.Print(os.Stdout); err != nil {
+			log.Fatalf("Print configuration error: %v\n", err)
 		}
-		flagStoreInterval = interval
-	}
-	if envFileStoragePath := os.Getenv("FILE_STORAGE_PATH"); envFileStoragePath != "" {
-		flagFileStoragePath = envFileStoragePath
-	}
-	if envRestore := os.Getenv("RESTORE"); envRestore != "" {
-		r, err := strconv.ParseBool(envRestore)
-		if err != nil {
-			log.Fatalf("Parse RESTORE global variable error: %v\n", err)
-		}
-		flagRestore = r
-	}
-	if envDatabaseDsn := os.Getenv("DATABASE_DSN"); envDatabaseDsn != "" {
-		flagDatabaseDsn = envDatabaseDsn
-	}
-	if envKey := os.Getenv("KEY"); envKey != "" {
-		flagKey = envKey
-	}
-	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
-		flagCryptoKey = envCryptoKey
-	}
-	if envConfigFile := os.Getenv("CONFIG"); envConfigFile != "" {
-		flagConfigFile = envConfigFile
+		os.Exit(0)
 	}
+	return cfg
 }
 
-// parseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
-func parseConfigFile() {
-	// если не указан файл конфигурации, то оставляю параметры запуска без изменения
-	if flagConfigFile == "" {
-		return
+// serverConfig - собирает параметры сервера из загруженных параметров запуска и проверяет их.
+func serverConfig() (app.Config, error) {
+	cfg := app.Config{
+		Address:             flagNetAddr,
+		LogLevel:            flagLogLevel,
+		StoreInterval:       time.Duration(flagStoreInterval) * time.Second,
+		FileStoragePath:     flagFileStoragePath,
+		Restore:             flagRestore,
+		DatabaseDSN:         flagDatabaseDsn,
+		ReplicaDSN:          flagReplicaDsn,
+		Pool:                flagPoolConfig,
+		BoltPath:            flagBoltPath,
+		Key:                 flagKey,
+		CryptoKey:           flagCryptoKey,
+		AdminToken:          flagAdminToken,
+		MetricsTTL:          time.Duration(flagMetricsTTL) * time.Second,
+		Retention:           flagRetention,
+		RequestTimeout:      flagRequestTimeout,
+		RateLimit:           flagRateLimit,
+		RateBurst:           flagRateBurst,
+		MaxConcurrentWrites: flagMaxConcurrentWrites,
 	}
-	configs, err := config.ParseConfigFile(flagConfigFile)
-	if err != nil {
-		log.Fatalf("parse config file error: %v\n", err)
+	var problems settings.Problems
+	if flagAgentConfig != "" {
+		agentConfigs, err := agentconfig.Load(flagAgentConfig)
+		problems.Add("load settings of agents error", err)
+		cfg.AgentConfigs = agentConfigs
 	}
-
-	// обновляю параметры запуска
-	flagNetAddr = configs.Address
-	flagRestore = configs.Restore
-	flagStoreInterval = int(configs.StoreInterval.Duration.Seconds())
-	flagFileStoragePath = configs.StoreFile
-	flagDatabaseDsn = configs.DatabaseDSN
-	flagCryptoKey = configs.CryptoKey
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return cfg, problems.Err()
 }
@@ -1,13 +1,18 @@
 package main
 
 import (
-	"flag"
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
 )
 
 func TestParseFlagsWithFlags(t *testing.T) {
@@ -16,8 +21,7 @@ func TestParseFlagsWithFlags(t *testing.T) {
 	os.Args = []string{"cmd", "-a", ":9000", "-i", "120", "-f", "./metrics.json", "-r=false", "-d", "db_dsn", "-k", "secret"}
 	defer func() { os.Args = originalArgs }()
 
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	result := parseFlags()
+	cfg := parseFlags()
 
 	assert.Equal(t, ":9000", flagNetAddr)
 	assert.Equal(t, 120, flagStoreInterval)
@@ -25,100 +29,153 @@ func TestParseFlagsWithFlags(t *testing.T) {
 	assert.Equal(t, false, flagRestore)
 	assert.Equal(t, "db_dsn", flagDatabaseDsn)
 	assert.Equal(t, "secret", flagKey)
-	assert.Equal(t, SAVEINDATABASE, result)
+	assert.Equal(t, 120*time.Second, cfg.StoreInterval)
+	assert.Equal(t, app.SAVEINDATABASE, cfg.Mode())
 }
 
 func TestParseFlagsPriority(t *testing.T) {
 	// Устанавливаем переменные окружения
-	os.Setenv("ADDRESS", ":8000")
-	os.Setenv("STORE_INTERVAL", "200")
-	os.Setenv("RESTORE", "true")
-	defer func() {
-		os.Unsetenv("ADDRESS")
-		os.Unsetenv("STORE_INTERVAL")
-		os.Unsetenv("RESTORE")
-	}()
-
-	// Создаём временный конфигурационный файл
-	configFile := "./test_config.json"
+	t.Setenv("ADDRESS", ":8000")
+	t.Setenv("STORE_INTERVAL", "200")
+
+	// Создаём временный конфигурационный файл, в котором заданы не все параметры
+	configFile := filepath.Join(t.TempDir(), "config.json")
 	configContent := `{
         "address": ":7000",
         "restore": false,
-        "store_interval": "60s"
+        "store_interval": "60s",
+        "rate_burst": 30
     }`
 	err := os.WriteFile(configFile, []byte(configContent), 0644)
 	require.NoError(t, err)
-	defer os.Remove(configFile)
 
 	// Сохраняем оригинальные значения флагов
 	originalArgs := os.Args
-	os.Args = []string{"cmd", "-a", ":9000", "-i", "120", "-f", "./metrics.json", "-r=false", "-d", "db_dsn", "-k", "secret", "-c", "./test_config.json"}
+	os.Args = []string{"cmd", "-a", ":9000", "-c", configFile}
 	defer func() { os.Args = originalArgs }()
 
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	parseFlags()
 
-	assert.Equal(t, ":7000", flagNetAddr)  // Флаг имеет приоритет
-	assert.Equal(t, 60, flagStoreInterval) // Флаг имеет приоритет
-	assert.Equal(t, false, flagRestore)    // Флаг имеет приоритет
+	assert.Equal(t, ":9000", flagNetAddr)               // Флаг имеет приоритет над переменной окружения и файлом
+	assert.Equal(t, 200, flagStoreInterval)             // Переменная окружения имеет приоритет над файлом
+	assert.Equal(t, false, flagRestore)                 // Файл имеет приоритет над значением по умолчанию
+	assert.Equal(t, 30, flagRateBurst)                  // Файл имеет приоритет над значением по умолчанию
+	assert.Equal(t, 10*time.Second, flagRequestTimeout) // Незаданный параметр остаётся по умолчанию
 }
 
 func TestParseEnvironment(t *testing.T) {
 	// Устанавливаем переменные окружения
-	os.Setenv("ADDRESS", ":8000")
-	os.Setenv("STORE_INTERVAL", "200")
-	os.Setenv("RESTORE", "true")
-	os.Setenv("FILE_STORAGE_PATH", "/tmp/metrics.json")
-	os.Setenv("DATABASE_DSN", "env_dsn")
-	os.Setenv("KEY", "env_key")
-	defer func() {
-		os.Unsetenv("ADDRESS")
-		os.Unsetenv("STORE_INTERVAL")
-		os.Unsetenv("RESTORE")
-		os.Unsetenv("FILE_STORAGE_PATH")
-		os.Unsetenv("DATABASE_DSN")
-		os.Unsetenv("KEY")
-	}()
-
-	parseEnvironment()
+	t.Setenv("ADDRESS", ":8000")
+	t.Setenv("STORE_INTERVAL", "200")
+	t.Setenv("RESTORE", "false")
+	t.Setenv("FILE_STORAGE_PATH", "/tmp/metrics.json")
+	t.Setenv("DATABASE_DSN", "env_dsn")
+	t.Setenv("KEY", "env_key")
+
+	originalArgs := os.Args
+	os.Args = []string{"cmd"}
+	defer func() { os.Args = originalArgs }()
+
+	cfg := parseFlags()
 
 	assert.Equal(t, ":8000", flagNetAddr)
 	assert.Equal(t, 200, flagStoreInterval)
-	assert.Equal(t, true, flagRestore)
+	assert.Equal(t, false, flagRestore)
 	assert.Equal(t, "/tmp/metrics.json", flagFileStoragePath)
 	assert.Equal(t, "env_dsn", flagDatabaseDsn)
 	assert.Equal(t, "env_key", flagKey)
+	assert.Equal(t, app.SAVEINDATABASE, cfg.Mode())
 }
 
 func TestParseConfigFile(t *testing.T) {
 	testFlagNetAddr := "localhost:8082"
-	testFlagRestore := true
+	testFlagRestore := false
 	testFlagStoreInterval := 1
 	testFlagFileStoragePath := "test/file/path"
-	testFlagDatabaseDsn := "test dsn"
 	testFlagCryptoKey := "test crypto key"
 
-	createFile := func(name string) {
-		data := fmt.Sprintf("{\"address\": \"%s\",\"restore\": %t,\"store_interval\": \"%ds\",\"store_file\": \"%s\",\"database_dsn\": \"%s\",\"crypto_key\": \"%s\"}",
-			testFlagNetAddr, testFlagRestore, testFlagStoreInterval, testFlagFileStoragePath, testFlagDatabaseDsn, testFlagCryptoKey)
-		f, err := os.Create(name)
-		require.NoError(t, err)
-		_, err = f.Write([]byte(data))
-		require.NoError(t, err)
-	}
-	nameFile := "./test_config.json"
-	createFile(nameFile)
+	nameFile := filepath.Join(t.TempDir(), "config.json")
+	data := fmt.Sprintf(`{"address": "%s","restore": %t,"store_interval": "%ds","store_file": "%s","crypto_key": "%s","log_level": "debug","key": "file key"}`,
+		testFlagNetAddr, testFlagRestore, testFlagStoreInterval, testFlagFileStoragePath, testFlagCryptoKey)
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0o600))
+	t.Setenv("CONFIG", nameFile)
 
-	flagConfigFile = nameFile
-	parseConfigFile()
+	originalArgs := os.Args
+	os.Args = []string{"cmd"}
+	defer func() { os.Args = originalArgs }()
 
+	cfg := parseFlags()
+
+	assert.Equal(t, nameFile, flagConfigFile)
 	assert.Equal(t, testFlagNetAddr, flagNetAddr)
 	assert.Equal(t, testFlagRestore, flagRestore)
 	assert.Equal(t, testFlagStoreInterval, flagStoreInterval)
 	assert.Equal(t, testFlagFileStoragePath, flagFileStoragePath)
-	assert.Equal(t, testFlagDatabaseDsn, flagDatabaseDsn)
 	assert.Equal(t, testFlagCryptoKey, flagCryptoKey)
+	assert.Equal(t, "debug", flagLogLevel)
+	assert.Equal(t, "file key", cfg.Key)
+	// параметры, которых нет в файле, не сбрасываются в нулевые значения
+	assert.Equal(t, pg.DefaultPoolConfig, flagPoolConfig)
+	assert.Equal(t, 20, flagRateBurst)
+	assert.Equal(t, app.SAVEINFILE, cfg.Mode())
+}
 
-	err := os.Remove(nameFile)
+func TestApplySettingsProblems(t *testing.T) {
+	nameFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(nameFile, []byte(`{"rate_burst": -1, "raw_retention": "-1h", "log_level": "loud"}`), 0o600))
+
+	require.NoError(t, loader.Load([]string{"-c", nameFile, "-max-concurrent-writes", "-2"}))
+	_, err := serverConfig()
+	require.Error(t, err)
+	// сообщаются все некорректные параметры сразу
+	for _, want := range []string{"rate_burst", "max_concurrent_writes", "retention", "log_level"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	require.NoError(t, loader.Load(nil))
+	_, err = serverConfig()
 	require.NoError(t, err)
 }
+
+func TestPrintConfig(t *testing.T) {
+	require.NoError(t, loader.Load([]string{"-print-config", "-k", "hash-secret", "-admin-token", "admin-secret", "-d", "user=metrics password=db-secret"}))
+	assert.True(t, loader.PrintRequested())
+
+	var buf bytes.Buffer
+	require.NoError(t, loader.Print(&buf))
+	for _, secret := range []string{"hash-secret", "admin-secret", "db-secret"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+	assert.Contains(t, buf.String(), `"store_interval": "5m0s"`)
+	require.NoError(t, loader.Load(nil))
+}
+
+func TestParseRateLimitFlags(t *testing.T) {
+	originalArgs := os.Args
+	os.Args = []string{"cmd", "-rate-limit", "5", "-rate-burst", "10", "-max-concurrent-writes", "4"}
+	defer func() { os.Args = originalArgs }()
+	os.Setenv("RATE_BURST", "15")
+	defer os.Unsetenv("RATE_BURST")
+
+	cfg := parseFlags()
+
+	assert.Equal(t, 5.0, cfg.RateLimit)
+	assert.Equal(t, 10, cfg.RateBurst) // флаг имеет приоритет над переменной окружения
+	assert.Equal(t, 4, cfg.MaxConcurrentWrites)
+}
+
+func TestParseAgentConfigFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"default":{"report_interval":"30s"},"groups":{"edge":{"rate_limit":2}}}`), 0o600))
+
+	originalArgs := os.Args
+	os.Args = []string{"cmd", "-agent-config", path}
+	defer func() { os.Args = originalArgs }()
+
+	cfg := parseFlags()
+
+	assert.Equal(t, path, flagAgentConfig)
+	config := cfg.AgentConfigs.Resolve("", "edge")
+	assert.Equal(t, 30*time.Second, config.ReportInterval.Duration)
+	assert.Equal(t, 2, config.RateLimit)
+}
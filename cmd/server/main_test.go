@@ -21,6 +21,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
@@ -39,7 +40,9 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string) *http.R
 func TestHandlerUpdate(t *testing.T) {
 	stor := storage.NewMemStorage(nil, map[string]int64{"testcount1": 1})
 
-	ts := httptest.NewServer(MetricRouter(stor, nil))
+	srv, err := app.New(app.DefaultConfig(), stor)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
 
 	defer ts.Close()
 
@@ -220,14 +223,8 @@ func TestMusthaveMetrics(t *testing.T) {
 		return port, nil
 	}
 
-	// функция для очистки файлов с ключами
-	removeFile := func(file string) {
-		err := os.Remove(file)
-		require.NoError(t, err)
-	}
-
-	// генирирую ключи для ассиметричного шифрования
-	pathKeys := "."
+	// генирирую ключи для ассиметричного шифрования во временной директории, чтобы они не попали в репозиторий
+	pathKeys := t.TempDir()
 	err := encryption.GenerateKeys(pathKeys)
 	require.NoError(t, err)
 
@@ -313,7 +310,4 @@ func TestMusthaveMetrics(t *testing.T) {
 	if err := pprof.WriteHeapProfile(fmem); err != nil {
 		panic(err)
 	}
-
-	defer removeFile(pathKeys + "/private_key.pem")
-	defer removeFile(pathKeys + "/public_key.pem")
 }
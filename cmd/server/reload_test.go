@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(data string) {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	}
+	defer func() {
+		serverArgs = nil
+		require.NoError(t, loader.Load(nil))
+	}()
+
+	// исходная конфигурация сервера, параметры из файла переопределяются переменными окружения и флагами
+	write(`{"address": ":8080", "store_interval": "300s", "store_file": "/tmp/metrics.json"}`)
+	t.Setenv("REQUEST_TIMEOUT", "3s")
+	serverArgs = []string{"-c", path, "-i", "100"}
+	require.NoError(t, loader.Load(serverArgs))
+	cfg, err := serverConfig()
+	require.NoError(t, err)
+	srv, err := app.New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+	_, _, err = reloadConfig(srv)
+	require.NoError(t, err)
+
+	// параметры, которые требуют перезапуска, не меняются
+	write(`{"address": ":8081", "store_interval": "60s", "store_file": "/tmp/metrics.json", "admin_token": "token",
+		"key": "secret", "log_level": "debug", "request_timeout": "3s", "raw_retention": "2h"}`)
+	applied, restart, err := reloadConfig(srv)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"admin_token", "key", "log_level", "raw_retention"}, applied)
+	assert.Equal(t, []string{"address"}, restart)
+	assert.Equal(t, ":8080", flagNetAddr)
+	// переменные окружения и флаги сохраняют приоритет над файлом
+	current := srv.Config()
+	assert.Equal(t, ":8080", current.Address)
+	assert.Equal(t, 100*time.Second, current.StoreInterval)
+	assert.Equal(t, "token", current.AdminToken)
+	assert.Equal(t, "secret", current.Key)
+	assert.Equal(t, "debug", current.LogLevel)
+	assert.Equal(t, 3*time.Second, current.RequestTimeout)
+	assert.Equal(t, 2*time.Hour, current.Retention.Raw)
+
+	// некорректная конфигурация не применяется
+	write(`{"address": ":8080", "store_interval": "60s", "store_file": "/tmp/metrics.json", "key": "other", "raw_retention": "-1h"}`)
+	_, _, err = reloadConfig(srv)
+	require.Error(t, err)
+	assert.Equal(t, "secret", srv.Config().Key)
+	assert.Equal(t, "secret", flagKey)
+	assert.Equal(t, 2*time.Hour, flagRetention.Raw)
+
+	write(`{"log_level": "loud"}`)
+	_, _, err = reloadConfig(srv)
+	require.Error(t, err)
+	assert.Equal(t, "debug", flagLogLevel)
+	assert.Equal(t, "debug", srv.Config().LogLevel)
+
+	write(`{`)
+	_, _, err = reloadConfig(srv)
+	require.Error(t, err)
+
+	serverArgs = nil
+	require.NoError(t, loader.Load(serverArgs))
+	_, _, err = reloadConfig(srv)
+	require.Error(t, err)
+}
@@ -0,0 +1,172 @@
+// Packet app implement metrics agent, which holds its configuration and dependencies and can be embedded into another application.
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/collecter"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/pusher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/remote"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+)
+
+// pushAction - путь отправки батча метрик на сервер.
+const pushAction = "updates/"
+
+// Agent - агент сбора метрик. Все параметры и зависимости агента хранятся в его экземпляре,
+// поэтому в одном процессе можно запустить несколько агентов.
+type Agent struct {
+	mu  sync.RWMutex // защищает параметры, которые меняются при перезагрузке конфигурации
+	cfg Config
+
+	level zap.AtomicLevel
+	log   *zap.Logger
+
+	metrics  *storage.MetricsStats
+	settings *config.Settings
+	sender   *worker.Sender
+	pusher   *pusher.Pusher
+	updater  *remote.Updater
+}
+
+// New - создаёт агента с параметрами cfg.
+func New(cfg Config) (*Agent, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	level := zap.NewAtomicLevel()
+	log, err := logger.New(level)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{
+		level:    level,
+		log:      log,
+		metrics:  storage.NewMetricsStats(),
+		settings: config.NewSettings(),
+	}
+	a.metrics.SetLogger(log)
+	a.sender = worker.NewSender(a.settings, log)
+	a.pusher = pusher.New(a.settings, log)
+	a.apply(cfg)
+	// локальные настройки запоминаются при создании Updater, поэтому он создаётся после их установки
+	a.updater = remote.New(a.serverURL(), a.metrics, a.settings, a.sender, log)
+	return a, nil
+}
+
+// apply - устанавливает параметры cfg в компоненты агента. Параметры должны быть проверены заранее.
+func (a *Agent) apply(cfg Config) {
+	if lvl, err := zap.ParseAtomicLevel(cfg.LogLevel); err == nil {
+		a.level.SetLevel(lvl.Level())
+	}
+	a.settings.SetPollInterval(cfg.PollInterval)
+	a.settings.SetReportInterval(cfg.ReportInterval)
+	a.settings.SetKey(cfg.Key)
+	a.settings.SetCryptoGrapher(encryption.Initialize(cfg.CryptoKey, ""))
+	a.settings.SetAgentID(cfg.AgentID)
+	a.settings.SetAgentGroup(cfg.AgentGroup)
+	a.sender.SetConcurrency(cfg.RateLimit)
+	a.sender.SetRetryPolicy(cfg.Retry)
+	a.sender.SetRetryBudget(worker.NewRetryBudget(cfg.RetryBudget, worker.DefaultRetryBudgetRatio))
+	a.cfg = cfg
+}
+
+// Reconfigure - применяет параметры cfg, которые можно изменить без перезапуска агента. Параметры, изменение
+// которых требует перезапуска, остаются прежними. Если параметры некорректны, не применяется ни один из них.
+// Настройки, полученные с сервера, по-прежнему переопределяют локальные параметры агента.
+func (a *Agent) Reconfigure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.apply(cfg.withRestartSettings(a.cfg))
+	a.mu.Unlock()
+	if err := a.updater.Rebase(); err != nil {
+		return fmt.Errorf("apply agent config from server error: %w", err)
+	}
+	return nil
+}
+
+// Config - возвращает действующие параметры агента.
+func (a *Agent) Config() Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.cfg
+}
+
+// Logger - возвращает логер агента.
+func (a *Agent) Logger() *zap.Logger {
+	return a.log
+}
+
+// Metrics - возвращает метрики, собираемые агентом.
+func (a *Agent) Metrics() *storage.MetricsStats {
+	return a.metrics
+}
+
+// serverURL - возвращает адрес сервера метрик.
+func (a *Agent) serverURL() string {
+	return "http://" + a.Config().Address
+}
+
+// Run - собирает метрики и отправляет их на сервер, пока не отменён контекст ctx. После отмены контекста агент
+// дожидается завершения начатых отправок.
+func (a *Agent) Run(ctx context.Context) error {
+	cfg := a.Config()
+	var wg sync.WaitGroup
+
+	a.log.Info("Running agent", zap.String("address", cfg.Address), zap.Int("rateLimit", cfg.RateLimit))
+	wg.Add(1)
+	go collecter.CollectWithTimer(ctx, a.metrics, a.settings, &wg)
+
+	// настройки агента, заданные на сервере, применяются без перезапуска агента
+	wg.Add(1)
+	go a.updater.Run(ctx, cfg.ConfigPollInterval, &wg)
+
+	// Размер буферизованного канала равен количеству количеству одновременно исходящих запросов
+	pushTasks := make(chan worker.Task, cfg.RateLimit)
+	wg.Add(1)
+	go a.generatePushTasks(ctx, pushTasks, &wg)
+
+	// создаю и запускаю воркеры, это и есть пул. Количество одновременных отправок ограничивается Sender.SetConcurrency,
+	// поэтому сервер может изменить его, не перезапуская агент
+	for w := 0; w < max(cfg.RateLimit, worker.MaxConcurrency); w++ {
+		wg.Add(1)
+		go a.sender.DoWork(ctx, pushTasks, &wg)
+		a.log.Debug("start pushing worker", zap.Int("worker", w))
+	}
+
+	<-ctx.Done()
+	a.log.Info("Shutting down agent")
+	wg.Wait()
+	return nil
+}
+
+// generatePushTasks - генерирует задачи для их выполнения пулом работников, пока не отменён контекст.
+func (a *Agent) generatePushTasks(ctx context.Context, tasks chan<- worker.Task, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(tasks)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tasks <- *worker.NewTask(a.serverURL(), pushAction, a.metrics, a.pusher.PrepareAndPushBatch):
+			// пока сервер перегружен, метрики отправляются реже
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(a.sender.ReportInterval(a.settings.GetReportInterval())):
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	serverapp "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, DefaultConfig().Validate())
+
+	cfg := DefaultConfig()
+	cfg.ReportInterval = -time.Second
+	cfg.RateLimit = -1
+	cfg.Retry.Jitter = 2
+	cfg.LogLevel = "loud"
+	err := cfg.Validate()
+	require.Error(t, err)
+	// сообщаются все некорректные параметры сразу
+	for _, want := range []string{"report_interval", "rate_limit", "retry", "log_level"} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestConfigWithRestartSettings(t *testing.T) {
+	current := DefaultConfig()
+	cfg := DefaultConfig()
+	cfg.Address = ":8081"
+	cfg.ConfigPollInterval = time.Hour
+	cfg.Key = "secret"
+
+	// параметры, которые требуют перезапуска, остаются действующими, остальные применяются
+	want := current
+	want.Key = "secret"
+	assert.Equal(t, want, cfg.withRestartSettings(current))
+	assert.True(t, RequiresRestart("config_poll_interval"))
+	assert.False(t, RequiresRestart("key"))
+}
+
+func TestAgentsAreIndependent(t *testing.T) {
+	first := DefaultConfig()
+	first.Key = "first"
+	first.RateLimit = 2
+	second := DefaultConfig()
+	second.Key = "second"
+
+	firstAgent, err := New(first)
+	require.NoError(t, err)
+	secondAgent, err := New(second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "first", firstAgent.settings.GetKey())
+	assert.Equal(t, "second", secondAgent.settings.GetKey())
+	assert.Equal(t, 2, firstAgent.sender.GetConcurrency())
+	assert.Equal(t, 1, secondAgent.sender.GetConcurrency())
+}
+
+func TestReconfigure(t *testing.T) {
+	agent, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.Address = "localhost:9090"
+	cfg.ConfigPollInterval = time.Second
+	cfg.ReportInterval = 20 * time.Second
+	cfg.Key = "secret"
+	cfg.RateLimit = 3
+	cfg.LogLevel = "debug"
+	require.NoError(t, agent.Reconfigure(cfg))
+
+	current := agent.Config()
+	// параметры, которые требуют перезапуска, не меняются
+	assert.Equal(t, ":8080", current.Address)
+	assert.Equal(t, time.Minute, current.ConfigPollInterval)
+	assert.Equal(t, 20*time.Second, agent.settings.GetReportInterval())
+	assert.Equal(t, "secret", agent.settings.GetKey())
+	assert.Equal(t, 3, agent.sender.GetConcurrency())
+	assert.True(t, agent.Logger().Core().Enabled(zap.DebugLevel))
+
+	// настройки сервера переопределяют локальные настройки и после перезагрузки
+	require.NoError(t, agent.updater.Apply(repositories.AgentConfig{Version: "v1", RateLimit: 5}))
+	cfg.RateLimit = 4
+	require.NoError(t, agent.Reconfigure(cfg))
+	assert.Equal(t, 5, agent.sender.GetConcurrency())
+
+	// некорректные параметры не применяются
+	cfg.Key = "other"
+	cfg.PollInterval = -time.Second
+	require.Error(t, agent.Reconfigure(cfg))
+	assert.Equal(t, "secret", agent.Config().Key)
+	assert.Equal(t, "secret", agent.settings.GetKey())
+}
+
+func TestGeneratePushTasks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	agent, err := New(DefaultConfig())
+	require.NoError(t, err)
+	tasks := make(chan worker.Task, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go agent.generatePushTasks(ctx, tasks, &wg)
+
+	// Проверяем, что задачи генерируются в канал
+	select {
+	case <-ctx.Done():
+		t.Fatal("context finished before task generation")
+	case task := <-tasks:
+		require.NotNil(t, task, "Generated task should not be nil")
+	}
+
+	// после отмены контекста канал задач закрывается
+	cancel()
+	wg.Wait()
+	_, ok := <-tasks
+	assert.False(t, ok)
+}
+
+func TestRun(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	srv, err := serverapp.New(serverapp.DefaultConfig(), stor)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Address = strings.TrimPrefix(ts.URL, "http://")
+	cfg.PollInterval = 10 * time.Millisecond
+	cfg.ReportInterval = 10 * time.Millisecond
+	cfg.ConfigPollInterval = 0
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx) }()
+
+	// собранные агентом метрики доставляются на сервер
+	require.Eventually(t, func() bool {
+		_, err := stor.GetMetric(context.Background(), "counter", "PollCount")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent is not stopped after context cancel")
+	}
+}
+
+func TestRunStopsDuringRetry(t *testing.T) {
+	// сервер всегда перегружен и просит повторить отправку через 30 секунд
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		res.Header().Set("Retry-After", "30")
+		http.Error(res, "server is busy", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.Address = strings.TrimPrefix(ts.URL, "http://")
+	cfg.PollInterval = 10 * time.Millisecond
+	cfg.ReportInterval = 10 * time.Millisecond
+	cfg.ConfigPollInterval = 0
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx) }()
+	require.Eventually(t, func() bool { return requests.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// ожидание перед повторной отправкой прерывается отменой контекста
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent is not stopped during retry wait")
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/settings"
+)
+
+// Config - параметры агента сбора метрик.
+type Config struct {
+	Address  string // адрес и порт сервера метрик
+	LogLevel string // уровень логирования
+
+	PollInterval   time.Duration // интервал между сбором метрик
+	ReportInterval time.Duration // интервал между отправками метрик на сервер
+
+	Key       string // ключ для подписи данных
+	CryptoKey string // путь к публичному ключу для шифрования данных
+
+	RateLimit   int                // количество одновременных отправок метрик на сервер, 0 - без ограничения
+	Retry       worker.RetryPolicy // параметры повторной отправки метрик
+	RetryBudget int                // максимальное количество повторов подряд, общее для всех отправок
+
+	AgentID            string        // идентификатор агента, по которому сервер ограничивает частоту запросов
+	AgentGroup         string        // группа агента, по которой сервер выбирает настройки агента
+	ConfigPollInterval time.Duration // интервал запроса настроек агента с сервера, 0 - настройки не запрашиваются
+}
+
+// DefaultConfig - возвращает параметры агента по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		Address:            ":8080",
+		LogLevel:           "info",
+		PollInterval:       config.DefaultPollInterval,
+		ReportInterval:     config.DefaultReportInterval,
+		RateLimit:          1,
+		Retry:              worker.DefaultRetryPolicy,
+		RetryBudget:        worker.DefaultRetryBudgetMax,
+		ConfigPollInterval: time.Minute,
+	}
+}
+
+// Validate - проверяет параметры агента и возвращает все найденные ошибки сразу.
+func (c Config) Validate() error {
+	var problems settings.Problems
+	problems.Check(c.ReportInterval >= 0, "report_interval must not be negative, got %s", c.ReportInterval)
+	problems.Check(c.PollInterval >= 0, "poll_interval must not be negative, got %s", c.PollInterval)
+	problems.Check(c.RateLimit >= 0, "rate_limit must not be negative, got %d", c.RateLimit)
+	problems.Check(c.ConfigPollInterval >= 0, "config_poll_interval must not be negative, got %s", c.ConfigPollInterval)
+	problems.Check(c.RetryBudget >= 0, "retry_budget must not be negative, got %d", c.RetryBudget)
+	_, err := zap.ParseAtomicLevel(c.LogLevel)
+	problems.Add("invalid log_level", err)
+	problems.Add("invalid retry settings", c.Retry.Validate())
+	return problems.Err()
+}
+
+// restartSettings - параметры запуска, изменение которых применяется только после перезапуска агента, по имени
+// параметра в файле конфигурации, и функции, переносящие значение параметра из действующих параметров current в c.
+var restartSettings = map[string]func(c *Config, current Config){
+	"address":              func(c *Config, current Config) { c.Address = current.Address },
+	"config_poll_interval": func(c *Config, current Config) { c.ConfigPollInterval = current.ConfigPollInterval },
+}
+
+// RequiresRestart - сообщает, применяется ли изменение параметра запуска key только после перезапуска агента.
+func RequiresRestart(key string) bool {
+	_, ok := restartSettings[key]
+	return ok
+}
+
+// withRestartSettings - возвращает копию параметров c, в которой параметры, изменение которых требует перезапуска
+// агента, взяты из действующих параметров current.
+func (c Config) withRestartSettings(current Config) Config {
+	for _, keep := range restartSettings {
+		keep(&c, current)
+	}
+	return c
+}
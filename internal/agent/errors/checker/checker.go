@@ -1,15 +1,20 @@
 package checker
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
-
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 )
 
 // IsConnectionRefused - проверка того, что ошибка это "connect: connection refused"
@@ -18,9 +23,6 @@ func IsConnectionRefused(err error) bool {
 		return false
 	}
 	res := errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "dial tcp: connect: connection refused")
-	if res {
-		logger.AgentLog.Debug("error isConnectionRefused")
-	}
 	return res
 }
 
@@ -43,9 +45,6 @@ func IsDBTransportError(err error) bool {
 		strings.Contains(err.Error(), "connection failure") ||
 		strings.Contains(err.Error(), "SQL client unable to establish SQL connection")
 	res := asPgError || asString
-	if res {
-		logger.AgentLog.Debug("error isDBTransportError")
-	}
 	return res
 }
 
@@ -63,8 +62,72 @@ func IsFileLockedError(err error) bool {
 	asString = strings.Contains(err.Error(), "permission denied") ||
 		strings.Contains(err.Error(), "read-only file system")
 	res := asError || asString
-	if res {
-		logger.AgentLog.Debug("error isFileLockedError")
+	return res
+}
+
+// StatusError - ошибка отправки метрик, при которой сервер ответил кодом, отличным от 200.
+type StatusError struct {
+	StatusCode int           // код ответа сервера
+	RetryAfter time.Duration // пауза перед повтором из заголовка Retry-After, 0 - заголовок не передан
+	Body       string        // тело ответа сервера
+}
+
+// NewStatusError - фабричная функция структуры StatusError. retryAfter - значение заголовка Retry-After.
+func NewStatusError(statusCode int, retryAfter string, body string) *StatusError {
+	return &StatusError{
+		StatusCode: statusCode,
+		RetryAfter: ParseRetryAfter(retryAfter, time.Now()),
+		Body:       body,
+	}
+}
+
+// Error - реализует интерфейс error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code is: %d %s", e.StatusCode, e.Body)
+}
+
+// ParseRetryAfter - возвращает паузу из значения заголовка Retry-After, заданного в секундах или датой HTTP.
+// Для пустого или некорректного значения, а также даты в прошлом возвращается 0.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+	return date.Sub(now)
+}
+
+// IsNetworkError - проверяет, что ошибка вызвана временной проблемой сети: таймаутом, разрывом соединения,
+// ошибкой разрешения имени сервера или ошибкой установки TLS-соединения. Ошибки проверки сертификата сервера не относятся к временным.
+func IsNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
 	}
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var netErr net.Error
+	res := errors.As(err, &dnsErr) ||
+		errors.As(err, &recordErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		strings.Contains(err.Error(), "TLS handshake") ||
+		strings.Contains(err.Error(), "tls: handshake failure")
 	return res
 }
@@ -1,11 +1,17 @@
 package checker
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -198,3 +204,65 @@ func TestIsFileLockedError(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNetworkError(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  error
+		want bool
+	}{
+		{name: "nil", arg: nil, want: false},
+		{name: "dns failure", arg: fmt.Errorf("post: %w", &net.DNSError{Err: "no such host", Name: "metrics.local"}), want: true},
+		{name: "timeout", arg: &net.OpError{Op: "dial", Err: &timeoutError{}}, want: true},
+		{name: "connection reset", arg: &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, want: true},
+		{name: "broken pipe", arg: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE}, want: true},
+		{name: "unexpected eof", arg: fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "tls record header", arg: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, want: true},
+		{name: "tls handshake timeout", arg: errors.New("net/http: TLS handshake timeout"), want: true},
+		{name: "certificate verification", arg: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, want: false},
+		{name: "other", arg: errors.New("answer metric from server not equal pushing metric"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsNetworkError(tt.arg))
+		})
+	}
+}
+
+// timeoutError - сетевая ошибка таймаута.
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty", value: "", want: 0},
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "negative seconds", value: "-5", want: 0},
+		{name: "http date", value: now.Add(30 * time.Second).Format(http.TimeFormat), want: 30 * time.Second},
+		{name: "date in past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "invalid", value: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseRetryAfter(tt.value, now))
+		})
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	err := fmt.Errorf("push: %w", NewStatusError(http.StatusServiceUnavailable, "7", "storage is unavailable"))
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(t, 7*time.Second, statusErr.RetryAfter)
+	assert.Contains(t, err.Error(), "status code is: 503 storage is unavailable")
+}
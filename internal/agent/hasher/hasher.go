@@ -10,26 +10,19 @@ import (
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
-
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 )
 
-var key string
-
-// SetKey - устанавливает секретный ключ для подписи и расшифровки данных.
-func SetKey(k string) {
-	key = k
-}
-
-// GetKey - получает установленный секретный ключ.
-func GetKey() string {
-	return key
+// VerifyHashMiddleware - возвращает middleware, которое проверяет хэш тела ответа ключом key.
+func VerifyHashMiddleware(key string, log *zap.Logger) resty.ResponseMiddleware {
+	return func(c *resty.Client, resp *resty.Response) error {
+		return verifyHash(key, log, resp)
+	}
 }
 
-// VerifyHashMiddleware - проверяет хэш тела ответа
-func VerifyHashMiddleware(c *resty.Client, resp *resty.Response) error {
+// verifyHash - проверяет хэш тела ответа
+func verifyHash(key string, log *zap.Logger, resp *resty.Response) error {
 	// Если ключ не задан, то проверять подпись данных не нужно
-	if k := GetKey(); k == "" {
+	if key == "" {
 		return nil
 	}
 	// Если ответ сервера
@@ -46,7 +39,7 @@ func VerifyHashMiddleware(c *resty.Client, resp *resty.Response) error {
 		return errors.New("missing HashSHA256 header in the response")
 	}
 	// Логирование заголовка
-	logger.AgentLog.Debug("Received HashSHA256 header and body", zap.String("header", serverHash), zap.String("body", fmt.Sprintf("%x", bodyBytes)))
+	log.Debug("Received HashSHA256 header and body", zap.String("header", serverHash), zap.String("body", fmt.Sprintf("%x", bodyBytes)))
 
 	serverHashBytes, err := hex.DecodeString(serverHash)
 
@@ -55,7 +48,7 @@ func VerifyHashMiddleware(c *resty.Client, resp *resty.Response) error {
 	}
 
 	// подписываем алгоритмом HMAC, используя SHA-256
-	h := hmac.New(sha256.New, []byte(GetKey()))
+	h := hmac.New(sha256.New, []byte(key))
 	_, err = h.Write(bodyBytes)
 	if err != nil {
 		return err
@@ -65,7 +58,7 @@ func VerifyHashMiddleware(c *resty.Client, resp *resty.Response) error {
 	// проверяю хэши
 	if !hmac.Equal(hash, serverHashBytes) {
 		err := fmt.Errorf("want %x, get %x", hash, serverHashBytes)
-		logger.AgentLog.Error("hashs is not equal ", zap.String("error: ", error.Error(err)))
+		log.Error("hashs is not equal ", zap.String("error: ", error.Error(err)))
 		return err
 	}
 
@@ -10,35 +10,13 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
-func TestSetKey(t *testing.T) {
-	{
-		SetKey("")
-		assert.Equal(t, "", key)
-	}
-	{
-		SetKey("secret key")
-		assert.Equal(t, "secret key", key)
-	}
-}
-
-func TestGetKey(t *testing.T) {
-	{
-		key = ""
-		assert.Equal(t, "", GetKey())
-	}
-	{
-		key = "secret key"
-		assert.Equal(t, "secret key", GetKey())
-	}
-}
-
 func TestVerifyHashMiddleware(t *testing.T) {
 	// ключ не задан, подпись не проверяется
 	{
-		SetKey("")
-		err := VerifyHashMiddleware(nil, nil)
+		err := VerifyHashMiddleware("", zap.NewNop())(nil, nil)
 		assert.NoError(t, err)
 	}
 	// подпись не проверяется, если статус ответа сервера не равен StatusOK
@@ -50,13 +28,13 @@ func TestVerifyHashMiddleware(t *testing.T) {
 		responce := resty.Response{
 			RawResponse: httpR,
 		}
-		err := VerifyHashMiddleware(nil, &responce)
+		err := VerifyHashMiddleware("secret key", zap.NewNop())(nil, &responce)
 		assert.NoError(t, err)
 	}
 	// отсутствует хэш в заголовке ответа
 	{
 		// устанавливаю секретный коюч
-		SetKey("secret key")
+		key := "secret key"
 		httpH := make(http.Header, 0)
 		httpH.Add("HashSHA256", "")
 
@@ -68,18 +46,18 @@ func TestVerifyHashMiddleware(t *testing.T) {
 		responce := resty.Response{
 			RawResponse: httpR,
 		}
-		err := VerifyHashMiddleware(nil, &responce)
+		err := VerifyHashMiddleware(key, zap.NewNop())(nil, &responce)
 		assert.Error(t, err)
 	}
 	// тест с успешной проверкой подписи
 	{
 		// устанавливаю секретный коюч
-		SetKey("secret key")
+		key := "secret key"
 
 		// устанавливаю тело ответа от сервера
 		body := []byte("my test information for hashing and checking")
 		// подписываю тело алгоритмом HMAC, используя SHA-256
-		h := hmac.New(sha256.New, []byte(GetKey()))
+		h := hmac.New(sha256.New, []byte(key))
 		_, err := h.Write(body)
 		require.NoError(t, err)
 		hash := h.Sum(nil)
@@ -95,13 +73,13 @@ func TestVerifyHashMiddleware(t *testing.T) {
 			RawResponse: httpR,
 		}
 		responce.SetBody(body)
-		err = VerifyHashMiddleware(nil, &responce)
+		err = VerifyHashMiddleware(key, zap.NewNop())(nil, &responce)
 		assert.NoError(t, err)
 	}
 	// тест с неуспешной проверкой подписи, разные секретные ключи
 	{
 		// устанавливаю секретный коюч
-		SetKey("secret key")
+		key := "secret key"
 
 		// устанавливаю тело ответа от сервера
 		body := []byte("my test information for hashing and checking")
@@ -122,18 +100,18 @@ func TestVerifyHashMiddleware(t *testing.T) {
 			RawResponse: httpR,
 		}
 		responce.SetBody(body)
-		err = VerifyHashMiddleware(nil, &responce)
+		err = VerifyHashMiddleware(key, zap.NewNop())(nil, &responce)
 		assert.Error(t, err)
 	}
 	// тест с неправильным форматом хэша
 	{
 		// устанавливаю секретный коюч
-		SetKey("secret key")
+		key := "secret key"
 
 		// устанавливаю тело ответа от сервера
 		body := []byte("my test information for hashing and checking")
 		// подписываю тело алгоритмом HMAC, используя SHA-256
-		h := hmac.New(sha256.New, []byte(GetKey()))
+		h := hmac.New(sha256.New, []byte(key))
 		_, err := h.Write(body)
 		require.NoError(t, err)
 		hash := h.Sum(nil)
@@ -149,7 +127,7 @@ func TestVerifyHashMiddleware(t *testing.T) {
 			RawResponse: httpR,
 		}
 		responce.SetBody(body)
-		err = VerifyHashMiddleware(nil, &responce)
+		err = VerifyHashMiddleware(key, zap.NewNop())(nil, &responce)
 		assert.Error(t, err)
 	}
 }
@@ -2,28 +2,15 @@ package logger
 
 import "go.uber.org/zap"
 
-// Log будет доступен всему коду как синглтон.
-// Никакой код навыка, кроме функции InitLogger, не должен модифицировать эту переменную.
-// По умолчанию установлен no-op-логер, который не выводит никаких сообщений.
-var AgentLog *zap.Logger = zap.NewNop()
-
-// Initialize - инициализирует синглтон логера с необходимым уровнем логирования.
-func Initialize(level string) error {
-	// преобразуем текстовый уровень логирования в zap.AtomicLevel
-	lvl, err := zap.ParseAtomicLevel(level)
-	if err != nil {
-		return err
-	}
+// New - создаёт логер агента, уровень логирования которого можно изменить во время работы через level.
+func New(level zap.AtomicLevel) (*zap.Logger, error) {
 	// создаём новую конфигурацию логера
 	cfg := zap.NewProductionConfig()
-	// устанавливаем уровень
-	cfg.Level = lvl
+	cfg.Level = level
 	// создаём логер на основе конфигурации
 	zl, err := cfg.Build()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// устанавливаем синглтон
-	AgentLog = zl.With(zap.String("role", "agent"))
-	return nil
+	return zl.With(zap.String("role", "agent")), nil
 }
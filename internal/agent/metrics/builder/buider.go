@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
@@ -32,6 +31,36 @@ func Build(typeMetric, nameMetric, valueMetric string) (metric repositories.Metr
 		err = fmt.Errorf("get invalid type of metric: %s", typeMetric)
 		return
 	}
-	logger.AgentLog.Debug(fmt.Sprintf("Success build metric structure for JSON: name: %s, type: %s, delta: %d, value: %d", metric.ID, metric.MType, metric.Delta, metric.Value))
 	return
 }
+
+// Gauge - строит метрику типа "gauge" из значения float64 без промежуточного преобразования в строку.
+func Gauge(nameMetric string, value float64) repositories.Metric {
+	return repositories.Metric{
+		ID:    nameMetric,
+		MType: "gauge",
+		Value: &value,
+	}
+}
+
+// Counter - строит метрику типа "counter" из значения int64 без промежуточного преобразования в строку.
+func Counter(nameMetric string, delta int64) repositories.Metric {
+	return repositories.Metric{
+		ID:    nameMetric,
+		MType: "counter",
+		Delta: &delta,
+	}
+}
+
+// Histogram - строит метрику типа "histogram" из копии переданной гистограммы.
+func Histogram(nameMetric string, histogram repositories.Histogram) repositories.Metric {
+	h := repositories.NewHistogram(histogram.Bounds)
+	copy(h.Counts, histogram.Counts)
+	h.Sum = histogram.Sum
+	h.Count = histogram.Count
+	return repositories.Metric{
+		ID:        nameMetric,
+		MType:     "histogram",
+		Histogram: &h,
+	}
+}
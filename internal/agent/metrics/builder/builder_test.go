@@ -1,7 +1,10 @@
 package builder
 
 import (
+	"encoding/json"
+	"math"
 	"testing"
+	"testing/quick"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -99,3 +102,39 @@ func TestBuildMetric(t *testing.T) {
 		})
 	}
 }
+
+// TestGaugeLossless - свойство: gauge метрика, построенная из float64, без потерь переживает сериализацию в JSON.
+func TestGaugeLossless(t *testing.T) {
+	property := func(name string, value float64) bool {
+		metric := Gauge(name, value)
+
+		data, err := json.Marshal(metric)
+		if err != nil {
+			return false
+		}
+		var decoded repositories.Metric
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded.Value == nil || decoded.Delta != nil {
+			return false
+		}
+		return decoded.ID == name && decoded.MType == "gauge" && math.Float64bits(*decoded.Value) == math.Float64bits(value)
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+// TestCounterLossless - свойство: counter метрика, построенная из int64, без потерь переживает сериализацию в JSON.
+func TestCounterLossless(t *testing.T) {
+	property := func(name string, delta int64) bool {
+		metric := Counter(name, delta)
+
+		data, err := json.Marshal(metric)
+		if err != nil {
+			return false
+		}
+		var decoded repositories.Metric
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded.Delta == nil || decoded.Value != nil {
+			return false
+		}
+		return decoded.ID == name && decoded.MType == "counter" && *decoded.Delta == delta
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
@@ -10,17 +10,17 @@ import (
 )
 
 // CollectWithTimer запускает сбор метрик через заданный интервал времени.
-func CollectWithTimer(ctx context.Context, metrics *storage.MetricsStats, wg *sync.WaitGroup) {
+// Интервал перечитывается из settings после каждого сбора, поэтому его изменение применяется без перезапуска агента.
+func CollectWithTimer(ctx context.Context, metrics *storage.MetricsStats, settings *config.Settings, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	sleepInterval := config.GetPollInterval() * time.Second
 	for {
+		metrics.CollectMetrics()
+		// ожидание прерывается отменой контекста, чтобы агент завершался без задержки на интервал сбора
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			config.SyncCollectMetrics(metrics)
-			time.Sleep(sleepInterval)
+		case <-time.After(settings.GetPollInterval()):
 		}
 	}
 }
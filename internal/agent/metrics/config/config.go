@@ -1,90 +1,151 @@
 package config
 
 import (
-	"bufio"
-	"encoding/json"
-	"fmt"
-	"os"
+	"sync"
 	"time"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
 )
 
-var (
-	pollInterval   time.Duration            = 2
-	reportInterval time.Duration            = 10
-	contextTimeout                          = 500 * time.Millisecond
-	cryptoGrapher  encryption.Cryptographer // переменная, которая хранит структуру шифрования и расшифровки.
+// Значения параметров агента по умолчанию.
+const (
+	DefaultPollInterval   = 2 * time.Second
+	DefaultReportInterval = 10 * time.Second
+	DefaultContextTimeout = 500 * time.Millisecond
 )
 
-// Configs представляет структуру конфигурации
-type Configs struct {
-	Address        string                `json:"address"`         // аналог переменной окружения ADDRESS или флага -a
-	ReportInterval repositories.Duration `json:"report_interval"` // аналог переменной окружения REPORT_INTERVAL или флага -r
-	PollInterval   repositories.Duration `json:"poll_interval"`   // аналог переменной окружения POLL_INTERVAL или флага -p
-	CryptoKey      string                `json:"crypto_key"`      // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
+// Settings - параметры агента, которые меняются во время работы. Каждый агент хранит свой экземпляр,
+// поэтому в одном процессе можно запустить несколько агентов с разными параметрами.
+type Settings struct {
+	mu             sync.RWMutex             // защищает параметры, которые меняются во время работы агента
+	pollInterval   time.Duration            // интервал между сбором метрик
+	reportInterval time.Duration            // интервал между отправками метрик на сервер
+	contextTimeout time.Duration            // таймаут отправки метрик на сервер
+	cryptoGrapher  encryption.Cryptographer // структура шифрования и расшифровки
+	key            string                   // ключ для подписи данных
+	agentID        string                   // идентификатор агента, по которому сервер ограничивает частоту запросов
+	agentGroup     string                   // группа агента, по которой сервер выбирает настройки агента
+	configVersions chan string              // версии настроек агента, полученные в ответах сервера
+}
+
+// NewSettings - создаёт параметры агента со значениями по умолчанию.
+func NewSettings() *Settings {
+	return &Settings{
+		pollInterval:   DefaultPollInterval,
+		reportInterval: DefaultReportInterval,
+		contextTimeout: DefaultContextTimeout,
+		configVersions: make(chan string, 1),
+	}
 }
 
 // SetPollInterval устанавливает интервал между сбором.
-func SetPollInterval(interval time.Duration) {
-	pollInterval = interval
+func (s *Settings) SetPollInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pollInterval = interval
 }
 
 // GetPollInterval - функция для получения интервала сбора метрик.
-func GetPollInterval() time.Duration {
-	return pollInterval
+func (s *Settings) GetPollInterval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pollInterval
 }
 
 // SetReportInterval устанавливает интервал между отправками метрик на сервер.
-func SetReportInterval(interval time.Duration) {
-	reportInterval = interval
+func (s *Settings) SetReportInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reportInterval = interval
 }
 
 // GetReportInterval - функция для получения интервала отправки метрик на сервер.
-func GetReportInterval() time.Duration {
-	return reportInterval
+func (s *Settings) GetReportInterval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.reportInterval
 }
 
 // SetContextTimeout - установка таймаута.
-func SetContextTimeout(timeout time.Duration) {
-	contextTimeout = timeout
+func (s *Settings) SetContextTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contextTimeout = timeout
 }
 
 // GetContextTimeout - получение таймаута.
-func GetContextTimeout() time.Duration {
-	return contextTimeout
+func (s *Settings) GetContextTimeout() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.contextTimeout
 }
 
-// SyncCollectMetrics - собирает метрики.
-func SyncCollectMetrics(metrics *storage.MetricsStats) {
-	metrics.CollectMetrics()
+// SetKey - устанавливает ключ для подписи данных.
+func (s *Settings) SetKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
 }
 
-// SetCryptoGrapher - функция для установки структуры шифрования и расшифровки.
-func SetCryptoGrapher(c *encryption.Cryptographer) {
-	cryptoGrapher = *c
+// GetKey - возвращает ключ для подписи данных.
+func (s *Settings) GetKey() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.key
 }
 
-// GetCryptoGrapher - функция для получения структуры шифрования и расшифровки.
-func GetCryptoGrapher() encryption.Cryptographer {
-	return cryptoGrapher
+// SetAgentID - устанавливает идентификатор агента, передаваемый серверу в заголовке repositories.AgentIDHeader.
+func (s *Settings) SetAgentID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agentID = id
 }
 
-// ParseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
-func ParseConfigFile(configFileName string) (Configs, error) {
-	var configs Configs
-	f, err := os.Open(configFileName)
-	if err != nil {
-		return Configs{}, fmt.Errorf("open cofiguration file error: %w", err)
-	}
-	reader := bufio.NewReader(f)
-	dec := json.NewDecoder(reader)
-	err = dec.Decode(&configs)
-	if err != nil {
-		return Configs{}, fmt.Errorf("parse cofiguration file error: %w", err)
+// GetAgentID - возвращает идентификатор агента.
+func (s *Settings) GetAgentID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.agentID
+}
+
+// SetAgentGroup - устанавливает группу агента, передаваемую серверу в заголовке repositories.AgentGroupHeader.
+func (s *Settings) SetAgentGroup(group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agentGroup = group
+}
+
+// GetAgentGroup - возвращает группу агента.
+func (s *Settings) GetAgentGroup() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.agentGroup
+}
+
+// NotifyConfigVersion - сообщает версию настроек агента, полученную в ответе сервера. Не блокируется,
+// если предыдущая версия ещё не обработана.
+func (s *Settings) NotifyConfigVersion(version string) {
+	select {
+	case s.configVersions <- version:
+	default:
 	}
+}
+
+// ConfigVersions - возвращает канал версий настроек агента, полученных в ответах сервера.
+func (s *Settings) ConfigVersions() <-chan string {
+	return s.configVersions
+}
 
-	return configs, nil
+// SetCryptoGrapher - функция для установки структуры шифрования и расшифровки.
+func (s *Settings) SetCryptoGrapher(c *encryption.Cryptographer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cryptoGrapher = *c
+}
+
+// GetCryptoGrapher - функция для получения структуры шифрования и расшифровки.
+func (s *Settings) GetCryptoGrapher() encryption.Cryptographer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cryptoGrapher
 }
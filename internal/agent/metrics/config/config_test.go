@@ -1,97 +1,86 @@
 package config
 
 import (
-	"fmt"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
 )
 
 func TestSetPollInterval(t *testing.T) {
-	assert.Equal(t, time.Duration(2), pollInterval)
-	SetPollInterval(10)
-	assert.Equal(t, time.Duration(10), pollInterval)
+	s := NewSettings()
+	assert.Equal(t, 2*time.Second, s.pollInterval)
+	s.SetPollInterval(10 * time.Second)
+	assert.Equal(t, 10*time.Second, s.pollInterval)
 }
 
 func TestGetPollInterval(t *testing.T) {
-	SetPollInterval(15)
-	assert.Equal(t, time.Duration(15), GetPollInterval())
+	s := NewSettings()
+	s.SetPollInterval(15 * time.Second)
+	assert.Equal(t, 15*time.Second, s.GetPollInterval())
 }
 
 func TestSetReportInterval(t *testing.T) {
-	assert.Equal(t, time.Duration(10), reportInterval)
-	SetReportInterval(20)
-	assert.Equal(t, time.Duration(20), reportInterval)
+	s := NewSettings()
+	assert.Equal(t, 10*time.Second, s.reportInterval)
+	s.SetReportInterval(20 * time.Second)
+	assert.Equal(t, 20*time.Second, s.reportInterval)
 }
 
 func TestGetReportInterval(t *testing.T) {
-	SetReportInterval(30)
-	assert.Equal(t, time.Duration(30), GetReportInterval())
+	s := NewSettings()
+	s.SetReportInterval(30 * time.Second)
+	assert.Equal(t, 30*time.Second, s.GetReportInterval())
 }
 
 func TestSetContextTimeout(t *testing.T) {
-	assert.Equal(t, time.Duration(500*time.Millisecond), contextTimeout)
-	SetContextTimeout(700 * time.Millisecond)
-	assert.Equal(t, time.Duration(700*time.Millisecond), contextTimeout)
+	s := NewSettings()
+	assert.Equal(t, 500*time.Millisecond, s.contextTimeout)
+	s.SetContextTimeout(700 * time.Millisecond)
+	assert.Equal(t, 700*time.Millisecond, s.contextTimeout)
 }
 
 func TestGetContextTimeout(t *testing.T) {
-	SetContextTimeout(800 * time.Millisecond)
-	assert.Equal(t, time.Duration(800*time.Millisecond), GetContextTimeout())
+	s := NewSettings()
+	s.SetContextTimeout(800 * time.Millisecond)
+	assert.Equal(t, 800*time.Millisecond, s.GetContextTimeout())
 }
 
-func TestSyncCollectMetrics(t *testing.T) {
-	metrics := &storage.MetricsStats{}
-	SyncCollectMetrics(metrics)
-	assert.NotEqual(t, storage.MetricsStats{}, metrics)
+func TestSetKey(t *testing.T) {
+	s := NewSettings()
+	s.SetKey("secret")
+	assert.Equal(t, "secret", s.GetKey())
+}
+
+func TestSettingsAreIndependent(t *testing.T) {
+	first := NewSettings()
+	second := NewSettings()
+	first.SetAgentID("first")
+	first.NotifyConfigVersion("v1")
+	assert.Equal(t, "", second.GetAgentID())
+	select {
+	case <-second.ConfigVersions():
+		t.Fatal("version must be delivered only to settings, which received it")
+	default:
+	}
+	assert.Equal(t, "v1", <-first.ConfigVersions())
 }
 
 func TestSetCryptoGrapher(t *testing.T) {
+	s := NewSettings()
 	crypto := encryption.Initialize("/path/to/public/key", "/path/to/private/key")
-	SetCryptoGrapher(crypto)
+	s.SetCryptoGrapher(crypto)
 
-	assert.Equal(t, crypto.PublicKeyIsSet(), cryptoGrapher.PublicKeyIsSet())
+	assert.Equal(t, crypto.PublicKeyIsSet(), s.cryptoGrapher.PublicKeyIsSet())
 }
 
 func TestGetCryptoKey(t *testing.T) {
+	s := NewSettings()
 	crypto := encryption.Initialize("/path/to/public/key", "/path/to/private/key")
-	cryptoGrapher = *crypto
+	s.cryptoGrapher = *crypto
 
-	getCrypto := GetCryptoGrapher()
+	getCrypto := s.GetCryptoGrapher()
 	assert.Equal(t, crypto.PublicKeyIsSet(), getCrypto.PublicKeyIsSet())
 }
-
-func TestParseConfigFile(t *testing.T) {
-	testFlagNetAddr := "localhost:8081"
-	testReportInterval := 21
-	testPollInterval := 3
-	testFlagCryptoKey := "test crypto key"
-
-	createFile := func(name string) {
-		data := fmt.Sprintf("{\"address\": \"%s\",\"report_interval\": \"%ds\",\"poll_interval\": \"%ds\",\"crypto_key\": \"%s\"}",
-			testFlagNetAddr, testReportInterval, testPollInterval, testFlagCryptoKey)
-		f, err := os.Create(name)
-		require.NoError(t, err)
-		_, err = f.Write([]byte(data))
-		require.NoError(t, err)
-	}
-	nameFile := "./test_config.json"
-	createFile(nameFile)
-
-	configs, err := ParseConfigFile(nameFile)
-	require.NoError(t, err)
-
-	assert.Equal(t, testFlagNetAddr, configs.Address)
-	assert.Equal(t, testReportInterval, int(configs.ReportInterval.Seconds()))
-	assert.Equal(t, testPollInterval, int(configs.PollInterval.Seconds()))
-	assert.Equal(t, testFlagCryptoKey, configs.CryptoKey)
-
-	err = os.Remove(nameFile)
-	require.NoError(t, err)
-}
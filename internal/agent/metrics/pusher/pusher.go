@@ -4,65 +4,68 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
-// Push - отправляет метрику на сервер в JSON формате и возвращает ошибку при неудаче.
-func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, client *resty.Client) error {
-	metric, err := builder.Build(typeMetric, nameMetric, valueMetric)
-	if err != nil {
-		logger.AgentLog.Error("Build metric error", zap.String("error", error.Error(err)))
-		return err
-	}
+// Pusher - отправляет метрики на сервер с параметрами агента settings.
+type Pusher struct {
+	settings *config.Settings
+	log      *zap.Logger
+}
 
+// New - создаёт Pusher, который подписывает и шифрует данные согласно settings и пишет сообщения в log.
+func New(settings *config.Settings, log *zap.Logger) *Pusher {
+	return &Pusher{settings: settings, log: log}
+}
+
+// PushJSON - отправляет метрику на сервер в JSON формате и возвращает ошибку при неудаче.
+func (p *Pusher) PushJSON(address, action string, metric repositories.Metric, client *resty.Client) error {
 	// сериализую полученную струтктуру с метриками в json-представление  в виде слайса байт
 	var bufEncode bytes.Buffer
 	enc := json.NewEncoder(&bufEncode)
 	if err := enc.Encode(metric); err != nil {
-		logger.AgentLog.Error("Encode message error", zap.String("error", error.Error(err)))
+		p.log.Error("Encode message error", zap.String("error", error.Error(err)))
 		return err
 	}
 
 	// Сжатие данных для передачи
 	compressBody, err := compress.Compress(bufEncode.Bytes())
 	if err != nil {
-		logger.AgentLog.Error("Fail to comperess push data ", zap.String("error", error.Error(err)))
+		p.log.Error("Fail to comperess push data ", zap.String("error", error.Error(err)))
 		return err
 	}
 
 	// Шифрование сжатых данных если установлен путь к публичному ключу
-	crypto := config.GetCryptoGrapher()
+	crypto := p.settings.GetCryptoGrapher()
 	if crypto.PublicKeyIsSet() {
 		compressBody, err = crypto.Encrypt(compressBody)
 		if err != nil {
-			logger.AgentLog.Error("fail to encode compressed data ", zap.String("error", error.Error(err)))
+			p.log.Error("fail to encode compressed data ", zap.String("error", error.Error(err)))
 			return err
 		}
 	}
 
 	// Подписываю данные отправляемые на сервер
 	// Делаю не через middleware, чтобы агент подписывал именно нескомпресированный ответ
-	hash, err := repositories.CalkHash(bufEncode.Bytes(), hasher.GetKey())
+	hash, err := repositories.CalkHash(bufEncode.Bytes(), p.settings.GetKey())
 	if err != nil {
-		logger.AgentLog.Error("Fail to calc hash ", zap.String("error", error.Error(err)))
+		p.log.Error("Fail to calc hash ", zap.String("error", error.Error(err)))
 		return err
 	}
-	logger.AgentLog.Debug("body and hash for forwarding to server ", zap.String("body", fmt.Sprintf("%x", bufEncode.Bytes())),
-		zap.String("hash", hash), zap.String("key", hasher.GetKey()))
+	p.log.Debug("body and hash for forwarding to server ", zap.String("body", fmt.Sprintf("%x", bufEncode.Bytes())),
+		zap.String("hash", hash), zap.String("key", p.settings.GetKey()))
 
 	url := fmt.Sprintf("%s/%s", address, action)
 	resp, err := client.R().
@@ -74,26 +77,26 @@ func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, clien
 		Post(url)
 
 	if err != nil {
-		logger.AgentLog.Error("Push json metric to server error ", zap.String("error", error.Error(err)))
+		p.log.Error("Push json metric to server error ", zap.String("error", error.Error(err)))
 		return err
 	}
 
-	logger.AgentLog.Debug("Get answer from server", zap.String("Content-Encoding", resp.Header().Get("Content-Encoding")),
+	p.log.Debug("Get answer from server", zap.String("Content-Encoding", resp.Header().Get("Content-Encoding")),
 		zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())),
 		zap.String("Content-Type", resp.Header().Get("Content-Type")),
 		zap.String("HashSHA256", resp.Header().Get("HashSHA256")),
 		zap.String("Content-Encoding", fmt.Sprint(resp.Header().Values("Content-Encoding"))))
 
 	if resp.StatusCode() != http.StatusOK {
-		logger.AgentLog.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
-		return fmt.Errorf("status code is: %d %w", resp.StatusCode(), errors.New(resp.String()))
+		p.log.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
+		return checker.NewStatusError(resp.StatusCode(), resp.Header().Get("Retry-After"), resp.String())
 	}
 
 	contentEncoding := resp.Header().Get("Content-Encoding")
 	if strings.Contains(contentEncoding, "gzip") {
-		logger.AgentLog.Debug("Get compress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
+		p.log.Debug("Get compress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
 	} else {
-		logger.AgentLog.Debug("Get uncompress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
+		p.log.Debug("Get uncompress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
 	}
 
 	responceMetric := resp.Body()
@@ -106,12 +109,12 @@ func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, clien
 	buRes := bytes.NewBuffer(responceMetric)
 	dec := json.NewDecoder(buRes)
 	if err := dec.Decode(&resJSON); err != nil {
-		logger.AgentLog.Error("decode decompress data from server error ", zap.String("error", error.Error(err)))
+		p.log.Error("decode decompress data from server error ", zap.String("error", error.Error(err)))
 		return err
 	}
-	logger.AgentLog.Debug(fmt.Sprintf("decode metric from server %s", resJSON.String()))
+	p.log.Debug(fmt.Sprintf("decode metric from server %s", resJSON.String()))
 
-	logger.AgentLog.Debug(fmt.Sprintf("Success push metric in JSON format: typeMetric - %s, nameMetric - %s, valueMetric - %s", typeMetric, nameMetric, valueMetric))
+	p.log.Debug(fmt.Sprintf("Success push metric in JSON format: %s", metric.String()))
 	return nil
 }
 
@@ -127,70 +130,100 @@ func Push(address, action, typemetric, namemetric, valuemetric string, client *r
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("received non-200 response status: %d for url: %s", resp.StatusCode(), url)
+		return fmt.Errorf("error with post: %s, %w", url, checker.NewStatusError(resp.StatusCode(), resp.Header().Get("Retry-After"), resp.String()))
 	}
 	return nil
 }
 
 // PushAll - отправляет все собранные метрики на сервер, поочередно отправляя каждую метрику по отдельности.
-func PushAll(address, action string, metrics *storage.MetricsStats, client *resty.Client) {
+func (p *Pusher) PushAll(address, action string, metrics *storage.MetricsStats, client *resty.Client) {
+	metricsSlice := p.collect(metrics)
+	sent := make([]repositories.Metric, 0, len(metricsSlice))
+	for _, metric := range metricsSlice {
+		if err := p.PushJSON(address, action, metric, client); err != nil {
+			p.log.Error(fmt.Sprintf("Failed to push metric %s: %v\n", metric.ID, err), zap.String("action", "push metrics"))
+			continue
+		}
+		sent = append(sent, metric)
+	}
+	commit(metrics, sent)
+}
+
+// collect - копирует собранные и пользовательские метрики под блокировкой metrics, чтобы отправлять их без блокировки
+// и не задерживать сбор новых значений на время запроса к серверу.
+func (p *Pusher) collect(metrics *storage.MetricsStats) []repositories.Metric {
 	metrics.Lock()
 	defer metrics.Unlock()
 
-	for _, metricName := range storage.AllMetrics {
-		typeMetric, value, err := metrics.GetMetricString(metricName)
+	metricsSlice := make([]repositories.Metric, 0)
+	for _, metricName := range metrics.EnabledMetrics() {
+		metric, err := metrics.GetMetric(metricName)
 		if err != nil {
-			logger.AgentLog.Error(fmt.Sprintf("Failed to get metric %s: %v\n", typeMetric, err), zap.String("action", "push metrics"))
+			p.log.Error(fmt.Sprintf("Failed to get metric %s: %v\n", metricName, err), zap.String("action", "push metrics"))
 			continue
 		}
-		er := PushJSON(address, action, typeMetric, metricName, value, client)
-		if er != nil {
-			logger.AgentLog.Error(fmt.Sprintf("Failed to push metric %s: %v\n", typeMetric, er), zap.String("action", "push metrics"))
+		metricsSlice = append(metricsSlice, metric)
+	}
+	return append(metricsSlice, metrics.CustomMetrics()...)
+}
+
+// commit - вычитает из metrics отправленные на сервер наблюдения гистограмм и значения пользовательских счётчиков,
+// сервер объединяет их с хранимыми. Значения, накопленные во время отправки, будут отправлены в следующий раз.
+func commit(metrics *storage.MetricsStats, sent []repositories.Metric) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	for _, metric := range sent {
+		switch {
+		case metric.MType == "histogram" && metric.Histogram != nil:
+			metrics.SubtractHistogram(metric.ID, *metric.Histogram)
+		case metric.MType == "counter" && metric.Delta != nil && !slices.Contains(storage.AllMetrics, metric.ID):
+			metrics.SubtractCounter(metric.ID, *metric.Delta)
 		}
 	}
 }
 
-// PushBatch - отправляет батч метрик на сервер.
-func PushBatch(address, action string, metricsSlice []repositories.Metric, client *resty.Client) error {
+// PushBatch - отправляет батч метрик на сервер. Запрос прерывается отменой контекста ctx.
+func (p *Pusher) PushBatch(ctx context.Context, address, action string, metricsSlice []repositories.Metric, client *resty.Client) error {
 
 	// сериализую полученную слайс с метриками в json-представление  в виде слайса байт
 	var bufEncode bytes.Buffer
 	enc := json.NewEncoder(&bufEncode)
 	if err := enc.Encode(metricsSlice); err != nil {
-		logger.AgentLog.Error("Encode message error", zap.String("error", error.Error(err)))
+		p.log.Error("Encode message error", zap.String("error", error.Error(err)))
 		return err
 	}
 
 	// Сжатие данных для передачи
 	compressBody, err := compress.Compress(bufEncode.Bytes())
 	if err != nil {
-		logger.AgentLog.Error("Fail to comperess push data ", zap.String("error", error.Error(err)))
+		p.log.Error("Fail to comperess push data ", zap.String("error", error.Error(err)))
 		return err
 	}
 
 	// Шифрование сжатых данных если установлен путь к публичному ключу
-	crypto := config.GetCryptoGrapher()
+	crypto := p.settings.GetCryptoGrapher()
 	if crypto.PublicKeyIsSet() {
 		compressBody, err = crypto.Encrypt(compressBody)
 		if err != nil {
-			logger.AgentLog.Error("fail to encode compressed data ", zap.String("error", error.Error(err)))
+			p.log.Error("fail to encode compressed data ", zap.String("error", error.Error(err)))
 			return err
 		}
 	}
 
 	// Создаю контекст с таймаутом
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetContextTimeout())
+	ctx, cancel := context.WithTimeout(ctx, p.settings.GetContextTimeout())
 	defer cancel()
 
 	// Подписываю данные отправляемые на сервер
 	// Делаю не через middleware, чтобы агент подписывал именно нескомпресированный ответ
-	hash, err := repositories.CalkHash(bufEncode.Bytes(), hasher.GetKey())
+	hash, err := repositories.CalkHash(bufEncode.Bytes(), p.settings.GetKey())
 	if err != nil {
-		logger.AgentLog.Error("Fail to calc hash ", zap.String("error", error.Error(err)))
+		p.log.Error("Fail to calc hash ", zap.String("error", error.Error(err)))
 		return err
 	}
-	logger.AgentLog.Debug("body and hash for forwarding to server ", zap.String("body", fmt.Sprintf("%x", bufEncode.Bytes())),
-		zap.String("hash", hash), zap.String("key", hasher.GetKey()))
+	p.log.Debug("body and hash for forwarding to server ", zap.String("body", fmt.Sprintf("%x", bufEncode.Bytes())),
+		zap.String("hash", hash), zap.String("key", p.settings.GetKey()))
 
 	url := fmt.Sprintf("%s/%s", address, action)
 	resp, err := client.R().
@@ -203,25 +236,29 @@ func PushBatch(address, action string, metricsSlice []repositories.Metric, clien
 		Post(url)
 
 	if err != nil {
-		logger.AgentLog.Error("Push batch json metrics to server error ", zap.String("error", error.Error(err)))
+		p.log.Error("Push batch json metrics to server error ", zap.String("error", error.Error(err)))
 		return err
 	}
 
-	logger.AgentLog.Debug("Get answer from server", zap.String("Content-Encoding", resp.Header().Get("Content-Encoding")),
+	p.log.Debug("Get answer from server", zap.String("Content-Encoding", resp.Header().Get("Content-Encoding")),
 		zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())),
 		zap.String("Content-Type", resp.Header().Get("Content-Type")),
 		zap.String("HashSHA256", resp.Header().Get("HashSHA256")),
 		zap.String("Content-Encoding", fmt.Sprint(resp.Header().Values("Content-Encoding"))))
 
 	if resp.StatusCode() != http.StatusOK {
-		logger.AgentLog.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
-		return fmt.Errorf("status code is: %d %w", resp.StatusCode(), errors.New(resp.String()))
+		p.log.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
+		return checker.NewStatusError(resp.StatusCode(), resp.Header().Get("Retry-After"), resp.String())
 	}
 	contentEncoding := resp.Header().Get("Content-Encoding")
 	if strings.Contains(contentEncoding, "gzip") {
-		logger.AgentLog.Debug("Get compress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
+		p.log.Debug("Get compress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
 	} else {
-		logger.AgentLog.Debug("Get uncompress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
+		p.log.Debug("Get uncompress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
+	}
+	// сервер сообщает актуальную версию настроек агента, по ней агент узнаёт об их изменении
+	if version := resp.Header().Get(repositories.AgentConfigVersionHeader); version != "" {
+		p.settings.NotifyConfigVersion(version)
 	}
 
 	responceMetrics := resp.Body()
@@ -234,38 +271,22 @@ func PushBatch(address, action string, metricsSlice []repositories.Metric, clien
 	buRes := bytes.NewBuffer(responceMetrics)
 	dec := json.NewDecoder(buRes)
 	if err := dec.Decode(&resJSON); err != nil {
-		logger.AgentLog.Error("decode decompress data from server error ", zap.String("error", error.Error(err)))
+		p.log.Error("decode decompress data from server error ", zap.String("error", error.Error(err)))
 		return err
 	}
 
-	logger.AgentLog.Debug("Success push batch metrics in JSON format")
+	p.log.Debug("Success push batch metrics in JSON format")
 	return nil
 }
 
 // PrepareAndPushBatch - строит батч метрик и вызывает функцию для отправки батча на сервер в рамках одной передачи.
-func PrepareAndPushBatch(address, action string, metrics *storage.MetricsStats, client *resty.Client) error {
-	metrics.Lock()
-	defer metrics.Unlock()
-	metricsSlice := make([]repositories.Metric, 0)
-
-	// создаю слайс с метриками для отправки батчем
-	for _, metricName := range storage.AllMetrics {
-		typeMetric, value, err := metrics.GetMetricString(metricName)
-		if err != nil {
-			logger.AgentLog.Error(fmt.Sprintf("Failed to get metric %s: %v\n", typeMetric, err), zap.String("action", "push metrics"))
-			continue
-		}
-		metric, err := builder.Build(typeMetric, metricName, value)
-		if err != nil {
-			logger.AgentLog.Error(fmt.Sprintf("Failed to build metric structer %s: %v\n", typeMetric, err), zap.String("action", "push metrics"))
-			continue
-		}
-		metricsSlice = append(metricsSlice, metric)
-	}
-	err := PushBatch(address, action, metricsSlice, client)
+func (p *Pusher) PrepareAndPushBatch(ctx context.Context, address, action string, metrics *storage.MetricsStats, client *resty.Client) error {
+	metricsSlice := p.collect(metrics)
+	err := p.PushBatch(ctx, address, action, metricsSlice, client)
 	if err != nil {
-		logger.AgentLog.Error("Failed to push batch metrics", zap.String("action", "push metrics"), zap.String("error", error.Error(err)))
+		p.log.Error("Failed to push batch metrics", zap.String("action", "push metrics"), zap.String("error", error.Error(err)))
 		return err
 	}
+	commit(metrics, metricsSlice)
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
@@ -16,15 +17,24 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/mocks"
+	agentstorage "github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/agentconfig"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/compress"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/handlers"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
 )
 
+// newPusher - создаёт Pusher с параметрами агента по умолчанию.
+func newPusher() *Pusher {
+	return New(config.NewSettings(), zap.NewNop())
+}
+
 func TestPush(t *testing.T) {
 	stor := storage.NewDefaultMemStorage()
 
@@ -123,12 +133,16 @@ func TestPushJSON(t *testing.T) {
 	{
 		stor := storage.NewDefaultMemStorage()
 
+		deltaPointer := func(delta int64) *int64 {
+			return &delta
+		}
+		valuePointer := func(value float64) *float64 {
+			return &value
+		}
 		type args struct {
-			action      string
-			typeMetric  string
-			nameMetric  string
-			valueMetric string
-			client      *resty.Client
+			action string
+			metric repositories.Metric
+			client *resty.Client
 		}
 		tests := []struct {
 			name     string
@@ -139,11 +153,9 @@ func TestPushJSON(t *testing.T) {
 			{
 				name: "Count #1",
 				args: args{
-					action:      "update",
-					typeMetric:  "counter",
-					nameMetric:  "counter1",
-					valueMetric: "4",
-					client:      resty.New(),
+					action: "update",
+					metric: repositories.Metric{ID: "counter1", MType: "counter", Delta: deltaPointer(4)},
+					client: resty.New(),
 				},
 				wantStor: storage.NewMemStorage(nil, map[string]int64{"counter1": 4}),
 				wantErr:  false,
@@ -151,11 +163,9 @@ func TestPushJSON(t *testing.T) {
 			{
 				name: "Count error #1",
 				args: args{
-					action:      "update",
-					typeMetric:  "wrangtype",
-					nameMetric:  "counter1",
-					valueMetric: "4",
-					client:      resty.New(),
+					action: "update",
+					metric: repositories.Metric{ID: "counter1", MType: "wrangtype", Delta: deltaPointer(4)},
+					client: resty.New(),
 				},
 				wantStor: storage.NewMemStorage(nil, map[string]int64{"counter1": 4}),
 				wantErr:  true,
@@ -163,11 +173,9 @@ func TestPushJSON(t *testing.T) {
 			{
 				name: "Gauge #1",
 				args: args{
-					action:      "update",
-					typeMetric:  "gauge",
-					nameMetric:  "gauge1",
-					valueMetric: "3.14",
-					client:      resty.New(),
+					action: "update",
+					metric: repositories.Metric{ID: "gauge1", MType: "gauge", Value: valuePointer(3.14)},
+					client: resty.New(),
 				},
 				wantStor: storage.NewMemStorage(map[string]float64{"gauge1": 3.14}, map[string]int64{"counter1": 4}),
 				wantErr:  false,
@@ -175,11 +183,9 @@ func TestPushJSON(t *testing.T) {
 			{
 				name: "Gauge error #1",
 				args: args{
-					action:      "update",
-					typeMetric:  "wrangtype",
-					nameMetric:  "gauge1",
-					valueMetric: "3.14",
-					client:      resty.New(),
+					action: "update",
+					metric: repositories.Metric{ID: "gauge1", MType: "wrangtype", Value: valuePointer(3.14)},
+					client: resty.New(),
 				},
 				wantStor: storage.NewMemStorage(map[string]float64{"gauge1": 3.14}, map[string]int64{"counter1": 4}),
 				wantErr:  true,
@@ -194,7 +200,7 @@ func TestPushJSON(t *testing.T) {
 				ts := httptest.NewServer(r)
 				defer ts.Close()
 
-				if err := PushJSON(ts.URL, tt.args.action, tt.args.typeMetric, tt.args.nameMetric, tt.args.valueMetric, tt.args.client); (err != nil) != tt.wantErr {
+				if err := newPusher().PushJSON(ts.URL, tt.args.action, tt.args.metric, tt.args.client); (err != nil) != tt.wantErr {
 					t.Errorf("PushJSON() error = %v, wantErr %v", err, tt.wantErr)
 				}
 				wantAll, err := tt.wantStor.GetAllMetrics(context.Background())
@@ -308,7 +314,7 @@ func TestPushJSON(t *testing.T) {
 				ts := httptest.NewServer(r)
 				defer ts.Close()
 
-				err := PushJSON(ts.URL, "update", tt.args.metric.MType, tt.args.metric.ID, "123", tt.args.client)
+				err := newPusher().PushJSON(ts.URL, "update", tt.args.metric, tt.args.client)
 
 				if tt.wantErr == true {
 					require.Error(t, err)
@@ -420,7 +426,7 @@ func TestPushBatch(t *testing.T) {
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
-			err := PushBatch(ts.URL, "updates/", tt.args.metricsSlice, tt.args.client)
+			err := newPusher().PushBatch(context.Background(), ts.URL, "updates/", tt.args.metricsSlice, tt.args.client)
 
 			if tt.wantErr == true {
 				require.Error(t, err)
@@ -429,3 +435,86 @@ func TestPushBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestPushBatchConfigVersion(t *testing.T) {
+	store := agentconfig.NewStore(agentconfig.Configs{Default: repositories.AgentConfig{RateLimit: 2}})
+
+	r := chi.NewRouter()
+	r.With(store.VersionMiddleware).Post("/updates/", compress.GzipMiddleware(handlers.UpdateMetricsBatchHandler(storage.NewDefaultMemStorage())))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	p := newPusher()
+	delta := int64(1)
+	err := p.PushBatch(context.Background(), ts.URL, "updates/", []repositories.Metric{{ID: "PollCount", MType: "counter", Delta: &delta}}, resty.New())
+	require.NoError(t, err)
+
+	select {
+	case version := <-p.settings.ConfigVersions():
+		assert.Equal(t, store.Get().Resolve("", "").Version, version)
+	default:
+		t.Fatal("config version from server response is not notified")
+	}
+}
+
+func TestPrepareAndPushBatchCustomMetrics(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	r := chi.NewRouter()
+	r.Post("/updates/", compress.GzipMiddleware(handlers.UpdateMetricsBatchHandler(stor)))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	metrics := agentstorage.NewMetricsStats()
+	require.NoError(t, metrics.SetGauge("QueueLength", 7))
+	require.NoError(t, metrics.AddCounter("Requests", 5))
+	require.NoError(t, newPusher().PrepareAndPushBatch(context.Background(), ts.URL, "updates/", metrics, resty.New()))
+
+	// пользовательские метрики отправляются вместе с собранными агентом
+	value, err := stor.GetMetric(context.Background(), "gauge", "QueueLength")
+	require.NoError(t, err)
+	assert.Equal(t, "7", value)
+	value, err = stor.GetMetric(context.Background(), "counter", "Requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+
+	// отправленный счётчик сбрасывается и не учитывается сервером повторно
+	require.NoError(t, newPusher().PrepareAndPushBatch(context.Background(), ts.URL, "updates/", metrics, resty.New()))
+	value, err = stor.GetMetric(context.Background(), "counter", "Requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+}
+
+func TestPrepareAndPushBatchDoesNotBlockMetrics(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	metrics := agentstorage.NewMetricsStats()
+	require.NoError(t, metrics.AddCounter("Requests", 5))
+
+	// во время запроса к серверу метрики изменяются без ожидания окончания отправки
+	batch := compress.GzipMiddleware(handlers.UpdateMetricsBatchHandler(stor))
+	r := chi.NewRouter()
+	r.Post("/updates/", func(w http.ResponseWriter, req *http.Request) {
+		done := make(chan error, 1)
+		go func() { done <- metrics.AddCounter("Requests", 2) }()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Error("metrics are locked during push")
+		}
+		batch(w, req)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, newPusher().PrepareAndPushBatch(context.Background(), ts.URL, "updates/", metrics, resty.New()))
+	value, err := stor.GetMetric(context.Background(), "counter", "Requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+
+	// значение, накопленное во время отправки, не теряется
+	metrics.Lock()
+	custom := metrics.CustomMetrics()
+	metrics.Unlock()
+	require.Len(t, custom, 1)
+	assert.Equal(t, int64(2), *custom[0].Delta)
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories (interfaces: ServerRepo)
+// Source: github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories (interfaces: IStorage)
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -7,13 +7,14 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 
 	repositories "github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
-// MockServerRepo is a mock of ServerRepo interface.
+// MockServerRepo is a mock of IStorage interface.
 type MockServerRepo struct {
 	ctrl     *gomock.Controller
 	recorder *MockServerRepoMockRecorder
@@ -64,6 +65,20 @@ func (mr *MockServerRepoMockRecorder) AddGauge(arg0, arg1, arg2 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGauge", reflect.TypeOf((*MockServerRepo)(nil).AddGauge), arg0, arg1, arg2)
 }
 
+// AddHistogram mocks base method.
+func (m *MockServerRepo) AddHistogram(arg0 context.Context, arg1 string, arg2 repositories.Histogram) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddHistogram", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddHistogram indicates an expected call of AddHistogram.
+func (mr *MockServerRepoMockRecorder) AddHistogram(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddHistogram", reflect.TypeOf((*MockServerRepo)(nil).AddHistogram), arg0, arg1, arg2)
+}
+
 // AddMetricsFromSlice mocks base method.
 func (m *MockServerRepo) AddMetricsFromSlice(arg0 context.Context, arg1 []repositories.Metric) error {
 	m.ctrl.T.Helper()
@@ -78,6 +93,20 @@ func (mr *MockServerRepoMockRecorder) AddMetricsFromSlice(arg0, arg1 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMetricsFromSlice", reflect.TypeOf((*MockServerRepo)(nil).AddMetricsFromSlice), arg0, arg1)
 }
 
+// AddRollups mocks base method.
+func (m *MockServerRepo) AddRollups(arg0 context.Context, arg1 string, arg2 time.Duration, arg3 []repositories.Rollup) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRollups", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRollups indicates an expected call of AddRollups.
+func (mr *MockServerRepoMockRecorder) AddRollups(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRollups", reflect.TypeOf((*MockServerRepo)(nil).AddRollups), arg0, arg1, arg2, arg3)
+}
+
 // Bootstrap mocks base method.
 func (m *MockServerRepo) Bootstrap(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -92,6 +121,81 @@ func (mr *MockServerRepoMockRecorder) Bootstrap(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Bootstrap", reflect.TypeOf((*MockServerRepo)(nil).Bootstrap), arg0)
 }
 
+// CountMetrics mocks base method.
+func (m *MockServerRepo) CountMetrics(arg0 context.Context, arg1 repositories.MetricsFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountMetrics indicates an expected call of CountMetrics.
+func (mr *MockServerRepoMockRecorder) CountMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMetrics", reflect.TypeOf((*MockServerRepo)(nil).CountMetrics), arg0, arg1)
+}
+
+// DeleteHistoryBefore mocks base method.
+func (m *MockServerRepo) DeleteHistoryBefore(arg0 context.Context, arg1 time.Duration, arg2 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteHistoryBefore", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteHistoryBefore indicates an expected call of DeleteHistoryBefore.
+func (mr *MockServerRepoMockRecorder) DeleteHistoryBefore(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteHistoryBefore", reflect.TypeOf((*MockServerRepo)(nil).DeleteHistoryBefore), arg0, arg1, arg2)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockServerRepo) DeleteMetrics(arg0 context.Context, arg1 repositories.MetricsFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockServerRepoMockRecorder) DeleteMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockServerRepo)(nil).DeleteMetrics), arg0, arg1)
+}
+
+// DeleteStaleMetrics mocks base method.
+func (m *MockServerRepo) DeleteStaleMetrics(arg0 context.Context, arg1 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteStaleMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteStaleMetrics indicates an expected call of DeleteStaleMetrics.
+func (mr *MockServerRepoMockRecorder) DeleteStaleMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteStaleMetrics", reflect.TypeOf((*MockServerRepo)(nil).DeleteStaleMetrics), arg0, arg1)
+}
+
+// GetAllMetadata mocks base method.
+func (m *MockServerRepo) GetAllMetadata(arg0 context.Context) ([]repositories.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllMetadata", arg0)
+	ret0, _ := ret[0].([]repositories.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllMetadata indicates an expected call of GetAllMetadata.
+func (mr *MockServerRepoMockRecorder) GetAllMetadata(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetadata", reflect.TypeOf((*MockServerRepo)(nil).GetAllMetadata), arg0)
+}
+
 // GetAllMetrics mocks base method.
 func (m *MockServerRepo) GetAllMetrics(arg0 context.Context) (string, error) {
 	m.ctrl.T.Helper()
@@ -122,6 +226,67 @@ func (mr *MockServerRepoMockRecorder) GetAllMetricsSlice(arg0 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetricsSlice", reflect.TypeOf((*MockServerRepo)(nil).GetAllMetricsSlice), arg0)
 }
 
+// GetHistogram mocks base method.
+func (m *MockServerRepo) GetHistogram(arg0 context.Context, arg1 string) (repositories.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", arg0, arg1)
+	ret0, _ := ret[0].(repositories.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockServerRepoMockRecorder) GetHistogram(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockServerRepo)(nil).GetHistogram), arg0, arg1)
+}
+
+// GetHistory mocks base method.
+func (m *MockServerRepo) GetHistory(arg0 context.Context, arg1 string, arg2, arg3 time.Time) ([]repositories.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]repositories.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockServerRepoMockRecorder) GetHistory(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockServerRepo)(nil).GetHistory), arg0, arg1, arg2, arg3)
+}
+
+// GetLastRollup mocks base method.
+func (m *MockServerRepo) GetLastRollup(arg0 context.Context, arg1 string, arg2 time.Duration) (repositories.Rollup, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastRollup", arg0, arg1, arg2)
+	ret0, _ := ret[0].(repositories.Rollup)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLastRollup indicates an expected call of GetLastRollup.
+func (mr *MockServerRepoMockRecorder) GetLastRollup(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastRollup", reflect.TypeOf((*MockServerRepo)(nil).GetLastRollup), arg0, arg1, arg2)
+}
+
+// GetMetadata mocks base method.
+func (m *MockServerRepo) GetMetadata(arg0 context.Context, arg1 string) (repositories.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetadata", arg0, arg1)
+	ret0, _ := ret[0].(repositories.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetadata indicates an expected call of GetMetadata.
+func (mr *MockServerRepoMockRecorder) GetMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadata", reflect.TypeOf((*MockServerRepo)(nil).GetMetadata), arg0, arg1)
+}
+
 // GetMetric mocks base method.
 func (m *MockServerRepo) GetMetric(arg0 context.Context, arg1, arg2 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -136,3 +301,47 @@ func (mr *MockServerRepoMockRecorder) GetMetric(arg0, arg1, arg2 interface{}) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockServerRepo)(nil).GetMetric), arg0, arg1, arg2)
 }
+
+// GetRollups mocks base method.
+func (m *MockServerRepo) GetRollups(arg0 context.Context, arg1 string, arg2 time.Duration, arg3, arg4 time.Time) ([]repositories.Rollup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRollups", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]repositories.Rollup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRollups indicates an expected call of GetRollups.
+func (mr *MockServerRepoMockRecorder) GetRollups(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRollups", reflect.TypeOf((*MockServerRepo)(nil).GetRollups), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListMetrics mocks base method.
+func (m *MockServerRepo) ListMetrics(arg0 context.Context, arg1 repositories.MetricsFilter) ([]repositories.Metric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]repositories.Metric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockServerRepoMockRecorder) ListMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockServerRepo)(nil).ListMetrics), arg0, arg1)
+}
+
+// SetMetadata mocks base method.
+func (m *MockServerRepo) SetMetadata(arg0 context.Context, arg1 repositories.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMetadata indicates an expected call of SetMetadata.
+func (mr *MockServerRepoMockRecorder) SetMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetadata", reflect.TypeOf((*MockServerRepo)(nil).SetMetadata), arg0, arg1)
+}
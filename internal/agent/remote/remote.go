@@ -0,0 +1,195 @@
+// Packet remote implement receiving of agent settings from the server and applying them without restart of the agent.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ConfigPath - путь запроса настроек агента на сервере.
+const ConfigPath = "/api/v1/agent/config"
+
+// Updater - получает настройки агента с сервера и применяет их к работающему агенту.
+type Updater struct {
+	address  string                   // адрес сервера, например http://localhost:8080
+	metrics  *storage.MetricsStats    // метрики агента, у которых включаются и выключаются сборщики
+	client   *resty.Client            // клиент для запроса настроек
+	settings *config.Settings         // параметры агента, которые меняют настройки сервера
+	sender   *worker.Sender           // отправитель метрик, у которого меняется количество одновременных отправок
+	log      *zap.Logger              // логер агента
+	mu       sync.Mutex               // защищает применённые настройки
+	baseline repositories.AgentConfig // локальные настройки агента, действующие, пока сервер их не переопределил
+	remote   repositories.AgentConfig // применённые настройки сервера
+	version  string                   // версия применённых настроек сервера
+}
+
+// New - фабричная функция структуры Updater. Текущие настройки агента запоминаются как локальные,
+// поэтому New вызывается после установки параметров запуска.
+func New(address string, metrics *storage.MetricsStats, settings *config.Settings, sender *worker.Sender, log *zap.Logger) *Updater {
+	u := &Updater{
+		address:  address,
+		metrics:  metrics,
+		client:   resty.New(),
+		settings: settings,
+		sender:   sender,
+		log:      log,
+	}
+	u.baseline = u.localConfig()
+	// подпись настроек проверяется действующим ключом агента, который может измениться при перезагрузке конфигурации
+	u.client.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+		return hasher.VerifyHashMiddleware(u.settings.GetKey(), u.log)(c, resp)
+	})
+	return u
+}
+
+// localConfig - возвращает текущие настройки агента.
+func (u *Updater) localConfig() repositories.AgentConfig {
+	return repositories.AgentConfig{
+		ReportInterval: repositories.Duration{Duration: u.settings.GetReportInterval()},
+		PollInterval:   repositories.Duration{Duration: u.settings.GetPollInterval()},
+		RateLimit:      u.sender.GetConcurrency(),
+	}
+}
+
+// Version - возвращает версию применённых настроек сервера.
+func (u *Updater) Version() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.version
+}
+
+// Fetch - запрашивает настройки агента с сервера. Если задан ключ, ответ сервера должен быть подписан им,
+// иначе возвращается ошибка и настройки не применяются. Если настройки не изменились с последнего применения,
+// возвращает false.
+func (u *Updater) Fetch(ctx context.Context) (repositories.AgentConfig, bool, error) {
+	req := u.client.R().SetContext(ctx)
+	// сервер подписывает ответ только на подписанный запрос, у запроса без тела подписывается пустое тело
+	if key := u.settings.GetKey(); key != "" {
+		hash, err := repositories.CalkHash(nil, key)
+		if err != nil {
+			return repositories.AgentConfig{}, false, fmt.Errorf("calc hash error: %w", err)
+		}
+		req.SetHeader("HashSHA256", hash)
+	}
+	if id := u.settings.GetAgentID(); id != "" {
+		req.SetHeader(repositories.AgentIDHeader, id)
+	}
+	if group := u.settings.GetAgentGroup(); group != "" {
+		req.SetHeader(repositories.AgentGroupHeader, group)
+	}
+	version := u.Version()
+	if version != "" {
+		req.SetHeader("If-None-Match", `"`+version+`"`)
+	}
+	resp, err := req.Get(u.address + ConfigPath)
+	if err != nil {
+		return repositories.AgentConfig{}, false, fmt.Errorf("request agent config error: %w", err)
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusNotModified:
+		return repositories.AgentConfig{}, false, nil
+	case http.StatusOK:
+	default:
+		return repositories.AgentConfig{}, false, checker.NewStatusError(resp.StatusCode(), resp.Header().Get("Retry-After"), resp.String())
+	}
+
+	var remote repositories.AgentConfig
+	if err := json.Unmarshal(resp.Body(), &remote); err != nil {
+		return repositories.AgentConfig{}, false, fmt.Errorf("decode agent config error: %w", err)
+	}
+	return remote, remote.Version != version, nil
+}
+
+// Apply - применяет настройки сервера поверх локальных настроек агента. Незаданные сервером настройки
+// возвращаются к локальным. Некорректные настройки не применяются.
+func (u *Updater) Apply(remote repositories.AgentConfig) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.apply(remote)
+}
+
+// Rebase - запоминает текущие настройки агента как локальные и заново применяет поверх них настройки сервера.
+// Вызывается после изменения локальных настроек, например при перезагрузке файла конфигурации.
+func (u *Updater) Rebase() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.baseline = u.localConfig()
+	return u.apply(u.remote)
+}
+
+// apply - применяет настройки сервера поверх локальных настроек агента, вызывается под u.mu.
+func (u *Updater) apply(remote repositories.AgentConfig) error {
+	if err := remote.Validate(); err != nil {
+		return fmt.Errorf("invalid agent config: %w", err)
+	}
+	merged := u.baseline.Merge(remote)
+	if err := u.metrics.SetCollectors(merged.Collectors); err != nil {
+		return fmt.Errorf("invalid agent config: %w", err)
+	}
+	u.settings.SetPollInterval(merged.PollInterval.Duration)
+	u.settings.SetReportInterval(merged.ReportInterval.Duration)
+	u.sender.SetConcurrency(merged.RateLimit)
+	u.remote = remote
+	u.version = remote.Version
+
+	u.log.Info("apply agent config from server", zap.String("version", remote.Version),
+		zap.Duration("pollInterval", merged.PollInterval.Duration), zap.Duration("reportInterval", merged.ReportInterval.Duration),
+		zap.Strings("collectors", merged.Collectors), zap.Int("rateLimit", merged.RateLimit))
+	return nil
+}
+
+// Update - запрашивает настройки агента с сервера и применяет их, если они изменились.
+func (u *Updater) Update(ctx context.Context) error {
+	remote, changed, err := u.Fetch(ctx)
+	if err != nil || !changed {
+		return err
+	}
+	return u.Apply(remote)
+}
+
+// Run - обновляет настройки агента с интервалом interval и после каждого ответа сервера с новой версией настроек,
+// пока не отменён контекст. Интервал 0 отключает периодический запрос настроек.
+func (u *Updater) Run(ctx context.Context, interval time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	update := func() {
+		if err := u.Update(ctx); err != nil {
+			u.log.Error("update agent config error", zap.String("error", error.Error(err)))
+		}
+	}
+	update()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			update()
+		case version := <-u.settings.ConfigVersions():
+			if version != u.Version() {
+				update()
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// configServer - тестовый сервер настроек агента, отвечающий 304 на запрос с актуальной версией.
+type configServer struct {
+	mu       sync.Mutex
+	config   repositories.AgentConfig
+	key      string // ключ подписи ответа, пустой - ответ не подписывается
+	requests atomic.Int32
+	headers  http.Header
+}
+
+func (s *configServer) set(config repositories.AgentConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+func (s *configServer) setKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+}
+
+func (s *configServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests.Add(1)
+	s.headers = req.Header.Clone()
+	if req.URL.Path != ConfigPath {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.Header.Get("If-None-Match") == `"`+s.config.Version+`"` {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, _ := json.Marshal(s.config)
+	if s.key != "" {
+		hash, _ := repositories.CalkHash(body, s.key)
+		res.Header().Set("HashSHA256", hash)
+	}
+	_, _ = res.Write(body)
+}
+
+// setup - создаёт параметры агента и отправителя метрик с локальными настройками для теста.
+func setup() (*config.Settings, *worker.Sender) {
+	settings := config.NewSettings()
+	sender := worker.NewSender(settings, zap.NewNop())
+	settings.SetPollInterval(2 * time.Second)
+	settings.SetReportInterval(10 * time.Second)
+	sender.SetConcurrency(1)
+	return settings, sender
+}
+
+func TestUpdate(t *testing.T) {
+	settings, sender := setup()
+	settings.SetAgentID("host-1")
+	settings.SetAgentGroup("edge")
+
+	srv := &configServer{config: repositories.AgentConfig{
+		Version:      "v1",
+		PollInterval: repositories.Duration{Duration: 5 * time.Second},
+		Collectors:   []string{storage.RuntimeCollector},
+		RateLimit:    4,
+	}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	metrics := storage.NewMetricsStats()
+	u := New(ts.URL, metrics, settings, sender, zap.NewNop())
+	require.NoError(t, u.Update(context.Background()))
+	assert.Equal(t, "v1", u.Version())
+	assert.Equal(t, 5*time.Second, settings.GetPollInterval())
+	assert.Equal(t, 10*time.Second, settings.GetReportInterval())
+	assert.Equal(t, 4, sender.GetConcurrency())
+	assert.NotContains(t, metrics.EnabledMetrics(), "CPUutilization1")
+	assert.Equal(t, "host-1", srv.headers.Get(repositories.AgentIDHeader))
+	assert.Equal(t, "edge", srv.headers.Get(repositories.AgentGroupHeader))
+
+	// неизменные настройки не запрашиваются повторно
+	_, changed, err := u.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// снятые сервером настройки возвращаются к локальным
+	srv.set(repositories.AgentConfig{Version: "v2", ReportInterval: repositories.Duration{Duration: 30 * time.Second}})
+	require.NoError(t, u.Update(context.Background()))
+	assert.Equal(t, "v2", u.Version())
+	assert.Equal(t, 2*time.Second, settings.GetPollInterval())
+	assert.Equal(t, 30*time.Second, settings.GetReportInterval())
+	assert.Equal(t, 1, sender.GetConcurrency())
+	assert.Equal(t, storage.AllMetrics, metrics.EnabledMetrics())
+}
+
+func TestApplyInvalid(t *testing.T) {
+	settings, sender := setup()
+	u := New("http://localhost", storage.NewMetricsStats(), settings, sender, zap.NewNop())
+
+	assert.Error(t, u.Apply(repositories.AgentConfig{Version: "v1", PollInterval: repositories.Duration{Duration: time.Millisecond}}))
+	assert.Error(t, u.Apply(repositories.AgentConfig{Version: "v1", Collectors: []string{"disk"}}))
+	assert.Equal(t, 2*time.Second, settings.GetPollInterval())
+	assert.Empty(t, u.Version())
+}
+
+func TestFetchError(t *testing.T) {
+	settings, sender := setup()
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u := New(ts.URL, storage.NewMetricsStats(), settings, sender, zap.NewNop())
+	assert.Error(t, u.Update(context.Background()))
+	assert.Equal(t, 2*time.Second, settings.GetPollInterval())
+}
+
+func TestFetchSigned(t *testing.T) {
+	settings, sender := setup()
+	settings.SetKey("secret")
+	srv := &configServer{config: repositories.AgentConfig{Version: "v1", RateLimit: 2}, key: "secret"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	u := New(ts.URL, storage.NewMetricsStats(), settings, sender, zap.NewNop())
+	require.NoError(t, u.Update(context.Background()))
+	assert.NotEmpty(t, srv.headers.Get("HashSHA256"))
+	assert.Equal(t, 2, sender.GetConcurrency())
+
+	// настройки с неверной подписью или без подписи не применяются
+	srv.set(repositories.AgentConfig{Version: "v2", RateLimit: 5})
+	srv.setKey("other")
+	require.Error(t, u.Update(context.Background()))
+	srv.setKey("")
+	require.Error(t, u.Update(context.Background()))
+	assert.Equal(t, 2, sender.GetConcurrency())
+	assert.Equal(t, "v1", u.Version())
+}
+
+func TestRun(t *testing.T) {
+	settings, sender := setup()
+	srv := &configServer{config: repositories.AgentConfig{Version: "v1", RateLimit: 2}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	u := New(ts.URL, storage.NewMetricsStats(), settings, sender, zap.NewNop())
+	// без периодического запроса настройки обновляются по версии из ответа сервера
+	go u.Run(ctx, 0, &wg)
+
+	require.Eventually(t, func() bool { return sender.GetConcurrency() == 2 }, time.Second, 10*time.Millisecond)
+	srv.set(repositories.AgentConfig{Version: "v2", RateLimit: 3})
+	settings.NotifyConfigVersion("v2")
+	require.Eventually(t, func() bool { return sender.GetConcurrency() == 3 }, time.Second, 10*time.Millisecond)
+
+	// уже применённая версия не запрашивается повторно
+	requests := srv.requests.Load()
+	settings.NotifyConfigVersion("v2")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, requests, srv.requests.Load())
+
+	cancel()
+	wg.Wait()
+}
+
+func TestRebase(t *testing.T) {
+	settings, sender := setup()
+	u := New("http://localhost", storage.NewMetricsStats(), settings, sender, zap.NewNop())
+	require.NoError(t, u.Apply(repositories.AgentConfig{Version: "v1", PollInterval: repositories.Duration{Duration: 5 * time.Second}, RateLimit: 4}))
+
+	// изменённые локальные настройки применяются, если сервер их не переопределил
+	settings.SetPollInterval(3 * time.Second)
+	settings.SetReportInterval(20 * time.Second)
+	sender.SetConcurrency(2)
+	require.NoError(t, u.Rebase())
+	assert.Equal(t, 5*time.Second, settings.GetPollInterval())
+	assert.Equal(t, 20*time.Second, settings.GetReportInterval())
+	assert.Equal(t, 4, sender.GetConcurrency())
+	assert.Equal(t, "v1", u.Version())
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrEmptyName - имя пользовательской метрики не задано.
+var ErrEmptyName = errors.New("metric name is empty")
+
+// AddCollector - добавляет пользовательский сборщик метрик, который вызывается при каждом сборе метрик CollectMetrics.
+// Сборщик устанавливает значения метрик методами SetGauge и AddCounter.
+func (metrics *MetricsStats) AddCollector(collect func()) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.customCollectors = append(metrics.customCollectors, collect)
+}
+
+// runCustomCollectors - вызывает пользовательские сборщики метрик.
+func (metrics *MetricsStats) runCustomCollectors() {
+	metrics.Lock()
+	collectors := slices.Clone(metrics.customCollectors)
+	metrics.Unlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+}
+
+// checkCustomName - проверяет, что имя name можно использовать для пользовательской метрики типа mType.
+// Вызывается под блокировкой metrics.
+func (metrics *MetricsStats) checkCustomName(name, mType string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if slices.Contains(AllMetrics, name) {
+		return fmt.Errorf("metric %s is collected by agent", name)
+	}
+	_, isGauge := metrics.customGauges[name]
+	_, isCounter := metrics.customCounters[name]
+	if (isGauge && mType != "gauge") || (isCounter && mType != "counter") {
+		return fmt.Errorf("metric %s is already registered with another type", name)
+	}
+	return nil
+}
+
+// SetGauge - устанавливает значение пользовательской метрики типа "gauge". Значение отправляется на сервер
+// при каждой отправке метрик, пока не будет изменено.
+func (metrics *MetricsStats) SetGauge(name string, value float64) error {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if err := metrics.checkCustomName(name, "gauge"); err != nil {
+		return err
+	}
+	if metrics.customGauges == nil {
+		metrics.customGauges = make(map[string]float64)
+	}
+	metrics.customGauges[name] = value
+	return nil
+}
+
+// AddCounter - увеличивает пользовательскую метрику типа "counter" на delta. Накопленное значение отправляется
+// на сервер и сбрасывается после успешной отправки, сервер суммирует полученные значения.
+func (metrics *MetricsStats) AddCounter(name string, delta int64) error {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if err := metrics.checkCustomName(name, "counter"); err != nil {
+		return err
+	}
+	if metrics.customCounters == nil {
+		metrics.customCounters = make(map[string]int64)
+	}
+	metrics.customCounters[name] += delta
+	return nil
+}
+
+// CustomMetrics - возвращает пользовательские метрики, отсортированные по имени. Вызывается под блокировкой metrics.
+func (metrics *MetricsStats) CustomMetrics() []repositories.Metric {
+	result := make([]repositories.Metric, 0, len(metrics.customGauges)+len(metrics.customCounters))
+	for name, value := range metrics.customGauges {
+		result = append(result, builder.Gauge(name, value))
+	}
+	for name, delta := range metrics.customCounters {
+		result = append(result, builder.Counter(name, delta))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// SubtractCounter - вычитает из пользовательской метрики типа "counter" значение delta после его успешной отправки
+// на сервер, чтобы оно не учитывалось повторно. Значение, накопленное во время отправки, сохраняется.
+// Вызывается под блокировкой metrics.
+func (metrics *MetricsStats) SubtractCounter(name string, delta int64) {
+	metrics.customCounters[name] -= delta
+	if metrics.customCounters[name] == 0 {
+		delete(metrics.customCounters, name)
+	}
+}
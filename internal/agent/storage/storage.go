@@ -2,32 +2,62 @@ package storage
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"runtime"
-	"strconv"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
 	"go.uber.org/zap"
-	"golang.org/x/exp/rand"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
 // GaugeMetrics - слайс метрик типа "gauge".
 var GaugeMetrics []string
 
+// HistogramMetrics - слайс метрик типа "histogram".
+var HistogramMetrics []string
+
 // AllMetrics - слайс метрик.
 var AllMetrics []string
 
+// GCPauseBounds - границы бакетов гистограммы длительностей пауз сборщика мусора в наносекундах.
+var GCPauseBounds = []float64{1e4, 5e4, 1e5, 2.5e5, 5e5, 1e6, 2.5e6, 5e6, 1e7, 2.5e7, 5e7, 1e8}
+
+// Сборщики метрик агента, которые можно включать и выключать без перезапуска агента.
+const (
+	RuntimeCollector  = "runtime"   // метрики runtime.MemStats, PollCount и RandomValue
+	SystemCollector   = "system"    // метрики памяти и процессора, собираемые пакетом gopsutil
+	GCPausesCollector = "gc_pauses" // гистограмма длительностей пауз сборщика мусора
+)
+
+// Collectors - все сборщики метрик агента.
+var Collectors = []string{RuntimeCollector, SystemCollector, GCPausesCollector}
+
+// collectorOf - возвращает сборщик, который собирает метрику name.
+func collectorOf(name string) string {
+	switch name {
+	case "TotalMemory", "FreeMemory", "CPUutilization1":
+		return SystemCollector
+	case "GCPauseNs":
+		return GCPausesCollector
+	}
+	return RuntimeCollector
+}
+
 func init() {
 	GaugeMetrics = []string{"Alloc", "BuckHashSys", "Frees", "GCCPUFraction", "GCSys", "HeapAlloc", "HeapIdle", "HeapInuse", "HeapObjects",
 		"HeapReleased", "HeapSys", "LastGC", "Lookups", "MCacheInuse", "MCacheSys", "MSpanInuse", "MSpanSys", "Mallocs", "NextGC", "NumForcedGC", "NumGC",
-		"OtherSys", "PauseTotalNs", "StackInuse", "StackSys", "Sys", "TotalAlloc", "TotalMemory", "FreeMemory", "CPUutilization1"}
+		"OtherSys", "PauseTotalNs", "StackInuse", "StackSys", "Sys", "TotalAlloc", "TotalMemory", "FreeMemory", "CPUutilization1", "RandomValue"}
 	AllMetrics = []string{"Alloc", "BuckHashSys", "Frees", "GCCPUFraction", "GCSys", "HeapAlloc", "HeapIdle", "HeapInuse", "HeapObjects",
 		"HeapReleased", "HeapSys", "LastGC", "Lookups", "MCacheInuse", "MCacheSys", "MSpanInuse", "MSpanSys", "Mallocs", "NextGC", "NumForcedGC", "NumGC",
-		"OtherSys", "PauseTotalNs", "StackInuse", "StackSys", "Sys", "TotalAlloc", "TotalMemory", "FreeMemory", "CPUutilization1", "PollCount", "RandomValue"}
+		"OtherSys", "PauseTotalNs", "StackInuse", "StackSys", "Sys", "TotalAlloc", "TotalMemory", "FreeMemory", "CPUutilization1", "PollCount", "RandomValue", "GCPauseNs"}
+	HistogramMetrics = []string{"GCPauseNs"}
 }
 
 // MetricsStats - структура для хранения метрик.
@@ -39,9 +69,67 @@ type MetricsStats struct {
 	TotalMemory     float64
 	FreeMemory      float64
 	CPUutilization1 float64
+	GCPauseNs       repositories.Histogram          // длительности пауз сборщика мусора, накопленные с последней отправки
+	lastNumGC       uint32                          // значение NumGC при предыдущем сборе метрик
+	collectors      atomic.Pointer[map[string]bool] // включённые сборщики метрик, nil - все сборщики
+	log             atomic.Pointer[zap.Logger]      // логер ошибок сбора метрик, nil - ошибки не логируются
+
+	customCollectors []func()           // пользовательские сборщики метрик
+	customGauges     map[string]float64 // пользовательские метрики типа "gauge"
+	customCounters   map[string]int64   // пользовательские метрики типа "counter", накопленные с последней отправки
+}
+
+// SetLogger - устанавливает логер, в который пишутся ошибки сбора метрик.
+func (metrics *MetricsStats) SetLogger(log *zap.Logger) {
+	metrics.log.Store(log)
+}
+
+// logger - возвращает логер ошибок сбора метрик.
+func (metrics *MetricsStats) logger() *zap.Logger {
+	if log := metrics.log.Load(); log != nil {
+		return log
+	}
+	return zap.NewNop()
+}
+
+// SetCollectors - включает только сборщики метрик names, пустой список включает все сборщики.
+func (metrics *MetricsStats) SetCollectors(names []string) error {
+	if len(names) == 0 {
+		metrics.collectors.Store(nil)
+		return nil
+	}
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !slices.Contains(Collectors, name) {
+			return fmt.Errorf("unknown collector %s", name)
+		}
+		enabled[name] = true
+	}
+	metrics.collectors.Store(&enabled)
+	return nil
+}
+
+// collectorEnabled - проверяет, включён ли сборщик метрик name.
+func (metrics *MetricsStats) collectorEnabled(name string) bool {
+	enabled := metrics.collectors.Load()
+	return enabled == nil || (*enabled)[name]
+}
+
+// EnabledMetrics - возвращает имена метрик из AllMetrics, собираемых включёнными сборщиками.
+func (metrics *MetricsStats) EnabledMetrics() []string {
+	if metrics.collectors.Load() == nil {
+		return AllMetrics
+	}
+	names := make([]string, 0, len(AllMetrics))
+	for _, name := range AllMetrics {
+		if metrics.collectorEnabled(collectorOf(name)) {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
-func collectExtraMetrics(ch chan<- map[string]float64) {
+func collectExtraMetrics(ch chan<- map[string]float64, log *zap.Logger) {
 	res := make(map[string]float64, 0)
 
 	v, err := mem.VirtualMemory()
@@ -49,29 +137,39 @@ func collectExtraMetrics(ch chan<- map[string]float64) {
 		res["TotalMemory"] = float64(v.Total)
 		res["FreeMemory"] = float64(v.Free)
 	} else {
-		logger.AgentLog.Error("collect memory metrics error by gopsutil package", zap.String("error", err.Error()))
+		log.Error("collect memory metrics error by gopsutil package", zap.String("error", err.Error()))
 	}
 
 	c, err := cpu.Percent(time.Second, true)
 	if err == nil {
 		res["CPUutilization1"] = float64(c[0])
 	} else {
-		logger.AgentLog.Error("collect cpu metrics error by gopsutil package", zap.String("error", err.Error()))
+		log.Error("collect cpu metrics error by gopsutil package", zap.String("error", err.Error()))
 	}
 	ch <- res
 }
 
-// CollectMetrics - собирает метрики.
+// CollectMetrics - собирает метрики включённых сборщиков и пользовательских сборщиков.
 func (metrics *MetricsStats) CollectMetrics() {
-	// Сбор дополнительных метрик в отдельной горутине
+	metrics.runCustomCollectors()
+
+	// Сбор дополнительных метрик в отдельной горутине, сбор загрузки процессора занимает секунду
 	extraM := make(chan map[string]float64, 1)
-	go collectExtraMetrics(extraM)
+	if metrics.collectorEnabled(SystemCollector) {
+		go collectExtraMetrics(extraM, metrics.logger())
+	} else {
+		extraM <- nil
+	}
 
 	metrics.Lock()
 	defer metrics.Unlock()
 
 	metrics.PollCount = 1
+	metrics.RandomValue = rand.Float64()
 	runtime.ReadMemStats(&metrics.MemStats)
+	if metrics.collectorEnabled(GCPausesCollector) {
+		metrics.observeGCPauses()
+	}
 
 	extraMetrics := <-extraM
 	for name, value := range extraMetrics {
@@ -86,86 +184,122 @@ func (metrics *MetricsStats) CollectMetrics() {
 	}
 }
 
-// GetRandomMetricName - вспомогательная функция для генерации метрики "RandomValue"
-func GetRandomMetricName() string {
-	// Инициализируем случайный источник с текущим временем
-	rand.Seed(uint64(time.Now().UnixNano()))
-	// Выбираем случайный индекс
-	randomIndex := rand.Intn(len(GaugeMetrics))
-	// Выбираем случайный элемент
-	return GaugeMetrics[randomIndex]
+// observeGCPauses - добавляет в гистограмму GCPauseNs паузы сборщика мусора, произошедшие с предыдущего сбора метрик.
+// MemStats.PauseNs - кольцевой буфер, поэтому учитываются не более len(PauseNs) последних пауз.
+func (metrics *MetricsStats) observeGCPauses() {
+	if metrics.GCPauseNs.Counts == nil {
+		metrics.GCPauseNs = repositories.NewHistogram(GCPauseBounds)
+	}
+	newGC := metrics.NumGC - metrics.lastNumGC
+	if newGC > uint32(len(metrics.PauseNs)) {
+		newGC = uint32(len(metrics.PauseNs))
+	}
+	for i := uint32(0); i < newGC; i++ {
+		// самая свежая пауза хранится в PauseNs[(NumGC+255)%256]
+		idx := (metrics.NumGC + uint32(len(metrics.PauseNs)) - 1 - i) % uint32(len(metrics.PauseNs))
+		metrics.GCPauseNs.Observe(float64(metrics.PauseNs[idx]))
+	}
+	metrics.lastNumGC = metrics.NumGC
+}
+
+// ResetHistogram - очищает гистограмму после её успешной отправки на сервер, чтобы наблюдения не учитывались повторно.
+func (metrics *MetricsStats) ResetHistogram(name string) {
+	if name == "GCPauseNs" {
+		metrics.GCPauseNs = repositories.NewHistogram(GCPauseBounds)
+	}
 }
 
-// GetMetricString - возвращает тип и значение метрики в виде строки по имени метрики.
-func (metrics *MetricsStats) GetMetricString(name string) (typeMetric, value string, err error) {
+// SubtractHistogram - исключает из гистограммы name наблюдения sent после их успешной отправки на сервер, чтобы они
+// не учитывались повторно. Наблюдения, добавленные во время отправки, сохраняются. Вызывается под блокировкой metrics.
+func (metrics *MetricsStats) SubtractHistogram(name string, sent repositories.Histogram) {
+	if name != "GCPauseNs" || metrics.GCPauseNs.Counts == nil {
+		return
+	}
+	rest, err := metrics.GCPauseNs.Subtract(sent)
+	if err != nil {
+		metrics.logger().Error("subtract sent histogram error", zap.String("name", name), zap.String("error", error.Error(err)))
+		metrics.ResetHistogram(name)
+		return
+	}
+	metrics.GCPauseNs = rest
+}
+
+// GetMetric - возвращает типизированную метрику по её имени.
+// Значения передаются без промежуточного преобразования в строку, поэтому не теряют точность.
+func (metrics *MetricsStats) GetMetric(name string) (repositories.Metric, error) {
 	switch name {
 	case "Alloc":
-		return "gauge", strconv.FormatUint(metrics.Alloc, 10), nil
+		return builder.Gauge(name, float64(metrics.Alloc)), nil
 	case "BuckHashSys":
-		return "gauge", strconv.FormatUint(metrics.BuckHashSys, 10), nil
+		return builder.Gauge(name, float64(metrics.BuckHashSys)), nil
 	case "Frees":
-		return "gauge", strconv.FormatUint(metrics.Frees, 10), nil
+		return builder.Gauge(name, float64(metrics.Frees)), nil
 	case "GCCPUFraction":
-		return "gauge", strconv.FormatFloat(metrics.GCCPUFraction, 'f', 6, 64), nil
+		return builder.Gauge(name, metrics.GCCPUFraction), nil
 	case "GCSys":
-		return "gauge", strconv.FormatUint(metrics.GCSys, 10), nil
+		return builder.Gauge(name, float64(metrics.GCSys)), nil
 	case "HeapAlloc":
-		return "gauge", strconv.FormatUint(metrics.HeapAlloc, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapAlloc)), nil
 	case "HeapIdle":
-		return "gauge", strconv.FormatUint(metrics.HeapIdle, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapIdle)), nil
 	case "HeapInuse":
-		return "gauge", strconv.FormatUint(metrics.HeapInuse, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapInuse)), nil
 	case "HeapObjects":
-		return "gauge", strconv.FormatUint(metrics.HeapObjects, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapObjects)), nil
 	case "HeapReleased":
-		return "gauge", strconv.FormatUint(metrics.HeapReleased, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapReleased)), nil
 	case "HeapSys":
-		return "gauge", strconv.FormatUint(metrics.HeapSys, 10), nil
+		return builder.Gauge(name, float64(metrics.HeapSys)), nil
 	case "LastGC":
-		return "gauge", strconv.FormatUint(metrics.LastGC, 10), nil
+		return builder.Gauge(name, float64(metrics.LastGC)), nil
 	case "Lookups":
-		return "gauge", strconv.FormatUint(metrics.Lookups, 10), nil
+		return builder.Gauge(name, float64(metrics.Lookups)), nil
 	case "MCacheInuse":
-		return "gauge", strconv.FormatUint(metrics.MCacheInuse, 10), nil
+		return builder.Gauge(name, float64(metrics.MCacheInuse)), nil
 	case "MCacheSys":
-		return "gauge", strconv.FormatUint(metrics.MCacheSys, 10), nil
+		return builder.Gauge(name, float64(metrics.MCacheSys)), nil
 	case "MSpanInuse":
-		return "gauge", strconv.FormatUint(metrics.MSpanInuse, 10), nil
+		return builder.Gauge(name, float64(metrics.MSpanInuse)), nil
 	case "MSpanSys":
-		return "gauge", strconv.FormatUint(metrics.MSpanSys, 10), nil
+		return builder.Gauge(name, float64(metrics.MSpanSys)), nil
 	case "Mallocs":
-		return "gauge", strconv.FormatUint(metrics.Mallocs, 10), nil
+		return builder.Gauge(name, float64(metrics.Mallocs)), nil
 	case "NextGC":
-		return "gauge", strconv.FormatUint(metrics.NextGC, 10), nil
+		return builder.Gauge(name, float64(metrics.NextGC)), nil
 	case "NumForcedGC":
-		return "gauge", strconv.FormatUint(uint64(metrics.NumForcedGC), 10), nil
+		return builder.Gauge(name, float64(metrics.NumForcedGC)), nil
 	case "NumGC":
-		return "gauge", strconv.FormatUint(uint64(metrics.NumGC), 10), nil
+		return builder.Gauge(name, float64(metrics.NumGC)), nil
 	case "OtherSys":
-		return "gauge", strconv.FormatUint(metrics.OtherSys, 10), nil
+		return builder.Gauge(name, float64(metrics.OtherSys)), nil
 	case "PauseTotalNs":
-		return "gauge", strconv.FormatUint(metrics.PauseTotalNs, 10), nil
+		return builder.Gauge(name, float64(metrics.PauseTotalNs)), nil
 	case "StackInuse":
-		return "gauge", strconv.FormatUint(metrics.StackInuse, 10), nil
+		return builder.Gauge(name, float64(metrics.StackInuse)), nil
 	case "StackSys":
-		return "gauge", strconv.FormatUint(metrics.StackSys, 10), nil
+		return builder.Gauge(name, float64(metrics.StackSys)), nil
 	case "Sys":
-		return "gauge", strconv.FormatUint(metrics.Sys, 10), nil
+		return builder.Gauge(name, float64(metrics.Sys)), nil
 	case "TotalAlloc":
-		return "gauge", strconv.FormatUint(metrics.TotalAlloc, 10), nil
+		return builder.Gauge(name, float64(metrics.TotalAlloc)), nil
 	case "PollCount":
-		return "counter", strconv.FormatUint(uint64(metrics.PollCount), 10), nil
+		return builder.Counter(name, metrics.PollCount), nil
 	case "RandomValue":
-		return metrics.GetMetricString(GetRandomMetricName())
+		return builder.Gauge(name, metrics.RandomValue), nil
 	case "TotalMemory":
-		return "gauge", strconv.FormatUint(uint64(metrics.TotalMemory), 10), nil
+		return builder.Gauge(name, metrics.TotalMemory), nil
 	case "FreeMemory":
-		return "gauge", strconv.FormatUint(uint64(metrics.FreeMemory), 10), nil
+		return builder.Gauge(name, metrics.FreeMemory), nil
 	case "CPUutilization1":
-		return "gauge", strconv.FormatUint(uint64(metrics.CPUutilization1), 10), nil
+		return builder.Gauge(name, metrics.CPUutilization1), nil
+	case "GCPauseNs":
+		if metrics.GCPauseNs.Counts == nil {
+			return builder.Histogram(name, repositories.NewHistogram(GCPauseBounds)), nil
+		}
+		return builder.Histogram(name, metrics.GCPauseNs), nil
 	}
 
-	return "", "", fmt.Errorf("metric %s is not exist", name)
+	return repositories.Metric{}, fmt.Errorf("metric %s is not exist", name)
 }
 
 // NewMetricsStats - фабричная функция для создания структуры MetricsStats
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"encoding/json"
+	"math"
+	"runtime"
 	"testing"
+	"testing/quick"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
 func TestCollectMetrics(t *testing.T) {
@@ -33,17 +39,170 @@ func TestCollectMetrics(t *testing.T) {
 	}
 }
 
-func TestGetMetricString(t *testing.T) {
+func TestGetMetric(t *testing.T) {
 	metrics := NewMetricsStats()
 	metrics.CollectMetrics()
 	for _, metricName := range GaugeMetrics {
 		t.Run(metricName, func(t *testing.T) {
-			typeMetric, value, err := metrics.GetMetricString(metricName)
-			assert.Equal(t, typeMetric, "gauge")
-			assert.NotEqual(t, "", value)
+			metric, err := metrics.GetMetric(metricName)
 			require.NoError(t, err)
+			assert.Equal(t, metricName, metric.ID)
+			assert.Equal(t, "gauge", metric.MType)
+			require.NotNil(t, metric.Value)
+			assert.Nil(t, metric.Delta)
 		})
 	}
-	_, _, err := metrics.GetMetricString("wrong metric")
+
+	counter, err := metrics.GetMetric("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "counter", counter.MType)
+	require.NotNil(t, counter.Delta)
+	assert.Equal(t, int64(1), *counter.Delta)
+
+	_, err = metrics.GetMetric("wrong metric")
 	require.Error(t, err)
 }
+
+func TestRandomValue(t *testing.T) {
+	metrics := NewMetricsStats()
+	metrics.CollectMetrics()
+
+	metric, err := metrics.GetMetric("RandomValue")
+	require.NoError(t, err)
+	assert.Equal(t, "RandomValue", metric.ID)
+	assert.Equal(t, "gauge", metric.MType)
+	require.NotNil(t, metric.Value)
+	assert.Equal(t, metrics.RandomValue, *metric.Value)
+	assert.GreaterOrEqual(t, *metric.Value, 0.0)
+	assert.Less(t, *metric.Value, 1.0)
+}
+
+// TestGetMetricLossless - свойство: значение gauge метрики совпадает с исходным значением поля без потери точности,
+// в том числе после сериализации в JSON и обратно.
+func TestGetMetricLossless(t *testing.T) {
+	property := func(alloc uint64, fraction, cpu float64) bool {
+		metrics := NewMetricsStats()
+		metrics.Alloc = alloc
+		metrics.GCCPUFraction = fraction
+		metrics.CPUutilization1 = cpu
+
+		want := map[string]float64{
+			"Alloc":           float64(alloc),
+			"GCCPUFraction":   fraction,
+			"CPUutilization1": cpu,
+		}
+		for name, value := range want {
+			metric, err := metrics.GetMetric(name)
+			if err != nil || metric.Value == nil || math.Float64bits(*metric.Value) != math.Float64bits(value) {
+				return false
+			}
+
+			data, err := json.Marshal(metric)
+			if err != nil {
+				return false
+			}
+			var decoded repositories.Metric
+			if err := json.Unmarshal(data, &decoded); err != nil || decoded.Value == nil {
+				return false
+			}
+			if math.Float64bits(*decoded.Value) != math.Float64bits(value) {
+				return false
+			}
+		}
+		return true
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestGCPauseHistogram(t *testing.T) {
+	metrics := NewMetricsStats()
+	metrics.CollectMetrics()
+	// сбрасываю паузы, накопленные до запуска теста
+	metrics.ResetHistogram("GCPauseNs")
+
+	runtime.GC()
+	runtime.GC()
+	metrics.CollectMetrics()
+
+	metric, err := metrics.GetMetric("GCPauseNs")
+	require.NoError(t, err)
+	assert.Equal(t, "histogram", metric.MType)
+	require.NotNil(t, metric.Histogram)
+	require.NoError(t, metric.Histogram.Validate())
+	assert.Equal(t, GCPauseBounds, metric.Histogram.Bounds)
+	assert.Equal(t, uint64(2), metric.Histogram.Count)
+
+	// повторный сбор без новых сборок мусора не добавляет наблюдений
+	metrics.CollectMetrics()
+	metric, err = metrics.GetMetric("GCPauseNs")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), metric.Histogram.Count)
+
+	// после отправки из гистограммы исключаются отправленные наблюдения
+	metrics.SubtractHistogram("GCPauseNs", *metric.Histogram)
+	metric, err = metrics.GetMetric("GCPauseNs")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), metric.Histogram.Count)
+}
+
+func TestSetCollectors(t *testing.T) {
+	metrics := NewMetricsStats()
+	assert.Equal(t, AllMetrics, metrics.EnabledMetrics())
+
+	require.NoError(t, metrics.SetCollectors([]string{SystemCollector, GCPausesCollector}))
+	assert.Equal(t, []string{"TotalMemory", "FreeMemory", "CPUutilization1", "GCPauseNs"}, metrics.EnabledMetrics())
+
+	require.NoError(t, metrics.SetCollectors([]string{RuntimeCollector}))
+	enabled := metrics.EnabledMetrics()
+	assert.Contains(t, enabled, "Alloc")
+	assert.Contains(t, enabled, "PollCount")
+	assert.NotContains(t, enabled, "CPUutilization1")
+	assert.NotContains(t, enabled, "GCPauseNs")
+
+	// выключенный сборщик системных метрик не собирает их
+	metrics.CollectMetrics()
+	assert.Equal(t, int64(1), metrics.PollCount)
+	assert.Zero(t, metrics.TotalMemory)
+
+	assert.Error(t, metrics.SetCollectors([]string{"disk"}))
+	assert.Equal(t, enabled, metrics.EnabledMetrics())
+
+	require.NoError(t, metrics.SetCollectors(nil))
+	assert.Equal(t, AllMetrics, metrics.EnabledMetrics())
+}
+
+func TestCustomMetrics(t *testing.T) {
+	metrics := NewMetricsStats()
+	calls := 0
+	metrics.AddCollector(func() {
+		calls++
+		require.NoError(t, metrics.SetGauge("QueueLength", 7))
+	})
+	metrics.CollectMetrics()
+	assert.Equal(t, 1, calls)
+
+	require.NoError(t, metrics.AddCounter("Requests", 2))
+	require.NoError(t, metrics.AddCounter("Requests", 3))
+	gauge, counter := 7.0, int64(5)
+	assert.Equal(t, []repositories.Metric{
+		{ID: "QueueLength", MType: "gauge", Value: &gauge},
+		{ID: "Requests", MType: "counter", Delta: &counter},
+	}, metrics.CustomMetrics())
+
+	// после отправки из счётчика вычитается отправленное значение, а значение gauge сохраняется
+	require.NoError(t, metrics.AddCounter("Requests", 4))
+	metrics.SubtractCounter("Requests", 5)
+	rest := int64(4)
+	assert.Equal(t, []repositories.Metric{
+		{ID: "QueueLength", MType: "gauge", Value: &gauge},
+		{ID: "Requests", MType: "counter", Delta: &rest},
+	}, metrics.CustomMetrics())
+	metrics.SubtractCounter("Requests", 4)
+	assert.Equal(t, []repositories.Metric{{ID: "QueueLength", MType: "gauge", Value: &gauge}}, metrics.CustomMetrics())
+
+	// имена собираемых агентом метрик и метрик другого типа недоступны
+	assert.ErrorIs(t, metrics.SetGauge("", 1), ErrEmptyName)
+	assert.Error(t, metrics.SetGauge("Alloc", 1))
+	assert.Error(t, metrics.AddCounter("PollCount", 1))
+	assert.Error(t, metrics.AddCounter("QueueLength", 1))
+}
@@ -0,0 +1,66 @@
+package worker
+
+import "sync"
+
+// MaxConcurrency - количество работников пула отправки, больше него одновременных отправок не бывает.
+const MaxConcurrency = 32
+
+// concurrencyLimiter - ограничивает количество одновременных отправок метрик. В отличие от размера пула работников,
+// лимит можно изменить во время работы агента.
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int // лимит одновременных отправок, 0 - без ограничения
+	active int // количество выполняющихся отправок
+}
+
+// newConcurrencyLimiter - фабричная функция структуры concurrencyLimiter.
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	l := &concurrencyLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire - ожидает, пока количество выполняющихся отправок меньше лимита, и занимает место отправки.
+func (l *concurrencyLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.limit > 0 && l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release - освобождает место отправки.
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// setLimit - изменяет лимит одновременных отправок. Уже выполняющиеся отправки не прерываются.
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// getLimit - возвращает лимит одновременных отправок.
+func (l *concurrencyLimiter) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetConcurrency - устанавливает количество одновременных отправок метрик, 0 - без ограничения.
+// Количество одновременных отправок не превышает количество работников пула.
+func (s *Sender) SetConcurrency(limit int) {
+	s.concurrency.setLimit(limit)
+}
+
+// GetConcurrency - возвращает количество одновременных отправок метрик.
+func (s *Sender) GetConcurrency() int {
+	return s.concurrency.getLimit()
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := newConcurrencyLimiter(2)
+
+	var active, peak atomic.Int32
+	var wg sync.WaitGroup
+	run := func() {
+		defer wg.Done()
+		l.acquire()
+		defer l.release()
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		active.Add(-1)
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go run()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak.Load())
+
+	// при достигнутом лимите отправка ждёт, пока лимит не увеличат
+	l.setLimit(1)
+	l.acquire()
+	done := make(chan struct{})
+	go func() {
+		l.acquire()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("acquire must wait while limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.setLimit(2)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("acquire must not wait after limit is increased")
+	}
+	assert.Equal(t, 2, l.getLimit())
+
+	// без ограничения отправки не ждут
+	l.setLimit(0)
+	l.acquire()
+}
+
+func TestSetConcurrency(t *testing.T) {
+	sender := NewSender(config.NewSettings(), zap.NewNop())
+	sender.SetConcurrency(3)
+	assert.Equal(t, 3, sender.GetConcurrency())
+}
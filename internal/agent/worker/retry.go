@@ -0,0 +1,187 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+)
+
+// RetryPolicy - параметры повторной отправки метрик на сервер.
+type RetryPolicy struct {
+	MaxAttempts   int           // количество попыток, включая первую
+	Base          time.Duration // пауза перед второй попыткой, перед каждой следующей удваивается
+	Max           time.Duration // максимальная пауза между попытками
+	Jitter        float64       // доля паузы от 0 до 1, на которую пауза случайно уменьшается
+	MaxRetryAfter time.Duration // максимальная пауза, которую может запросить сервер заголовком Retry-After, 0 - заголовок не учитывается
+	StatusRules   map[int]bool  // повторять ли запрос для кода ответа, переопределяет правила по умолчанию
+}
+
+// DefaultRetryPolicy - параметры повторной отправки по умолчанию.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:   4,
+	Base:          time.Second,
+	Max:           5 * time.Second,
+	Jitter:        0.2,
+	MaxRetryAfter: 30 * time.Second,
+}
+
+// Validate - проверяет корректность параметров повторной отправки.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("max attempts must be positive, got %d", p.MaxAttempts)
+	}
+	if p.Base < 0 || p.Max < 0 || p.MaxRetryAfter < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be in [0, 1], got %g", p.Jitter)
+	}
+	return nil
+}
+
+// Backoff - возвращает паузу перед повтором после неудачной попытки attempt (начиная с 1).
+// Пауза растёт экспоненциально до Max и случайно уменьшается на долю Jitter, чтобы агенты не повторяли запросы одновременно.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.Base << (attempt - 1)
+	if d <= 0 || (p.Max > 0 && d > p.Max) {
+		d = p.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - time.Duration(p.Jitter*rand.Float64()*float64(d))
+}
+
+// Classify - определяет, следует ли повторить отправку после ошибки err, и паузу, которую запросил сервер.
+// Если сервер не запросил паузу, возвращается 0 и пауза определяется методом Backoff.
+func (p RetryPolicy) Classify(err error) (bool, time.Duration) {
+	if err == nil {
+		return false, 0
+	}
+	var statusErr *checker.StatusError
+	if errors.As(err, &statusErr) {
+		if !p.retryStatus(statusErr.StatusCode) {
+			return false, 0
+		}
+		return true, min(statusErr.RetryAfter, p.MaxRetryAfter)
+	}
+	retry := errors.Is(err, context.DeadlineExceeded) ||
+		checker.IsConnectionRefused(err) ||
+		checker.IsDBTransportError(err) ||
+		checker.IsFileLockedError(err) ||
+		checker.IsNetworkError(err)
+	return retry, 0
+}
+
+// retryStatus - возвращает true, если запрос с кодом ответа code следует повторить.
+// По умолчанию повторяются ответы 408, 429 и 5xx, кроме 501 и 505.
+func (p RetryPolicy) retryStatus(code int) bool {
+	if retry, ok := p.StatusRules[code]; ok {
+		return retry
+	}
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return code >= 500 && code < 600
+}
+
+// ParseStatusRules - разбирает правила повтора для кодов ответа в формате "503=true,500=false".
+func ParseStatusRules(value string) (map[int]bool, error) {
+	rules := make(map[int]bool)
+	if strings.TrimSpace(value) == "" {
+		return rules, nil
+	}
+	for _, rule := range strings.Split(value, ",") {
+		code, retry, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			return nil, fmt.Errorf("status rule %q must be in form code=bool", rule)
+		}
+		statusCode, err := strconv.Atoi(code)
+		if err != nil || statusCode < 100 || statusCode > 599 {
+			return nil, fmt.Errorf("status rule %q has invalid status code", rule)
+		}
+		rules[statusCode], err = strconv.ParseBool(retry)
+		if err != nil {
+			return nil, fmt.Errorf("status rule %q has invalid value", rule)
+		}
+	}
+	return rules, nil
+}
+
+// RetryBudget - общий для всех отправок лимит повторов, который не даёт агенту усиливать нагрузку на недоступный сервер.
+// Каждая отправка пополняет бюджет на долю Ratio повтора, каждый повтор расходует один повтор из бюджета.
+// Бюджет не превышает Max повторов, поэтому после исчерпания повторяется не больше доли Ratio отправок.
+type RetryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+// Параметры бюджета повторов по умолчанию.
+const (
+	DefaultRetryBudgetMax   = 10
+	DefaultRetryBudgetRatio = 0.2
+)
+
+// NewRetryBudget - фабричная функция структуры RetryBudget. Бюджет создаётся заполненным.
+func NewRetryBudget(maxRetries int, ratio float64) *RetryBudget {
+	return &RetryBudget{tokens: float64(maxRetries), max: float64(maxRetries), ratio: ratio}
+}
+
+// deposit - пополняет бюджет при новой отправке.
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.max)
+}
+
+// withdraw - расходует повтор из бюджета и возвращает false, если бюджет исчерпан.
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// SetRetryPolicy - устанавливает параметры повторной отправки метрик.
+func (s *Sender) SetRetryPolicy(policy RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryPolicy = policy
+}
+
+// GetRetryPolicy - возвращает параметры повторной отправки метрик.
+func (s *Sender) GetRetryPolicy() RetryPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retryPolicy
+}
+
+// SetRetryBudget - устанавливает общий для всех отправок бюджет повторов.
+func (s *Sender) SetRetryBudget(budget *RetryBudget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryBudget = budget
+}
+
+// getRetryBudget - возвращает общий бюджет повторов.
+func (s *Sender) getRetryBudget() *RetryBudget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retryBudget
+}
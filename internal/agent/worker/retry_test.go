@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
+)
+
+func TestRetryPolicyClassify(t *testing.T) {
+	policy := DefaultRetryPolicy
+	policy.StatusRules = map[int]bool{http.StatusInternalServerError: false, 409: true}
+
+	connectionRefused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantWait  time.Duration
+	}{
+		{name: "success", err: nil, wantRetry: false},
+		{name: "connection refused", err: fmt.Errorf("post: %w", connectionRefused), wantRetry: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, wantRetry: true},
+		{name: "dns failure", err: &net.DNSError{Err: "no such host", Name: "metrics.local"}, wantRetry: true},
+		{name: "tls handshake timeout", err: errors.New("net/http: TLS handshake timeout"), wantRetry: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, wantRetry: true},
+		{name: "service unavailable", err: checker.NewStatusError(503, "", ""), wantRetry: true},
+		{name: "bad gateway", err: checker.NewStatusError(502, "", ""), wantRetry: true},
+		{name: "too many requests with retry after", err: checker.NewStatusError(429, "3", ""), wantRetry: true, wantWait: 3 * time.Second},
+		{name: "retry after is limited", err: checker.NewStatusError(503, "3600", ""), wantRetry: true, wantWait: policy.MaxRetryAfter},
+		{name: "wrapped status", err: fmt.Errorf("push: %w", checker.NewStatusError(504, "", "")), wantRetry: true},
+		{name: "bad request", err: checker.NewStatusError(400, "", ""), wantRetry: false},
+		{name: "not implemented", err: checker.NewStatusError(501, "", ""), wantRetry: false},
+		{name: "rule disables retry", err: checker.NewStatusError(http.StatusInternalServerError, "", ""), wantRetry: false},
+		{name: "rule enables retry", err: checker.NewStatusError(409, "", ""), wantRetry: true},
+		{name: "other error", err: errors.New("answer metric from server not equal pushing metric"), wantRetry: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, wait := policy.Classify(tt.err)
+			assert.Equal(t, tt.wantRetry, retry)
+			assert.Equal(t, tt.wantWait, wait)
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, Base: 100 * time.Millisecond, Max: 300 * time.Millisecond, Jitter: 0.5}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 3, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+		{attempt: 70, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := policy.Backoff(tt.attempt)
+			assert.GreaterOrEqual(t, d, tt.min)
+			assert.LessOrEqual(t, d, tt.max)
+		}
+	}
+
+	policy.Jitter = 0
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, DefaultRetryPolicy.Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 0}.Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 1, Base: -time.Second}.Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 1, Jitter: 1.5}.Validate())
+}
+
+func TestParseStatusRules(t *testing.T) {
+	rules, err := ParseStatusRules(" 500=false, 409=true ")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{500: false, 409: true}, rules)
+
+	rules, err = ParseStatusRules("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, value := range []string{"500", "abc=true", "700=true", "500=maybe"} {
+		_, err := ParseStatusRules(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(2, 0.5)
+	assert.True(t, budget.withdraw())
+	assert.True(t, budget.withdraw())
+	assert.False(t, budget.withdraw())
+
+	// две отправки пополняют бюджет на один повтор
+	budget.deposit()
+	assert.False(t, budget.withdraw())
+	budget.deposit()
+	assert.True(t, budget.withdraw())
+
+	// бюджет не превышает максимума
+	for i := 0; i < 100; i++ {
+		budget.deposit()
+	}
+	assert.True(t, budget.withdraw())
+	assert.True(t, budget.withdraw())
+	assert.False(t, budget.withdraw())
+}
+
+func TestRetryExecPushFunction(t *testing.T) {
+	sender := NewSender(config.NewSettings(), zap.NewNop())
+	sender.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, Base: time.Millisecond, Max: time.Millisecond, MaxRetryAfter: time.Second})
+
+	pushWithErrors := func(calls *int, errs ...error) PushFunction {
+		return func(context.Context, string, string, *storage.MetricsStats, *resty.Client) error {
+			*calls++
+			if *calls <= len(errs) {
+				return errs[*calls-1]
+			}
+			return nil
+		}
+	}
+	unavailable := checker.NewStatusError(503, "", "")
+
+	t.Run("retried until success", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(10, 0))
+		calls := 0
+		err := sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, unavailable, unavailable))
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("attempts are exhausted", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(10, 0))
+		calls := 0
+		err := sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, unavailable, unavailable, unavailable, unavailable, unavailable))
+		require.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(10, 0))
+		calls := 0
+		badRequest := checker.NewStatusError(400, "", "")
+		err := sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, badRequest))
+		require.ErrorIs(t, err, badRequest)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("budget is exhausted", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(1, 0))
+		calls := 0
+		err := sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, unavailable, unavailable, unavailable))
+		require.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 2, calls)
+
+		// пустой бюджет не позволяет повторять и следующие отправки
+		calls = 0
+		err = sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, unavailable))
+		require.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("retry after is honoured", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(10, 0))
+		calls := 0
+		start := time.Now()
+		err := sender.RetryExecPushFunction(context.Background(), "", "", nil, nil, pushWithErrors(&calls, checker.NewStatusError(429, "1", "")))
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("wait is interrupted by context", func(t *testing.T) {
+		sender.SetRetryBudget(NewRetryBudget(10, 0))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		calls := 0
+		start := time.Now()
+		err := sender.RetryExecPushFunction(ctx, "", "", nil, nil, pushWithErrors(&calls, checker.NewStatusError(429, "1", "")))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, calls)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
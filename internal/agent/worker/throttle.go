@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+)
+
+// DefaultMaxThrottleFactor - во сколько раз по умолчанию может быть увеличен интервал отправки метрик.
+const DefaultMaxThrottleFactor = 8
+
+// Throttle - адаптивно увеличивает интервал отправки метрик, пока сервер перегружен.
+// Каждый ответ 429 или 503 удваивает интервал, но не больше чем в maxFactor раз, каждая успешная отправка вдвое уменьшает
+// увеличение. Интервал также не меньше паузы, которую сервер запросил заголовком Retry-After.
+type Throttle struct {
+	mu         sync.Mutex
+	factor     float64       // текущий множитель интервала отправки
+	maxFactor  float64       // максимальный множитель интервала отправки
+	retryAfter time.Duration // пауза из заголовка Retry-After последнего ответа о перегрузке
+}
+
+// NewThrottle - фабричная функция структуры Throttle.
+func NewThrottle(maxFactor float64) *Throttle {
+	return &Throttle{factor: 1, maxFactor: max(maxFactor, 1)}
+}
+
+// Observe - учитывает результат отправки метрик и возвращает true, если сервер сообщил о перегрузке.
+// Ошибки, не связанные с перегрузкой сервера, не меняют интервал.
+func (t *Throttle) Observe(err error) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil {
+		t.factor = max(t.factor/2, 1)
+		t.retryAfter = 0
+		return false
+	}
+	var statusErr *checker.StatusError
+	if !errors.As(err, &statusErr) ||
+		(statusErr.StatusCode != http.StatusTooManyRequests && statusErr.StatusCode != http.StatusServiceUnavailable) {
+		return false
+	}
+	t.factor = min(t.factor*2, t.maxFactor)
+	t.retryAfter = statusErr.RetryAfter
+	return true
+}
+
+// Interval - возвращает интервал отправки метрик с учётом перегрузки сервера для обычного интервала base.
+func (t *Throttle) Interval(base time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return max(time.Duration(float64(base)*t.factor), t.retryAfter)
+}
+
+// SetThrottle - устанавливает общий для всех отправок регулятор интервала отправки.
+func (s *Sender) SetThrottle(t *Throttle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttle = t
+}
+
+// getThrottle - возвращает общий регулятор интервала отправки.
+func (s *Sender) getThrottle() *Throttle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.throttle
+}
+
+// ReportInterval - возвращает интервал отправки метрик с учётом перегрузки сервера для обычного интервала base.
+func (s *Sender) ReportInterval(base time.Duration) time.Duration {
+	return s.getThrottle().Interval(base)
+}
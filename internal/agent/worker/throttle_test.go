@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+)
+
+func TestThrottle(t *testing.T) {
+	base := 10 * time.Second
+	throttle := NewThrottle(4)
+	assert.Equal(t, base, throttle.Interval(base))
+
+	// ошибки, не связанные с перегрузкой сервера, не меняют интервал
+	throttle.Observe(errors.New("connection refused"))
+	throttle.Observe(checker.NewStatusError(500, "", ""))
+	assert.Equal(t, base, throttle.Interval(base))
+
+	// ответы о перегрузке увеличивают интервал не больше чем в maxFactor раз
+	throttle.Observe(checker.NewStatusError(429, "", ""))
+	assert.Equal(t, 2*base, throttle.Interval(base))
+	throttle.Observe(checker.NewStatusError(503, "", ""))
+	throttle.Observe(checker.NewStatusError(503, "", ""))
+	assert.Equal(t, 4*base, throttle.Interval(base))
+
+	// интервал не меньше запрошенной сервером паузы
+	throttle.Observe(checker.NewStatusError(429, "120", ""))
+	assert.Equal(t, 2*time.Minute, throttle.Interval(base))
+
+	// успешные отправки постепенно возвращают обычный интервал
+	throttle.Observe(nil)
+	assert.Equal(t, 2*base, throttle.Interval(base))
+	throttle.Observe(nil)
+	throttle.Observe(nil)
+	assert.Equal(t, base, throttle.Interval(base))
+}
+
+func TestReportInterval(t *testing.T) {
+	sender := NewSender(config.NewSettings(), zap.NewNop())
+	throttle := NewThrottle(DefaultMaxThrottleFactor)
+	sender.SetThrottle(throttle)
+
+	assert.True(t, throttle.Observe(checker.NewStatusError(429, "", "")))
+	assert.Equal(t, 2*time.Second, sender.ReportInterval(time.Second))
+
+	// у каждого Sender свой регулятор интервала отправки
+	assert.Equal(t, time.Second, NewSender(config.NewSettings(), zap.NewNop()).ReportInterval(time.Second))
+}
@@ -2,7 +2,6 @@ package worker
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,32 +9,76 @@ import (
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
-// PushFunction - тип функции выполняющей отправку метрики.
-type PushFunction = func(string, string, *storage.MetricsStats, *resty.Client) error
+// PushFunction - тип функции выполняющей отправку метрики. Отправка прерывается отменой контекста.
+type PushFunction = func(context.Context, string, string, *storage.MetricsStats, *resty.Client) error
 
-// RetryExecPushFunction - для повторной отправки запроса в случае, если сервер не отвечает. Установлено три дополнительных попыток.
-func RetryExecPushFunction(address, action string, metrics *storage.MetricsStats, client *resty.Client, pushFunction PushFunction) {
-	sleepIntervals := []time.Duration{0, 1, 3, 5}
+// Sender - выполняет задачи отправки метрик. Хранит общие для всех отправок агента лимит одновременных отправок,
+// параметры и бюджет повторов и регулятор интервала отправки.
+type Sender struct {
+	settings    *config.Settings    // параметры агента, которые передаются серверу
+	log         *zap.Logger         // логер агента
+	concurrency *concurrencyLimiter // лимит одновременных отправок
 
-	for i := 0; i < 4; i++ {
-		logger.AgentLog.Debug(fmt.Sprintf("Push metrics to server, attemption %d", i+1))
+	mu          sync.RWMutex
+	retryPolicy RetryPolicy  // параметры повторной отправки
+	retryBudget *RetryBudget // общий бюджет повторов
+	throttle    *Throttle    // регулятор интервала отправки
+}
 
-		time.Sleep(sleepIntervals[i] * time.Second)
+// NewSender - создаёт Sender с параметрами повторной отправки по умолчанию и без ограничения одновременных отправок.
+func NewSender(settings *config.Settings, log *zap.Logger) *Sender {
+	return &Sender{
+		settings:    settings,
+		log:         log,
+		concurrency: newConcurrencyLimiter(0),
+		retryPolicy: DefaultRetryPolicy,
+		retryBudget: NewRetryBudget(DefaultRetryBudgetMax, DefaultRetryBudgetRatio),
+		throttle:    NewThrottle(DefaultMaxThrottleFactor),
+	}
+}
 
-		err := pushFunction(address, action, metrics, client)
-		if err != nil && (errors.Is(err, context.DeadlineExceeded) ||
-			checker.IsConnectionRefused(err) ||
-			checker.IsDBTransportError(err)) ||
-			checker.IsFileLockedError(err) {
-			continue
-		} else {
-			return
+// RetryExecPushFunction - выполняет отправку метрик, повторяя её по правилам GetRetryPolicy, пока не исчерпаны попытки
+// или общий бюджет повторов. Результат каждой попытки учитывается при расчёте интервала отправки ReportInterval.
+// Возвращает ошибку последней попытки. Отмена контекста ctx прерывает отправку и ожидание перед повтором.
+func (s *Sender) RetryExecPushFunction(ctx context.Context, address, action string, metrics *storage.MetricsStats, client *resty.Client, pushFunction PushFunction) error {
+	policy := s.GetRetryPolicy()
+	budget := s.getRetryBudget()
+	throttle := s.getThrottle()
+	budget.deposit()
+
+	for attempt := 1; ; attempt++ {
+		s.log.Debug(fmt.Sprintf("Push metrics to server, attemption %d", attempt))
+
+		err := pushFunction(ctx, address, action, metrics, client)
+		if throttle.Observe(err) {
+			s.log.Debug("server is overloaded, report interval is increased",
+				zap.Duration("report_interval", throttle.Interval(s.settings.GetReportInterval())))
+		}
+		retry, wait := policy.Classify(err)
+		if !retry {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			s.log.Warn("push metrics attempts are exhausted", zap.Int("attempts", attempt), zap.String("error", error.Error(err)))
+			return err
+		}
+		if !budget.withdraw() {
+			s.log.Warn("retry budget is exhausted, push metrics is not retried", zap.String("error", error.Error(err)))
+			return err
+		}
+		if wait == 0 {
+			wait = policy.Backoff(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
 		}
 	}
 }
@@ -59,21 +102,38 @@ func NewTask(address, action string, metrics *storage.MetricsStats, pushFunction
 	}
 }
 
-// Do - метод для выполнения задачи.
-func (t Task) Do() {
-	client := resty.New()
+// Do - метод для выполнения задачи. Отмена контекста ctx прерывает отправку.
+func (s *Sender) Do(ctx context.Context, t Task) {
+	client := resty.New().SetTimeout(s.settings.GetContextTimeout())
 	// Добавляем middleware для обработки ответа
-	client.OnAfterResponse(hasher.VerifyHashMiddleware)
+	client.OnAfterResponse(hasher.VerifyHashMiddleware(s.settings.GetKey(), s.log))
+	// по идентификатору агента сервер ограничивает частоту запросов, без него - по IP-адресу
+	if id := s.settings.GetAgentID(); id != "" {
+		client.SetHeader(repositories.AgentIDHeader, id)
+	}
+	// по группе агента сервер выбирает настройки, версию которых возвращает в ответе
+	if group := s.settings.GetAgentGroup(); group != "" {
+		client.SetHeader(repositories.AgentGroupHeader, group)
+	}
 
-	RetryExecPushFunction(t.address, t.action, t.metrics, client, t.pushFunction)
-	logger.AgentLog.Debug("Running agent", zap.String("action", "push metrics"))
+	if err := s.RetryExecPushFunction(ctx, t.address, t.action, t.metrics, client, t.pushFunction); err != nil {
+		s.log.Error("push metrics error", zap.String("error", error.Error(err)))
+	}
+	s.log.Debug("Running agent", zap.String("action", "push metrics"))
 }
 
-// DoWork - принимает задачу из канала и выполняет её.
-func DoWork(pushTasks <-chan Task, wg *sync.WaitGroup) {
+// DoWork - принимает задачу из канала и выполняет её, соблюдая лимит одновременных отправок SetConcurrency.
+// Отмена контекста ctx прерывает начатые отправки.
+func (s *Sender) DoWork(ctx context.Context, pushTasks <-chan Task, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for pushTask := range pushTasks {
-		pushTask.Do()
+		// задачи, оставшиеся в канале после отмены контекста, не выполняются
+		if ctx.Err() != nil {
+			continue
+		}
+		s.concurrency.acquire()
+		s.Do(ctx, pushTask)
+		s.concurrency.release()
 	}
 }
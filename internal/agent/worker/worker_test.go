@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"testing"
 
 	"github.com/go-resty/resty/v2"
@@ -14,7 +15,7 @@ func TestNewTask(t *testing.T) {
 	action := "Post"
 	metrics := storage.NewMetricsStats()
 	metrics.CollectMetrics()
-	pushFunction := func(string, string, *storage.MetricsStats, *resty.Client) error {
+	pushFunction := func(context.Context, string, string, *storage.MetricsStats, *resty.Client) error {
 		return nil
 	}
 	wantTask := &Task{
@@ -27,5 +28,5 @@ func TestNewTask(t *testing.T) {
 	assert.Equal(t, wantTask.address, getTask.address)
 	assert.Equal(t, wantTask.action, getTask.action)
 	assert.Equal(t, wantTask.metrics, getTask.metrics)
-	assert.Equal(t, wantTask.pushFunction("", "", nil, nil), getTask.pushFunction("", "", nil, nil))
+	assert.Equal(t, wantTask.pushFunction(context.Background(), "", "", nil, nil), getTask.pushFunction(context.Background(), "", "", nil, nil))
 }
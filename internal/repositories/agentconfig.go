@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+)
+
+// Заголовки, которыми агент и сервер обмениваются сведениями о настройках агента.
+const (
+	AgentGroupHeader         = "X-Agent-Group"          // группа агента, по которой сервер выбирает настройки группы
+	AgentConfigVersionHeader = "X-Agent-Config-Version" // версия настроек агента, актуальная на сервере
+)
+
+// AgentConfig - настройки агента, которые сервер передаёт агенту. Незаданные (нулевые) настройки агент не меняет.
+type AgentConfig struct {
+	Version        string   `json:"version,omitempty"`    // версия настроек, меняется при любом их изменении
+	ReportInterval Duration `json:"report_interval"`      // интервал отправки метрик, не меньше секунды
+	PollInterval   Duration `json:"poll_interval"`        // интервал сбора метрик, не меньше секунды
+	Collectors     []string `json:"collectors,omitempty"` // включённые сборщики метрик, пустой список - все сборщики
+	RateLimit      int      `json:"rate_limit,omitempty"` // количество одновременных отправок метрик на сервер
+}
+
+// Validate - проверяет корректность настроек агента.
+func (c AgentConfig) Validate() error {
+	for name, d := range map[string]time.Duration{"report_interval": c.ReportInterval.Duration, "poll_interval": c.PollInterval.Duration} {
+		if d != 0 && d < time.Second {
+			return fmt.Errorf("%s must be at least 1s, got %s", name, d)
+		}
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative, got %d", c.RateLimit)
+	}
+	return nil
+}
+
+// Merge - возвращает настройки c, в которых заданные в override настройки заменяют исходные. Версия не переносится.
+func (c AgentConfig) Merge(override AgentConfig) AgentConfig {
+	if override.ReportInterval.Duration != 0 {
+		c.ReportInterval = override.ReportInterval
+	}
+	if override.PollInterval.Duration != 0 {
+		c.PollInterval = override.PollInterval
+	}
+	if len(override.Collectors) > 0 {
+		c.Collectors = override.Collectors
+	}
+	if override.RateLimit != 0 {
+		c.RateLimit = override.RateLimit
+	}
+	return c
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AgentConfig
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			config:  AgentConfig{},
+			wantErr: false,
+		},
+		{
+			name:    "valid",
+			config:  AgentConfig{ReportInterval: Duration{10 * time.Second}, PollInterval: Duration{2 * time.Second}, RateLimit: 3},
+			wantErr: false,
+		},
+		{
+			name:    "too short report interval",
+			config:  AgentConfig{ReportInterval: Duration{500 * time.Millisecond}},
+			wantErr: true,
+		},
+		{
+			name:    "too short poll interval",
+			config:  AgentConfig{PollInterval: Duration{time.Millisecond}},
+			wantErr: true,
+		},
+		{
+			name:    "negative rate limit",
+			config:  AgentConfig{RateLimit: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAgentConfigMerge(t *testing.T) {
+	base := AgentConfig{
+		Version:        "base",
+		ReportInterval: Duration{10 * time.Second},
+		PollInterval:   Duration{2 * time.Second},
+		Collectors:     []string{"runtime"},
+		RateLimit:      1,
+	}
+	merged := base.Merge(AgentConfig{Version: "override", PollInterval: Duration{5 * time.Second}, RateLimit: 4})
+	assert.Equal(t, AgentConfig{
+		Version:        "base",
+		ReportInterval: Duration{10 * time.Second},
+		PollInterval:   Duration{5 * time.Second},
+		Collectors:     []string{"runtime"},
+		RateLimit:      4,
+	}, merged)
+}
+
+func TestAgentConfigJSON(t *testing.T) {
+	config := AgentConfig{ReportInterval: Duration{10 * time.Second}, Collectors: []string{"runtime", "system"}}
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"report_interval":"10s","poll_interval":"0s","collectors":["runtime","system"]}`, string(data))
+
+	var decoded AgentConfig
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, config, decoded)
+}
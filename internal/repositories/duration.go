@@ -25,3 +25,8 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	d.Duration = duration
 	return nil
 }
+
+// MarshalJSON реализует кастомный Marshal для Duration в виде строки, например "10s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MetricsFilter - условия выборки метрик из хранилища.
+// Пустые поля не ограничивают выборку. Метрики возвращаются отсортированными по имени.
+type MetricsFilter struct {
+	ID      string            // точное имя метрики
+	Type    string            // тип метрики: gauge, counter или histogram
+	Prefix  string            // префикс имени метрики
+	Match   string            // регулярное выражение, которому должно соответствовать имя метрики
+	Labels  map[string]string // метки, которые должны быть у метрики в реестре метаданных
+	AfterID string            // курсор: возвращаются только метрики с именем больше AfterID
+	Limit   int               // максимальное количество метрик в ответе, 0 - без ограничения
+}
+
+// Validate - проверяет корректность условий выборки.
+func (f MetricsFilter) Validate() error {
+	if f.Type != "" && !IsValidMetricType(f.Type) {
+		return fmt.Errorf("invalid type of metric: %s", f.Type)
+	}
+	if f.Limit < 0 {
+		return fmt.Errorf("limit must not be negative, got %d", f.Limit)
+	}
+	if f.Match != "" {
+		if _, err := regexp.Compile(f.Match); err != nil {
+			return fmt.Errorf("invalid match expression: %w", err)
+		}
+	}
+	return nil
+}
+
+// Matcher - возвращает функцию, проверяющую соответствие метрики условиям выборки без учёта курсора и лимита.
+// labels - метки метрики из реестра метаданных.
+func (f MetricsFilter) Matcher() (func(metric Metric, labels map[string]string) bool, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	var re *regexp.Regexp
+	if f.Match != "" {
+		re = regexp.MustCompile(f.Match)
+	}
+	return func(metric Metric, labels map[string]string) bool {
+		if f.ID != "" && metric.ID != f.ID {
+			return false
+		}
+		if f.Type != "" && metric.MType != f.Type {
+			return false
+		}
+		if !strings.HasPrefix(metric.ID, f.Prefix) {
+			return false
+		}
+		if re != nil && !re.MatchString(metric.ID) {
+			return false
+		}
+		for key, value := range f.Labels {
+			if got, ok := labels[key]; !ok || got != value {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// IsEmpty - проверяет, что фильтр не ограничивает выборку метрик.
+func (f MetricsFilter) IsEmpty() bool {
+	return f.ID == "" && f.Type == "" && f.Prefix == "" && f.Match == "" && len(f.Labels) == 0
+}
+
+// Page - применяет к отсортированному слайсу метрик курсор и лимит выборки.
+func (f MetricsFilter) Page(metrics []Metric) []Metric {
+	start := sort.Search(len(metrics), func(i int) bool {
+		return metrics[i].ID > f.AfterID
+	})
+	metrics = metrics[start:]
+	if f.Limit > 0 && len(metrics) > f.Limit {
+		metrics = metrics[:f.Limit]
+	}
+	return metrics
+}
+
+// SortMetrics - сортирует слайс метрик по имени, а метрики с одинаковым именем - по типу.
+func SortMetrics(metrics []Metric) {
+	slices.SortStableFunc(metrics, func(a, b Metric) int {
+		if c := strings.Compare(a.ID, b.ID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MType, b.MType)
+	})
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsFilterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  MetricsFilter
+		wantErr bool
+	}{
+		{name: "empty", filter: MetricsFilter{}},
+		{name: "full", filter: MetricsFilter{Type: "gauge", Prefix: "Heap", Match: "^Heap.*$", Labels: map[string]string{"host": "a"}, Limit: 10}},
+		{name: "invalid type", filter: MetricsFilter{Type: "summary"}, wantErr: true},
+		{name: "negative limit", filter: MetricsFilter{Limit: -1}, wantErr: true},
+		{name: "invalid match", filter: MetricsFilter{Match: "("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMetricsFilterMatcher(t *testing.T) {
+	heap := Metric{ID: "HeapAlloc", MType: "gauge"}
+	poll := Metric{ID: "PollCount", MType: "counter"}
+	labels := map[string]string{"host": "agent"}
+
+	tests := []struct {
+		name   string
+		filter MetricsFilter
+		metric Metric
+		labels map[string]string
+		want   bool
+	}{
+		{name: "empty filter", filter: MetricsFilter{}, metric: heap, want: true},
+		{name: "type", filter: MetricsFilter{Type: "counter"}, metric: heap, want: false},
+		{name: "prefix", filter: MetricsFilter{Prefix: "Heap"}, metric: heap, want: true},
+		{name: "wrong prefix", filter: MetricsFilter{Prefix: "Heap"}, metric: poll, want: false},
+		{name: "match", filter: MetricsFilter{Match: "Count$"}, metric: poll, want: true},
+		{name: "wrong match", filter: MetricsFilter{Match: "^Count"}, metric: poll, want: false},
+		{name: "label", filter: MetricsFilter{Labels: labels}, metric: heap, labels: labels, want: true},
+		{name: "missing label", filter: MetricsFilter{Labels: labels}, metric: heap, want: false},
+		{name: "wrong label", filter: MetricsFilter{Labels: labels}, metric: heap, labels: map[string]string{"host": "server"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.filter.Matcher()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, match(tt.metric, tt.labels))
+		})
+	}
+
+	_, err := MetricsFilter{Match: "("}.Matcher()
+	require.Error(t, err)
+}
+
+func TestMetricsFilterPage(t *testing.T) {
+	metrics := []Metric{{ID: "c", MType: "gauge"}, {ID: "a", MType: "gauge"}, {ID: "b", MType: "counter"}, {ID: "d", MType: "gauge"}}
+	SortMetrics(metrics)
+	assert.Equal(t, []Metric{{ID: "a", MType: "gauge"}, {ID: "b", MType: "counter"}, {ID: "c", MType: "gauge"}, {ID: "d", MType: "gauge"}}, metrics)
+
+	assert.Equal(t, metrics, MetricsFilter{}.Page(metrics))
+	assert.Equal(t, metrics[:2], MetricsFilter{Limit: 2}.Page(metrics))
+	assert.Equal(t, metrics[2:3], MetricsFilter{AfterID: "b", Limit: 1}.Page(metrics))
+	assert.Equal(t, metrics[2:], MetricsFilter{AfterID: "bb"}.Page(metrics))
+	assert.Empty(t, MetricsFilter{AfterID: "d"}.Page(metrics))
+}
@@ -8,8 +8,6 @@ import (
 	"net/http"
 
 	"go.uber.org/zap"
-
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
 )
 
 // CalkHash - подписывает данные body алгоритмом SHA-256 с помощью ключа key.
@@ -28,9 +26,6 @@ func CalkHash(body []byte, key string) (string, error) {
 
 // CheckHash - проверяет корректность подписи.
 func CheckHash(body []byte, wantHash, key string) error {
-	logger.ServerLog.Debug("getting body and hash to check in CheckHash", zap.String("body", fmt.Sprintf("%x", body)), zap.String("hash", wantHash),
-		zap.String("key", key))
-
 	reqHashBytes, err := hex.DecodeString(wantHash)
 	if err != nil {
 		return err
@@ -55,13 +50,15 @@ func CheckHash(body []byte, wantHash, key string) error {
 type HashWriter struct {
 	w   http.ResponseWriter
 	key string
+	log *zap.Logger
 }
 
-// NewHashWriter - фабричная функция для создания структуры HashWriter.
-func NewHashWriter(w http.ResponseWriter, key string) *HashWriter {
+// NewHashWriter - фабричная функция для создания структуры HashWriter. В log пишутся вычисленные подписи ответа.
+func NewHashWriter(w http.ResponseWriter, key string, log *zap.Logger) *HashWriter {
 	return &HashWriter{
 		w:   w,
 		key: key,
+		log: log,
 	}
 }
 
@@ -79,7 +76,7 @@ func (h *HashWriter) Write(p []byte) (int, error) {
 	// Устанавливаю заголовок о подписи данных и результат подписи хэша
 	h.w.Header().Set("HashSHA256", hash)
 
-	logger.ServerLog.Debug("calculated hash in Write method", zap.String("hash", hash), zap.String("size of p", fmt.Sprintf("%d", len(p))),
+	h.log.Debug("calculated hash in Write method", zap.String("hash", hash), zap.String("size of p", fmt.Sprintf("%d", len(p))),
 		zap.String("body", fmt.Sprintf("%x", p)))
 
 	return h.w.Write(p)
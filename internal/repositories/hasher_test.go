@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestCalkHash(t *testing.T) {
@@ -246,7 +247,7 @@ func TestNewHashWriter(t *testing.T) {
 
 	expectedKey := "testKey"
 
-	hashWriter := NewHashWriter(mockResponseWriter, expectedKey)
+	hashWriter := NewHashWriter(mockResponseWriter, expectedKey, zap.NewNop())
 
 	// Проверяю, что структура инициализирована корректно
 	if hashWriter.w != mockResponseWriter {
@@ -264,7 +265,7 @@ func TestHashWriter_Header(t *testing.T) {
 	headerValue := "first value"
 	mockResponseWriter.Header().Add(headerKey, headerValue)
 
-	hashWriter := NewHashWriter(mockResponseWriter, expectedKey)
+	hashWriter := NewHashWriter(mockResponseWriter, expectedKey, zap.NewNop())
 	header := hashWriter.Header()
 	assert.Equal(t, headerValue, header.Get(headerKey))
 }
@@ -281,7 +282,7 @@ func TestTestHashWriter_Write(t *testing.T) {
 	mockResponseWriter := httptest.NewRecorder()
 	key := "testKey"
 
-	hashWriter := NewHashWriter(mockResponseWriter, key)
+	hashWriter := NewHashWriter(mockResponseWriter, key, zap.NewNop())
 
 	rnd := mathRand.New(mathRand.NewSource(79))
 	testBody := randomData(rnd, 256)
@@ -305,7 +306,7 @@ func TestTestHashWriter_Write(t *testing.T) {
 func TestTestHashWriter_WriteHeader(t *testing.T) {
 	mockResponseWriter := httptest.NewRecorder()
 	key := "testKey"
-	hashWriter := NewHashWriter(mockResponseWriter, key)
+	hashWriter := NewHashWriter(mockResponseWriter, key, zap.NewNop())
 
 	wantHeader := 400
 	hashWriter.WriteHeader(wantHeader)
@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrHistogramBoundsMismatch - ошибка слияния гистограмм с разными границами бакетов.
+var ErrHistogramBoundsMismatch = errors.New("histogram bucket bounds mismatch")
+
+// Histogram - гистограмма распределения значений метрики.
+// Bounds содержит верхние границы бакетов в порядке возрастания, Counts - количество наблюдений в каждом бакете.
+// Последний элемент Counts соответствует бакету +Inf, поэтому len(Counts) == len(Bounds)+1.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы бакетов
+	Counts []uint64  `json:"counts"` // количество наблюдений в каждом бакете
+	Sum    float64   `json:"sum"`    // сумма всех наблюдений
+	Count  uint64    `json:"count"`  // общее количество наблюдений
+}
+
+// NewHistogram - фабричная функция для создания пустой гистограммы с заданными границами бакетов.
+func NewHistogram(bounds []float64) Histogram {
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	return Histogram{
+		Bounds: b,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe - добавляет в гистограмму одно наблюдение.
+func (h *Histogram) Observe(value float64) {
+	// индекс первого бакета, верхняя граница которого не меньше значения
+	i := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Validate - проверяет корректность гистограммы.
+func (h Histogram) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram must have %d counts for %d bounds, got %d", len(h.Bounds)+1, len(h.Bounds), len(h.Counts))
+	}
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("histogram bound %d is not finite", i)
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return fmt.Errorf("histogram bounds must be strictly increasing")
+		}
+	}
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d is not equal to sum of bucket counts %d", h.Count, total)
+	}
+	return nil
+}
+
+// Merge - возвращает новую гистограмму, объединяющую наблюдения h и other.
+// Гистограммы должны иметь одинаковые границы бакетов.
+func (h Histogram) Merge(other Histogram) (Histogram, error) {
+	if len(h.Bounds) != len(other.Bounds) {
+		return Histogram{}, ErrHistogramBoundsMismatch
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return Histogram{}, ErrHistogramBoundsMismatch
+		}
+	}
+	if len(h.Counts) != len(other.Counts) {
+		return Histogram{}, ErrHistogramBoundsMismatch
+	}
+
+	result := NewHistogram(h.Bounds)
+	for i := range h.Counts {
+		result.Counts[i] = h.Counts[i] + other.Counts[i]
+	}
+	result.Sum = h.Sum + other.Sum
+	result.Count = h.Count + other.Count
+	return result, nil
+}
+
+// Subtract - возвращает новую гистограмму, из которой исключены наблюдения other, например уже отправленные на сервер.
+// Гистограммы должны иметь одинаковые границы бакетов, а наблюдения other должны входить в h.
+func (h Histogram) Subtract(other Histogram) (Histogram, error) {
+	if _, err := h.Merge(other); err != nil {
+		return Histogram{}, err
+	}
+
+	result := NewHistogram(h.Bounds)
+	for i := range h.Counts {
+		if other.Counts[i] > h.Counts[i] {
+			return Histogram{}, fmt.Errorf("histogram bucket %d has %d observations, cannot subtract %d", i, h.Counts[i], other.Counts[i])
+		}
+		result.Counts[i] = h.Counts[i] - other.Counts[i]
+	}
+	result.Sum = h.Sum - other.Sum
+	result.Count = h.Count - other.Count
+	return result, nil
+}
+
+// Quantile - оценивает квантиль q (0 <= q <= 1) линейной интерполяцией внутри бакета.
+// Для наблюдений, попавших в бакет +Inf, возвращается верхняя граница последнего конечного бакета.
+func (h Histogram) Quantile(q float64) (float64, error) {
+	if math.IsNaN(q) || q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile must be in range [0, 1], got %g", q)
+	}
+	if h.Count == 0 {
+		return 0, fmt.Errorf("histogram is empty")
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return 0, fmt.Errorf("histogram is malformed")
+	}
+
+	rank := q * float64(h.Count)
+	var cumulative uint64
+	for i, count := range h.Counts {
+		prev := cumulative
+		cumulative += count
+		if float64(cumulative) < rank || count == 0 {
+			continue
+		}
+		// бакет +Inf
+		if i == len(h.Bounds) {
+			if len(h.Bounds) == 0 {
+				return 0, fmt.Errorf("histogram has no finite buckets")
+			}
+			return h.Bounds[len(h.Bounds)-1], nil
+		}
+		upper := h.Bounds[i]
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		} else if upper <= 0 {
+			// у первого бакета нет нижней границы, если он не положительный
+			return upper, nil
+		}
+		return lower + (upper-lower)*(rank-float64(prev))/float64(count), nil
+	}
+	return 0, fmt.Errorf("histogram count %d is not equal to sum of bucket counts %d", h.Count, cumulative)
+}
+
+// String возвращает представление гистограммы в виде строки
+func (h Histogram) String() string {
+	buckets := make([]string, 0, len(h.Counts))
+	for i, count := range h.Counts {
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = fmt.Sprintf("%g", h.Bounds[i])
+		}
+		buckets = append(buckets, fmt.Sprintf("%s:%d", le, count))
+	}
+	return fmt.Sprintf("count=%d sum=%g buckets=[%s]", h.Count, h.Sum, strings.Join(buckets, " "))
+}
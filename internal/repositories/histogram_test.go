@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 10, 100} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 2, 1}, h.Counts)
+	assert.Equal(t, uint64(6), h.Count)
+	assert.Equal(t, 121.5, h.Sum)
+	require.NoError(t, h.Validate())
+}
+
+func TestHistogramValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram Histogram
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			histogram: Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3},
+			wantErr:   false,
+		},
+		{
+			name:      "empty without bounds",
+			histogram: Histogram{Counts: []uint64{0}},
+			wantErr:   false,
+		},
+		{
+			name:      "wrong number of counts",
+			histogram: Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 2}, Count: 3},
+			wantErr:   true,
+		},
+		{
+			name:      "bounds not increasing",
+			histogram: Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}},
+			wantErr:   true,
+		},
+		{
+			name:      "count mismatch",
+			histogram: Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 5},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.histogram.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	first := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3}
+	second := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5}
+
+	merged, err := first.Merge(second)
+	require.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, merged)
+	// исходные гистограммы не изменяются
+	assert.Equal(t, []uint64{1, 0, 2}, first.Counts)
+
+	_, err = first.Merge(Histogram{Bounds: []float64{1, 3}, Counts: []uint64{0, 0, 0}})
+	require.ErrorIs(t, err, ErrHistogramBoundsMismatch)
+
+	_, err = first.Merge(Histogram{Bounds: []float64{1}, Counts: []uint64{0, 0}})
+	require.ErrorIs(t, err, ErrHistogramBoundsMismatch)
+}
+
+func TestHistogramSubtract(t *testing.T) {
+	total := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}
+	sent := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3}
+
+	rest, err := total.Subtract(sent)
+	require.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5}, rest)
+	// исходные гистограммы не изменяются
+	assert.Equal(t, []uint64{1, 4, 3}, total.Counts)
+
+	_, err = sent.Subtract(total)
+	require.Error(t, err)
+
+	_, err = total.Subtract(Histogram{Bounds: []float64{1, 3}, Counts: []uint64{0, 0, 0}})
+	require.ErrorIs(t, err, ErrHistogramBoundsMismatch)
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := Histogram{Bounds: []float64{10, 20, 40}, Counts: []uint64{10, 10, 0, 5}, Count: 25}
+
+	tests := []struct {
+		name    string
+		q       float64
+		want    float64
+		wantErr bool
+	}{
+		{name: "zero", q: 0, want: 0},
+		{name: "inside first bucket", q: 0.2, want: 5},
+		{name: "inside second bucket", q: 0.6, want: 15},
+		{name: "end of second bucket", q: 0.8, want: 20},
+		{name: "inf bucket", q: 0.99, want: 40},
+		{name: "less than zero", q: -0.1, wantErr: true},
+		{name: "greater than one", q: 1.1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Quantile(tt.q)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+
+	_, err := NewHistogram([]float64{1}).Quantile(0.5)
+	require.Error(t, err)
+}
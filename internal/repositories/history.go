@@ -0,0 +1,31 @@
+package repositories
+
+import "time"
+
+// Sample - значение метрики в момент её обновления.
+// Для gauge сохраняется значение, для counter - накопленная сумма, для histogram - количество наблюдений.
+type Sample struct {
+	Time  time.Time `json:"t"` // время обновления метрики
+	Value float64   `json:"v"` // значение метрики после обновления
+}
+
+// Rollup - агрегированные значения метрики за интервал времени длительностью resolution.
+// Для counter, как и в Sample, используются накопленные суммы: Delta - приращение счётчика
+// от конца предыдущего интервала до конца текущего с учётом сброса счётчика.
+type Rollup struct {
+	Time  time.Time `json:"t"`     // начало интервала
+	Min   float64   `json:"min"`   // минимальное значение за интервал
+	Max   float64   `json:"max"`   // максимальное значение за интервал
+	Sum   float64   `json:"sum"`   // сумма значений за интервал
+	Count int64     `json:"count"` // количество значений за интервал
+	Last  float64   `json:"last"`  // последнее значение за интервал
+	Delta float64   `json:"delta"` // приращение counter за интервал
+}
+
+// Avg - возвращает среднее значение метрики за интервал.
+func (r Rollup) Avg() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Sum / float64(r.Count)
+}
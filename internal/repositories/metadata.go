@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrMetricTypeConflict - ошибка записи метрики, тип которой отличается от зарегистрированного в реестре метаданных.
+var ErrMetricTypeConflict = errors.New("metric type conflict")
+
+// Metadata - метаданные метрики, которые хранятся в реестре на сервере.
+type Metadata struct {
+	ID            string            `json:"id"`                       // имя метрики
+	MType         string            `json:"type"`                     // тип метрики: gauge, counter или histogram
+	Unit          string            `json:"unit,omitempty"`           // единица измерения, например bytes или seconds
+	Description   string            `json:"description,omitempty"`    // описание метрики
+	AllowedLabels []string          `json:"allowed_labels,omitempty"` // имена меток, которые разрешено устанавливать метрике
+	Labels        map[string]string `json:"labels,omitempty"`         // метки метрики
+}
+
+// IsValidMetricType - проверяет, что тип метрики поддерживается сервисом.
+func IsValidMetricType(mtype string) bool {
+	switch mtype {
+	case "gauge", "counter", "histogram":
+		return true
+	}
+	return false
+}
+
+// Validate - проверяет корректность метаданных.
+func (m Metadata) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("metadata id is empty")
+	}
+	if !IsValidMetricType(m.MType) {
+		return fmt.Errorf("invalid type of metric: %s", m.MType)
+	}
+	if len(m.AllowedLabels) == 0 {
+		return nil
+	}
+	allowed := make(map[string]struct{}, len(m.AllowedLabels))
+	for _, label := range m.AllowedLabels {
+		allowed[label] = struct{}{}
+	}
+	for label := range m.Labels {
+		if _, ok := allowed[label]; !ok {
+			return fmt.Errorf("label %s is not allowed for metric %s", label, m.ID)
+		}
+	}
+	return nil
+}
+
+// TypeConflictError - возвращает ошибку ErrMetricTypeConflict с описанием конфликта.
+func TypeConflictError(name, registered, requested string) error {
+	return fmt.Errorf("%w: metric %s is registered as %s, got %s", ErrMetricTypeConflict, name, registered, requested)
+}
+
+// SortMetadata - сортирует слайс метаданных по имени метрики.
+func SortMetadata(metadata []Metadata) {
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].ID < metadata[j].ID
+	})
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			metadata: Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"},
+			wantErr:  false,
+		},
+		{
+			name:     "empty id",
+			metadata: Metadata{MType: "gauge"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid type",
+			metadata: Metadata{ID: "Alloc", MType: "summary"},
+			wantErr:  true,
+		},
+		{
+			name:     "allowed label",
+			metadata: Metadata{ID: "requests", MType: "counter", AllowedLabels: []string{"host"}, Labels: map[string]string{"host": "server"}},
+			wantErr:  false,
+		},
+		{
+			name:     "not allowed label",
+			metadata: Metadata{ID: "requests", MType: "counter", AllowedLabels: []string{"host"}, Labels: map[string]string{"region": "eu"}},
+			wantErr:  true,
+		},
+		{
+			name:     "any label without restrictions",
+			metadata: Metadata{ID: "requests", MType: "counter", Labels: map[string]string{"region": "eu"}},
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTypeConflictError(t *testing.T) {
+	err := TypeConflictError("Alloc", "gauge", "counter")
+	require.ErrorIs(t, err, ErrMetricTypeConflict)
+	require.Contains(t, err.Error(), "Alloc")
+}
@@ -36,6 +36,21 @@ func (m *MockMetricsReader) EXPECT() *MockMetricsReaderMockRecorder {
 	return m.recorder
 }
 
+// CountMetrics mocks base method.
+func (m *MockMetricsReader) CountMetrics(arg0 context.Context, arg1 repositories.MetricsFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountMetrics indicates an expected call of CountMetrics.
+func (mr *MockMetricsReaderMockRecorder) CountMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMetrics", reflect.TypeOf((*MockMetricsReader)(nil).CountMetrics), arg0, arg1)
+}
+
 // GetAllMetrics mocks base method.
 func (m *MockMetricsReader) GetAllMetrics(arg0 context.Context) (string, error) {
 	m.ctrl.T.Helper()
@@ -66,6 +81,21 @@ func (mr *MockMetricsReaderMockRecorder) GetAllMetricsSlice(arg0 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetricsSlice", reflect.TypeOf((*MockMetricsReader)(nil).GetAllMetricsSlice), arg0)
 }
 
+// GetHistogram mocks base method.
+func (m *MockMetricsReader) GetHistogram(arg0 context.Context, arg1 string) (repositories.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", arg0, arg1)
+	ret0, _ := ret[0].(repositories.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockMetricsReaderMockRecorder) GetHistogram(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockMetricsReader)(nil).GetHistogram), arg0, arg1)
+}
+
 // GetMetric mocks base method.
 func (m *MockMetricsReader) GetMetric(arg0 context.Context, arg1, arg2 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -80,3 +110,18 @@ func (mr *MockMetricsReaderMockRecorder) GetMetric(arg0, arg1, arg2 interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockMetricsReader)(nil).GetMetric), arg0, arg1, arg2)
 }
+
+// ListMetrics mocks base method.
+func (m *MockMetricsReader) ListMetrics(arg0 context.Context, arg1 repositories.MetricsFilter) ([]repositories.Metric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]repositories.Metric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockMetricsReaderMockRecorder) ListMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockMetricsReader)(nil).ListMetrics), arg0, arg1)
+}
@@ -2,9 +2,18 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// ErrStorageUnavailable - хранилище временно недоступно, операция не была выполнена и может быть повторена позже.
+var ErrStorageUnavailable = errors.New("storage is unavailable")
+
+// AgentIDHeader - заголовок, которым агент передаёт серверу свой идентификатор.
+const AgentIDHeader = "X-Agent-ID"
+
 // Интерфесы хранилища метрик.
 type (
 	// MetricsReader - интерфейс для получения метрик из хранилища.
@@ -12,13 +21,57 @@ type (
 		GetMetric(ctx context.Context, typeMetric string, nameMetric string) (string, error) // Метод для получения метрики по типу и имени метрики.
 		GetAllMetrics(context.Context) (string, error)                                       // Возвращает все хранимые в сервисе метрики в виде строки
 		GetAllMetricsSlice(context.Context) ([]Metric, error)                                // Возвращает все хранимые в сервисе метрики в виде слайса метрик
+		GetHistogram(ctx context.Context, nameMetric string) (Histogram, error)              // Возвращает метрику типа "histogram" по имени метрики
+		ListMetrics(ctx context.Context, filter MetricsFilter) ([]Metric, error)             // Возвращает отсортированные по имени метрики, удовлетворяющие условиям выборки
+		CountMetrics(ctx context.Context, filter MetricsFilter) (int, error)                 // Возвращает количество метрик, удовлетворяющих условиям выборки без учёта курсора и лимита
+	}
+
+	// HistoryReader - интерфейс для получения истории значений метрик.
+	HistoryReader interface {
+		GetHistory(ctx context.Context, nameMetric string, from, to time.Time) ([]Sample, error) // Возвращает значения метрики за период [from, to] в порядке возрастания времени
+	}
+
+	// RollupReader - интерфейс для получения агрегированной истории значений метрик.
+	RollupReader interface {
+		GetRollups(ctx context.Context, nameMetric string, resolution time.Duration, from, to time.Time) ([]Rollup, error) // Возвращает агрегаты метрики с началом интервала в [from, to] в порядке возрастания времени
+		GetLastRollup(ctx context.Context, nameMetric string, resolution time.Duration) (Rollup, bool, error)              // Возвращает последний агрегат метрики и false, если агрегатов нет
+	}
+
+	// RollupWriter - интерфейс для сохранения агрегированной истории и удаления устаревшей истории значений метрик.
+	RollupWriter interface {
+		AddRollups(ctx context.Context, nameMetric string, resolution time.Duration, rollups []Rollup) error // Добавляет или заменяет агрегаты метрики с совпадающим началом интервала
+		DeleteHistoryBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error)    // Удаляет значения (resolution = 0) или агрегаты всех метрик старше before и возвращает их количество
 	}
 
 	// MetricsWriter - интерфейс для добавления метрик в хранилище.
 	MetricsWriter interface {
-		AddGauge(context.Context, string, float64) error     // Добавлеет в сервис новую метрики типа "gauge"
-		AddCounter(context.Context, string, int64) error     // Добавлеет в сервис новую метрики типа "counter"
-		AddMetricsFromSlice(context.Context, []Metric) error // Добавляет в сервис метрики из слайса метрик
+		AddGauge(context.Context, string, float64) error       // Добавлеет в сервис новую метрики типа "gauge"
+		AddCounter(context.Context, string, int64) error       // Добавлеет в сервис новую метрики типа "counter"
+		AddHistogram(context.Context, string, Histogram) error // Объединяет переданную гистограмму с хранимой метрикой типа "histogram"
+		AddMetricsFromSlice(context.Context, []Metric) error   // Добавляет в сервис метрики из слайса метрик
+	}
+
+	// MetricsDeleter - интерфейс для удаления метрик из хранилища. Вместе с метрикой удаляются её метаданные.
+	MetricsDeleter interface {
+		DeleteMetrics(ctx context.Context, filter MetricsFilter) (int, error)  // Удаляет метрики, удовлетворяющие условиям выборки без учёта курсора и лимита, и возвращает их количество
+		DeleteStaleMetrics(ctx context.Context, before time.Time) (int, error) // Удаляет метрики, которые не обновлялись с момента before, и возвращает их количество
+	}
+
+	// MetadataReader - интерфейс для получения метаданных метрик из реестра.
+	MetadataReader interface {
+		GetMetadata(ctx context.Context, nameMetric string) (Metadata, error) // Возвращает метаданные метрики по имени метрики
+		GetAllMetadata(context.Context) ([]Metadata, error)                   // Возвращает метаданные всех зарегистрированных метрик
+	}
+
+	// MetadataWriter - интерфейс для изменения метаданных метрик в реестре.
+	MetadataWriter interface {
+		SetMetadata(context.Context, Metadata) error // Добавляет или обновляет метаданные метрики
+	}
+
+	// MetadataStorage - интерфейс реестра метаданных метрик.
+	MetadataStorage interface {
+		MetadataReader
+		MetadataWriter
 	}
 
 	// StorageStarter - интерфейс для инициализации хранилища.
@@ -29,16 +82,23 @@ type (
 	// IStorage - полный интерфейс храненилища метрик.
 	IStorage interface {
 		MetricsReader
+		HistoryReader
+		RollupReader
+		RollupWriter
 		MetricsWriter
+		MetricsDeleter
+		MetadataStorage
 		StorageStarter
 	}
 
 	// Metric - структура для работы с метриками json формата
 	Metric struct {
-		ID    string   `json:"id"`              // имя метрики
-		MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-		Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-		Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+		ID        string     `json:"id"`                   // имя метрики
+		MType     string     `json:"type"`                 // параметр, принимающий значение gauge, counter или histogram
+		Delta     *int64     `json:"delta,omitempty"`      // значение метрики в случае передачи counter
+		Value     *float64   `json:"value,omitempty"`      // значение метрики в случае передачи gauge
+		Histogram *Histogram `json:"histogram,omitempty"`  // значение метрики в случае передачи histogram
+		UpdatedAt *time.Time `json:"updated_at,omitempty"` // время последнего обновления, заполняется только при выборке через ListMetrics
 	}
 )
 
@@ -52,5 +112,26 @@ func (metrcic Metric) String() string {
 	if metrcic.Value != nil {
 		value = fmt.Sprintf("%g", *metrcic.Value)
 	}
-	return fmt.Sprintf("ID: %s, MType: %s, Delta: %s, Value: %s", metrcic.ID, metrcic.MType, delta, value)
+	var histogram = "nil"
+	if metrcic.Histogram != nil {
+		histogram = metrcic.Histogram.String()
+	}
+	return fmt.Sprintf("ID: %s, MType: %s, Delta: %s, Value: %s, Histogram: %s", metrcic.ID, metrcic.MType, delta, value, histogram)
+}
+
+// FormatMetrics - возвращает текстовое представление метрик, по одной строке на метрику.
+// Используется хранилищами для реализации метода GetAllMetrics.
+func FormatMetrics(metrics []Metric) string {
+	var result strings.Builder
+	for _, metric := range metrics {
+		switch {
+		case metric.Value != nil:
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
+		case metric.Delta != nil:
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
+		case metric.Histogram != nil:
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %s\n", metric.MType, metric.ID, metric.Histogram)
+		}
+	}
+	return result.String()
 }
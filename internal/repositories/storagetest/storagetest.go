@@ -0,0 +1,601 @@
+// Packet storagetest implement common test suite for every implementation of repositories.IStorage.
+// Хранилище проходит набор, если ведёт себя так же, как остальные хранилища сервера:
+// одинаково форматирует значения, накапливает counter, проверяет типы метрик, записывает батч атомарно,
+// корректно работает при параллельных запросах и не выполняет запросы с отменённым контекстом.
+package storagetest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Factory - создаёт пустое хранилище для одного теста набора.
+// Освобождение ресурсов хранилища регистрируется через t.Cleanup.
+type Factory func(t *testing.T) repositories.IStorage
+
+// Run - запускает набор тестов для хранилища, создаваемого newStorage. Каждый тест получает новое хранилище.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, stor repositories.IStorage)
+	}{
+		{name: "GetMetric", test: testGetMetric},
+		{name: "GetAllMetrics", test: testGetAllMetrics},
+		{name: "GaugeValues", test: testGaugeValues},
+		{name: "CounterAccumulation", test: testCounterAccumulation},
+		{name: "Histogram", test: testHistogram},
+		{name: "TypeConflict", test: testTypeConflict},
+		{name: "BatchAtomicity", test: testBatchAtomicity},
+		{name: "Metadata", test: testMetadata},
+		{name: "ListMetrics", test: testListMetrics},
+		{name: "DeleteMetrics", test: testDeleteMetrics},
+		{name: "History", test: testHistory},
+		{name: "Rollups", test: testRollups},
+		{name: "Concurrency", test: testConcurrency},
+		{name: "ContextCancellation", test: testContextCancellation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// ids - возвращает имена метрик.
+func ids(metrics []repositories.Metric) []string {
+	result := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		result = append(result, metric.ID)
+	}
+	return result
+}
+
+// utc - приводит время агрегатов к UTC, так как хранилища могут возвращать время в другом часовом поясе.
+func utc(rollups []repositories.Rollup) []repositories.Rollup {
+	for i := range rollups {
+		rollups[i].Time = rollups[i].Time.UTC()
+	}
+	return rollups
+}
+
+func testGetMetric(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddHistogram(ctx, "Latency", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 4.5, Count: 3}))
+
+	tests := []struct {
+		name       string
+		metricType string
+		metricName string
+		want       string
+		wantErr    bool
+	}{
+		{name: "gauge", metricType: "gauge", metricName: "Alloc", want: "1.5"},
+		{name: "counter", metricType: "counter", metricName: "PollCount", want: "3"},
+		{name: "histogram", metricType: "histogram", metricName: "Latency", want: `{"bounds":[1],"counts":[1,2],"sum":4.5,"count":3}`},
+		{name: "other type", metricType: "counter", metricName: "Alloc", wantErr: true},
+		{name: "unknown type", metricType: "unknown", metricName: "Alloc", wantErr: true},
+		{name: "unknown metric", metricType: "gauge", metricName: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stor.GetMetric(ctx, tt.metricType, tt.metricName)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testGetAllMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+
+	all, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "", all)
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	require.NoError(t, stor.AddGauge(ctx, "gauge1", 17.77))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 5))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 2))
+
+	// метрики упорядочены по имени независимо от порядка записи
+	all, err = stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "type: gauge, name: Alloc, value: 2\ntype: counter, name: PollCount, value: 5\ntype: gauge, name: gauge1, value: 17.77\n", all)
+
+	alloc, gauge1 := 2.0, 17.77
+	pollCount := int64(5)
+	metrics, err = stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Metric{
+		{ID: "Alloc", MType: "gauge", Value: &alloc},
+		{ID: "PollCount", MType: "counter", Delta: &pollCount},
+		{ID: "gauge1", MType: "gauge", Value: &gauge1},
+	}, metrics)
+}
+
+func testGaugeValues(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		value float64
+		want  string
+	}{
+		{name: "negative", value: -82352.34534, want: "-82352.34534"},
+		{name: "zero", value: 0, want: "0"},
+		{name: "max", value: math.MaxFloat64, want: "1.7976931348623157e+308"},
+		{name: "smallest", value: math.SmallestNonzeroFloat64, want: "5e-324"},
+		{name: "positive infinity", value: math.Inf(1), want: "+Inf"},
+		{name: "negative infinity", value: math.Inf(-1), want: "-Inf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, stor.AddGauge(ctx, "Gauge", tt.value))
+			got, err := stor.GetMetric(ctx, "gauge", "Gauge")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testCounterAccumulation(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", -2))
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "5", got)
+
+	// значения counter из батча суммируются между собой и с хранимым значением
+	delta := int64(10)
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	}))
+	got, err = stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "25", got)
+
+	// значение gauge заменяется
+	value := 1.5
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 10))
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "Alloc", MType: "gauge", Value: &value}}))
+	got, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, nil))
+}
+
+func testHistogram(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+
+	require.NoError(t, stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3}))
+	require.NoError(t, stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5}))
+	got, err := stor.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, got)
+
+	// гистограммы из батча объединяются с хранимыми
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "latency", MType: "histogram", Histogram: &repositories.Histogram{
+		Bounds: []float64{1, 2}, Counts: []uint64{2, 0, 0}, Sum: 1, Count: 2}}}))
+	got, err = stor.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), got.Count)
+
+	// гистограмму с другими границами бакетов объединить нельзя
+	err = stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{0, 0, 0}})
+	require.ErrorIs(t, err, repositories.ErrHistogramBoundsMismatch)
+
+	// некорректная гистограмма не записывается
+	err = stor.AddHistogram(ctx, "broken", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1})
+	require.Error(t, err)
+	_, err = stor.GetHistogram(ctx, "broken")
+	require.Error(t, err)
+
+	_, err = stor.GetHistogram(ctx, "unknown")
+	require.Error(t, err)
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	_, err = stor.GetHistogram(ctx, "Alloc")
+	require.Error(t, err)
+}
+
+func testTypeConflict(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+
+	err := stor.AddCounter(ctx, "Alloc", 3)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	err = stor.AddHistogram(ctx, "Alloc", repositories.NewHistogram([]float64{1}))
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// батч с конфликтом типов не записывается частично
+	delta := int64(5)
+	value := 2.5
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "counter", Delta: &delta},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	_, err = stor.GetMetric(ctx, "counter", "PollCount")
+	require.Error(t, err)
+
+	// тип нельзя изменить и внутри одного батча
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "HeapAlloc", MType: "gauge", Value: &value},
+		{ID: "HeapAlloc", MType: "counter", Delta: &delta},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	_, err = stor.GetMetric(ctx, "gauge", "HeapAlloc")
+	require.Error(t, err)
+
+	got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+}
+
+func testBatchAtomicity(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	require.NoError(t, stor.AddHistogram(ctx, "Latency", repositories.NewHistogram([]float64{1})))
+
+	delta := int64(5)
+	value := 2.5
+	tests := []struct {
+		name   string
+		broken repositories.Metric
+	}{
+		{name: "gauge without value", broken: repositories.Metric{ID: "HeapIdle", MType: "gauge"}},
+		{name: "counter without delta", broken: repositories.Metric{ID: "HeapIdle", MType: "counter"}},
+		{name: "histogram without value", broken: repositories.Metric{ID: "HeapIdle", MType: "histogram"}},
+		{name: "unknown type", broken: repositories.Metric{ID: "HeapIdle", MType: "unknown", Value: &value}},
+		{name: "invalid histogram", broken: repositories.Metric{ID: "HeapIdle", MType: "histogram", Histogram: &repositories.Histogram{
+			Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}}},
+		{name: "histogram bounds mismatch", broken: repositories.Metric{ID: "Latency", MType: "histogram", Histogram: &repositories.Histogram{
+			Bounds: []float64{2}, Counts: []uint64{0, 0}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+				{ID: "HeapAlloc", MType: "gauge", Value: &value},
+				{ID: "PollCount", MType: "counter", Delta: &delta},
+				tt.broken,
+			})
+			require.Error(t, err)
+
+			// ни одна метрика батча не записана
+			_, err = stor.GetMetric(ctx, "gauge", "HeapAlloc")
+			require.Error(t, err)
+			got, err := stor.GetMetric(ctx, "counter", "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, "1", got)
+			count, err := stor.CountMetrics(ctx, repositories.MetricsFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	}
+}
+
+func testMetadata(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+
+	// метрики регистрируются в реестре при первой записи
+	all, err := stor.GetAllMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Metadata{
+		{ID: "Alloc", MType: "gauge"},
+		{ID: "PollCount", MType: "counter"},
+	}, all)
+
+	meta := repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"}
+	require.NoError(t, stor.SetMetadata(ctx, meta))
+	got, err := stor.GetMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, meta, got)
+
+	// тип метрики, для которой уже есть значения, изменить нельзя
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "PollCount", MType: "gauge"})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// метаданные можно зарегистрировать заранее, и тогда они ограничивают тип метрики
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "Latency", MType: "histogram"}))
+	err = stor.AddGauge(ctx, "Latency", 1)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "Alloc", MType: "unknown"})
+	require.Error(t, err)
+	_, err = stor.GetMetadata(ctx, "unknown")
+	require.Error(t, err)
+}
+
+func testListMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	for _, name := range []string{"HeapIdle", "Alloc", "HeapAlloc"} {
+		require.NoError(t, stor.AddGauge(ctx, name, 1))
+	}
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "HeapIdle", MType: "gauge", Labels: map[string]string{"host": "agent"}}))
+
+	tests := []struct {
+		name      string
+		filter    repositories.MetricsFilter
+		want      []string
+		wantCount int
+	}{
+		{name: "all sorted", filter: repositories.MetricsFilter{}, want: []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}, wantCount: 4},
+		{name: "id", filter: repositories.MetricsFilter{ID: "HeapAlloc"}, want: []string{"HeapAlloc"}, wantCount: 1},
+		{name: "type", filter: repositories.MetricsFilter{Type: "counter"}, want: []string{"PollCount"}, wantCount: 1},
+		{name: "prefix", filter: repositories.MetricsFilter{Prefix: "Heap"}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 2},
+		{name: "match", filter: repositories.MetricsFilter{Match: "Alloc$"}, want: []string{"Alloc", "HeapAlloc"}, wantCount: 2},
+		{name: "labels", filter: repositories.MetricsFilter{Labels: map[string]string{"host": "agent"}}, want: []string{"HeapIdle"}, wantCount: 1},
+		{name: "cursor and limit", filter: repositories.MetricsFilter{AfterID: "Alloc", Limit: 2}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 4},
+		{name: "nothing", filter: repositories.MetricsFilter{Prefix: "Unknown"}, want: []string{}, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := stor.ListMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(metrics))
+			for _, metric := range metrics {
+				assert.NotNil(t, metric.UpdatedAt, metric.ID)
+			}
+
+			count, err := stor.CountMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+
+	_, err := stor.ListMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+	_, err = stor.CountMetrics(ctx, repositories.MetricsFilter{Type: "unknown"})
+	require.Error(t, err)
+}
+
+func testDeleteMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	start := time.Now()
+	require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddHistogram(ctx, "HeapPause", repositories.NewHistogram([]float64{1})))
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.Error(t, err)
+	_, err = stor.GetMetadata(ctx, "Alloc")
+	require.Error(t, err)
+
+	// после удаления имя метрики можно использовать с другим типом
+	require.NoError(t, stor.AddCounter(ctx, "Alloc", 1))
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Prefix: "Heap"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc", "PollCount"}, ids(metrics))
+
+	// удаляются только метрики, которые не обновлялись с заданного времени
+	deleted, err = stor.DeleteStaleMetrics(ctx, start.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = stor.DeleteStaleMetrics(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	count, err := stor.CountMetrics(ctx, repositories.MetricsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func testHistory(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 2.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddHistogram(ctx, "Pause", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2}))
+	to := time.Now().Add(time.Minute)
+
+	values := func(samples []repositories.Sample) []float64 {
+		result := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			result = append(result, sample.Value)
+		}
+		return result
+	}
+
+	samples, err := stor.GetHistory(ctx, "Alloc", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2.5}, values(samples))
+
+	// для counter сохраняется накопленная сумма
+	samples, err = stor.GetHistory(ctx, "PollCount", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 7}, values(samples))
+
+	// для histogram сохраняется количество наблюдений
+	samples, err = stor.GetHistory(ctx, "Pause", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2}, values(samples))
+
+	// значения вне периода не возвращаются
+	samples, err = stor.GetHistory(ctx, "Alloc", to, to.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	_, err = stor.GetHistory(ctx, "unknown", from, to)
+	require.Error(t, err)
+}
+
+func testRollups(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Min: 2, Max: 2, Sum: 2, Count: 1, Last: 2, Delta: 1},
+		{Time: t0, Min: 1, Max: 1, Sum: 1, Count: 1, Last: 1},
+	}))
+	// агрегат с тем же началом интервала заменяется
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Min: 2, Max: 5, Sum: 7, Count: 2, Last: 5, Delta: 4},
+		{Time: t0.Add(2 * time.Minute), Min: 6, Max: 6, Sum: 6, Count: 1, Last: 6, Delta: 1},
+	}))
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Hour, []repositories.Rollup{{Time: t0, Min: 1, Max: 6, Sum: 14, Count: 4, Last: 6, Delta: 5}}))
+	assert.Error(t, stor.AddRollups(ctx, "unknown", time.Minute, []repositories.Rollup{{Time: t0}}))
+	assert.Error(t, stor.AddRollups(ctx, "PollCount", 0, []repositories.Rollup{{Time: t0}}))
+
+	rollups, err := stor.GetRollups(ctx, "PollCount", time.Minute, t0.Add(time.Minute), t0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Min: 2, Max: 5, Sum: 7, Count: 2, Last: 5, Delta: 4},
+		{Time: t0.Add(2 * time.Minute), Min: 6, Max: 6, Sum: 6, Count: 1, Last: 6, Delta: 1},
+	}, utc(rollups))
+	last, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 6.0, last.Last)
+	_, err = stor.GetRollups(ctx, "unknown", time.Minute, t0, t0)
+	assert.Error(t, err)
+
+	// удаляются только агрегаты заданного уровня
+	deleted, err := stor.DeleteHistoryBefore(ctx, time.Minute, t0.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	rollups, err = stor.GetRollups(ctx, "PollCount", time.Hour, t0, t0)
+	require.NoError(t, err)
+	assert.Len(t, rollups, 1)
+
+	deleted, err = stor.DeleteHistoryBefore(ctx, 0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	samples, err := stor.GetHistory(ctx, "PollCount", t0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// агрегаты удаляются вместе с метрикой
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "PollCount"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	_, ok, err = stor.GetLastRollup(ctx, "PollCount", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func testConcurrency(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	const (
+		workers = 8
+		updates = 25
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*workers*updates)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delta := int64(1)
+			for j := 0; j < updates; j++ {
+				errs <- stor.AddCounter(ctx, "PollCount", 1)
+				errs <- stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "Batch", MType: "counter", Delta: &delta}})
+				errs <- stor.AddHistogram(ctx, "Latency", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1})
+				_, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// параллельные обновления не теряются
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "200", got)
+	got, err = stor.GetMetric(ctx, "counter", "Batch")
+	require.NoError(t, err)
+	assert.Equal(t, "200", got)
+	histogram, err := stor.GetHistogram(ctx, "Latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(workers*updates), histogram.Count)
+	assert.Equal(t, []uint64{workers * updates, 0}, histogram.Counts)
+}
+
+func testContextCancellation(t *testing.T, stor repositories.IStorage) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{name: "canceled", ctx: canceled, want: context.Canceled},
+		{name: "deadline exceeded", ctx: expired, want: context.DeadlineExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := int64(1)
+			require.ErrorIs(t, stor.AddGauge(tt.ctx, "Alloc", 2), tt.want)
+			require.ErrorIs(t, stor.AddCounter(tt.ctx, "PollCount", 1), tt.want)
+			require.ErrorIs(t, stor.AddHistogram(tt.ctx, "Latency", repositories.NewHistogram([]float64{1})), tt.want)
+			require.ErrorIs(t, stor.AddMetricsFromSlice(tt.ctx, []repositories.Metric{{ID: "Batch", MType: "counter", Delta: &delta}}), tt.want)
+
+			_, err := stor.GetMetric(tt.ctx, "gauge", "Alloc")
+			require.ErrorIs(t, err, tt.want)
+			_, err = stor.GetAllMetricsSlice(tt.ctx)
+			require.ErrorIs(t, err, tt.want)
+			_, err = stor.ListMetrics(tt.ctx, repositories.MetricsFilter{})
+			require.ErrorIs(t, err, tt.want)
+			_, err = stor.DeleteMetrics(tt.ctx, repositories.MetricsFilter{})
+			require.ErrorIs(t, err, tt.want)
+
+			// запросы с отменённым контекстом не изменяют хранилище
+			got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+			require.NoError(t, err)
+			assert.Equal(t, "1", got)
+			count, err := stor.CountMetrics(ctx, repositories.MetricsFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Packet agentconfig implement storage and http handler of agent settings, which the server pushes to agents.
+package agentconfig
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Configs - настройки агентов. Настройки агента складываются из настроек по умолчанию,
+// настроек группы агента и настроек самого агента, каждый следующий уровень переопределяет заданные в нём параметры.
+type Configs struct {
+	Default repositories.AgentConfig            `json:"default"` // настройки всех агентов
+	Groups  map[string]repositories.AgentConfig `json:"groups"`  // настройки групп агентов по имени группы
+	Agents  map[string]repositories.AgentConfig `json:"agents"`  // настройки агентов по идентификатору агента
+}
+
+// Validate - проверяет корректность настроек всех уровней.
+func (c Configs) Validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for name, group := range c.Groups {
+		if err := group.Validate(); err != nil {
+			return fmt.Errorf("group %s: %w", name, err)
+		}
+	}
+	for id, agent := range c.Agents {
+		if err := agent.Validate(); err != nil {
+			return fmt.Errorf("agent %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Resolve - возвращает настройки агента id из группы group с версией, вычисленной по содержимому настроек.
+func (c Configs) Resolve(id, group string) repositories.AgentConfig {
+	result := repositories.AgentConfig{}.Merge(c.Default)
+	if group != "" {
+		result = result.Merge(c.Groups[group])
+	}
+	if id != "" {
+		result = result.Merge(c.Agents[id])
+	}
+	result.Version = version(result)
+	return result
+}
+
+// version - возвращает версию настроек агента в виде хеша их JSON-представления.
+func version(config repositories.AgentConfig) string {
+	config.Version = ""
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Load - читает и проверяет настройки агентов из JSON-файла.
+func Load(path string) (Configs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Configs{}, fmt.Errorf("open agent configuration file error: %w", err)
+	}
+	defer f.Close()
+
+	var configs Configs
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&configs); err != nil {
+		return Configs{}, fmt.Errorf("parse agent configuration file error: %w", err)
+	}
+	if err := configs.Validate(); err != nil {
+		return Configs{}, fmt.Errorf("invalid agent configuration: %w", err)
+	}
+	return configs, nil
+}
+
+// Store - настройки агентов одного сервера, которые можно заменить без перезапуска.
+type Store struct {
+	configs atomic.Pointer[Configs]
+}
+
+// NewStore - фабричная функция структуры Store.
+func NewStore(c Configs) *Store {
+	s := &Store{}
+	s.Set(c)
+	return s
+}
+
+// Set - устанавливает настройки агентов. Агенты получают новые настройки при следующем обращении к серверу.
+func (s *Store) Set(c Configs) {
+	s.configs.Store(&c)
+}
+
+// Get - возвращает настройки агентов.
+func (s *Store) Get() Configs {
+	if c := s.configs.Load(); c != nil {
+		return *c
+	}
+	return Configs{}
+}
+
+// resolveRequest - возвращает настройки агента, отправившего запрос req.
+func (s *Store) resolveRequest(req *http.Request) repositories.AgentConfig {
+	return s.Get().Resolve(req.Header.Get(repositories.AgentIDHeader), req.Header.Get(repositories.AgentGroupHeader))
+}
+
+// Handler - возвращает настройки агента, отправившего запрос. Версия настроек передаётся в заголовке ETag,
+// если она совпадает с версией из заголовка If-None-Match, сервер отвечает 304 Not Modified.
+func (s *Store) Handler() http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		config := s.resolveRequest(req)
+		etag := `"` + config.Version + `"`
+		res.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(res).Encode(config); err != nil {
+			logger.FromContext(req.Context()).Error("encode agent config error", zap.String("error", error.Error(err)))
+		}
+	}
+	return fn
+}
+
+// VersionMiddleware - middleware, которое передаёт в заголовке repositories.AgentConfigVersionHeader ответа
+// версию настроек агента, отправившего запрос, чтобы агент запросил настройки после их изменения.
+func (s *Store) VersionMiddleware(handler http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set(repositories.AgentConfigVersionHeader, s.resolveRequest(req).Version)
+		handler.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
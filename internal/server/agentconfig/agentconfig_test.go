@@ -0,0 +1,130 @@
+package agentconfig
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func testConfigs() Configs {
+	return Configs{
+		Default: repositories.AgentConfig{
+			ReportInterval: repositories.Duration{Duration: 10 * time.Second},
+			PollInterval:   repositories.Duration{Duration: 2 * time.Second},
+		},
+		Groups: map[string]repositories.AgentConfig{
+			"edge": {PollInterval: repositories.Duration{Duration: 5 * time.Second}, Collectors: []string{"runtime"}},
+		},
+		Agents: map[string]repositories.AgentConfig{
+			"host-1": {RateLimit: 4},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	c := testConfigs()
+
+	config := c.Resolve("", "")
+	assert.Equal(t, 10*time.Second, config.ReportInterval.Duration)
+	assert.Equal(t, 2*time.Second, config.PollInterval.Duration)
+	assert.Empty(t, config.Collectors)
+	assert.NotEmpty(t, config.Version)
+
+	config = c.Resolve("host-1", "edge")
+	assert.Equal(t, 10*time.Second, config.ReportInterval.Duration)
+	assert.Equal(t, 5*time.Second, config.PollInterval.Duration)
+	assert.Equal(t, []string{"runtime"}, config.Collectors)
+	assert.Equal(t, 4, config.RateLimit)
+
+	// неизвестные агент и группа получают настройки по умолчанию
+	assert.Equal(t, c.Resolve("", ""), c.Resolve("host-2", "core"))
+
+	// версия меняется только вместе с настройками
+	assert.Equal(t, config.Version, c.Resolve("host-1", "edge").Version)
+	assert.NotEqual(t, config.Version, c.Resolve("", "edge").Version)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "agents.json")
+	data := `{"default":{"report_interval":"10s","poll_interval":"2s"},"groups":{"edge":{"poll_interval":"5s","collectors":["runtime"]}},"agents":{"host-1":{"rate_limit":4}}}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	c, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, testConfigs(), c)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"groups":{"edge":{"poll_interval":"10ms"}}}`), 0o600))
+	_, err = Load(invalid)
+	assert.Error(t, err)
+
+	unknown := filepath.Join(dir, "unknown.json")
+	require.NoError(t, os.WriteFile(unknown, []byte(`{"default":{"poll":"2s"}}`), 0o600))
+	_, err = Load(unknown)
+	assert.Error(t, err)
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	store := NewStore(testConfigs())
+
+	do := func(etag string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/agent/config", nil)
+		req.Header.Set(repositories.AgentIDHeader, "host-1")
+		req.Header.Set(repositories.AgentGroupHeader, "edge")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		store.Handler().ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do("")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var config repositories.AgentConfig
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&config))
+	assert.Equal(t, testConfigs().Resolve("host-1", "edge"), config)
+	etag := res.Header.Get("ETag")
+	assert.Equal(t, `"`+config.Version+`"`, etag)
+
+	res = do(etag)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	// после изменения настроек агент получает новую версию
+	c := testConfigs()
+	c.Agents["host-1"] = repositories.AgentConfig{RateLimit: 8}
+	store.Set(c)
+	res = do(etag)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestVersionMiddleware(t *testing.T) {
+	store := NewStore(testConfigs())
+
+	handler := store.VersionMiddleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.Header.Set(repositories.AgentGroupHeader, "edge")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, testConfigs().Resolve("", "edge").Version, res.Header.Get(repositories.AgentConfigVersionHeader))
+}
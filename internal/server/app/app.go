@@ -0,0 +1,468 @@
+// Packet app implement metrics server, which holds its configuration and dependencies and can be embedded into another application.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/agentconfig"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/auth"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/bolt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/compress"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/dashboard"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/encrypt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/fallback"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/handlers"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hub"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/retention"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/timeout"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+)
+
+const shutdownWaitPeriod = 20 * time.Second // для установки в контекст для реализаации graceful shutdown
+
+const replicaCheckInterval = 5 * time.Second // период проверки доступности реплики базы данных
+
+const (
+	fallbackBufferLimit   = 100000      // максимальное количество метрик, накапливаемых в памяти, пока база данных недоступна
+	fallbackFlushInterval = time.Second // период записи накопленных метрик в базу данных
+)
+
+// Server - сервер метрик. Все параметры и зависимости сервера хранятся в его экземпляре,
+// поэтому в одном процессе можно запустить несколько серверов.
+type Server struct {
+	mu  sync.RWMutex // защищает параметры, которые меняются при перезагрузке конфигурации
+	cfg Config
+
+	level zap.AtomicLevel
+	log   *zap.Logger
+
+	stor     repositories.IStorage
+	db       *sql.DB          // соединение с базой данных для обработчика /ping, nil - база данных не используется
+	replica  *pg.Store        // хранилище с репликой, доступность которой проверяется в фоне
+	buffered *fallback.Store  // буфер метрик на время недоступности базы данных
+	writer   saver.FileWriter // запись метрик в файл в режиме SAVEINFILE
+	closers  []io.Closer
+
+	hasher    *hasher.Hasher
+	auth      *auth.Authenticator
+	decrypter *encrypt.Decrypter
+	timeout   *timeout.Limiter
+	limits    *ratelimit.Limits
+	agents    *agentconfig.Store
+	retention *rollup.Retention
+	self      *selfmetrics.Registry
+	updates   *hub.Hub // принятые обновления метрик для подписчиков потока /api/v1/stream
+}
+
+// newServer - создаёт сервер с параметрами cfg без хранилища метрик.
+func newServer(cfg Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	level := zap.NewAtomicLevel()
+	log, err := logger.New(level)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		level:     level,
+		log:       log,
+		hasher:    hasher.New(""),
+		auth:      auth.New(""),
+		decrypter: encrypt.New(nil),
+		timeout:   timeout.New(0),
+		limits:    ratelimit.New(),
+		agents:    agentconfig.NewStore(agentconfig.Configs{}),
+		retention: rollup.NewRetention(rollup.DefaultPolicy),
+		self:      selfmetrics.NewRegistry(),
+		updates:   hub.New(),
+	}
+	s.apply(cfg)
+	// количество отклонённых из-за ограничений нагрузки запросов выводится вместе с метриками в /metrics
+	s.self.Register("ratelimit", s.limits.Metrics)
+	return s, nil
+}
+
+// New - создаёт сервер с параметрами cfg, который хранит метрики в stor. Если задан только путь к файлу
+// cfg.FileStoragePath, метрики из stor периодически сохраняются в файл.
+func New(cfg Config, stor repositories.IStorage) (*Server, error) {
+	s, err := newServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.stor = stor
+	if err := s.openFile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open - создаёт сервер с параметрами cfg и открывает хранилище метрик, выбранное по cfg.Mode.
+// Хранилище закрывается методом Close.
+func Open(cfg Config) (*Server, error) {
+	s, err := newServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openStorage(); err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	return s, nil
+}
+
+// openStorage - открывает хранилище метрик в базе данных, во встроенной базе или в оперативной памяти.
+func (s *Server) openStorage() error {
+	ctx := logger.WithContext(context.Background(), s.log)
+	switch s.cfg.Mode() {
+	case SAVEINDATABASE:
+		// Один пул соединений используется хранилищем метрик и обработчиком /ping
+		db, err := pg.Open(s.cfg.DatabaseDSN, s.cfg.Pool)
+		if err != nil {
+			return fmt.Errorf("connection to database: %w", err)
+		}
+		s.closers = append(s.closers, db)
+		s.db = db
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("checking connection with database: %w", err)
+		}
+		// при наличии реплики метрики читаются с неё
+		store := pg.NewStore(db)
+		if s.cfg.ReplicaDSN != "" {
+			replicaDB, err := pg.Open(s.cfg.ReplicaDSN, s.cfg.Pool)
+			if err != nil {
+				return fmt.Errorf("connection to database replica: %w", err)
+			}
+			s.closers = append(s.closers, replicaDB)
+			store = pg.NewStoreWithReplica(db, replicaDB)
+			s.replica = store
+		}
+		// статистика пулов соединений выводится вместе с метриками в /metrics
+		s.self.Register("pg", store.PoolMetrics)
+		if err := store.Bootstrap(ctx); err != nil {
+			return fmt.Errorf("prepare database to work: %w", err)
+		}
+		// пока база данных недоступна, принятые метрики накапливаются в памяти и записываются после её восстановления
+		s.buffered = fallback.New(store, fallbackBufferLimit)
+		// по типам зарегистрированных метрик буфер отклоняет конфликтующие записи, пока база данных недоступна
+		if err := s.buffered.LoadTypes(ctx); err != nil {
+			return fmt.Errorf("load metric types: %w", err)
+		}
+		s.self.Register("fallback", s.buffered.Metrics)
+		s.stor = s.buffered
+	case SAVEINBOLT:
+		// открываю файл встроенной базы, при необходимости сжимая его
+		boltDB, err := bolt.Open(ctx, s.cfg.BoltPath)
+		if err != nil {
+			return fmt.Errorf("open embedded database %s: %w", s.cfg.BoltPath, err)
+		}
+		s.closers = append(s.closers, boltDB)
+		s.stor = bolt.NewStore(boltDB)
+		if err := s.stor.Bootstrap(ctx); err != nil {
+			return fmt.Errorf("prepare embedded database to work: %w", err)
+		}
+	default:
+		s.stor = storage.NewDefaultMemStorage()
+		return s.openFile()
+	}
+	return nil
+}
+
+// openFile - открывает файл для сохранения метрик, если сервер запущен в режиме SAVEINFILE.
+func (s *Server) openFile() error {
+	if s.cfg.Mode() != SAVEINFILE {
+		return nil
+	}
+	writer, err := saver.NewWriter(s.cfg.FileStoragePath)
+	if err != nil {
+		return fmt.Errorf("create writer for saving metrics: %w", err)
+	}
+	s.closers = append(s.closers, writer)
+	s.writer = writer
+	return nil
+}
+
+// apply - устанавливает параметры cfg в компоненты сервера. Параметры должны быть проверены заранее.
+func (s *Server) apply(cfg Config) {
+	if lvl, err := zap.ParseAtomicLevel(cfg.LogLevel); err == nil {
+		s.level.SetLevel(lvl.Level())
+	}
+	s.hasher.SetKey(cfg.Key)
+	s.decrypter.SetCryptoGrapher(encryption.Initialize("", cfg.CryptoKey))
+	s.auth.SetToken(cfg.AdminToken)
+	s.retention.SetPolicy(cfg.Retention)
+	s.timeout.SetTimeout(cfg.RequestTimeout)
+	// новый ограничитель заполняет корзины клиентов заново, поэтому создаётся только при изменении ограничения
+	if cfg.RateLimit != s.cfg.RateLimit || cfg.RateBurst != s.cfg.RateBurst {
+		s.limits.SetRateLimit(cfg.RateLimit, cfg.RateBurst)
+	}
+	s.limits.SetMaxConcurrentWrites(cfg.MaxConcurrentWrites)
+	s.agents.Set(cfg.AgentConfigs)
+	s.cfg = cfg
+}
+
+// Reconfigure - применяет параметры cfg, которые можно изменить без перезапуска сервера. Параметры, изменение
+// которых требует перезапуска, остаются прежними. Если параметры некорректны, не применяется ни один из них.
+func (s *Server) Reconfigure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apply(cfg.withRestartSettings(s.cfg))
+	return nil
+}
+
+// Config - возвращает действующие параметры сервера.
+func (s *Server) Config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// Logger - возвращает логер сервера.
+func (s *Server) Logger() *zap.Logger {
+	return s.log
+}
+
+// Storage - возвращает хранилище метрик сервера.
+func (s *Server) Storage() repositories.IStorage {
+	return s.stor
+}
+
+// Run - загружает метрики из файла, запускает фоновые задачи сервера и обрабатывает запросы, пока не отменён
+// контекст ctx. После отмены контекста сервер дожидается завершения запросов и сохраняет накопленные метрики.
+func (s *Server) Run(ctx context.Context) error {
+	ctx = logger.WithContext(ctx, s.log)
+	if err := s.restore(ctx); err != nil {
+		return err
+	}
+
+	background, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+	var wg sync.WaitGroup
+	s.startBackground(background, &wg)
+
+	address := s.Config().Address
+	srv := &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+	// потоки событий живут до отключения клиента, поэтому при остановке сервера они закрываются сразу,
+	// чтобы Shutdown не ждал их до истечения shutdownWaitPeriod
+	srv.RegisterOnShutdown(s.updates.Close)
+	serveErr := make(chan error, 1)
+	go func() {
+		s.log.Info("Running server", zap.String("address", address))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		s.log.Info("Shutting down server...")
+		// останавливаю сервер, чтобы он перестал принимать новые запросы
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownWaitPeriod)
+		if err = srv.Shutdown(shutdownCtx); err != nil {
+			s.log.Error("Stopping server error", zap.String("error", error.Error(err)))
+		}
+		cancel()
+	}
+
+	stopBackground()
+	wg.Wait()
+	s.flush(context.WithoutCancel(ctx))
+	return err
+}
+
+// restore - загружает метаданные и метрики из файла, сохраненные в предыдущих запусках, если это требуется параметрами.
+// Метаданные загружаются первыми, чтобы метрики проверялись по зарегистрированным типам.
+func (s *Server) restore(ctx context.Context) error {
+	cfg := s.Config()
+	if s.writer == nil || !cfg.Restore {
+		return nil
+	}
+	reader, err := saver.NewReader(cfg.FileStoragePath)
+	if err != nil {
+		return fmt.Errorf("create reader of saved metrics: %w", err)
+	}
+	if err := saver.AddMetadataFromFile(ctx, s.stor, reader); err != nil {
+		return fmt.Errorf("add metadata from file: %w", err)
+	}
+	if err := saver.AddMetricsFromFile(ctx, s.stor, reader); err != nil {
+		return fmt.Errorf("add metrics from file: %w", err)
+	}
+	return nil
+}
+
+// startBackground - запускает фоновые задачи сервера, которые работают до отмены контекста ctx.
+func (s *Server) startBackground(ctx context.Context, wg *sync.WaitGroup) {
+	goBackground := func(task func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task()
+		}()
+	}
+	if s.writer != nil {
+		goBackground(func() { s.flushToFile(ctx) })
+	}
+	if s.replica != nil {
+		goBackground(func() { s.replica.MonitorReplica(ctx, replicaCheckInterval) })
+	}
+	if s.buffered != nil {
+		goBackground(func() { s.buffered.Run(ctx, fallbackFlushInterval) })
+	}
+	// удаляю метрики, которые не обновлялись дольше заданного времени
+	goBackground(func() { retention.Run(ctx, s.stor, s.Config().MetricsTTL) })
+	// сжимаю историю значений метрик в агрегаты и удаляю историю старше времени хранения её уровня
+	goBackground(func() { rollup.Run(ctx, s.stor, s.retention) })
+}
+
+// flushToFile - сохраняет метрики и их метаданные в файл, пока не отменён контекст.
+func (s *Server) flushToFile(ctx context.Context) {
+	s.log.Debug("starting flush metrics to file")
+
+	for {
+		s.writeFile(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		// интервал перечитывается, так как он меняется при перезагрузке конфигурации
+		case <-time.After(s.Config().StoreInterval):
+		}
+	}
+}
+
+// writeFile - сохраняет метрики и их метаданные в файл.
+func (s *Server) writeFile(ctx context.Context) {
+	if err := s.writer.WriteMetrics(ctx, s.stor); err != nil {
+		s.log.Error("flushing metrics error", zap.String("error", error.Error(err)))
+	}
+	if err := s.writer.WriteMetadata(ctx, s.stor); err != nil {
+		s.log.Error("flushing metadata error", zap.String("error", error.Error(err)))
+	}
+}
+
+// flush - при штатном завершении работы сервера записывает накопленные в памяти метрики в базу данных
+// или сохраняет метрики в файл.
+func (s *Server) flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, shutdownWaitPeriod)
+	defer cancel()
+	if s.buffered != nil {
+		if err := s.buffered.Flush(ctx); err != nil {
+			s.log.Error("flushing buffered metrics error", zap.String("error", error.Error(err)), zap.Int("lost", s.buffered.Buffered()))
+		}
+	}
+	if s.writer != nil {
+		s.writeFile(ctx)
+	}
+}
+
+// Close - закрывает хранилище метрик и файл, открытые сервером.
+func (s *Server) Close() error {
+	var errs []error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		errs = append(errs, s.closers[i].Close())
+	}
+	s.closers = nil
+	return errors.Join(errs...)
+}
+
+// Handler - возвращает обработчик http запросов к серверу.
+func (s *Server) Handler() http.Handler {
+	stor := s.stor
+
+	r := chi.NewRouter()
+	// логер сервера передаётся обработчикам через контекст запроса
+	r.Use(logger.Middleware(s.log))
+
+	// принятые обновления метрик публикуются подписчикам потока /api/v1/stream
+	writer := hub.NewWriter(stor, s.updates)
+
+	// signed - обработчик запроса на запись, тело которого может быть зашифровано, сжато и подписано
+	signed := func(h http.Handler) http.HandlerFunc {
+		return logger.RequestLogger(s.decrypter.Middleware(compress.GzipMiddleware(s.hasher.HashMiddleware(h))))
+	}
+	// plain - обработчик запроса без тела
+	plain := func(h http.HandlerFunc) http.HandlerFunc {
+		return logger.RequestLogger(compress.GzipMiddleware(h))
+	}
+	// admin - обработчик административного запроса, доступного по токену
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return logger.RequestLogger(s.auth.Middleware(compress.GzipMiddleware(h)))
+	}
+
+	r.Route("/", func(r chi.Router) {
+		// поток не сжимается, так как gzip буферизует данные и задерживает события
+		r.Get("/api/v1/stream", logger.RequestLogger(handlers.StreamMetricsHandler(s.updates)))
+
+		// время обработки остальных запросов ограничено, поток событий живёт до отключения клиента
+		r.Group(func(r chi.Router) {
+			r.Use(s.limits.Middleware)
+			r.Use(s.timeout.Middleware)
+
+			r.Get("/", plain(dashboard.IndexHandler()))
+			r.Get("/plain", plain(handlers.GetGlobalHandler(stor, stor)))
+			r.Get("/dashboard/metric/{metricName}", plain(dashboard.MetricHandler()))
+			r.Get(dashboard.StaticPrefix+"*", plain(dashboard.StaticHandler()))
+			r.Get("/metrics", plain(handlers.GetPrometheusHandler(stor, stor, s.self)))
+			r.Get("/ping", plain(handlers.PingDatabaseHandler(s.db)))
+
+			r.With(s.limits.WriteMiddleware, s.agents.VersionMiddleware).Post("/updates/", signed(handlers.UpdateMetricsBatchHandler(writer)))
+			r.Route("/update", func(r chi.Router) {
+				r.With(s.limits.WriteMiddleware).Post("/", signed(handlers.UpdateMetricsJSONHandler(writer)))
+				r.With(s.limits.WriteMiddleware).Post("/{metricType}/{metricName}/{metricValue}", signed(handlers.UpdateMetricsHandler(writer)))
+			})
+
+			r.Route("/value", func(r chi.Router) {
+				r.Post("/", signed(handlers.GetMetricJSONHandler(stor)))
+				r.Get("/{metricType}/{metricName}", plain(handlers.GetMetricHandler(stor)))
+			})
+
+			r.Get("/quantile/{metricName}/{quantile}", plain(handlers.GetQuantileHandler(stor)))
+
+			r.Route("/api/v1/metrics", func(r chi.Router) {
+				r.Get("/", plain(handlers.ListMetricsHandler(stor)))
+				r.Delete("/", admin(handlers.DeleteMetricsHandler(stor)))
+				r.Delete("/{metricName}", admin(handlers.DeleteMetricHandler(stor)))
+				r.Get("/{metricName}/history", plain(handlers.GetHistoryHandler(stor, s.retention)))
+			})
+			r.Get("/api/v1/query", plain(handlers.QueryMetricsHandler(stor, s.retention)))
+			r.Route("/api/v1/metadata", func(r chi.Router) {
+				r.Get("/", plain(handlers.GetAllMetadataHandler(stor)))
+				r.Get("/{metricName}", plain(handlers.GetMetadataHandler(stor)))
+				// описание меняет тип и смысл метрики для всех клиентов, поэтому доступно только администратору
+				r.With(s.limits.WriteMiddleware).Put("/{metricName}", admin(handlers.UpdateMetadataHandler(stor)))
+			})
+			// настройки меняют поведение агентов, поэтому ответ подписывается так же, как ответы на запись метрик
+			r.Get("/api/v1/agent/config", plain(s.hasher.HashMiddleware(s.agents.Handler())))
+		})
+	})
+
+	// Определяем маршрут по умолчанию для некорректных запросов
+	r.NotFound(logger.RequestLogger(compress.GzipMiddleware(s.hasher.HashMiddleware(handlers.OtherRequestHandler()))))
+
+	return r
+}
@@ -0,0 +1,256 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, DefaultConfig().Validate())
+
+	cfg := DefaultConfig()
+	cfg.RateBurst = -1
+	cfg.StoreInterval = -time.Second
+	cfg.LogLevel = "loud"
+	cfg.Retention.Raw = -time.Hour
+	err := cfg.Validate()
+	require.Error(t, err)
+	// сообщаются все некорректные параметры сразу
+	for _, want := range []string{"rate_burst", "store_interval", "log_level", "retention"} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestConfigMode(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.Equal(t, SAVEINRAM, cfg.Mode())
+	cfg.FileStoragePath = "metrics.json"
+	assert.Equal(t, SAVEINFILE, cfg.Mode())
+	cfg.BoltPath = "metrics.db"
+	assert.Equal(t, SAVEINBOLT, cfg.Mode())
+	cfg.DatabaseDSN = "host=localhost"
+	assert.Equal(t, SAVEINDATABASE, cfg.Mode())
+}
+
+func TestConfigWithRestartSettings(t *testing.T) {
+	current := DefaultConfig()
+	cfg := DefaultConfig()
+	cfg.Address = ":8081"
+	cfg.Restore = true
+	cfg.FileStoragePath = "metrics.json"
+	cfg.DatabaseDSN = "host=localhost"
+	cfg.ReplicaDSN = "host=replica"
+	cfg.Pool.MaxOpenConns++
+	cfg.Pool.MaxIdleConns++
+	cfg.Pool.ConnMaxLifetime += time.Minute
+	cfg.Pool.ConnMaxIdleTime += time.Minute
+	cfg.BoltPath = "metrics.db"
+	cfg.MetricsTTL = time.Hour
+	cfg.Key = "secret"
+
+	// параметры, которые требуют перезапуска, остаются действующими, остальные применяются
+	want := current
+	want.Key = "secret"
+	assert.Equal(t, want, cfg.withRestartSettings(current))
+	assert.True(t, RequiresRestart("db_max_open_conns"))
+	assert.False(t, RequiresRestart("key"))
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	first := DefaultConfig()
+	first.AdminToken = "first"
+	second := DefaultConfig()
+	second.AdminToken = "second"
+
+	firstServer, err := New(first, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+	secondServer, err := New(second, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+
+	do := func(srv *Server, method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	// метрика, записанная в один сервер, не видна в другом
+	require.Equal(t, http.StatusOK, do(firstServer, http.MethodPost, "/update/gauge/Alloc/1.5", ""))
+	assert.Equal(t, http.StatusOK, do(firstServer, http.MethodGet, "/value/gauge/Alloc", ""))
+	assert.Equal(t, http.StatusNotFound, do(secondServer, http.MethodGet, "/value/gauge/Alloc", ""))
+
+	// у каждого сервера свой токен доступа к административным эндпоинтам
+	assert.Equal(t, http.StatusUnauthorized, do(firstServer, http.MethodDelete, "/api/v1/metrics/Alloc", "second"))
+	assert.Equal(t, http.StatusOK, do(firstServer, http.MethodDelete, "/api/v1/metrics/Alloc", "first"))
+	assert.Equal(t, http.StatusNotFound, do(secondServer, http.MethodDelete, "/api/v1/metrics/Alloc", "second"))
+}
+
+func TestReconfigure(t *testing.T) {
+	srv, err := New(DefaultConfig(), storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.Address = ":9090"
+	cfg.MetricsTTL = time.Hour
+	cfg.Key = "secret"
+	cfg.LogLevel = "debug"
+	cfg.RequestTimeout = time.Second
+	require.NoError(t, srv.Reconfigure(cfg))
+
+	current := srv.Config()
+	// параметры, которые требуют перезапуска, не меняются
+	assert.Equal(t, ":8080", current.Address)
+	assert.Equal(t, time.Duration(0), current.MetricsTTL)
+	assert.Equal(t, "secret", current.Key)
+	assert.Equal(t, time.Second, current.RequestTimeout)
+	assert.Equal(t, "secret", srv.hasher.GetKey())
+	assert.Equal(t, time.Second, srv.timeout.GetTimeout())
+	assert.True(t, srv.Logger().Core().Enabled(zap.DebugLevel))
+
+	// некорректные параметры не применяются
+	cfg.Key = "other"
+	cfg.RateLimit = -1
+	require.Error(t, srv.Reconfigure(cfg))
+	assert.Equal(t, "secret", srv.Config().Key)
+	assert.Equal(t, "secret", srv.hasher.GetKey())
+}
+
+func TestReconfigureKeepsRateLimiter(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimit = 0.001
+	cfg.RateBurst = 1
+	srv, err := New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/gauge/Alloc", nil))
+		res := w.Result()
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusNotFound, get())
+	assert.Equal(t, http.StatusTooManyRequests, get())
+
+	// перезагрузка с прежним ограничением не пополняет корзины клиентов
+	cfg.LogLevel = "debug"
+	require.NoError(t, srv.Reconfigure(cfg))
+	assert.Equal(t, http.StatusTooManyRequests, get())
+
+	// новое ограничение применяется с полными корзинами
+	cfg.RateBurst = 2
+	require.NoError(t, srv.Reconfigure(cfg))
+	assert.Equal(t, http.StatusNotFound, get())
+}
+
+func TestRunWithFile(t *testing.T) {
+	// функция для получения свободного адреса для запуска сервера
+	freeAddress := func() string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		return listener.Addr().String()
+	}
+	// run - запускает сервер до выполнения функции fn
+	run := func(cfg Config, fn func(url string)) {
+		srv, err := Open(cfg)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, srv.Close()) }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- srv.Run(ctx) }()
+		url := "http://" + cfg.Address
+		require.Eventually(t, func() bool {
+			res, err := http.Get(url + "/value/gauge/missing")
+			if err != nil {
+				return false
+			}
+			res.Body.Close()
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+		fn(url)
+		cancel()
+		require.NoError(t, <-done)
+	}
+	get := func(url string) int {
+		res, err := http.Get(url)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	cfg := DefaultConfig()
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+	cfg.Address = freeAddress()
+
+	// метрики сохраняются в файл при завершении работы сервера
+	run(cfg, func(url string) {
+		res, err := http.Post(url+"/update/counter/PollCount/3", "text/plain", strings.NewReader(""))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	// и загружаются из файла при следующем запуске
+	run(cfg, func(url string) {
+		assert.Equal(t, http.StatusOK, get(url+"/value/counter/PollCount"))
+	})
+
+	// без восстановления метрики из файла не загружаются
+	cfg.Restore = false
+	run(cfg, func(url string) {
+		assert.Equal(t, http.StatusNotFound, get(url+"/value/counter/PollCount"))
+	})
+
+	// открытый поток событий не задерживает остановку сервера
+	var stream *http.Response
+	defer func() { stream.Body.Close() }()
+	run(cfg, func(url string) {
+		var err error
+		stream, err = http.Get(url + "/api/v1/stream")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, stream.StatusCode)
+	})
+}
+
+func TestUpdateMetadataRequiresAdmin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminToken = "admin"
+	srv, err := New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+
+	put := func(token string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/metadata/load", strings.NewReader(`{"id":"load","type":"gauge","unit":"percent"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, put(""))
+	assert.Equal(t, http.StatusUnauthorized, put("other"))
+	assert.Equal(t, http.StatusOK, put("admin"))
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/agentconfig"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/settings"
+)
+
+// Определяют способ хранения метрик.
+const (
+	// SAVEINRAM устанавливает созранение метрик в оперативную память
+	SAVEINRAM = iota
+	// SAVEINFILE устанавливает созранение метрик в файл
+	SAVEINFILE
+	// SAVEINDATABASE устанавливает созранение метрик в базу данных
+	SAVEINDATABASE
+	// SAVEINBOLT устанавливает сохранение метрик во встроенную базу данных в файле
+	SAVEINBOLT
+)
+
+// Config - параметры сервера метрик.
+type Config struct {
+	Address  string // адрес и порт, на котором сервер принимает запросы
+	LogLevel string // уровень логирования
+
+	StoreInterval   time.Duration // период сохранения метрик в файл
+	FileStoragePath string        // путь к файлу для сохранения метрик
+	Restore         bool          // загружать ли метрики из файла при запуске
+
+	DatabaseDSN string        // адрес подключения к базе данных
+	ReplicaDSN  string        // адрес подключения к реплике базы данных только для чтения
+	Pool        pg.PoolConfig // настройки пула соединений с базой данных
+	BoltPath    string        // путь к файлу встроенной базы данных
+
+	Key        string // ключ для подписи данных
+	CryptoKey  string // путь к приватному ключу для расшифровки данных от агентов
+	AdminToken string // токен доступа к административным эндпоинтам
+
+	MetricsTTL     time.Duration // время, после которого не обновлявшиеся метрики удаляются, 0 - не удаляются
+	Retention      rollup.Policy // время хранения уровней истории значений метрик
+	RequestTimeout time.Duration // максимальное время обработки запроса, 0 - без ограничения
+
+	RateLimit           float64 // максимальное количество запросов в секунду от одного агента, 0 - без ограничения
+	RateBurst           int     // допустимый всплеск запросов от одного агента сверх RateLimit
+	MaxConcurrentWrites int     // максимальное количество одновременных запросов на запись, 0 - без ограничения
+
+	AgentConfigs agentconfig.Configs // настройки, которые сервер передаёт агентам
+}
+
+// DefaultConfig - возвращает параметры сервера по умолчанию: метрики хранятся в оперативной памяти.
+func DefaultConfig() Config {
+	return Config{
+		Address:        ":8080",
+		LogLevel:       "info",
+		StoreInterval:  300 * time.Second,
+		Restore:        true,
+		Pool:           pg.DefaultPoolConfig,
+		Retention:      rollup.DefaultPolicy,
+		RequestTimeout: 10 * time.Second,
+		RateBurst:      20,
+	}
+}
+
+// Validate - проверяет параметры сервера и возвращает все найденные ошибки сразу.
+func (c Config) Validate() error {
+	var problems settings.Problems
+	problems.Check(c.StoreInterval >= 0, "store_interval must not be negative, got %s", c.StoreInterval)
+	problems.Check(c.MetricsTTL >= 0, "metrics_ttl must not be negative, got %s", c.MetricsTTL)
+	problems.Check(c.RequestTimeout >= 0, "request_timeout must not be negative, got %s", c.RequestTimeout)
+	problems.Check(c.RateLimit >= 0, "rate_limit must not be negative, got %g", c.RateLimit)
+	problems.Check(c.RateBurst >= 0, "rate_burst must not be negative, got %d", c.RateBurst)
+	problems.Check(c.MaxConcurrentWrites >= 0, "max_concurrent_writes must not be negative, got %d", c.MaxConcurrentWrites)
+	_, err := zap.ParseAtomicLevel(c.LogLevel)
+	problems.Add("invalid log_level", err)
+	problems.Add("invalid retention of metric history", c.Retention.Validate())
+	problems.Add("invalid settings of database connection pool", c.Pool.Validate())
+	problems.Add("invalid settings of agents", c.AgentConfigs.Validate())
+	return problems.Err()
+}
+
+// Mode - возвращает способ хранения метрик. База данных имеет приоритет над встроенной базой, а она - над файлом.
+func (c Config) Mode() int {
+	if c.DatabaseDSN != "" {
+		return SAVEINDATABASE
+	} else if c.BoltPath != "" {
+		return SAVEINBOLT
+	} else if c.FileStoragePath != "" {
+		return SAVEINFILE
+	}
+	return SAVEINRAM
+}
+
+// restartSettings - параметры запуска, изменение которых применяется только после перезапуска сервера, по имени
+// параметра в файле конфигурации, и функции, переносящие значение параметра из действующих параметров current в c.
+var restartSettings = map[string]func(c *Config, current Config){
+	"address":               func(c *Config, current Config) { c.Address = current.Address },
+	"restore":               func(c *Config, current Config) { c.Restore = current.Restore },
+	"store_file":            func(c *Config, current Config) { c.FileStoragePath = current.FileStoragePath },
+	"database_dsn":          func(c *Config, current Config) { c.DatabaseDSN = current.DatabaseDSN },
+	"database_replica_dsn":  func(c *Config, current Config) { c.ReplicaDSN = current.ReplicaDSN },
+	"db_max_open_conns":     func(c *Config, current Config) { c.Pool.MaxOpenConns = current.Pool.MaxOpenConns },
+	"db_max_idle_conns":     func(c *Config, current Config) { c.Pool.MaxIdleConns = current.Pool.MaxIdleConns },
+	"db_conn_max_lifetime":  func(c *Config, current Config) { c.Pool.ConnMaxLifetime = current.Pool.ConnMaxLifetime },
+	"db_conn_max_idle_time": func(c *Config, current Config) { c.Pool.ConnMaxIdleTime = current.Pool.ConnMaxIdleTime },
+	"bolt_path":             func(c *Config, current Config) { c.BoltPath = current.BoltPath },
+	"metrics_ttl":           func(c *Config, current Config) { c.MetricsTTL = current.MetricsTTL },
+}
+
+// RequiresRestart - сообщает, применяется ли изменение параметра запуска key только после перезапуска сервера.
+func RequiresRestart(key string) bool {
+	_, ok := restartSettings[key]
+	return ok
+}
+
+// withRestartSettings - возвращает копию параметров c, в которой параметры, изменение которых требует перезапуска
+// сервера, взяты из действующих параметров current.
+func (c Config) withRestartSettings(current Config) Config {
+	for _, keep := range restartSettings {
+		keep(&c, current)
+	}
+	return c
+}
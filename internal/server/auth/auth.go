@@ -0,0 +1,61 @@
+// Packet auth implement middleware for checking access token of administrative endpoints.
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Authenticator - проверка токена доступа к административным эндпоинтам.
+type Authenticator struct {
+	mu    sync.RWMutex
+	token string
+}
+
+// New - фабричная функция структуры Authenticator.
+func New(token string) *Authenticator {
+	return &Authenticator{token: token}
+}
+
+// SetToken - устанавливает токен доступа к административным эндпоинтам.
+func (a *Authenticator) SetToken(t string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = t
+}
+
+// GetToken - возвращает токен доступа к административным эндпоинтам.
+func (a *Authenticator) GetToken() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.token
+}
+
+// Middleware - middleware для проверки токена доступа из заголовка Authorization: Bearer <token>.
+// Если токен не задан, административные эндпоинты недоступны.
+func (a *Authenticator) Middleware(handler http.Handler) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		t := a.GetToken()
+		if t == "" {
+			logger.FromContext(req.Context()).Debug("admin token is not set, request is forbidden", zap.String("address", req.URL.String()))
+			http.Error(res, "administrative endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		reqToken, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(reqToken), []byte(t)) != 1 {
+			logger.FromContext(req.Context()).Debug("invalid admin token", zap.String("address", req.URL.String()))
+			res.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(res, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	}
+	return fn
+}
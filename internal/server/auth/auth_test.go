@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetToken(t *testing.T) {
+	a := New("token")
+	a.SetToken("new token")
+	assert.Equal(t, "new token", a.token)
+}
+
+func TestGetToken(t *testing.T) {
+	a := New("second token")
+	assert.Equal(t, "second token", a.GetToken())
+}
+
+func TestMiddleware(t *testing.T) {
+	a := New("")
+	handler := a.Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantCode      int
+	}{
+		{name: "valid token", token: "secret", authorization: "Bearer secret", wantCode: http.StatusOK},
+		{name: "invalid token", token: "secret", authorization: "Bearer wrong", wantCode: http.StatusUnauthorized},
+		{name: "missing header", token: "secret", wantCode: http.StatusUnauthorized},
+		{name: "wrong scheme", token: "secret", authorization: "Basic secret", wantCode: http.StatusUnauthorized},
+		{name: "token is not set", authorization: "Bearer ", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.SetToken(tt.token)
+
+			request := httptest.NewRequest(http.MethodDelete, "/api/v1/metrics/Alloc", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", res.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
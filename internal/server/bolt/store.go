@@ -0,0 +1,842 @@
+// Packet bolt implement storage of metrics in embedded key-value database bbolt.
+// Каждое изменение выполняется в отдельной транзакции, которая фиксируется на диске до возврата из метода,
+// поэтому после аварийного завершения сервера в файле остаются только целиком записанные изменения.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Корневые бакеты базы.
+var (
+	bucketMetrics  = []byte("metrics")  // имя метрики -> json record
+	bucketMetadata = []byte("metadata") // имя метрики -> json repositories.Metadata
+	bucketHistory  = []byte("history")  // имя метрики -> бакет: время в наносекундах -> значение
+	bucketRollups  = []byte("rollups")  // длительность интервала -> бакет: имя метрики -> бакет: начало интервала -> encodeRollup
+)
+
+const (
+	openTimeout = time.Second // время ожидания блокировки файла базы другим процессом
+
+	compactMinSize   = 4 << 20  // минимальный размер файла базы, при котором выполняется сжатие
+	compactFreeRatio = 0.5      // доля свободных страниц в файле, при которой выполняется сжатие
+	compactTxMaxSize = 64 << 20 // максимальный объём данных, копируемый в одной транзакции при сжатии
+)
+
+// Store - реализует интерфейс repositories.IStorage поверх базы bbolt.
+type Store struct {
+	db *bbolt.DB
+}
+
+// NewStore - фабричная функция для создания Store.
+func NewStore(db *bbolt.DB) *Store {
+	return &Store{db: db}
+}
+
+// Open - открывает файл базы, предварительно сжимая его, если большая часть файла занята свободными страницами.
+// Ошибка сжатия выводится в логер из контекста ctx.
+func Open(ctx context.Context, path string) (*bbolt.DB, error) {
+	if err := compactIfNeeded(path); err != nil {
+		// база остаётся работоспособной и без сжатия
+		logger.FromContext(ctx).Error("compact bolt database error", zap.String("path", path), zap.String("error", error.Error(err)))
+	}
+	return bbolt.Open(path, 0o600, &bbolt.Options{Timeout: openTimeout})
+}
+
+// compactIfNeeded - сжимает файл базы, если он занимает больше compactMinSize и доля свободных страниц больше compactFreeRatio.
+func compactIfNeeded(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.Size() < compactMinSize {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	// в режиме только для чтения bbolt не загружает список свободных страниц,
+	// поэтому занятые страницы подсчитываются обходом бакетов
+	var used, size int64
+	err = db.View(func(tx *bbolt.Tx) error {
+		size = tx.Size()
+		return tx.ForEach(func(_ []byte, b *bbolt.Bucket) error {
+			stats := b.Stats()
+			pages := stats.BranchPageN + stats.BranchOverflowN + stats.LeafPageN + stats.LeafOverflowN
+			used += int64(pages * tx.DB().Info().PageSize)
+			return nil
+		})
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if float64(size-used) < compactFreeRatio*float64(size) {
+		return nil
+	}
+	return Compact(path)
+}
+
+// Compact - переписывает закрытый файл базы без свободных страниц. Сжатая копия записывается во временный файл,
+// который атомарно заменяет исходный, поэтому при аварийном завершении сохраняется исходный файл.
+func Compact(path string) error {
+	src, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".compact"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dst, err := bbolt.Open(tmpPath, 0o600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, src, compactTxMaxSize); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compact %s: %w", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	// фиксирую переименование файла на диске
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Bootstrap - реализует метод Bootstrap интерфейса repositories.StorageStarter. Создаёт корневые бакеты базы.
+func (s *Store) Bootstrap(ctx context.Context) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketMetrics, bucketMetadata, bucketHistory, bucketRollups} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Disable - удаляет все данные из базы.
+// Метод необходим для тестирования, чтобы в процессе удалять тестовые записи.
+func (s *Store) Disable(ctx context.Context) error {
+	err := s.update(ctx, func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketMetrics, bucketMetadata, bucketHistory, bucketRollups} {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Bootstrap(ctx)
+}
+
+// update - выполняет fn в транзакции на запись, если контекст не отменён.
+func (s *Store) update(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(fn)
+}
+
+// view - выполняет fn в транзакции на чтение, если контекст не отменён.
+func (s *Store) view(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.View(fn)
+}
+
+// timeKey - возвращает ключ, упорядочивающий записи по времени.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// keyTime - возвращает время, записанное в ключе timeKey.
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key))).UTC()
+}
+
+// resolutionKey - возвращает ключ бакета агрегатов уровня resolution.
+func resolutionKey(resolution time.Duration) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(resolution))
+	return key
+}
+
+// record - представление метрики в базе. Значение gauge хранится в виде битов float64,
+// так как encoding/json не поддерживает бесконечности.
+type record struct {
+	MType     string                  `json:"type"`
+	Delta     *int64                  `json:"delta,omitempty"`
+	Value     *uint64                 `json:"value,omitempty"`
+	Histogram *repositories.Histogram `json:"histogram,omitempty"`
+	UpdatedAt time.Time               `json:"updated_at"`
+}
+
+// encodeMetric - возвращает представление метрики для записи в базу.
+func encodeMetric(metric repositories.Metric) ([]byte, error) {
+	rec := record{MType: metric.MType, Delta: metric.Delta, Histogram: metric.Histogram}
+	if metric.Value != nil {
+		bits := math.Float64bits(*metric.Value)
+		rec.Value = &bits
+	}
+	if metric.UpdatedAt != nil {
+		rec.UpdatedAt = *metric.UpdatedAt
+	}
+	return json.Marshal(rec)
+}
+
+// decodeMetric - читает метрику с именем name из записи базы.
+func decodeMetric(name, data []byte) (repositories.Metric, error) {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return repositories.Metric{}, fmt.Errorf("decode metric %s: %w", name, err)
+	}
+	metric := repositories.Metric{ID: string(name), MType: rec.MType, Delta: rec.Delta, Histogram: rec.Histogram}
+	if rec.Value != nil {
+		value := math.Float64frombits(*rec.Value)
+		metric.Value = &value
+	}
+	if !rec.UpdatedAt.IsZero() {
+		updated := rec.UpdatedAt
+		metric.UpdatedAt = &updated
+	}
+	return metric, nil
+}
+
+// getMetric - читает метрику в рамках транзакции tx.
+func getMetric(tx *bbolt.Tx, name string) (repositories.Metric, bool, error) {
+	data := tx.Bucket(bucketMetrics).Get([]byte(name))
+	if data == nil {
+		return repositories.Metric{}, false, nil
+	}
+	metric, err := decodeMetric([]byte(name), data)
+	if err != nil {
+		return repositories.Metric{}, false, err
+	}
+	return metric, true, nil
+}
+
+// getMetadata - читает метаданные метрики в рамках транзакции tx.
+func getMetadata(tx *bbolt.Tx, name string) (repositories.Metadata, bool, error) {
+	data := tx.Bucket(bucketMetadata).Get([]byte(name))
+	if data == nil {
+		return repositories.Metadata{}, false, nil
+	}
+	var meta repositories.Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return repositories.Metadata{}, false, fmt.Errorf("decode metadata %s: %w", name, err)
+	}
+	return meta, true, nil
+}
+
+// putMetadata - сохраняет метаданные метрики в рамках транзакции tx.
+func putMetadata(tx *bbolt.Tx, meta repositories.Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketMetadata).Put([]byte(meta.ID), data)
+}
+
+// registerType - проверяет, что тип метрики совпадает с зарегистрированным в реестре метаданных.
+// Метрика, которой нет в реестре, регистрируется с переданным типом.
+func registerType(tx *bbolt.Tx, name, mtype string) error {
+	meta, ok, err := getMetadata(tx, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return putMetadata(tx, repositories.Metadata{ID: name, MType: mtype})
+	}
+	if meta.MType != mtype {
+		return repositories.TypeConflictError(name, meta.MType, mtype)
+	}
+	return nil
+}
+
+// putMetric - сохраняет метрику с временем обновления now и добавляет её значение в историю.
+// Для counter в историю записывается накопленная сумма, для histogram - количество наблюдений.
+func putMetric(tx *bbolt.Tx, metric repositories.Metric, now time.Time) error {
+	history, err := tx.Bucket(bucketHistory).CreateBucketIfNotExists([]byte(metric.ID))
+	if err != nil {
+		return err
+	}
+	// значения с одинаковым временем не перезаписывают друг друга
+	key := timeKey(now)
+	if last, _ := history.Cursor().Last(); last != nil && bytes.Compare(key, last) <= 0 {
+		key = timeKey(keyTime(last).Add(time.Nanosecond))
+	}
+	var value float64
+	switch {
+	case metric.Value != nil:
+		value = *metric.Value
+	case metric.Delta != nil:
+		value = float64(*metric.Delta)
+	case metric.Histogram != nil:
+		value = float64(metric.Histogram.Count)
+	}
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, math.Float64bits(value))
+	if err := history.Put(key, encoded); err != nil {
+		return err
+	}
+
+	updated := keyTime(key)
+	metric.UpdatedAt = &updated
+	data, err := encodeMetric(metric)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketMetrics).Put([]byte(metric.ID), data)
+}
+
+// addMetric - добавляет значение метрики в рамках транзакции tx: gauge заменяется, counter суммируется,
+// histogram объединяется с хранимой гистограммой.
+func addMetric(tx *bbolt.Tx, metric repositories.Metric, now time.Time) error {
+	switch metric.MType {
+	case "gauge":
+		if metric.Value == nil {
+			return fmt.Errorf("invalid metric, value of gauge metric is nil")
+		}
+	case "counter":
+		if metric.Delta == nil {
+			return fmt.Errorf("invalid metric, delta of counter metric is nil")
+		}
+	case "histogram":
+		if metric.Histogram == nil {
+			return fmt.Errorf("invalid metric, histogram of histogram metric is nil")
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+	}
+	if err := registerType(tx, metric.ID, metric.MType); err != nil {
+		return err
+	}
+
+	stored, ok, err := getMetric(tx, metric.ID)
+	if err != nil {
+		return err
+	}
+	result := repositories.Metric{ID: metric.ID, MType: metric.MType}
+	switch metric.MType {
+	case "gauge":
+		value := *metric.Value
+		result.Value = &value
+	case "counter":
+		delta := *metric.Delta
+		if ok && stored.Delta != nil {
+			delta += *stored.Delta
+		}
+		result.Delta = &delta
+	case "histogram":
+		base := repositories.NewHistogram(metric.Histogram.Bounds)
+		if ok && stored.Histogram != nil {
+			base = *stored.Histogram
+		}
+		merged, err := base.Merge(*metric.Histogram)
+		if err != nil {
+			return fmt.Errorf("merge histogram %s error: %w", metric.ID, err)
+		}
+		result.Histogram = &merged
+	}
+	return putMetric(tx, result, now)
+}
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.MetricsWriter.
+func (s *Store) AddGauge(ctx context.Context, name string, value float64) error {
+	return s.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: name, MType: "gauge", Value: &value}})
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.MetricsWriter.
+func (s *Store) AddCounter(ctx context.Context, name string, delta int64) error {
+	return s.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: name, MType: "counter", Delta: &delta}})
+}
+
+// AddHistogram - реализует метод AddHistogram интерфейса repositories.MetricsWriter.
+func (s *Store) AddHistogram(ctx context.Context, name string, histogram repositories.Histogram) error {
+	return s.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: name, MType: "histogram", Histogram: &histogram}})
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.MetricsWriter.
+// Метрики записываются в одной транзакции, поэтому при ошибке не записывается ни одна метрика.
+func (s *Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		for _, metric := range metrics {
+			if err := addMetric(tx, metric, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetMetric - реализует метод GetMetric интерфейса repositories.MetricsReader.
+func (s *Store) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	if !repositories.IsValidMetricType(metricType) {
+		return "", fmt.Errorf("whrong type of metric")
+	}
+	var result string
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		metric, ok, err := getMetric(tx, name)
+		if err != nil {
+			return err
+		}
+		if !ok || metric.MType != metricType {
+			return fmt.Errorf("metric %s of type %s not found", name, metricType)
+		}
+		switch metricType {
+		case "gauge":
+			result = fmt.Sprintf("%g", *metric.Value)
+		case "counter":
+			result = fmt.Sprintf("%d", *metric.Delta)
+		case "histogram":
+			data, err := json.Marshal(metric.Histogram)
+			if err != nil {
+				return err
+			}
+			result = string(data)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// GetHistogram - реализует метод GetHistogram интерфейса repositories.MetricsReader.
+func (s *Store) GetHistogram(ctx context.Context, name string) (repositories.Histogram, error) {
+	var histogram repositories.Histogram
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		metric, ok, err := getMetric(tx, name)
+		if err != nil {
+			return err
+		}
+		if !ok || metric.Histogram == nil {
+			return fmt.Errorf("metric %s of type histogram not found", name)
+		}
+		histogram = *metric.Histogram
+		return nil
+	})
+	return histogram, err
+}
+
+// GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.MetricsReader.
+func (s *Store) GetAllMetrics(ctx context.Context) (string, error) {
+	metrics, err := s.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return "", err
+	}
+	return repositories.FormatMetrics(metrics), nil
+}
+
+// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.MetricsReader.
+func (s *Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	metrics, err := s.ListMetrics(ctx, repositories.MetricsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range metrics {
+		metrics[i].UpdatedAt = nil
+	}
+	return metrics, nil
+}
+
+// filterMetrics - возвращает отсортированные по имени метрики, удовлетворяющие условиям выборки
+// без учёта курсора и лимита, в рамках транзакции tx.
+func filterMetrics(tx *bbolt.Tx, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	match, err := filter.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]repositories.Metric, 0)
+	err = tx.Bucket(bucketMetrics).ForEach(func(k, v []byte) error {
+		metric, err := decodeMetric(k, v)
+		if err != nil {
+			return err
+		}
+		var labels map[string]string
+		if len(filter.Labels) > 0 {
+			meta, _, err := getMetadata(tx, metric.ID)
+			if err != nil {
+				return err
+			}
+			labels = meta.Labels
+		}
+		if match(metric, labels) {
+			result = append(result, metric)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// ключи bbolt упорядочены побайтово, как и имена метрик в repositories.SortMetrics
+	return result, nil
+}
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+func (s *Store) ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	var metrics []repositories.Metric
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		var err error
+		metrics, err = filterMetrics(tx, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(metrics), nil
+}
+
+// CountMetrics - реализует метод CountMetrics интерфейса repositories.MetricsReader.
+func (s *Store) CountMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	metrics, err := s.ListMetrics(ctx, repositories.MetricsFilter{
+		ID: filter.ID, Type: filter.Type, Prefix: filter.Prefix, Match: filter.Match, Labels: filter.Labels,
+	})
+	return len(metrics), err
+}
+
+// deleteMetric - удаляет метрику вместе с метаданными, историей и агрегатами в рамках транзакции tx.
+func deleteMetric(tx *bbolt.Tx, name string) error {
+	key := []byte(name)
+	if err := tx.Bucket(bucketMetrics).Delete(key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketMetadata).Delete(key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketHistory).DeleteBucket(key); err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+		return err
+	}
+	return tx.Bucket(bucketRollups).ForEachBucket(func(resolution []byte) error {
+		err := tx.Bucket(bucketRollups).Bucket(resolution).DeleteBucket(key)
+		if err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+func (s *Store) DeleteMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	deleted := 0
+	err := s.update(ctx, func(tx *bbolt.Tx) error {
+		metrics, err := filterMetrics(tx, filter)
+		if err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			if err := deleteMetric(tx, metric.ID); err != nil {
+				return err
+			}
+		}
+		deleted = len(metrics)
+		return nil
+	})
+	return deleted, err
+}
+
+// DeleteStaleMetrics - реализует метод DeleteStaleMetrics интерфейса repositories.MetricsDeleter.
+func (s *Store) DeleteStaleMetrics(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := s.update(ctx, func(tx *bbolt.Tx) error {
+		metrics, err := filterMetrics(tx, repositories.MetricsFilter{})
+		if err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			if metric.UpdatedAt == nil || !metric.UpdatedAt.Before(before) {
+				continue
+			}
+			if err := deleteMetric(tx, metric.ID); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// metricExists - возвращает ошибку, если в хранилище нет значений метрики.
+func metricExists(tx *bbolt.Tx, name string) error {
+	if tx.Bucket(bucketMetrics).Get([]byte(name)) == nil {
+		return fmt.Errorf("metric %s not found", name)
+	}
+	return nil
+}
+
+// GetHistory - реализует метод GetHistory интерфейса repositories.HistoryReader.
+func (s *Store) GetHistory(ctx context.Context, name string, from, to time.Time) ([]repositories.Sample, error) {
+	samples := make([]repositories.Sample, 0)
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		if err := metricExists(tx, name); err != nil {
+			return err
+		}
+		history := tx.Bucket(bucketHistory).Bucket([]byte(name))
+		if history == nil {
+			return nil
+		}
+		end := timeKey(to)
+		c := history.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			samples = append(samples, repositories.Sample{Time: keyTime(k), Value: math.Float64frombits(binary.BigEndian.Uint64(v))})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// rollupBucket - возвращает бакет агрегатов метрики уровня resolution или nil, если агрегатов нет.
+func rollupBucket(tx *bbolt.Tx, name string, resolution time.Duration) *bbolt.Bucket {
+	byResolution := tx.Bucket(bucketRollups).Bucket(resolutionKey(resolution))
+	if byResolution == nil {
+		return nil
+	}
+	return byResolution.Bucket([]byte(name))
+}
+
+// rollupSize - размер записи агрегата в бакете агрегатов.
+const rollupSize = 6 * 8
+
+// encodeRollup - возвращает запись агрегата для бакета агрегатов. Начало интервала хранится в ключе записи.
+func encodeRollup(rollup repositories.Rollup) []byte {
+	data := make([]byte, rollupSize)
+	binary.BigEndian.PutUint64(data[0:], math.Float64bits(rollup.Min))
+	binary.BigEndian.PutUint64(data[8:], math.Float64bits(rollup.Max))
+	binary.BigEndian.PutUint64(data[16:], math.Float64bits(rollup.Sum))
+	binary.BigEndian.PutUint64(data[24:], uint64(rollup.Count))
+	binary.BigEndian.PutUint64(data[32:], math.Float64bits(rollup.Last))
+	binary.BigEndian.PutUint64(data[40:], math.Float64bits(rollup.Delta))
+	return data
+}
+
+// decodeRollup - читает агрегат из записи бакета агрегатов.
+func decodeRollup(k, v []byte) (repositories.Rollup, error) {
+	if len(v) != rollupSize {
+		return repositories.Rollup{}, fmt.Errorf("decode rollup: invalid size %d", len(v))
+	}
+	return repositories.Rollup{
+		Time:  keyTime(k),
+		Min:   math.Float64frombits(binary.BigEndian.Uint64(v[0:])),
+		Max:   math.Float64frombits(binary.BigEndian.Uint64(v[8:])),
+		Sum:   math.Float64frombits(binary.BigEndian.Uint64(v[16:])),
+		Count: int64(binary.BigEndian.Uint64(v[24:])),
+		Last:  math.Float64frombits(binary.BigEndian.Uint64(v[32:])),
+		Delta: math.Float64frombits(binary.BigEndian.Uint64(v[40:])),
+	}, nil
+}
+
+// GetRollups - реализует метод GetRollups интерфейса repositories.RollupReader.
+func (s *Store) GetRollups(ctx context.Context, name string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	rollups := make([]repositories.Rollup, 0)
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		if err := metricExists(tx, name); err != nil {
+			return err
+		}
+		bucket := rollupBucket(tx, name, resolution)
+		if bucket == nil {
+			return nil
+		}
+		end := timeKey(to)
+		c := bucket.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			rollup, err := decodeRollup(k, v)
+			if err != nil {
+				return err
+			}
+			rollups = append(rollups, rollup)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// GetLastRollup - реализует метод GetLastRollup интерфейса repositories.RollupReader.
+func (s *Store) GetLastRollup(ctx context.Context, name string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	var rollup repositories.Rollup
+	found := false
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		if err := metricExists(tx, name); err != nil {
+			return err
+		}
+		bucket := rollupBucket(tx, name, resolution)
+		if bucket == nil {
+			return nil
+		}
+		k, v := bucket.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		var err error
+		rollup, err = decodeRollup(k, v)
+		found = err == nil
+		return err
+	})
+	return rollup, found, err
+}
+
+// AddRollups - реализует метод AddRollups интерфейса repositories.RollupWriter.
+func (s *Store) AddRollups(ctx context.Context, name string, resolution time.Duration, rollups []repositories.Rollup) error {
+	if resolution <= 0 {
+		return fmt.Errorf("invalid rollup resolution %s", resolution)
+	}
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		if err := metricExists(tx, name); err != nil {
+			return err
+		}
+		byResolution, err := tx.Bucket(bucketRollups).CreateBucketIfNotExists(resolutionKey(resolution))
+		if err != nil {
+			return err
+		}
+		bucket, err := byResolution.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		for _, rollup := range rollups {
+			if err := bucket.Put(timeKey(rollup.Time), encodeRollup(rollup)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteBefore - удаляет из бакета записи с ключом времени раньше before и возвращает их количество.
+func deleteBefore(bucket *bbolt.Bucket, before time.Time) (int, error) {
+	end := timeKey(before)
+	var keys [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	// удаляю после обхода, так как удаление во время обхода курсором может пропускать записи
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// DeleteHistoryBefore - реализует метод DeleteHistoryBefore интерфейса repositories.RollupWriter.
+func (s *Store) DeleteHistoryBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	deleted := 0
+	err := s.update(ctx, func(tx *bbolt.Tx) error {
+		parent := tx.Bucket(bucketHistory)
+		if resolution != 0 {
+			parent = tx.Bucket(bucketRollups).Bucket(resolutionKey(resolution))
+			if parent == nil {
+				return nil
+			}
+		}
+		return parent.ForEachBucket(func(name []byte) error {
+			n, err := deleteBefore(parent.Bucket(name), before)
+			deleted += n
+			return err
+		})
+	})
+	return deleted, err
+}
+
+// GetMetadata - реализует метод GetMetadata интерфейса repositories.MetadataReader.
+func (s *Store) GetMetadata(ctx context.Context, name string) (repositories.Metadata, error) {
+	var meta repositories.Metadata
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		var ok bool
+		var err error
+		meta, ok, err = getMetadata(tx, name)
+		if err == nil && !ok {
+			err = fmt.Errorf("metadata of metric %s not found", name)
+		}
+		return err
+	})
+	return meta, err
+}
+
+// GetAllMetadata - реализует метод GetAllMetadata интерфейса repositories.MetadataReader.
+func (s *Store) GetAllMetadata(ctx context.Context) ([]repositories.Metadata, error) {
+	result := make([]repositories.Metadata, 0)
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMetadata).ForEach(func(k, v []byte) error {
+			var meta repositories.Metadata
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return fmt.Errorf("decode metadata %s: %w", k, err)
+			}
+			result = append(result, meta)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMetadata - реализует метод SetMetadata интерфейса repositories.MetadataWriter.
+// Тип метрики нельзя изменить, если в хранилище уже есть значения метрики другого типа.
+func (s *Store) SetMetadata(ctx context.Context, meta repositories.Metadata) error {
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		metric, ok, err := getMetric(tx, meta.ID)
+		if err != nil {
+			return err
+		}
+		if ok && metric.MType != meta.MType {
+			return repositories.TypeConflictError(meta.ID, metric.MType, meta.MType)
+		}
+		return putMetadata(tx, meta)
+	})
+}
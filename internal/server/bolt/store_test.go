@@ -0,0 +1,469 @@
+package bolt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+)
+
+// newTestStore - открывает хранилище во временном каталоге теста.
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	db, err := Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	stor := NewStore(db)
+	require.NoError(t, stor.Bootstrap(context.Background()))
+	return stor, path
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.IStorage {
+		stor, _ := newTestStore(t)
+		return stor
+	})
+}
+
+func TestGetMetric(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	tests := []struct {
+		name       string
+		metricType string
+		metricName string
+		want       string
+		wantErr    bool
+	}{
+		{name: "gauge", metricType: "gauge", metricName: "Alloc", want: "1.5"},
+		{name: "counter", metricType: "counter", metricName: "PollCount", want: "7"},
+		{name: "wrong type", metricType: "counter", metricName: "Alloc", wantErr: true},
+		{name: "unknown type", metricType: "unknown", metricName: "Alloc", wantErr: true},
+		{name: "unknown metric", metricType: "gauge", metricName: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stor.GetMetric(ctx, tt.metricType, tt.metricName)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetAllMetrics(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+
+	got, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	got, err = stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "type: gauge, name: Alloc, value: 1.5\ntype: counter, name: PollCount, value: 3\n", got)
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	value := 1.5
+	delta := int64(3)
+	assert.Equal(t, []repositories.Metric{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	}, metrics)
+}
+
+func TestAddMetricsFromSlice(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+
+	value := 2.5
+	delta := int64(5)
+	err := stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	})
+	require.NoError(t, err)
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "10", got)
+
+	// батч с некорректной метрикой не записывается частично
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "HeapAlloc", MType: "gauge", Value: &value},
+		{ID: "HeapIdle", MType: "gauge"},
+	})
+	require.Error(t, err)
+	_, err = stor.GetMetric(ctx, "gauge", "HeapAlloc")
+	require.Error(t, err)
+
+	// батч с конфликтом типов не записывается частично
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "counter", Delta: &delta},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	got, err = stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "10", got)
+
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "Alloc", MType: "unknown"}})
+	require.Error(t, err)
+}
+
+func TestAddHistogram(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+
+	err := stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3})
+	require.NoError(t, err)
+	err = stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5})
+	require.NoError(t, err)
+
+	got, err := stor.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, got)
+
+	value, err := stor.GetMetric(ctx, "histogram", "latency")
+	require.NoError(t, err)
+	assert.Equal(t, `{"bounds":[1,2],"counts":[1,4,3],"sum":22.5,"count":8}`, value)
+
+	// гистограмму с другими границами бакетов объединить нельзя
+	err = stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{0, 0, 0}})
+	require.ErrorIs(t, err, repositories.ErrHistogramBoundsMismatch)
+
+	// некорректная гистограмма
+	err = stor.AddHistogram(ctx, "broken", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1})
+	require.Error(t, err)
+
+	_, err = stor.GetHistogram(ctx, "unknown")
+	require.Error(t, err)
+}
+
+func TestMetadata(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+
+	all, err := stor.GetAllMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Metadata{
+		{ID: "Alloc", MType: "gauge"},
+		{ID: "PollCount", MType: "counter"},
+	}, all)
+
+	meta := repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"}
+	require.NoError(t, stor.SetMetadata(ctx, meta))
+	got, err := stor.GetMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, meta, got)
+
+	// тип метрики, для которой уже есть значения, изменить нельзя
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "PollCount", MType: "gauge"})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// метаданные можно зарегистрировать заранее, и тогда они ограничивают тип метрики
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "Latency", MType: "histogram"}))
+	err = stor.AddGauge(ctx, "Latency", 1)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "Alloc", MType: "unknown"})
+	require.Error(t, err)
+	_, err = stor.GetMetadata(ctx, "unknown")
+	require.Error(t, err)
+
+	require.NoError(t, stor.Disable(ctx))
+	all, err = stor.GetAllMetadata(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestListMetrics(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	for name, value := range map[string]float64{"HeapAlloc": 1, "HeapIdle": 2, "Alloc": 3} {
+		require.NoError(t, stor.AddGauge(ctx, name, value))
+	}
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "HeapIdle", MType: "gauge", Labels: map[string]string{"host": "agent"}}))
+
+	ids := func(metrics []repositories.Metric) []string {
+		result := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			result = append(result, metric.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		filter    repositories.MetricsFilter
+		want      []string
+		wantCount int
+	}{
+		{name: "all sorted", filter: repositories.MetricsFilter{}, want: []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}, wantCount: 4},
+		{name: "type", filter: repositories.MetricsFilter{Type: "counter"}, want: []string{"PollCount"}, wantCount: 1},
+		{name: "prefix", filter: repositories.MetricsFilter{Prefix: "Heap"}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 2},
+		{name: "match", filter: repositories.MetricsFilter{Match: "Alloc$"}, want: []string{"Alloc", "HeapAlloc"}, wantCount: 2},
+		{name: "labels", filter: repositories.MetricsFilter{Labels: map[string]string{"host": "agent"}}, want: []string{"HeapIdle"}, wantCount: 1},
+		{name: "cursor and limit", filter: repositories.MetricsFilter{AfterID: "Alloc", Limit: 2}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := stor.ListMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(metrics))
+
+			count, err := stor.CountMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+
+	_, err := stor.ListMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+	_, err = stor.CountMetrics(ctx, repositories.MetricsFilter{Type: "unknown"})
+	require.Error(t, err)
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddHistogram(ctx, "HeapPause", repositories.NewHistogram([]float64{1})))
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.Error(t, err)
+	_, err = stor.GetMetadata(ctx, "Alloc")
+	require.Error(t, err)
+
+	// после удаления имя метрики можно использовать с другим типом
+	require.NoError(t, stor.AddCounter(ctx, "Alloc", 1))
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Prefix: "Heap"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "Alloc", metrics[0].ID)
+	assert.Equal(t, "PollCount", metrics[1].ID)
+
+	// устаревшие метрики
+	deleted, err = stor.DeleteStaleMetrics(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = stor.DeleteStaleMetrics(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+}
+
+func TestGetHistory(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	from := time.Now()
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 2.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddHistogram(ctx, "Pause", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2}))
+
+	values := func(samples []repositories.Sample) []float64 {
+		result := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			result = append(result, sample.Value)
+		}
+		return result
+	}
+	to := time.Now()
+
+	samples, err := stor.GetHistory(ctx, "Alloc", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2.5}, values(samples))
+
+	// для counter сохраняется накопленная сумма
+	samples, err = stor.GetHistory(ctx, "PollCount", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 7}, values(samples))
+
+	// для histogram сохраняется количество наблюдений
+	samples, err = stor.GetHistory(ctx, "Pause", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2}, values(samples))
+
+	samples, err = stor.GetHistory(ctx, "Alloc", to.Add(time.Second), to.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	_, err = stor.GetHistory(ctx, "unknown", from, to)
+	require.Error(t, err)
+
+	// время последнего обновления совпадает со временем последнего значения в истории
+	samples, err = stor.GetHistory(ctx, "Alloc", from, to)
+	require.NoError(t, err)
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	require.NotNil(t, metrics[0].UpdatedAt)
+	assert.Equal(t, samples[len(samples)-1].Time, *metrics[0].UpdatedAt)
+}
+
+func TestRollups(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Last: 2, Count: 1},
+		{Time: t0, Last: 1, Count: 1},
+	}))
+	// агрегат с тем же началом интервала заменяется
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Last: 5, Count: 2},
+		{Time: t0.Add(2 * time.Minute), Last: 6, Count: 1},
+	}))
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Hour, []repositories.Rollup{{Time: t0, Last: 6, Count: 4}}))
+	assert.Error(t, stor.AddRollups(ctx, "unknown", time.Minute, []repositories.Rollup{{Time: t0}}))
+	assert.Error(t, stor.AddRollups(ctx, "PollCount", 0, []repositories.Rollup{{Time: t0}}))
+
+	rollups, err := stor.GetRollups(ctx, "PollCount", time.Minute, t0.Add(time.Minute), t0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{{Time: t0.Add(time.Minute), Last: 5, Count: 2}, {Time: t0.Add(2 * time.Minute), Last: 6, Count: 1}}, rollups)
+	last, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 6.0, last.Last)
+	_, err = stor.GetRollups(ctx, "unknown", time.Minute, t0, t0)
+	assert.Error(t, err)
+
+	// удаляются только агрегаты заданного уровня
+	deleted, err := stor.DeleteHistoryBefore(ctx, time.Minute, t0.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	rollups, err = stor.GetRollups(ctx, "PollCount", time.Hour, t0, t0)
+	require.NoError(t, err)
+	assert.Len(t, rollups, 1)
+
+	deleted, err = stor.DeleteHistoryBefore(ctx, 0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	samples, err := stor.GetHistory(ctx, "PollCount", t0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// агрегаты удаляются вместе с метрикой
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "PollCount"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	_, ok, err = stor.GetLastRollup(ctx, "PollCount", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCanceledContext(t *testing.T) {
+	stor, _ := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(t, stor.AddGauge(ctx, "Alloc", 1), context.Canceled)
+	_, err := stor.GetAllMetricsSlice(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReopen(t *testing.T) {
+	stor, path := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.db.Close())
+
+	// данные сохраняются после повторного открытия файла
+	db, err := Open(context.Background(), path)
+	require.NoError(t, err)
+	defer db.Close()
+	stor = NewStore(db)
+	require.NoError(t, stor.Bootstrap(ctx))
+
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	got, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "type: gauge, name: Alloc, value: 1.5\ntype: counter, name: PollCount, value: 7\n", got)
+}
+
+func TestCompact(t *testing.T) {
+	stor, path := newTestStore(t)
+	ctx := context.Background()
+
+	// заполняю базу и удаляю большую часть данных, чтобы в файле остались свободные страницы
+	metrics := make([]repositories.Metric, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		value := float64(i)
+		metrics = append(metrics, repositories.Metric{ID: "Metric" + time.Duration(i).String(), MType: "gauge", Value: &value})
+	}
+	for i := 0; i < 60; i++ {
+		require.NoError(t, stor.AddMetricsFromSlice(ctx, metrics))
+	}
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	_, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{Prefix: "Metric"})
+	require.NoError(t, err)
+	require.NoError(t, stor.db.Close())
+
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Greater(t, before.Size(), int64(compactMinSize))
+
+	// сжатие выполняется при открытии базы
+	db, err := Open(context.Background(), path)
+	require.NoError(t, err)
+	defer db.Close()
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+	_, err = os.Stat(path + ".compact")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	stor = NewStore(db)
+	got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+
+	// открытую другим процессом базу сжать нельзя
+	err = Compact(path)
+	require.ErrorIs(t, err, bbolt.ErrTimeout)
+}
@@ -32,7 +32,7 @@ func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
 		supportsGzip := strings.Contains(acceptEncoding, "gzip")
 		contentType := r.Header.Get("Content-Type")
 		if supportsGzip && slices.Contains(contentTypes, contentType) {
-			logger.ServerLog.Debug("client accept encoding, compress answer data", zap.String("Accept-Encoding", acceptEncoding),
+			logger.FromContext(r.Context()).Debug("client accept encoding, compress answer data", zap.String("Accept-Encoding", acceptEncoding),
 				zap.String("Content-Type", contentType))
 			// оборачиваем оригинальный http.ResponseWriter новым с поддержкой сжатия
 			cw := repositories.NewCompressWriter(w)
@@ -46,7 +46,7 @@ func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
 		contentEncoding := r.Header.Get("Content-Encoding")
 		sendsGzip := strings.Contains(contentEncoding, "gzip")
 		if sendsGzip {
-			logger.ServerLog.Debug("client push encoding data, needed decompress", zap.String("Content-Encoding", contentEncoding))
+			logger.FromContext(r.Context()).Debug("client push encoding data, needed decompress", zap.String("Content-Encoding", contentEncoding))
 			// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
 			cr, err := repositories.NewCompressReader(r.Body)
 			if err != nil {
@@ -0,0 +1,62 @@
+// Packet dashboard contain embedded web dashboard for viewing metrics stored on the server.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// StaticPrefix - путь, по которому отдаются статические файлы панели мониторинга.
+const StaticPrefix = "/dashboard/static/"
+
+//go:embed static
+var static embed.FS
+
+// page - отдаёт html страницу из встроенной файловой системы.
+func page(name string) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		data, err := static.ReadFile("static/" + name)
+		if err != nil {
+			logger.FromContext(req.Context()).Error("read dashboard page error", zap.String("page", name), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+		// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+		// а после WriteHeader заголовки уже не устанавливаются
+		res.Header().Set("Status-Code", "200")
+		if _, err := res.Write(data); err != nil {
+			logger.FromContext(req.Context()).Error("write dashboard page error", zap.String("page", name), zap.String("error", error.Error(err)))
+			return
+		}
+	}
+	return fn
+}
+
+// IndexHandler - возвращает главную страницу панели мониторинга с таблицей всех метрик.
+func IndexHandler() http.HandlerFunc {
+	return page("index.html")
+}
+
+// MetricHandler - возвращает страницу панели мониторинга с подробной информацией о метрике.
+// Имя метрики страница извлекает из своего адреса.
+func MetricHandler() http.HandlerFunc {
+	return page("metric.html")
+}
+
+// StaticHandler - возвращает обработчик статических файлов панели мониторинга по пути StaticPrefix.
+func StaticHandler() http.HandlerFunc {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		// каталог static встроен при компиляции, поэтому ошибка невозможна
+		panic(err)
+	}
+	return http.StripPrefix(StaticPrefix, http.FileServer(http.FS(sub))).ServeHTTP
+}
@@ -0,0 +1,68 @@
+package dashboard
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/", IndexHandler())
+	r.Get("/dashboard/metric/{metricName}", MetricHandler())
+	r.Get(StaticPrefix+"*", StaticHandler())
+
+	tests := []struct {
+		name        string
+		request     string
+		wantCode    int
+		contentType string
+		contains    string
+	}{
+		{name: "index", request: "/", wantCode: 200, contentType: "text/html; charset=utf-8", contains: `<table id="metrics">`},
+		{name: "metric page", request: "/dashboard/metric/Poll%20Count", wantCode: 200, contentType: "text/html; charset=utf-8", contains: `id="sparkline"`},
+		{name: "script", request: StaticPrefix + "dashboard.js", wantCode: 200, contentType: "text/javascript; charset=utf-8", contains: "const Dashboard"},
+		{name: "style", request: StaticPrefix + "dashboard.css", wantCode: 200, contentType: "text/css; charset=utf-8", contains: ".sparkline"},
+		{name: "unknown file", request: StaticPrefix + "unknown.js", wantCode: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"))
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.contains)
+		})
+	}
+}
+
+// панель мониторинга не должна загружать ресурсы с внешних серверов
+func TestNoExternalResources(t *testing.T) {
+	external := regexp.MustCompile(`(src|href)\s*=\s*["']?(https?:)?//|url\(\s*["']?(https?:)?//|@import|fetch\(\s*["']https?:`)
+	err := fs.WalkDir(static, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := static.ReadFile(path)
+		require.NoError(t, err)
+		assert.False(t, external.Match(data), "file %s references external resource", path)
+		return nil
+	})
+	require.NoError(t, err)
+}
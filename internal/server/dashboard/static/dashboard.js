@@ -0,0 +1,110 @@
+// Общие функции панели мониторинга. Внешние библиотеки не используются.
+"use strict";
+
+const Dashboard = {
+    refreshInterval: 5000,
+
+    // fetchJSON запрашивает json и использует ETag для повторных запросов.
+    // Возвращает null, если данные не изменились с прошлого запроса.
+    async fetchJSON(url, cache) {
+        const headers = {};
+        if (cache && cache[url]) {
+            headers["If-None-Match"] = cache[url].etag;
+        }
+        const response = await fetch(url, { headers });
+        if (response.status === 304) {
+            return null;
+        }
+        if (!response.ok) {
+            throw new Error(url + ": " + response.status + " " + (await response.text()).trim());
+        }
+        const data = await response.json();
+        const etag = response.headers.get("ETag");
+        if (cache && etag) {
+            cache[url] = { etag, data };
+        }
+        return data;
+    },
+
+    // sortValue возвращает числовое значение метрики для сортировки.
+    sortValue(metric) {
+        if (metric.type === "gauge") {
+            return metric.value;
+        }
+        if (metric.type === "counter") {
+            return metric.delta;
+        }
+        if (metric.type === "histogram" && metric.histogram) {
+            return metric.histogram.count;
+        }
+        return 0;
+    },
+
+    formatNumber(value) {
+        if (value === undefined || value === null) {
+            return "";
+        }
+        if (Number.isInteger(value)) {
+            return value.toLocaleString("en-US");
+        }
+        return Number(value.toPrecision(6)).toString();
+    },
+
+    formatValue(metric) {
+        if (metric.type === "histogram" && metric.histogram) {
+            const h = metric.histogram;
+            return "count " + this.formatNumber(h.count) + ", sum " + this.formatNumber(h.sum);
+        }
+        return this.formatNumber(this.sortValue(metric));
+    },
+
+    formatTime(iso) {
+        if (!iso) {
+            return "";
+        }
+        const seconds = Math.round((Date.now() - new Date(iso).getTime()) / 1000);
+        if (seconds < 5) {
+            return "just now";
+        }
+        if (seconds < 60) {
+            return seconds + "s ago";
+        }
+        if (seconds < 3600) {
+            return Math.floor(seconds / 60) + "m ago";
+        }
+        if (seconds < 86400) {
+            return Math.floor(seconds / 3600) + "h ago";
+        }
+        return new Date(iso).toLocaleString();
+    },
+
+    setStatus(text, isError) {
+        const status = document.getElementById("status");
+        status.textContent = text;
+        status.classList.toggle("error", Boolean(isError));
+    },
+
+    // poll вызывает load сразу и затем периодически, пока включено автообновление.
+    poll(load) {
+        const checkbox = document.getElementById("auto-refresh");
+        const run = async () => {
+            try {
+                await load();
+                this.setStatus("Updated " + new Date().toLocaleTimeString());
+            } catch (err) {
+                this.setStatus(err.message, true);
+            }
+        };
+        run();
+        setInterval(() => {
+            if (checkbox.checked && !document.hidden) {
+                run();
+            }
+        }, this.refreshInterval);
+        return run;
+    },
+
+    metricURL(name) {
+        return "/dashboard/metric/" + encodeURIComponent(name);
+    },
+};
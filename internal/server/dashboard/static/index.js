@@ -0,0 +1,118 @@
+// Таблица всех метрик с поиском, сортировкой и автообновлением.
+"use strict";
+
+(function () {
+    const cache = {};
+    const state = { metrics: [], key: "id", direction: 1, search: "" };
+    const tbody = document.querySelector("#metrics tbody");
+    const empty = document.getElementById("empty");
+
+    // loadAll загружает все страницы списка метрик. Возвращает false, если ни одна страница не изменилась.
+    async function loadAll() {
+        let metrics = [];
+        let changed = false;
+        let cursor = "";
+        do {
+            let url = "/api/v1/metrics?limit=1000";
+            if (cursor) {
+                url += "&cursor=" + encodeURIComponent(cursor);
+            }
+            let page = await Dashboard.fetchJSON(url, cache);
+            if (page === null) {
+                page = cache[url].data;
+            } else {
+                changed = true;
+            }
+            metrics = metrics.concat(page.metrics);
+            cursor = page.next_cursor || "";
+        } while (cursor);
+
+        if (changed || state.metrics.length !== metrics.length) {
+            state.metrics = metrics;
+        }
+        render();
+    }
+
+    function compare(a, b) {
+        let left;
+        let right;
+        switch (state.key) {
+        case "type":
+            left = a.type;
+            right = b.type;
+            break;
+        case "value":
+            left = Dashboard.sortValue(a);
+            right = Dashboard.sortValue(b);
+            break;
+        case "updated":
+            left = a.updated_at || "";
+            right = b.updated_at || "";
+            break;
+        default:
+            left = a.id;
+            right = b.id;
+        }
+        if (left < right) {
+            return -state.direction;
+        }
+        if (left > right) {
+            return state.direction;
+        }
+        // при равенстве сортирую по имени, чтобы порядок строк был стабильным
+        return a.id < b.id ? -1 : a.id > b.id ? 1 : 0;
+    }
+
+    function render() {
+        const search = state.search.toLowerCase();
+        const rows = state.metrics
+            .filter((metric) => metric.id.toLowerCase().includes(search))
+            .sort(compare);
+
+        const fragment = document.createDocumentFragment();
+        for (const metric of rows) {
+            const tr = document.createElement("tr");
+
+            const name = document.createElement("td");
+            const link = document.createElement("a");
+            link.href = Dashboard.metricURL(metric.id);
+            link.textContent = metric.id;
+            name.appendChild(link);
+            tr.appendChild(name);
+
+            for (const text of [metric.type, Dashboard.formatValue(metric), Dashboard.formatTime(metric.updated_at)]) {
+                const td = document.createElement("td");
+                td.textContent = text;
+                tr.appendChild(td);
+            }
+            tr.lastChild.title = metric.updated_at || "";
+            fragment.appendChild(tr);
+        }
+        tbody.replaceChildren(fragment);
+        empty.hidden = rows.length !== 0;
+
+        for (const th of document.querySelectorAll("th[data-key]")) {
+            th.classList.toggle("asc", th.dataset.key === state.key && state.direction === 1);
+            th.classList.toggle("desc", th.dataset.key === state.key && state.direction === -1);
+        }
+    }
+
+    for (const th of document.querySelectorAll("th[data-key]")) {
+        th.addEventListener("click", () => {
+            if (state.key === th.dataset.key) {
+                state.direction = -state.direction;
+            } else {
+                state.key = th.dataset.key;
+                state.direction = 1;
+            }
+            render();
+        });
+    }
+
+    document.getElementById("search").addEventListener("input", (event) => {
+        state.search = event.target.value;
+        render();
+    });
+
+    Dashboard.poll(loadAll);
+})();
@@ -0,0 +1,108 @@
+// Страница метрики с текущим значением, метаданными и графиком истории значений.
+"use strict";
+
+(function () {
+    const cache = {};
+    const name = decodeURIComponent(location.pathname.split("/").pop());
+    let range = "1h";
+
+    document.title = name + " - Metrics";
+    document.getElementById("name").textContent = name;
+
+    function text(id, value) {
+        document.getElementById(id).textContent = value === undefined || value === null ? "" : value;
+    }
+
+    async function loadMetric() {
+        const list = await Dashboard.fetchJSON("/api/v1/metrics?name=" + encodeURIComponent(name), cache);
+        if (list === null) {
+            return;
+        }
+        if (list.metrics.length === 0) {
+            throw new Error("metric " + name + " not found");
+        }
+        const metric = list.metrics[0];
+        text("type", metric.type);
+        text("value", Dashboard.formatValue(metric));
+        text("updated", metric.updated_at ? new Date(metric.updated_at).toLocaleString() : "");
+    }
+
+    async function loadMetadata() {
+        const response = await fetch("/api/v1/metadata/" + encodeURIComponent(name));
+        if (!response.ok) {
+            return;
+        }
+        const metadata = await response.json();
+        text("unit", metadata.unit);
+        text("description", metadata.description);
+    }
+
+    async function loadHistory() {
+        const url = "/api/v1/metrics/" + encodeURIComponent(name) + "/history?range=" + range;
+        const response = await fetch(url);
+        if (!response.ok) {
+            throw new Error(url + ": " + response.status);
+        }
+        const history = await response.json();
+        renderSparkline(history);
+    }
+
+    // renderSparkline рисует историю значений в виде ломаной линии внутри svg.
+    function renderSparkline(history) {
+        const container = document.getElementById("sparkline");
+        const samples = history.samples || [];
+        const summary = document.getElementById("range-summary");
+        if (samples.length === 0) {
+            container.replaceChildren();
+            summary.textContent = "No values for the selected range";
+            return;
+        }
+
+        const width = 1000;
+        const height = 100;
+        const from = new Date(history.from).getTime();
+        const to = new Date(history.to).getTime();
+        const values = samples.map((sample) => sample.v);
+        let min = Math.min(...values);
+        let max = Math.max(...values);
+        if (min === max) {
+            min -= 1;
+            max += 1;
+        }
+
+        const points = samples.map((sample) => {
+            const x = ((new Date(sample.t).getTime() - from) / Math.max(to - from, 1)) * width;
+            const y = height - ((sample.v - min) / (max - min)) * height;
+            return x.toFixed(1) + "," + y.toFixed(1);
+        });
+        if (points.length === 1) {
+            // одну точку растягиваю до конца периода, чтобы линия была видна
+            points.push(width + "," + points[0].split(",")[1]);
+        }
+
+        const svgNS = "http://www.w3.org/2000/svg";
+        const svg = document.createElementNS(svgNS, "svg");
+        svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+        svg.setAttribute("preserveAspectRatio", "none");
+        const polyline = document.createElementNS(svgNS, "polyline");
+        polyline.setAttribute("points", points.join(" "));
+        svg.appendChild(polyline);
+        container.replaceChildren(svg);
+
+        summary.textContent = samples.length + " values, min " + Dashboard.formatNumber(Math.min(...values)) +
+            ", max " + Dashboard.formatNumber(Math.max(...values));
+    }
+
+    const refresh = Dashboard.poll(() => Promise.all([loadMetric(), loadHistory()]));
+    loadMetadata();
+
+    for (const button of document.querySelectorAll("button[data-range]")) {
+        button.addEventListener("click", () => {
+            range = button.dataset.range;
+            for (const other of document.querySelectorAll("button[data-range]")) {
+                other.classList.toggle("active", other === button);
+            }
+            refresh();
+        });
+    }
+})();
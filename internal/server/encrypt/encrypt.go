@@ -4,23 +4,45 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"sync"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
 )
 
-// переменная, которая хранит структуру шифрования и расшифровки
-var cryptoGrapher encryption.Cryptographer
+// Decrypter - расшифровка данных от агента приватным ключом сервера.
+type Decrypter struct {
+	mu            sync.RWMutex
+	cryptoGrapher encryption.Cryptographer
+}
+
+// New - фабричная функция структуры Decrypter.
+func New(c *encryption.Cryptographer) *Decrypter {
+	d := &Decrypter{}
+	if c != nil {
+		d.cryptoGrapher = *c
+	}
+	return d
+}
 
 // SetCryptoGrapher - функция для установки структуры шифрования и расшифровки данных
-func SetCryptoGrapher(c *encryption.Cryptographer) {
-	cryptoGrapher = *c
+func (d *Decrypter) SetCryptoGrapher(c *encryption.Cryptographer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cryptoGrapher = *c
+}
+
+// getCryptoGrapher - возвращает структуру шифрования и расшифровки данных.
+func (d *Decrypter) getCryptoGrapher() encryption.Cryptographer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.cryptoGrapher
 }
 
 // Middleware - мидлварь, которая расшифровывает данные от агента.
-func Middleware(h http.HandlerFunc) http.HandlerFunc {
+func (d *Decrypter) Middleware(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// если установлен адрес к приватному ключу предполагается, что используется шифрование данных
-		if cryptoGrapher.PrivateKeyIsSet() {
+		if cryptoGrapher := d.getCryptoGrapher(); cryptoGrapher.PrivateKeyIsSet() {
 			// Чтение зашифрованного тела запроса
 			encryptedData, err := io.ReadAll(r.Body)
 			if err != nil {
@@ -18,9 +18,10 @@ import (
 
 func TestSetCryptoGrapher(t *testing.T) {
 	crypto := encryption.Initialize("/path/to/public/key", "/path/to/private/key")
-	SetCryptoGrapher(crypto)
+	d := New(nil)
+	d.SetCryptoGrapher(crypto)
 
-	assert.Equal(t, crypto.PublicKeyIsSet(), cryptoGrapher.PublicKeyIsSet())
+	assert.Equal(t, crypto.PublicKeyIsSet(), d.cryptoGrapher.PublicKeyIsSet())
 }
 
 func TestMiddleware(t *testing.T) {
@@ -54,12 +55,12 @@ func TestMiddleware(t *testing.T) {
 	require.NoError(t, err)
 
 	// Создаю струткуру с ключами шифрования
-	SetCryptoGrapher(encryption.Initialize(pathKeys+"/public_key.pem", pathKeys+"/private_key.pem"))
+	d := New(encryption.Initialize(pathKeys+"/public_key.pem", pathKeys+"/private_key.pem"))
 
 	// Success decryption test------------------------------
 	rnd := mathRand.New(mathRand.NewSource(103))
 	body := randomData(rnd, 256)
-	ecryptedData, err := cryptoGrapher.Encrypt(body)
+	ecryptedData, err := d.cryptoGrapher.Encrypt(body)
 	require.NoError(t, err)
 
 	type want struct {
@@ -95,7 +96,7 @@ func TestMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Post("/test", Middleware(testHandler()))
+			r.Post("/test", d.Middleware(testHandler()))
 
 			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewReader(tt.data))
 			w := httptest.NewRecorder()
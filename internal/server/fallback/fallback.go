@@ -0,0 +1,356 @@
+// Packet fallback implement storage wrapper, which buffers written metrics in memory while the main storage is unavailable.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+)
+
+// Store - обёртка хранилища метрик. Если хранилище вернуло repositories.ErrStorageUnavailable, записываемые метрики
+// сохраняются в буфер в памяти и записываются в хранилище методом Flush, когда оно снова станет доступно.
+// В буфере хранится одно значение на метрику: значения gauge заменяются, значения counter суммируются,
+// гистограммы объединяются. Пока буфер не пуст, новые метрики добавляются в буфер, чтобы сохранить порядок записи.
+// Метрики, тип которых отличается от известного типа в хранилище, в буфер не добавляются и отклоняются ошибкой
+// repositories.ErrMetricTypeConflict, как их отклонило бы хранилище. Методы чтения возвращают данные хранилища без учёта буфера.
+type Store struct {
+	repositories.IStorage
+	mu       sync.Mutex
+	pending  map[string]repositories.Metric // накопленные метрики по имени
+	order    []string                       // имена метрик в порядке первого добавления в буфер
+	limit    int                            // максимальное количество метрик в буфере
+	flushing int                            // количество метрик, которые записываются в хранилище методом Flush
+	types    map[string]string              // известные типы метрик: зарегистрированные в реестре метаданных и записанные в хранилище
+}
+
+// New - фабричная функция структуры Store. limit - максимальное количество разных метрик в буфере,
+// при его превышении запись завершается исходной ошибкой хранилища.
+func New(stor repositories.IStorage, limit int) *Store {
+	return &Store{
+		IStorage: stor,
+		pending:  make(map[string]repositories.Metric),
+		limit:    limit,
+		types:    make(map[string]string),
+	}
+}
+
+// LoadTypes - загружает типы метрик из реестра метаданных хранилища, чтобы проверять их при записи в буфер.
+// Вызывается, пока хранилище доступно, например при запуске сервера.
+func (s *Store) LoadTypes(ctx context.Context) error {
+	metadata, err := s.IStorage.GetAllMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string, len(metadata))
+	for _, meta := range metadata {
+		types[meta.ID] = meta.MType
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types = types
+	return nil
+}
+
+// remember - запоминает типы метрик, принятых хранилищем. Вызывается под блокировкой s.mu.
+func (s *Store) remember(metrics []repositories.Metric) {
+	for _, metric := range metrics {
+		s.types[metric.ID] = metric.MType
+	}
+}
+
+// SetMetadata - реализует метод SetMetadata интерфейса repositories.MetadataWriter и запоминает тип метрики.
+func (s *Store) SetMetadata(ctx context.Context, meta repositories.Metadata) error {
+	if err := s.IStorage.SetMetadata(ctx, meta); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remember([]repositories.Metric{{ID: meta.ID, MType: meta.MType}})
+	return nil
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter. Вместе с метриками удаляются
+// их метаданные, поэтому известные типы метрик загружаются заново.
+func (s *Store) DeleteMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	deleted, err := s.IStorage.DeleteMetrics(ctx, filter)
+	s.reloadTypes(ctx, deleted)
+	return deleted, err
+}
+
+// DeleteStaleMetrics - реализует метод DeleteStaleMetrics интерфейса repositories.MetricsDeleter.
+// Известные типы метрик загружаются заново, как и в DeleteMetrics.
+func (s *Store) DeleteStaleMetrics(ctx context.Context, before time.Time) (int, error) {
+	deleted, err := s.IStorage.DeleteStaleMetrics(ctx, before)
+	s.reloadTypes(ctx, deleted)
+	return deleted, err
+}
+
+// reloadTypes - загружает известные типы метрик заново после удаления deleted метрик. Если загрузить типы не удалось,
+// они забываются: метрика неизвестного типа записывается в буфер, а её тип проверяет хранилище при Flush.
+func (s *Store) reloadTypes(ctx context.Context, deleted int) {
+	if deleted == 0 {
+		return
+	}
+	if err := s.LoadTypes(ctx); err != nil {
+		logger.FromContext(ctx).Warn("loading metric types error", zap.String("error", error.Error(err)))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.types = make(map[string]string)
+	}
+}
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.MetricsWriter.
+func (s *Store) AddGauge(ctx context.Context, name string, value float64) error {
+	return s.write(ctx, []repositories.Metric{{ID: name, MType: "gauge", Value: &value}}, func() error {
+		return s.IStorage.AddGauge(ctx, name, value)
+	})
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.MetricsWriter.
+func (s *Store) AddCounter(ctx context.Context, name string, delta int64) error {
+	return s.write(ctx, []repositories.Metric{{ID: name, MType: "counter", Delta: &delta}}, func() error {
+		return s.IStorage.AddCounter(ctx, name, delta)
+	})
+}
+
+// AddHistogram - реализует метод AddHistogram интерфейса repositories.MetricsWriter.
+func (s *Store) AddHistogram(ctx context.Context, name string, histogram repositories.Histogram) error {
+	return s.write(ctx, []repositories.Metric{{ID: name, MType: "histogram", Histogram: &histogram}}, func() error {
+		return s.IStorage.AddHistogram(ctx, name, histogram)
+	})
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.MetricsWriter.
+func (s *Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	return s.write(ctx, metrics, func() error {
+		return s.IStorage.AddMetricsFromSlice(ctx, metrics)
+	})
+}
+
+// write - записывает метрики в хранилище функцией store, а если хранилище недоступно, буфер не пуст
+// или его метрики записываются в хранилище - в буфер.
+func (s *Store) write(ctx context.Context, metrics []repositories.Metric, store func() error) error {
+	s.mu.Lock()
+	if len(s.order) > 0 || s.flushing > 0 {
+		defer s.mu.Unlock()
+		return s.buffer(ctx, metrics, repositories.ErrStorageUnavailable)
+	}
+	s.mu.Unlock()
+
+	err := store()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.remember(metrics)
+	}
+	if !errors.Is(err, repositories.ErrStorageUnavailable) {
+		return err
+	}
+	return s.buffer(ctx, metrics, err)
+}
+
+// buffer - добавляет метрики в буфер целиком или не добавляет ни одной. Если буфер переполнен, возвращается ошибка cause.
+// В размере буфера учитываются и метрики, которые записываются методом Flush, чтобы после их возврата в буфер
+// при неудачной записи буфер не превысил limit. Вызывается под блокировкой s.mu.
+func (s *Store) buffer(ctx context.Context, metrics []repositories.Metric, cause error) error {
+	staged := make(map[string]repositories.Metric, len(metrics))
+	var added []string
+	for _, metric := range metrics {
+		if known, ok := s.types[metric.ID]; ok && known != metric.MType {
+			return repositories.TypeConflictError(metric.ID, known, metric.MType)
+		}
+		current, ok := staged[metric.ID]
+		if !ok {
+			current, ok = s.pending[metric.ID]
+			if !ok {
+				added = append(added, metric.ID)
+			}
+		}
+		var err error
+		if ok {
+			metric, err = merge(current, metric)
+		} else {
+			metric, err = copyMetric(metric)
+		}
+		if err != nil {
+			return err
+		}
+		staged[metric.ID] = metric
+	}
+	if len(s.order)+s.flushing+len(added) > s.limit {
+		logger.FromContext(ctx).Warn("fallback buffer is full, metrics are rejected", zap.Int("limit", s.limit))
+		return cause
+	}
+
+	if len(s.order) == 0 && s.flushing == 0 {
+		logger.FromContext(ctx).Warn("storage is unavailable, buffering metrics in memory", zap.String("error", error.Error(cause)))
+	}
+	for name, metric := range staged {
+		s.pending[name] = metric
+	}
+	s.order = append(s.order, added...)
+	return nil
+}
+
+// copyMetric - возвращает копию метрики, не разделяющую память с исходной, или ошибку, если значение метрики не задано.
+func copyMetric(metric repositories.Metric) (repositories.Metric, error) {
+	result := repositories.Metric{ID: metric.ID, MType: metric.MType}
+	switch {
+	case metric.MType == "gauge" && metric.Value != nil:
+		value := *metric.Value
+		result.Value = &value
+	case metric.MType == "counter" && metric.Delta != nil:
+		delta := *metric.Delta
+		result.Delta = &delta
+	case metric.MType == "histogram" && metric.Histogram != nil:
+		histogram := repositories.Histogram{
+			Bounds: append([]float64(nil), metric.Histogram.Bounds...),
+			Counts: append([]uint64(nil), metric.Histogram.Counts...),
+			Sum:    metric.Histogram.Sum,
+			Count:  metric.Histogram.Count,
+		}
+		result.Histogram = &histogram
+	default:
+		return repositories.Metric{}, fmt.Errorf("metric %s of type %s has no value", metric.ID, metric.MType)
+	}
+	return result, nil
+}
+
+// merge - возвращает накопленное значение метрики current после записи значения next.
+func merge(current, next repositories.Metric) (repositories.Metric, error) {
+	if current.MType != next.MType {
+		return repositories.Metric{}, repositories.TypeConflictError(current.ID, current.MType, next.MType)
+	}
+	next, err := copyMetric(next)
+	if err != nil {
+		return repositories.Metric{}, err
+	}
+	switch next.MType {
+	case "counter":
+		*next.Delta += *current.Delta
+	case "histogram":
+		histogram, err := current.Histogram.Merge(*next.Histogram)
+		if err != nil {
+			return repositories.Metric{}, err
+		}
+		next.Histogram = &histogram
+	}
+	return next, nil
+}
+
+// Buffered - возвращает количество метрик в буфере, включая записываемые в хранилище методом Flush.
+func (s *Store) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.order) + s.flushing
+}
+
+// Flush - записывает накопленные метрики в хранилище в порядке их поступления.
+// Если хранилище отклонило пакет метрик, метрики записываются по одной, а отклонённые хранилищем отбрасываются.
+// Если хранилище недоступно, незаписанные метрики возвращаются в буфер и возвращается ошибка.
+// Хранилище вызывается без блокировки, метрики, записанные во время Flush, добавляются в новый буфер.
+func (s *Store) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	if len(s.order) == 0 || s.flushing > 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	metrics := make([]repositories.Metric, 0, len(s.order))
+	for _, name := range s.order {
+		metrics = append(metrics, s.pending[name])
+	}
+	s.pending = make(map[string]repositories.Metric)
+	s.order = nil
+	s.flushing = len(metrics)
+	s.mu.Unlock()
+
+	err := s.IStorage.AddMetricsFromSlice(ctx, metrics)
+	if err != nil && (errors.Is(err, repositories.ErrStorageUnavailable) || ctx.Err() != nil) {
+		s.restore(ctx, nil, metrics)
+		return err
+	}
+	written := metrics
+	if err != nil {
+		written = make([]repositories.Metric, 0, len(metrics))
+		for i, metric := range metrics {
+			err := s.IStorage.AddMetricsFromSlice(ctx, []repositories.Metric{metric})
+			if err != nil && (errors.Is(err, repositories.ErrStorageUnavailable) || ctx.Err() != nil) {
+				s.restore(ctx, written, metrics[i:])
+				return err
+			}
+			if err != nil {
+				logger.FromContext(ctx).Error("buffered metric is rejected by storage", zap.String("name", metric.ID), zap.String("error", error.Error(err)))
+				continue
+			}
+			written = append(written, metric)
+		}
+	}
+	logger.FromContext(ctx).Info("buffered metrics are written to storage", zap.Int("count", len(metrics)))
+	s.restore(ctx, written, nil)
+	return nil
+}
+
+// restore - завершает Flush: запоминает типы записанных в хранилище метрик written и возвращает в начало буфера
+// метрики metrics, которые не удалось записать. Значения, накопленные в буфере во время Flush, объединяются
+// с возвращёнными как более поздние. Размер буфера не превышает limit, так как buffer учитывает записываемые метрики.
+func (s *Store) restore(ctx context.Context, written, metrics []repositories.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushing = 0
+	s.remember(written)
+	if len(metrics) == 0 {
+		return
+	}
+	order := make([]string, 0, len(metrics)+len(s.order))
+	restored := make(map[string]struct{}, len(metrics))
+	for _, metric := range metrics {
+		if next, ok := s.pending[metric.ID]; ok {
+			merged, err := merge(metric, next)
+			if err != nil {
+				// хранилище отклонит более позднее значение другого типа, поэтому сохраняется ранее принятое
+				logger.FromContext(ctx).Error("buffered metric is replaced", zap.String("name", metric.ID), zap.String("error", error.Error(err)))
+				merged = metric
+			}
+			metric = merged
+		}
+		s.pending[metric.ID] = metric
+		order = append(order, metric.ID)
+		restored[metric.ID] = struct{}{}
+	}
+	for _, name := range s.order {
+		if _, ok := restored[name]; !ok {
+			order = append(order, name)
+		}
+	}
+	s.order = order
+}
+
+// Run - записывает накопленные метрики в хранилище с периодом interval до отмены контекста.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if err := s.Flush(ctx); err != nil && ctx.Err() == nil {
+			logger.FromContext(ctx).Debug("flushing buffered metrics error", zap.String("error", error.Error(err)))
+		}
+	}
+}
+
+// Metrics - возвращает количество метрик в буфере в виде метрики сервера.
+func (s *Store) Metrics() []selfmetrics.Metric {
+	return []selfmetrics.Metric{
+		selfmetrics.Gauge("fallback_buffered_metrics", float64(s.Buffered()), "number of metrics buffered in memory while the storage is unavailable"),
+	}
+}
@@ -0,0 +1,310 @@
+package fallback
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// flakyStorage - хранилище в памяти, которое возвращает repositories.ErrStorageUnavailable, пока установлен признак down.
+type flakyStorage struct {
+	*storage.MemStorage
+	down   atomic.Bool
+	writes atomic.Int32
+}
+
+func newFlakyStorage() *flakyStorage {
+	return &flakyStorage{MemStorage: storage.NewDefaultMemStorage()}
+}
+
+func (f *flakyStorage) check() error {
+	f.writes.Add(1)
+	if f.down.Load() {
+		return repositories.ErrStorageUnavailable
+	}
+	return nil
+}
+
+func (f *flakyStorage) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	return f.MemStorage.AddGauge(ctx, name, value)
+}
+
+func (f *flakyStorage) AddCounter(ctx context.Context, name string, delta int64) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	return f.MemStorage.AddCounter(ctx, name, delta)
+}
+
+func (f *flakyStorage) AddHistogram(ctx context.Context, name string, histogram repositories.Histogram) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	return f.MemStorage.AddHistogram(ctx, name, histogram)
+}
+
+func (f *flakyStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	return f.MemStorage.AddMetricsFromSlice(ctx, metrics)
+}
+
+func TestStoreBuffersWhileUnavailable(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	s := New(inner, 10)
+
+	require.NoError(t, s.AddGauge(ctx, "temperature", 1.5))
+	assert.Equal(t, 0, s.Buffered())
+
+	inner.down.Store(true)
+	require.NoError(t, s.AddGauge(ctx, "temperature", 2.5))
+	require.NoError(t, s.AddCounter(ctx, "requests", 3))
+	delta := int64(4)
+	value := 3.5
+	require.NoError(t, s.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "temperature", MType: "gauge", Value: &value},
+	}))
+	histogram := repositories.NewHistogram([]float64{1, 10})
+	histogram.Observe(5)
+	require.NoError(t, s.AddHistogram(ctx, "latency", histogram))
+	require.NoError(t, s.AddHistogram(ctx, "latency", histogram))
+	assert.Equal(t, 3, s.Buffered())
+	assert.Equal(t, 3.0, *s.Metrics()[0].Value)
+
+	// конфликт типов с накопленной метрикой отклоняет запись целиком
+	err := s.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "other", MType: "counter", Delta: &delta},
+		{ID: "requests", MType: "gauge", Value: &value},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	assert.Equal(t, 3, s.Buffered())
+
+	// пока хранилище недоступно, буфер сохраняется
+	require.ErrorIs(t, s.Flush(ctx), repositories.ErrStorageUnavailable)
+	assert.Equal(t, 3, s.Buffered())
+
+	inner.down.Store(false)
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, 0, s.Buffered())
+
+	got, err := inner.GetMetric(ctx, "gauge", "temperature")
+	require.NoError(t, err)
+	assert.Equal(t, "3.5", got)
+	got, err = inner.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "7", got)
+	stored, err := inner.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), stored.Count)
+}
+
+func TestStoreKeepsOrderWhileBuffered(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	s := New(inner, 10)
+
+	inner.down.Store(true)
+	require.NoError(t, s.AddCounter(ctx, "requests", 1))
+
+	// пока буфер не пуст, метрики пишутся в буфер без обращения к хранилищу
+	inner.down.Store(false)
+	writes := inner.writes.Load()
+	require.NoError(t, s.AddCounter(ctx, "requests", 2))
+	assert.Equal(t, writes, inner.writes.Load())
+	assert.Equal(t, 1, s.Buffered())
+
+	require.NoError(t, s.Flush(ctx))
+	got, err := inner.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+
+	// после записи буфера метрики снова пишутся в хранилище
+	require.NoError(t, s.AddCounter(ctx, "requests", 1))
+	assert.Equal(t, writes+2, inner.writes.Load())
+}
+
+func TestStoreLimit(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	s := New(inner, 2)
+	inner.down.Store(true)
+
+	require.NoError(t, s.AddGauge(ctx, "a", 1))
+	require.NoError(t, s.AddGauge(ctx, "b", 2))
+	// значение уже накопленной метрики заменяется без увеличения буфера
+	require.NoError(t, s.AddGauge(ctx, "a", 3))
+
+	err := s.AddGauge(ctx, "c", 4)
+	require.ErrorIs(t, err, repositories.ErrStorageUnavailable)
+	assert.Equal(t, 2, s.Buffered())
+}
+
+func TestStoreOtherErrorsAreNotBuffered(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	s := New(inner, 10)
+	require.NoError(t, inner.SetMetadata(ctx, repositories.Metadata{ID: "requests", MType: "counter"}))
+
+	err := s.AddGauge(ctx, "requests", 1)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	assert.Equal(t, 0, s.Buffered())
+}
+
+func TestStoreTypeConflictWhileBuffered(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	require.NoError(t, inner.SetMetadata(ctx, repositories.Metadata{ID: "registered", MType: "counter"}))
+	s := New(inner, 10)
+	require.NoError(t, s.LoadTypes(ctx))
+	require.NoError(t, s.AddGauge(ctx, "temperature", 1))
+	require.NoError(t, s.SetMetadata(ctx, repositories.Metadata{ID: "latency", MType: "histogram"}))
+
+	// пока хранилище недоступно, запись метрики другого типа отклоняется так же, как её отклонило бы хранилище
+	inner.down.Store(true)
+	require.NoError(t, s.AddCounter(ctx, "requests", 1))
+	require.ErrorIs(t, s.AddGauge(ctx, "registered", 1), repositories.ErrMetricTypeConflict)
+	require.ErrorIs(t, s.AddCounter(ctx, "temperature", 1), repositories.ErrMetricTypeConflict)
+	require.ErrorIs(t, s.AddGauge(ctx, "latency", 1), repositories.ErrMetricTypeConflict)
+	assert.Equal(t, 1, s.Buffered())
+
+	// после удаления метрики её тип можно изменить
+	inner.down.Store(false)
+	require.NoError(t, s.Flush(ctx))
+	deleted, err := s.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "temperature"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	inner.down.Store(true)
+	require.NoError(t, s.AddCounter(ctx, "temperature", 1))
+	require.ErrorIs(t, s.AddGauge(ctx, "requests", 1), repositories.ErrMetricTypeConflict)
+}
+
+func TestStoreFlushDropsRejectedMetrics(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlakyStorage()
+	s := New(inner, 10)
+	require.NoError(t, inner.SetMetadata(ctx, repositories.Metadata{ID: "requests", MType: "counter"}))
+
+	inner.down.Store(true)
+	require.NoError(t, s.AddGauge(ctx, "requests", 1))
+	require.NoError(t, s.AddGauge(ctx, "temperature", 2))
+
+	inner.down.Store(false)
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, 0, s.Buffered())
+
+	got, err := inner.GetMetric(ctx, "gauge", "temperature")
+	require.NoError(t, err)
+	assert.Equal(t, "2", got)
+	_, err = inner.GetMetric(ctx, "gauge", "requests")
+	assert.Error(t, err)
+}
+
+// blockingStorage - хранилище, запись пакета метрик в которое ждёт сигнала release.
+type blockingStorage struct {
+	*flakyStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.flakyStorage.AddMetricsFromSlice(ctx, metrics)
+}
+
+func TestStoreWritesDuringFlush(t *testing.T) {
+	ctx := context.Background()
+	inner := &blockingStorage{flakyStorage: newFlakyStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	s := New(inner, 10)
+
+	inner.down.Store(true)
+	require.NoError(t, s.AddCounter(ctx, "requests", 1))
+	require.NoError(t, s.AddGauge(ctx, "temperature", 1))
+
+	flushed := make(chan error)
+	go func() { flushed <- s.Flush(ctx) }()
+	<-inner.started
+
+	// пока буфер записывается в хранилище, запись не ждёт Flush и попадает в новый буфер
+	require.NoError(t, s.AddCounter(ctx, "requests", 2))
+	require.NoError(t, s.AddGauge(ctx, "load", 3))
+	assert.Equal(t, 4, s.Buffered())
+	// повторный Flush не записывает метрики, пока не завершился предыдущий
+	require.NoError(t, s.Flush(ctx))
+
+	// незаписанные метрики возвращаются в начало буфера и объединяются с накопленными во время Flush
+	inner.release <- struct{}{}
+	require.ErrorIs(t, <-flushed, repositories.ErrStorageUnavailable)
+	assert.Equal(t, 3, s.Buffered())
+	assert.Equal(t, []string{"requests", "temperature", "load"}, s.order)
+
+	inner.down.Store(false)
+	go func() { flushed <- s.Flush(ctx) }()
+	<-inner.started
+	inner.release <- struct{}{}
+	require.NoError(t, <-flushed)
+	assert.Equal(t, 0, s.Buffered())
+
+	got, err := inner.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+	got, err = inner.GetMetric(ctx, "gauge", "load")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+}
+
+func TestStoreLimitDuringFlush(t *testing.T) {
+	ctx := context.Background()
+	inner := &blockingStorage{flakyStorage: newFlakyStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	s := New(inner, 2)
+
+	inner.down.Store(true)
+	require.NoError(t, s.AddGauge(ctx, "a", 1))
+	require.NoError(t, s.AddGauge(ctx, "b", 2))
+
+	flushed := make(chan error)
+	go func() { flushed <- s.Flush(ctx) }()
+	<-inner.started
+
+	// записываемые метрики учитываются в размере буфера, поэтому после их возврата буфер не превышает limit
+	require.ErrorIs(t, s.AddGauge(ctx, "c", 3), repositories.ErrStorageUnavailable)
+	inner.release <- struct{}{}
+	require.ErrorIs(t, <-flushed, repositories.ErrStorageUnavailable)
+	assert.Equal(t, 2, s.Buffered())
+}
+
+func TestStoreRun(t *testing.T) {
+	inner := newFlakyStorage()
+	s := New(inner, 10)
+	inner.down.Store(true)
+	require.NoError(t, s.AddGauge(context.Background(), "temperature", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	inner.down.Store(false)
+	assert.Eventually(t, func() bool { return s.Buffered() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushing of buffer is not stopped after cancel of context")
+	}
+}
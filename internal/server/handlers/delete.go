@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// DeleteResult - ответ на запрос удаления метрик.
+type DeleteResult struct {
+	Deleted int `json:"deleted"` // количество удаленных метрик
+}
+
+// writeDeleteResult - записывает в ответ количество удаленных метрик.
+func writeDeleteResult(res http.ResponseWriter, req *http.Request, deleted int) {
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	if err := json.NewEncoder(res).Encode(DeleteResult{Deleted: deleted}); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// DeleteMetric - удаляет метрику вместе с её метаданными. Имя метрики извлекается из http запроса.
+func DeleteMetric(res http.ResponseWriter, req *http.Request, storage repositories.MetricsDeleter) {
+	res.Header().Set("Content-Type", "application/json")
+
+	metricName := chi.URLParam(req, "metricName")
+	deleted, err := storage.DeleteMetrics(req.Context(), repositories.MetricsFilter{ID: metricName})
+	if err != nil {
+		logger.FromContext(req.Context()).Error("delete metric error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+	if deleted == 0 {
+		http.Error(res, "metric "+metricName+" not found", http.StatusNotFound)
+		return
+	}
+	logger.FromContext(req.Context()).Info("metric deleted", zap.String("name", metricName))
+	writeDeleteResult(res, req, deleted)
+}
+
+// DeleteMetrics - удаляет метрики, отобранные по параметрам http запроса name, type, prefix, match и label.
+// Запрос без условий отбора отклоняется, чтобы случайно не удалить все метрики.
+func DeleteMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsDeleter) {
+	res.Header().Set("Content-Type", "application/json")
+
+	filter, err := parseMetricsSelector(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.IsEmpty() {
+		http.Error(res, "at least one of name, type, prefix, match or label parameters is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := storage.DeleteMetrics(req.Context(), filter)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("delete metrics error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+	logger.FromContext(req.Context()).Info("metrics deleted", zap.String("address", req.URL.String()), zap.Int("count", deleted))
+	writeDeleteResult(res, req, deleted)
+}
+
+// DeleteMetricHandler - обертка над DeleteMetric для возможности установить хранилище метрик.
+func DeleteMetricHandler(stor repositories.MetricsDeleter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		DeleteMetric(res, req, stor)
+	}
+	return fn
+}
+
+// DeleteMetricsHandler - обертка над DeleteMetrics для возможности установить хранилище метрик.
+func DeleteMetricsHandler(stor repositories.MetricsDeleter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		DeleteMetrics(res, req, stor)
+	}
+	return fn
+}
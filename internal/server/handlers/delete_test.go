@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestDeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewMemStorage(map[string]float64{"HeapAlloc": 1, "HeapIdle": 2, "Alloc": 3}, map[string]int64{"PollCount": 4})
+
+	r := chi.NewRouter()
+	r.Delete("/api/v1/metrics", DeleteMetricsHandler(stor))
+	r.Delete("/api/v1/metrics/{metricName}", DeleteMetricHandler(stor))
+
+	tests := []struct {
+		name        string
+		request     string
+		wantCode    int
+		wantDeleted int
+	}{
+		{name: "single metric", request: "/api/v1/metrics/Alloc", wantCode: 200, wantDeleted: 1},
+		{name: "unknown metric", request: "/api/v1/metrics/Alloc", wantCode: 404},
+		{name: "without selector", request: "/api/v1/metrics", wantCode: 400},
+		{name: "invalid match", request: "/api/v1/metrics?match=(", wantCode: 400},
+		{name: "pattern", request: "/api/v1/metrics?match=%5EHeap", wantCode: 200, wantDeleted: 2},
+		{name: "nothing matched", request: "/api/v1/metrics?prefix=Heap", wantCode: 200, wantDeleted: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodDelete, tt.request, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode == http.StatusOK {
+				var result DeleteResult
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+				assert.Equal(t, tt.wantDeleted, result.Deleted)
+			}
+		})
+	}
+
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "PollCount", metrics[0].ID)
+
+	// вместе с метрикой удаляются её метаданные
+	_, err = stor.GetMetadata(ctx, "Alloc")
+	require.Error(t, err)
+}
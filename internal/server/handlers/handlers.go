@@ -2,8 +2,12 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
@@ -31,7 +35,14 @@ func init() {
             <title>HTML Response</title>
         </head>
         <body>
-            <pre>{{.}}</pre>
+            <pre>{{.Metrics}}</pre>
+            {{if .Metadata}}
+            <table>
+                <tr><th>Name</th><th>Type</th><th>Unit</th><th>Description</th></tr>
+                {{range .Metadata}}<tr><td>{{.ID}}</td><td>{{.MType}}</td><td>{{.Unit}}</td><td>{{.Description}}</td></tr>
+                {{end}}
+            </table>
+            {{end}}
         </body>
         </html>
     `))
@@ -43,8 +54,15 @@ func OtherRequest(res http.ResponseWriter, req *http.Request) {
 	res.WriteHeader(http.StatusNotFound)
 }
 
+// globalPage - данные для шаблона страницы со всеми метриками.
+type globalPage struct {
+	Metrics  string                  // все метрики в виде строки
+	Metadata []repositories.Metadata // метаданные метрик из реестра
+}
+
 // GetGlobal - возвращаю все хранящие на сервере метрики в виде html страницы.
-func GetGlobal(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
+// Если передан реестр метаданных, на странице выводятся единицы измерения и описания метрик.
+func GetGlobal(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader, metadata repositories.MetadataReader) {
 	res.Header().Set("Content-Type", "text/html")
 
 	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
@@ -53,23 +71,37 @@ func GetGlobal(res http.ResponseWriter, req *http.Request, storage repositories.
 	res.Header().Set("Status-Code", "200")
 	metrics, err := storage.GetAllMetrics(req.Context())
 	if err != nil {
-		logger.ServerLog.Error("get all metrics error in GetGlobal handler", zap.String("error", error.Error(err)))
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		logger.FromContext(req.Context()).Error("get all metrics error in GetGlobal handler", zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
 		return
 	}
 
-	if err := tmpl.Execute(res, metrics); err != nil {
-		logger.ServerLog.Error("template execute error in GetGlobal handler", zap.String("error", error.Error(err)))
+	page := globalPage{Metrics: metrics}
+	if metadata != nil {
+		page.Metadata, err = metadata.GetAllMetadata(req.Context())
+		if err != nil {
+			logger.FromContext(req.Context()).Error("get all metadata error in GetGlobal handler", zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
+			return
+		}
+	}
+
+	if err := tmpl.Execute(res, page); err != nil {
+		logger.FromContext(req.Context()).Error("template execute error in GetGlobal handler", zap.String("error", error.Error(err)))
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-// PingDatabase - проверка связи с базой данных.
+// PingDatabase - проверка связи с базой данных. Если сервер работает без базы данных, db равен nil.
 func PingDatabase(res http.ResponseWriter, req *http.Request, db *sql.DB) {
+	if db == nil {
+		http.Error(res, "database is not configured", http.StatusInternalServerError)
+		return
+	}
 	if err := db.PingContext(req.Context()); err != nil {
-		logger.ServerLog.Error("fail to ping database", zap.String("error", error.Error(err)))
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		logger.FromContext(req.Context()).Error("fail to ping database", zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
 		return
 	}
 	res.WriteHeader(http.StatusOK)
@@ -77,7 +109,7 @@ func PingDatabase(res http.ResponseWriter, req *http.Request, db *sql.DB) {
 
 // GetMetricJSON - возвращает метрику в json представлении.
 func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
-	logger.ServerLog.Debug("In GetMetricJSON", zap.String("address", req.URL.String()))
+	logger.FromContext(req.Context()).Debug("In GetMetricJSON", zap.String("address", req.URL.String()))
 
 	res.Header().Set("Content-Type", "application/json")
 
@@ -85,7 +117,7 @@ func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositor
 
 	var metrics repositories.Metric
 	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
-		logger.ServerLog.Error("In GetMetricJSON decode body error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		logger.FromContext(req.Context()).Error("In GetMetricJSON decode body error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -95,7 +127,7 @@ func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositor
 
 	value, err := storage.GetMetric(req.Context(), metricType, metricName)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusNotFound)
+		http.Error(res, err.Error(), lookupErrorStatus(err))
 		return
 	}
 
@@ -103,7 +135,7 @@ func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositor
 	case "counter":
 		val, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			logger.ServerLog.Error("Convert string to int64 error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
+			logger.FromContext(req.Context()).Error("Convert string to int64 error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
 			http.Error(res, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -111,13 +143,21 @@ func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositor
 	case "gauge":
 		val, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			logger.ServerLog.Error("Convert string to float64 error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
+			logger.FromContext(req.Context()).Error("Convert string to float64 error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
 			http.Error(res, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		metrics.Value = &val
+	case "histogram":
+		var val repositories.Histogram
+		if err := json.Unmarshal([]byte(value), &val); err != nil {
+			logger.FromContext(req.Context()).Error("Decode histogram error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		metrics.Histogram = &val
 	default:
-		logger.ServerLog.Debug("In GetMetricJSON invalid type of metric", zap.String("address", req.URL.String()))
+		logger.FromContext(req.Context()).Debug("In GetMetricJSON invalid type of metric", zap.String("address", req.URL.String()))
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -128,14 +168,14 @@ func GetMetricJSON(res http.ResponseWriter, req *http.Request, storage repositor
 	res.Header().Set("Status-Code", "200")
 	enc := json.NewEncoder(res)
 	if err := enc.Encode(metrics); err != nil {
-		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
 		return
 	}
 }
 
 // GetMetric - возвращает метрику в виде строки.
 func GetMetric(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
-	logger.ServerLog.Debug("in GetMetric handler", zap.String("address", req.URL.String()))
+	logger.FromContext(req.Context()).Debug("in GetMetric handler", zap.String("address", req.URL.String()))
 
 	res.Header().Set("Content-Type", "text/plan")
 	metricType := chi.URLParam(req, "metricType")
@@ -143,8 +183,8 @@ func GetMetric(res http.ResponseWriter, req *http.Request, storage repositories.
 
 	value, err := storage.GetMetric(req.Context(), metricType, metricName)
 	if err != nil {
-		logger.ServerLog.Error("get metric error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-		http.Error(res, err.Error(), http.StatusNotFound)
+		logger.FromContext(req.Context()).Error("get metric error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), lookupErrorStatus(err))
 		return
 	}
 	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
@@ -162,6 +202,70 @@ func GetMetric(res http.ResponseWriter, req *http.Request, storage repositories.
 	}
 }
 
+// GetQuantile - возвращает оценку квантиля метрики типа "histogram" в виде строки.
+// Имя метрики и квантиль извлекаются из http запроса.
+func GetQuantile(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
+	logger.FromContext(req.Context()).Debug("in GetQuantile handler", zap.String("address", req.URL.String()))
+
+	res.Header().Set("Content-Type", "text/plain")
+	metricName := chi.URLParam(req, "metricName")
+
+	q, err := strconv.ParseFloat(chi.URLParam(req, "quantile"), 64)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	histogram, err := storage.GetHistogram(req.Context(), metricName)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("get histogram error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), lookupErrorStatus(err))
+		return
+	}
+
+	value, err := histogram.Quantile(q)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	if _, err := res.Write([]byte(strconv.FormatFloat(value, 'g', -1, 64))); err != nil {
+		log.Printf("Write error in GetQuantile handler: %v\n", err)
+		return
+	}
+}
+
+// storageErrorStatus - возвращает код ответа для ошибки хранилища.
+// Несовпадение типа метрики с реестром метаданных и несовпадение границ бакетов гистограмм
+// являются конфликтом с уже хранимыми данными. Если хранилище не ответило до истечения срока обработки запроса,
+// возвращается 504, если запрос отменён при остановке сервера, соединение с базой данных потеряно
+// или хранилище временно недоступно - 503.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, repositories.ErrStorageUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, repositories.ErrMetricTypeConflict), errors.Is(err, repositories.ErrHistogramBoundsMismatch):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// lookupErrorStatus - возвращает код ответа для ошибки поиска метрики в хранилище.
+// Если хранилище ответило вовремя, считается, что метрика не найдена.
+func lookupErrorStatus(err error) int {
+	if status := storageErrorStatus(err); status == http.StatusGatewayTimeout || status == http.StatusServiceUnavailable {
+		return status
+	}
+	return http.StatusNotFound
+}
+
 // UpdateMetricsBatch - обновляет метрики через json батч, который является слайсом метрик.
 func UpdateMetricsBatch(res http.ResponseWriter, req *http.Request, storage repositories.MetricsWriter) {
 	// Проверка на nil для storage
@@ -175,22 +279,39 @@ func UpdateMetricsBatch(res http.ResponseWriter, req *http.Request, storage repo
 	metrics := make([]repositories.Metric, 0)
 
 	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
-		logger.ServerLog.Error("Decode message error", zap.String("address", req.URL.String()))
+		logger.FromContext(req.Context()).Error("Decode message error", zap.String("address", req.URL.String()))
 		http.Error(res, "Decode message error", http.StatusInternalServerError)
 		return
 	}
 
+	// гистограммы проверяются так же, как при обновлении одной метрики, чтобы некорректная гистограмма не дошла до хранилища
+	for _, metric := range metrics {
+		if metric.MType != "histogram" {
+			continue
+		}
+		if metric.Histogram == nil {
+			logger.FromContext(req.Context()).Error("Decode message error, histogram in histogram metric is nil", zap.String("address", req.URL.String()))
+			http.Error(res, fmt.Sprintf("histogram of metric %s is not set", metric.ID), http.StatusBadRequest)
+			return
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			logger.FromContext(req.Context()).Error("invalid histogram", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, fmt.Sprintf("metric %s: %s", metric.ID, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
 	err := storage.AddMetricsFromSlice(req.Context(), metrics)
 	if err != nil {
-		logger.ServerLog.Error("add metric into server error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		logger.FromContext(req.Context()).Error("add metric into server error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
 		return
 	}
 
-	logger.ServerLog.Debug("Successful decode metrcic from json", zap.String("address: ", req.URL.String()))
+	logger.FromContext(req.Context()).Debug("Successful decode metrcic from json", zap.String("address: ", req.URL.String()))
 
 	bodyDebug, _ := io.ReadAll(req.Body)
-	logger.ServerLog.Debug("message before compress", zap.String("bytes: ", string(bodyDebug)))
+	logger.FromContext(req.Context()).Debug("message before compress", zap.String("bytes: ", string(bodyDebug)))
 
 	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
 	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
@@ -199,13 +320,13 @@ func UpdateMetricsBatch(res http.ResponseWriter, req *http.Request, storage repo
 
 	enc := json.NewEncoder(res)
 	if err := enc.Encode(metrics); err != nil {
-		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
 		return
 	}
 
-	logger.ServerLog.Debug("successful write encode data to answer message in UpdateMetricsBatch")
+	logger.FromContext(req.Context()).Debug("successful write encode data to answer message in UpdateMetricsBatch")
 
-	logger.ServerLog.Debug("server answer is", zap.String("Content-Encoding", res.Header().Get("Content-Encoding")),
+	logger.FromContext(req.Context()).Debug("server answer is", zap.String("Content-Encoding", res.Header().Get("Content-Encoding")),
 		zap.String("Status-Code", res.Header().Get("Status-Code")),
 		zap.String("Content-Type", res.Header().Get("Content-Type")),
 		zap.String("HashSHA256", res.Header().Get("HashSHA256")))
@@ -225,7 +346,7 @@ func UpdateMetricsJSON(res http.ResponseWriter, req *http.Request, storage repos
 	var metrics = repositories.Metric{}
 
 	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
-		logger.ServerLog.Error("Decode message error", zap.String("address", req.URL.String()))
+		logger.FromContext(req.Context()).Error("Decode message error", zap.String("address", req.URL.String()))
 		http.Error(res, "Decode message error", http.StatusInternalServerError)
 		return
 	}
@@ -233,37 +354,54 @@ func UpdateMetricsJSON(res http.ResponseWriter, req *http.Request, storage repos
 	switch metrics.MType {
 	case "gauge":
 		if metrics.Value == nil {
-			logger.ServerLog.Error("Decode message error, value in gauge metric is nil", zap.String("address", req.URL.String()))
+			logger.FromContext(req.Context()).Error("Decode message error, value in gauge metric is nil", zap.String("address", req.URL.String()))
 			res.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		err := storage.AddGauge(req.Context(), metrics.ID, *metrics.Value)
 		if err != nil {
-			logger.ServerLog.Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			logger.FromContext(req.Context()).Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	case "counter":
 		if metrics.Delta == nil {
-			logger.ServerLog.Error("Decode message error, delta in counter metric is nil", zap.String("address", req.URL.String()))
+			logger.FromContext(req.Context()).Error("Decode message error, delta in counter metric is nil", zap.String("address", req.URL.String()))
 			res.WriteHeader(http.StatusBadRequest)
 			return
 		}
 		err := storage.AddCounter(req.Context(), metrics.ID, *metrics.Delta)
 		if err != nil {
-			logger.ServerLog.Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			logger.FromContext(req.Context()).Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
+			return
+		}
+	case "histogram":
+		if metrics.Histogram == nil {
+			logger.FromContext(req.Context()).Error("Decode message error, histogram in histogram metric is nil", zap.String("address", req.URL.String()))
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := metrics.Histogram.Validate(); err != nil {
+			logger.FromContext(req.Context()).Error("invalid histogram", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := storage.AddHistogram(req.Context(), metrics.ID, *metrics.Histogram)
+		if err != nil {
+			logger.FromContext(req.Context()).Error("add histogram error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	default:
-		logger.ServerLog.Error("Invalid type of metric", zap.String("type", metrics.MType)) //---------------------------------------------
+		logger.FromContext(req.Context()).Error("Invalid type of metric", zap.String("type", metrics.MType)) //---------------------------------------------
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	logger.ServerLog.Debug("Successful decode metrcic from json", zap.String("address: ", req.URL.String()))
+	logger.FromContext(req.Context()).Debug("Successful decode metrcic from json", zap.String("address: ", req.URL.String()))
 
 	bodyDebug, _ := io.ReadAll(req.Body)
-	logger.ServerLog.Debug("message before compress", zap.String("bytes: ", string(bodyDebug)))
+	logger.FromContext(req.Context()).Debug("message before compress", zap.String("bytes: ", string(bodyDebug)))
 
 	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
 	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
@@ -272,13 +410,13 @@ func UpdateMetricsJSON(res http.ResponseWriter, req *http.Request, storage repos
 
 	enc := json.NewEncoder(res)
 	if err := enc.Encode(metrics); err != nil {
-		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
 		return
 	}
 
-	logger.ServerLog.Debug("successful write encode data to answer message")
+	logger.FromContext(req.Context()).Debug("successful write encode data to answer message")
 
-	logger.ServerLog.Debug("server answer is", zap.String("Content-Encoding", res.Header().Get("Content-Encoding")),
+	logger.FromContext(req.Context()).Debug("server answer is", zap.String("Content-Encoding", res.Header().Get("Content-Encoding")),
 		zap.String("Status-Code", res.Header().Get("Status-Code")),
 		zap.String("HashSHA256", res.Header().Get("HashSHA256")),
 		zap.String("Content-Type", res.Header().Get("Content-Type")))
@@ -312,8 +450,8 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 		}
 		err = storage.AddGauge(req.Context(), metricName, value)
 		if err != nil {
-			logger.ServerLog.Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			logger.FromContext(req.Context()).Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	case "counter":
@@ -324,8 +462,8 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 		}
 		err = storage.AddCounter(req.Context(), metricName, value)
 		if err != nil {
-			logger.ServerLog.Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			logger.FromContext(req.Context()).Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	default:
@@ -336,10 +474,10 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 	res.WriteHeader(http.StatusOK)
 }
 
-// GetGlobalHandler - обертка над GetGlobal для возможности установить хранилище метрик.
-func GetGlobalHandler(stor repositories.MetricsReader) http.HandlerFunc {
+// GetGlobalHandler - обертка над GetGlobal для возможности установить хранилище метрик и реестр метаданных.
+func GetGlobalHandler(stor repositories.MetricsReader, metadata repositories.MetadataReader) http.HandlerFunc {
 	fn := func(res http.ResponseWriter, req *http.Request) {
-		GetGlobal(res, req, stor)
+		GetGlobal(res, req, stor, metadata)
 	}
 	return fn
 }
@@ -392,6 +530,14 @@ func GetMetricHandler(stor repositories.MetricsReader) http.HandlerFunc {
 	return fn
 }
 
+// GetQuantileHandler - обертка над GetQuantile для возможности установить хранилище метрик.
+func GetQuantileHandler(stor repositories.MetricsReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		GetQuantile(res, req, stor)
+	}
+	return fn
+}
+
 // OtherRequestHandler - обертка над OtherRequest для возможности установить хранилище метрик.
 func OtherRequestHandler() http.HandlerFunc {
 	fn := func(res http.ResponseWriter, req *http.Request) {
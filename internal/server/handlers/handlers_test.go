@@ -13,6 +13,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -27,6 +28,7 @@ import (
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/mocks"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/timeout"
 )
 
 func TestOtherRequest(t *testing.T) {
@@ -159,7 +161,7 @@ counter: 1</pre>
 			r := chi.NewRouter()
 			r.Get("/test", func(res http.ResponseWriter, req *http.Request) {
 				req = req.WithContext(tt.ctx)
-				GetGlobal(res, req, m)
+				GetGlobal(res, req, m, nil)
 			})
 
 			request := httptest.NewRequest(http.MethodGet, "/test", nil)
@@ -434,14 +436,13 @@ func TestGetMetricJSON(t *testing.T) {
 		errWrite := storForFluahFile.AddMetricsFromSlice(context.Background(), metrcSlice)
 		require.NoError(t, errWrite)
 
-		errFlush := saverVar.WriteMetrics(storForFluahFile)
+		errFlush := saverVar.WriteMetrics(context.Background(), storForFluahFile)
 		require.NoError(t, errFlush)
 
 		reader, erReader := saver.NewReader(nameTestFile)
 		require.NoError(t, erReader)
 
-		saver.SetRestore(true)
-		saver.AddMetricsFromFile(stor, reader)
+		saver.AddMetricsFromFile(context.Background(), stor, reader)
 
 		type want struct {
 			code        int
@@ -876,6 +877,180 @@ func TestUpdateMetricsJSON(t *testing.T) {
 	}
 }
 
+func TestUpdateMetricsJSONHistogram(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+
+	r := chi.NewRouter()
+	r.Post("/update", func(res http.ResponseWriter, req *http.Request) {
+		UpdateMetricsJSON(res, req, stor)
+	})
+	r.Post("/value", func(res http.ResponseWriter, req *http.Request) {
+		GetMetricJSON(res, req, stor)
+	})
+
+	tests := []struct {
+		name     string
+		request  string
+		body     repositories.Metric
+		wantCode int
+	}{
+		{
+			name:    "first histogram",
+			request: "/update",
+			body: repositories.Metric{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+				Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3}},
+			wantCode: 200,
+		},
+		{
+			name:    "merge histogram",
+			request: "/update",
+			body: repositories.Metric{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+				Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5}},
+			wantCode: 200,
+		},
+		{
+			name:     "histogram is nil",
+			request:  "/update",
+			body:     repositories.Metric{ID: "pause", MType: "histogram"},
+			wantCode: 400,
+		},
+		{
+			name:    "invalid histogram",
+			request: "/update",
+			body: repositories.Metric{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+				Bounds: []float64{1, 2}, Counts: []uint64{1}, Count: 1}},
+			wantCode: 400,
+		},
+		{
+			name:    "bounds mismatch",
+			request: "/update",
+			body: repositories.Metric{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+				Bounds: []float64{1, 3}, Counts: []uint64{1, 0, 0}, Sum: 1, Count: 1}},
+			wantCode: 409,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+
+			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+
+	// получаю объединенную гистограмму
+	body, err := json.Marshal(repositories.Metric{ID: "pause", MType: "histogram"})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/value", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var got repositories.Metric
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	require.NotNil(t, got.Histogram)
+	assert.Equal(t, repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, *got.Histogram)
+}
+
+func TestUpdateMetricsBatchHistogram(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	handler := UpdateMetricsBatchHandler(stor)
+	delta := int64(1)
+
+	tests := []struct {
+		name     string
+		body     []repositories.Metric
+		wantCode int
+	}{
+		{
+			name: "valid histogram",
+			body: []repositories.Metric{{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+				Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3}}},
+			wantCode: 200,
+		},
+		{
+			name: "histogram is nil",
+			body: []repositories.Metric{
+				{ID: "requests", MType: "counter", Delta: &delta},
+				{ID: "pause", MType: "histogram"},
+			},
+			wantCode: 400,
+		},
+		{
+			name: "invalid histogram",
+			body: []repositories.Metric{
+				{ID: "requests", MType: "counter", Delta: &delta},
+				{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1}, Count: 1}},
+			},
+			wantCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBuffer(body)))
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+
+	// батч с некорректной гистограммой не записывается целиком
+	_, err := stor.GetMetric(context.Background(), "counter", "requests")
+	assert.Error(t, err)
+}
+
+func TestGetQuantile(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	err := stor.AddHistogram(context.Background(), "pause", repositories.Histogram{
+		Bounds: []float64{10, 20, 40}, Counts: []uint64{10, 10, 0, 5}, Count: 25})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Get("/quantile/{metricName}/{quantile}", GetQuantileHandler(stor))
+
+	tests := []struct {
+		name     string
+		request  string
+		wantCode int
+		wantBody string
+	}{
+		{name: "median", request: "/quantile/pause/0.5", wantCode: 200, wantBody: "12.5"},
+		{name: "inf bucket", request: "/quantile/pause/0.99", wantCode: 200, wantBody: "40"},
+		{name: "unknown metric", request: "/quantile/unknown/0.5", wantCode: 404},
+		{name: "invalid quantile", request: "/quantile/pause/abc", wantCode: 400},
+		{name: "quantile out of range", request: "/quantile/pause/2", wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode == http.StatusOK {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
+
 func BenchmarkUpdateMetricsJSON(b *testing.B) {
 	// В качестве хранилища использую оперативную память.
 	// В данной конфигурации автотестов использовать в качестве хранилища не представляется возможным,
@@ -974,3 +1149,126 @@ func BenchmarkUpdateMetricsJSON(b *testing.B) {
 		}
 	}
 }
+
+// slowStorage - хранилище, которое отвечает с задержкой delay или при отмене контекста запроса.
+type slowStorage struct {
+	repositories.IStorage
+	delay time.Duration
+}
+
+// wait - ожидает задержку хранилища или отмену контекста.
+func (s slowStorage) wait(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s slowStorage) GetMetric(ctx context.Context, typeMetric string, nameMetric string) (string, error) {
+	if err := s.wait(ctx); err != nil {
+		return "", err
+	}
+	return s.IStorage.GetMetric(ctx, typeMetric, nameMetric)
+}
+
+func (s slowStorage) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.IStorage.AddGauge(ctx, name, value)
+}
+
+func (s slowStorage) ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.IStorage.ListMetrics(ctx, filter)
+}
+
+func TestStorageTimeout(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+	slow := slowStorage{IStorage: stor, delay: time.Second}
+
+	limiter := timeout.New(10 * time.Millisecond)
+
+	r := chi.NewRouter()
+	r.Use(limiter.Middleware)
+	r.Get("/value/{metricType}/{metricName}", GetMetricHandler(slow))
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", UpdateMetricsHandler(slow))
+	r.Get("/api/v1/metrics", ListMetricsHandler(slow))
+
+	tests := []struct {
+		name    string
+		method  string
+		request string
+	}{
+		{name: "get metric", method: http.MethodGet, request: "/value/gauge/Alloc"},
+		{name: "update metric", method: http.MethodPost, request: "/update/gauge/Alloc/2"},
+		{name: "list metrics", method: http.MethodGet, request: "/api/v1/metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// хранилище не успевает ответить до истечения срока обработки запроса
+			start := time.Now()
+			request := httptest.NewRequest(tt.method, tt.request, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+			assert.Less(t, time.Since(start), slow.delay)
+
+			// запрос отменён клиентом или при остановке сервера
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			request = httptest.NewRequest(tt.method, tt.request, nil).WithContext(ctx)
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res = w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		})
+	}
+
+	// значение метрики не изменилось
+	value, err := stor.GetMetric(context.Background(), "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
+
+// unavailableStorage - хранилище, которое всегда отвечает ошибкой repositories.ErrStorageUnavailable.
+type unavailableStorage struct {
+	repositories.IStorage
+}
+
+func (s unavailableStorage) GetMetric(context.Context, string, string) (string, error) {
+	return "", fmt.Errorf("get metric: %w", repositories.ErrStorageUnavailable)
+}
+
+func (s unavailableStorage) ListMetrics(context.Context, repositories.MetricsFilter) ([]repositories.Metric, error) {
+	return nil, fmt.Errorf("list metrics: %w", repositories.ErrStorageUnavailable)
+}
+
+func TestStorageUnavailable(t *testing.T) {
+	stor := unavailableStorage{IStorage: storage.NewDefaultMemStorage()}
+
+	r := chi.NewRouter()
+	r.Get("/value/{metricType}/{metricName}", GetMetricHandler(stor))
+	r.Get("/api/v1/metrics", ListMetricsHandler(stor))
+
+	for _, request := range []string{"/value/gauge/Alloc", "/api/v1/metrics"} {
+		t.Run(request, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, request, nil))
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		})
+	}
+}
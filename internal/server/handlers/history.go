@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+)
+
+const defaultHistoryRange = time.Hour // период истории метрики по умолчанию
+
+// MetricHistory - ответ на запрос истории значений метрики.
+type MetricHistory struct {
+	ID         string                `json:"id"`                // имя метрики
+	From       time.Time             `json:"from"`              // начало периода
+	To         time.Time             `json:"to"`                // конец периода
+	Resolution string                `json:"resolution"`        // уровень истории: raw, 1m или 1h
+	Samples    []repositories.Sample `json:"samples"`           // значения метрики в порядке возрастания времени, у агрегатов - последнее значение интервала
+	Rollups    []repositories.Rollup `json:"rollups,omitempty"` // агрегаты метрики, если уровень истории не raw
+}
+
+// parseHistoryRange - извлекает период истории из параметров http запроса from и to в формате RFC 3339
+// или из параметра range в формате длительности Go. По умолчанию возвращается последний час.
+func parseHistoryRange(req *http.Request) (time.Time, time.Time, error) {
+	query := req.URL.Query()
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to parameter: %w", err)
+		}
+	}
+
+	from := to.Add(-defaultHistoryRange)
+	if value := query.Get("range"); value != "" {
+		period, err := time.ParseDuration(value)
+		if err != nil || period <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid range parameter %s", value)
+		}
+		from = to.Add(-period)
+	}
+	if value := query.Get("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from parameter: %w", err)
+		}
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
+// GetHistory - возвращает историю значений метрики в json представлении. Имя метрики извлекается из http запроса.
+// Уровень истории задаётся параметром resolution (raw, 1m или 1h), по умолчанию выбирается уровень,
+// который ещё хранит значения за начало периода по времени хранения уровней retention.
+func GetHistory(res http.ResponseWriter, req *http.Request, storage rollup.Reader, retention *rollup.Retention) {
+	res.Header().Set("Content-Type", "application/json")
+
+	from, to, err := parseHistoryRange(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resolution := retention.GetPolicy().Select(from, time.Now())
+	if value := req.URL.Query().Get("resolution"); value != "" && value != "auto" {
+		if resolution, err = rollup.ParseResolution(value); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metricName := chi.URLParam(req, "metricName")
+	rollups, err := rollup.Read(req.Context(), storage, metricName, resolution, from, to)
+	if err != nil {
+		logger.FromContext(req.Context()).Debug("get history error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), lookupErrorStatus(err))
+		return
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	history := MetricHistory{ID: metricName, From: from, To: to, Resolution: rollup.FormatResolution(resolution), Samples: make([]repositories.Sample, len(rollups))}
+	for i, r := range rollups {
+		history.Samples[i] = repositories.Sample{Time: r.Time, Value: r.Last}
+	}
+	if resolution != rollup.Raw {
+		history.Rollups = rollups
+	}
+	if err := json.NewEncoder(res).Encode(history); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// GetHistoryHandler - обертка над GetHistory для возможности установить хранилище метрик и время хранения уровней истории.
+func GetHistoryHandler(stor rollup.Reader, retention *rollup.Retention) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		GetHistory(res, req, stor, retention)
+	}
+	return fn
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestGetHistory(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/metrics/{metricName}/history", GetHistoryHandler(stor, rollup.NewRetention(rollup.DefaultPolicy)))
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		metric         string
+		query          url.Values
+		wantCode       int
+		wantSamples    []float64
+		wantResolution string
+	}{
+		{name: "default range", metric: "PollCount", query: url.Values{}, wantCode: 200, wantSamples: []float64{3, 7}},
+		{name: "range", metric: "PollCount", query: url.Values{"range": {"15m"}, "to": {future}}, wantCode: 200, wantSamples: []float64{}},
+		{name: "from and to", metric: "PollCount", query: url.Values{"from": {past}, "to": {future}}, wantCode: 200, wantSamples: []float64{3, 7}},
+		{name: "minute resolution", metric: "PollCount", query: url.Values{"resolution": {"1m"}}, wantCode: 200, wantResolution: "1m"},
+		{name: "invalid resolution", metric: "PollCount", query: url.Values{"resolution": {"5m"}}, wantCode: 400},
+		{name: "unknown metric", metric: "unknown", query: url.Values{}, wantCode: 404},
+		{name: "invalid range", metric: "PollCount", query: url.Values{"range": {"-1h"}}, wantCode: 400},
+		{name: "invalid from", metric: "PollCount", query: url.Values{"from": {"yesterday"}}, wantCode: 400},
+		{name: "from after to", metric: "PollCount", query: url.Values{"from": {future}, "to": {past}}, wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/metrics/"+tt.metric+"/history?"+tt.query.Encode(), nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var history MetricHistory
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&history))
+			assert.Equal(t, tt.metric, history.ID)
+			if tt.wantResolution != "" {
+				// значения могут попасть в разные минутные интервалы, поэтому проверяется только последнее значение
+				assert.Equal(t, tt.wantResolution, history.Resolution)
+				require.NotEmpty(t, history.Rollups)
+				assert.Equal(t, 7.0, history.Samples[len(history.Samples)-1].Value)
+				return
+			}
+			assert.Equal(t, "raw", history.Resolution)
+			assert.Empty(t, history.Rollups)
+			values := make([]float64, 0, len(history.Samples))
+			for _, sample := range history.Samples {
+				values = append(values, sample.Value)
+			}
+			assert.Equal(t, tt.wantSamples, values)
+		})
+	}
+}
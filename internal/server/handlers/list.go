@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+const (
+	defaultListLimit = 100  // количество метрик на странице по умолчанию
+	maxListLimit     = 1000 // максимальное количество метрик на странице
+)
+
+// MetricsList - ответ на запрос списка метрик.
+type MetricsList struct {
+	Metrics    []repositories.Metric `json:"metrics"`               // метрики на текущей странице
+	Total      int                   `json:"total"`                 // количество метрик, удовлетворяющих фильтру
+	NextCursor string                `json:"next_cursor,omitempty"` // курсор следующей страницы, пустой на последней странице
+}
+
+// parseMetricsSelector - извлекает условия отбора метрик из параметров http запроса.
+// Поддерживаются параметры name, type, prefix, match и label (в формате имя:значение, может повторяться).
+func parseMetricsSelector(query url.Values) (repositories.MetricsFilter, error) {
+	filter := repositories.MetricsFilter{
+		ID:     query.Get("name"),
+		Type:   query.Get("type"),
+		Prefix: query.Get("prefix"),
+		Match:  query.Get("match"),
+	}
+
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, ":")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("label must be in format name:value, got %s", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+	return filter, filter.Validate()
+}
+
+// parseMetricsFilter - извлекает условия выборки метрик из параметров http запроса.
+// Кроме условий отбора parseMetricsSelector поддерживаются параметры страницы limit и cursor.
+func parseMetricsFilter(req *http.Request) (repositories.MetricsFilter, error) {
+	query := req.URL.Query()
+	filter, err := parseMetricsSelector(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit = defaultListLimit
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxListLimit {
+			return filter, fmt.Errorf("limit must be in range [1, %d], got %s", maxListLimit, limit)
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		afterID, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(afterID) == 0 {
+			return filter, fmt.Errorf("invalid cursor %s", cursor)
+		}
+		filter.AfterID = string(afterID)
+	}
+	return filter, filter.Validate()
+}
+
+// etagMatches - проверяет, содержит ли заголовок If-None-Match переданный ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ListMetrics - возвращает страницу метрик в json представлении, отфильтрованных по параметрам http запроса.
+// Метрики отсортированы по имени, для перехода на следующую страницу используется курсор next_cursor.
+// Ответ содержит заголовок ETag, и при совпадении с If-None-Match возвращается статус 304 без тела.
+func ListMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
+	res.Header().Set("Content-Type", "application/json")
+
+	filter, err := parseMetricsFilter(req)
+	if err != nil {
+		logger.FromContext(req.Context()).Debug("parse metrics filter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// запрашиваю на одну метрику больше, чтобы узнать, есть ли следующая страница
+	pageFilter := filter
+	pageFilter.Limit++
+	metrics, err := storage.ListMetrics(req.Context(), pageFilter)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("list metrics error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+	total, err := storage.CountMetrics(req.Context(), filter)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("count metrics error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+
+	list := MetricsList{Metrics: metrics, Total: total}
+	if len(metrics) > filter.Limit {
+		list.Metrics = metrics[:filter.Limit]
+		list.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(list.Metrics[filter.Limit-1].ID))
+	}
+
+	body, err := json.Marshal(list)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		res.Header().Set("Status-Code", "304")
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	if _, err := res.Write(body); err != nil {
+		logger.FromContext(req.Context()).Error("write error in ListMetrics handler", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// ListMetricsHandler - обертка над ListMetrics для возможности установить хранилище метрик.
+func ListMetricsHandler(stor repositories.MetricsReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		ListMetrics(res, req, stor)
+	}
+	return fn
+}
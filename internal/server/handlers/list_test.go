@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestListMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewMemStorage(map[string]float64{"HeapAlloc": 1, "HeapIdle": 2, "Alloc": 3}, map[string]int64{"PollCount": 4})
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "HeapIdle", MType: "gauge", Labels: map[string]string{"host": "agent"}}))
+	handler := ListMetricsHandler(stor)
+
+	get := func(t *testing.T, query url.Values, header http.Header) (*http.Response, MetricsList) {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query.Encode(), nil)
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler(w, request)
+
+		res := w.Result()
+		var list MetricsList
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+		}
+		res.Body.Close()
+		return res, list
+	}
+	ids := func(list MetricsList) []string {
+		result := make([]string, 0, len(list.Metrics))
+		for _, metric := range list.Metrics {
+			result = append(result, metric.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		wantCode int
+		want     []string
+	}{
+		{name: "all", query: url.Values{}, wantCode: 200, want: []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}},
+		{name: "type", query: url.Values{"type": {"counter"}}, wantCode: 200, want: []string{"PollCount"}},
+		{name: "prefix", query: url.Values{"prefix": {"Heap"}}, wantCode: 200, want: []string{"HeapAlloc", "HeapIdle"}},
+		{name: "match", query: url.Values{"match": {"Alloc$"}}, wantCode: 200, want: []string{"Alloc", "HeapAlloc"}},
+		{name: "label", query: url.Values{"label": {"host:agent"}}, wantCode: 200, want: []string{"HeapIdle"}},
+		{name: "invalid type", query: url.Values{"type": {"summary"}}, wantCode: 400},
+		{name: "invalid match", query: url.Values{"match": {"("}}, wantCode: 400},
+		{name: "invalid label", query: url.Values{"label": {"host"}}, wantCode: 400},
+		{name: "invalid limit", query: url.Values{"limit": {"0"}}, wantCode: 400},
+		{name: "too big limit", query: url.Values{"limit": {"100000"}}, wantCode: 400},
+		{name: "invalid cursor", query: url.Values{"cursor": {"%%%"}}, wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, list := get(t, tt.query, nil)
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, tt.want, ids(list))
+				assert.Equal(t, len(tt.want), list.Total)
+				assert.Empty(t, list.NextCursor)
+			}
+		})
+	}
+
+	// обход всех метрик постранично
+	t.Run("pagination", func(t *testing.T) {
+		got := make([]string, 0)
+		query := url.Values{"limit": {"3"}}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3)
+			res, list := get(t, query, nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, 4, list.Total)
+			got = append(got, ids(list)...)
+			if list.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", list.NextCursor)
+		}
+		assert.Equal(t, []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}, got)
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		res, _ := get(t, url.Values{}, nil)
+		etag := res.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		res, _ = get(t, url.Values{}, http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+		res, _ = get(t, url.Values{}, http.Header{"If-None-Match": {`"other", W/` + etag}})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+		// после изменения метрик ETag меняется
+		require.NoError(t, stor.AddGauge(ctx, "Alloc", 10))
+		res, _ = get(t, url.Values{}, http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEqual(t, etag, res.Header.Get("ETag"))
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// GetAllMetadata - возвращает метаданные всех зарегистрированных метрик в json представлении.
+func GetAllMetadata(res http.ResponseWriter, req *http.Request, metadata repositories.MetadataReader) {
+	res.Header().Set("Content-Type", "application/json")
+
+	result, err := metadata.GetAllMetadata(req.Context())
+	if err != nil {
+		logger.FromContext(req.Context()).Error("get all metadata error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	if err := json.NewEncoder(res).Encode(result); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// GetMetadata - возвращает метаданные метрики в json представлении. Имя метрики извлекается из http запроса.
+func GetMetadata(res http.ResponseWriter, req *http.Request, metadata repositories.MetadataReader) {
+	res.Header().Set("Content-Type", "application/json")
+
+	meta, err := metadata.GetMetadata(req.Context(), chi.URLParam(req, "metricName"))
+	if err != nil {
+		logger.FromContext(req.Context()).Debug("get metadata error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), lookupErrorStatus(err))
+		return
+	}
+
+	res.Header().Set("Status-Code", "200")
+	if err := json.NewEncoder(res).Encode(meta); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// UpdateMetadata - добавляет или изменяет метаданные метрики. Имя метрики извлекается из http запроса,
+// метаданные - из json тела запроса. Если тип метрики не указан, сохраняется ранее зарегистрированный тип.
+func UpdateMetadata(res http.ResponseWriter, req *http.Request, metadata repositories.MetadataStorage) {
+	res.Header().Set("Content-Type", "application/json")
+
+	var meta repositories.Metadata
+	if err := json.NewDecoder(req.Body).Decode(&meta); err != nil {
+		logger.FromContext(req.Context()).Error("decode metadata error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metricName := chi.URLParam(req, "metricName")
+	if meta.ID != "" && meta.ID != metricName {
+		http.Error(res, "metric name in body is not equal metric name in address", http.StatusBadRequest)
+		return
+	}
+	meta.ID = metricName
+
+	if meta.MType == "" {
+		registered, err := metadata.GetMetadata(req.Context(), metricName)
+		if err != nil {
+			http.Error(res, "type of metric is required for unregistered metric", http.StatusBadRequest)
+			return
+		}
+		meta.MType = registered.MType
+	}
+	if err := meta.Validate(); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := metadata.SetMetadata(req.Context(), meta); err != nil {
+		logger.FromContext(req.Context()).Error("set metadata error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+
+	res.Header().Set("Status-Code", "200")
+	if err := json.NewEncoder(res).Encode(meta); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// GetAllMetadataHandler - обертка над GetAllMetadata для возможности установить реестр метаданных.
+func GetAllMetadataHandler(metadata repositories.MetadataReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		GetAllMetadata(res, req, metadata)
+	}
+	return fn
+}
+
+// GetMetadataHandler - обертка над GetMetadata для возможности установить реестр метаданных.
+func GetMetadataHandler(metadata repositories.MetadataReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		GetMetadata(res, req, metadata)
+	}
+	return fn
+}
+
+// UpdateMetadataHandler - обертка над UpdateMetadata для возможности установить реестр метаданных.
+func UpdateMetadataHandler(metadata repositories.MetadataStorage) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		UpdateMetadata(res, req, metadata)
+	}
+	return fn
+}
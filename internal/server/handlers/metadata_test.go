@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestMetadataHandlers(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/metadata", GetAllMetadataHandler(stor))
+	r.Get("/api/v1/metadata/{metricName}", GetMetadataHandler(stor))
+	r.Put("/api/v1/metadata/{metricName}", UpdateMetadataHandler(stor))
+
+	tests := []struct {
+		name     string
+		method   string
+		request  string
+		body     string
+		wantCode int
+		want     *repositories.Metadata
+	}{
+		{
+			name:     "registered metric",
+			method:   http.MethodGet,
+			request:  "/api/v1/metadata/Alloc",
+			wantCode: 200,
+			want:     &repositories.Metadata{ID: "Alloc", MType: "gauge"},
+		},
+		{
+			name:     "unknown metric",
+			method:   http.MethodGet,
+			request:  "/api/v1/metadata/unknown",
+			wantCode: 404,
+		},
+		{
+			name:     "update without type",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Alloc",
+			body:     `{"unit":"bytes","description":"allocated heap objects"}`,
+			wantCode: 200,
+			want:     &repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"},
+		},
+		{
+			name:     "register new metric",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Latency",
+			body:     `{"type":"histogram","unit":"seconds"}`,
+			wantCode: 200,
+			want:     &repositories.Metadata{ID: "Latency", MType: "histogram", Unit: "seconds"},
+		},
+		{
+			name:     "new metric without type",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/PollCount",
+			body:     `{"unit":"times"}`,
+			wantCode: 400,
+		},
+		{
+			name:     "id mismatch",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Alloc",
+			body:     `{"id":"HeapAlloc","type":"gauge"}`,
+			wantCode: 400,
+		},
+		{
+			name:     "label is not allowed",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Alloc",
+			body:     `{"type":"gauge","allowed_labels":["host"],"labels":{"region":"eu"}}`,
+			wantCode: 400,
+		},
+		{
+			name:     "invalid json",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Alloc",
+			body:     `{"type":`,
+			wantCode: 400,
+		},
+		{
+			name:     "type conflict",
+			method:   http.MethodPut,
+			request:  "/api/v1/metadata/Alloc",
+			body:     `{"type":"counter"}`,
+			wantCode: 409,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.want != nil {
+				var got repositories.Metadata
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, *tt.want, got)
+			}
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/metadata", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var all []repositories.Metadata
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&all))
+	assert.Equal(t, []repositories.Metadata{
+		{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"},
+		{ID: "Latency", MType: "histogram", Unit: "seconds"},
+	}, all)
+}
+
+func TestUpdateMetricsTypeConflict(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+
+	r := chi.NewRouter()
+	r.Post("/update/", UpdateMetricsJSONHandler(stor))
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", UpdateMetricsHandler(stor))
+	r.Post("/updates/", UpdateMetricsBatchHandler(stor))
+
+	tests := []struct {
+		name    string
+		request string
+		body    string
+	}{
+		{name: "json", request: "/update/", body: `{"id":"Alloc","type":"counter","delta":1}`},
+		{name: "url", request: "/update/counter/Alloc/1"},
+		{name: "batch", request: "/updates/", body: `[{"id":"Alloc","type":"counter","delta":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusConflict, res.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+)
+
+// GetPrometheus - возвращает все хранящиеся на сервере метрики в текстовом формате Prometheus.
+// Описание, единица измерения и метки метрик берутся из реестра метаданных. После хранимых метрик
+// выводятся метрики самого сервера из реестра self, если он задан.
+func GetPrometheus(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader, metadata repositories.MetadataReader, self *selfmetrics.Registry) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	metrics, err := storage.GetAllMetricsSlice(req.Context())
+	if err != nil {
+		logger.FromContext(req.Context()).Error("get all metrics error in GetPrometheus handler", zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+	registry := make(map[string]repositories.Metadata)
+	if metadata != nil {
+		all, err := metadata.GetAllMetadata(req.Context())
+		if err != nil {
+			logger.FromContext(req.Context()).Error("get all metadata error in GetPrometheus handler", zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
+			return
+		}
+		for _, meta := range all {
+			registry[meta.ID] = meta
+		}
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].ID < metrics[j].ID
+	})
+	var sb strings.Builder
+	for _, metric := range metrics {
+		writePrometheusMetric(&sb, metric, registry[metric.ID])
+	}
+	// метрики самого сервера, например статистика пула соединений с базой данных
+	for _, metric := range self.Collect() {
+		writePrometheusMetric(&sb, metric.Metric, metric.Meta)
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	if _, err := res.Write([]byte(sb.String())); err != nil {
+		logger.FromContext(req.Context()).Error("write error in GetPrometheus handler", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// writePrometheusMetric - записывает одну метрику в текстовом формате Prometheus.
+func writePrometheusMetric(sb *strings.Builder, metric repositories.Metric, meta repositories.Metadata) {
+	name := prometheusName(metric.ID)
+
+	help := meta.Description
+	if meta.Unit != "" {
+		help = strings.TrimSpace(fmt.Sprintf("%s (unit: %s)", help, meta.Unit))
+	}
+	if help != "" {
+		fmt.Fprintf(sb, "# HELP %s %s\n", name, escapeHelp(help))
+	}
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, metric.MType)
+
+	labels := prometheusLabels(meta.Labels, "")
+	switch metric.MType {
+	case "gauge":
+		if metric.Value != nil {
+			fmt.Fprintf(sb, "%s%s %s\n", name, labels, strconv.FormatFloat(*metric.Value, 'g', -1, 64))
+		}
+	case "counter":
+		if metric.Delta != nil {
+			fmt.Fprintf(sb, "%s%s %d\n", name, labels, *metric.Delta)
+		}
+	case "histogram":
+		if metric.Histogram == nil {
+			return
+		}
+		h := metric.Histogram
+		var cumulative uint64
+		for i, count := range h.Counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.Bounds) {
+				le = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", name, prometheusLabels(meta.Labels, le), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+		fmt.Fprintf(sb, "%s_count%s %d\n", name, labels, h.Count)
+	}
+}
+
+// prometheusName - приводит имя метрики к допустимому в Prometheus виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+func prometheusName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+// prometheusLabels - формирует набор меток метрики. Если le не пустая, добавляется метка бакета гистограммы.
+func prometheusLabels(labels map[string]string, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", prometheusName(key), labels[key]))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeHelp - экранирует текст описания метрики по правилам текстового формата Prometheus.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// GetPrometheusHandler - обертка над GetPrometheus для возможности установить хранилище метрик, реестр метаданных
+// и реестр метрик сервера.
+func GetPrometheusHandler(stor repositories.MetricsReader, metadata repositories.MetadataReader, self *selfmetrics.Registry) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		GetPrometheus(res, req, stor, metadata, self)
+	}
+	return fn
+}
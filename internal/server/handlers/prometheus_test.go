@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestGetPrometheus(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "Poll Count", 3))
+	require.NoError(t, stor.AddHistogram(ctx, "GCPauseNs", repositories.Histogram{
+		Bounds: []float64{10, 20}, Counts: []uint64{1, 2, 1}, Sum: 55, Count: 4}))
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{
+		ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects",
+		Labels: map[string]string{"runtime": "go", "host": "agent"},
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	GetPrometheusHandler(stor, stor, nil)(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP Alloc allocated heap objects (unit: bytes)
+# TYPE Alloc gauge
+Alloc{host="agent",runtime="go"} 1.5
+# TYPE GCPauseNs histogram
+GCPauseNs_bucket{le="10"} 1
+GCPauseNs_bucket{le="20"} 3
+GCPauseNs_bucket{le="+Inf"} 4
+GCPauseNs_sum 55
+GCPauseNs_count 4
+# TYPE Poll_Count counter
+Poll_Count 3
+`, string(body))
+}
+
+func TestGetPrometheusSelfMetrics(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+	self := selfmetrics.NewRegistry()
+	self.Register("test", func() []selfmetrics.Metric {
+		return []selfmetrics.Metric{selfmetrics.Gauge("pg_primary_open_connections", 2, "open connections")}
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	GetPrometheusHandler(stor, stor, self)(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `# TYPE Alloc gauge
+Alloc 1
+# HELP pg_primary_open_connections open connections
+# TYPE pg_primary_open_connections gauge
+pg_primary_open_connections 2
+`, string(body))
+}
+
+func TestPrometheusName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Alloc", want: "Alloc"},
+		{name: "heap.alloc-bytes", want: "heap_alloc_bytes"},
+		{name: "1st", want: "_1st"},
+		{name: "ns:metric_1", want: "ns:metric_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, prometheusName(tt.name))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/query"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+)
+
+// QueryResult - ответ на запрос агрегации метрик.
+type QueryResult struct {
+	Query  string         `json:"query"`  // выражение запроса в каноническом виде
+	Time   time.Time      `json:"time"`   // момент, на который вычислены функции над периодом
+	Result []query.Series `json:"result"` // ряды результата, отсортированные по имени метрики и меткам
+}
+
+// parseQueryTime - извлекает момент вычисления запроса из параметра time в формате RFC 3339. По умолчанию - текущее время.
+func parseQueryTime(req *http.Request) (time.Time, error) {
+	value := req.URL.Query().Get("time")
+	if value == "" {
+		return time.Now(), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time parameter: %w", err)
+	}
+	return at, nil
+}
+
+// QueryMetrics - вычисляет выражение из параметра query, например rate(PollCount[5m]) или sum by(host)(Alloc),
+// по хранящимся на сервере метрикам и истории их значений и возвращает результат в json представлении.
+func QueryMetrics(res http.ResponseWriter, req *http.Request, storage query.Storage, retention *rollup.Retention) {
+	res.Header().Set("Content-Type", "application/json")
+
+	input := req.URL.Query().Get("query")
+	if input == "" {
+		http.Error(res, "query parameter is required", http.StatusBadRequest)
+		return
+	}
+	expr, err := query.Parse(input)
+	if err != nil {
+		logger.FromContext(req.Context()).Debug("parse query error", zap.String("query", input), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	at, err := parseQueryTime(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := query.Eval(req.Context(), storage, retention.GetPolicy(), expr, at)
+	if err != nil {
+		logger.FromContext(req.Context()).Error("evaluate query error", zap.String("query", input), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+	result := QueryResult{Query: expr.String(), Time: at, Result: series}
+	if err := json.NewEncoder(res).Encode(result); err != nil {
+		logger.FromContext(req.Context()).Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// QueryMetricsHandler - обертка над QueryMetrics для возможности установить хранилище метрик и время хранения уровней истории.
+func QueryMetricsHandler(stor query.Storage, retention *rollup.Retention) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		QueryMetrics(res, req, stor, retention)
+	}
+	return fn
+}
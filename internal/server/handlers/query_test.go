@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestQueryMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc.a", 10))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc.b", 30))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "Alloc.a", MType: "gauge", Labels: map[string]string{"host": "a"}}))
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantCode   int
+		wantQuery  string
+		wantResult []float64
+	}{
+		{name: "max", query: url.Values{"query": {`max({__name__=~"Alloc.*"})`}}, wantCode: 200, wantQuery: `max({__name__=~"Alloc.*"})`, wantResult: []float64{30}},
+		{name: "sum by", query: url.Values{"query": {`sum by (host) ({__name__=~"Alloc.*"})`}}, wantCode: 200, wantQuery: `sum by(host)({__name__=~"Alloc.*"})`, wantResult: []float64{30, 10}},
+		{name: "increase", query: url.Values{"query": {"increase(PollCount[5m])"}}, wantCode: 200, wantQuery: "increase(PollCount[5m])", wantResult: []float64{4}},
+		{name: "empty result", query: url.Values{"query": {"max_over_time(Alloc.a[5m])"}, "time": {"2000-01-01T00:00:00Z"}}, wantCode: 200, wantQuery: "max_over_time(Alloc.a[5m])", wantResult: []float64{}},
+		{name: "missing query", query: url.Values{}, wantCode: 400},
+		{name: "parse error", query: url.Values{"query": {"rate(PollCount)"}}, wantCode: 400},
+		{name: "invalid time", query: url.Values{"query": {"PollCount"}, "time": {"yesterday"}}, wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/query?"+tt.query.Encode(), nil)
+			w := httptest.NewRecorder()
+			QueryMetricsHandler(stor, rollup.NewRetention(rollup.DefaultPolicy))(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var result QueryResult
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+			assert.Equal(t, tt.wantQuery, result.Query)
+			values := make([]float64, 0, len(result.Result))
+			for _, s := range result.Result {
+				values = append(values, s.Value)
+			}
+			assert.Equal(t, tt.wantResult, values)
+		})
+	}
+}
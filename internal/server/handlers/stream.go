@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hub"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second // интервал отправки комментария для поддержания соединения
+	maxStreamBuffer         = 10000            // максимальный размер буфера подписчика
+)
+
+// StreamMetrics - передаёт клиенту принятые сервером обновления метрик в формате Server-Sent Events.
+// Обновления можно отфильтровать параметрами name, type, prefix и match. Параметр buffer задаёт размер
+// буфера подписчика: если клиент не успевает читать обновления и буфер заполняется, сервер отправляет
+// событие dropped и закрывает соединение.
+func StreamMetrics(res http.ResponseWriter, req *http.Request, h *hub.Hub) {
+	filter, err := parseMetricsSelector(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(filter.Labels) != 0 {
+		http.Error(res, "label filter is not supported for stream", http.StatusBadRequest)
+		return
+	}
+	buffer := hub.DefaultBufferSize
+	if value := req.URL.Query().Get("buffer"); value != "" {
+		buffer, err = strconv.Atoi(value)
+		if err != nil || buffer <= 0 || buffer > maxStreamBuffer {
+			http.Error(res, fmt.Sprintf("buffer must be in range [1, %d], got %s", maxStreamBuffer, value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, err := h.Subscribe(filter, buffer)
+	if errors.Is(err, hub.ErrClosed) {
+		http.Error(res, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer sub.Close()
+
+	controller := http.NewResponseController(res)
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	// отключаю буферизацию ответа на стороне reverse proxy
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.Header().Set("Status-Code", "200")
+	res.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		logger.FromContext(req.Context()).Error("stream is not supported by response writer", zap.String("error", error.Error(err)))
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return
+			}
+		case metric, ok := <-sub.Events():
+			// канал закрывается без отключения подписчика при остановке сервера
+			if !ok && !sub.Dropped() {
+				return
+			}
+			if !ok {
+				logger.FromContext(req.Context()).Info("slow stream subscriber dropped", zap.String("address", req.RemoteAddr))
+				fmt.Fprint(res, "event: dropped\ndata: subscriber buffer overflow\n\n")
+				controller.Flush()
+				return
+			}
+			data, err := json.Marshal(metric)
+			if err != nil {
+				logger.FromContext(req.Context()).Error("error encoding metric", zap.String("error", error.Error(err)))
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: metric\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// StreamMetricsHandler - обертка над StreamMetrics для возможности установить Hub.
+func StreamMetricsHandler(h *hub.Hub) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		StreamMetrics(res, req, h)
+	}
+	return fn
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hub"
+)
+
+func TestStreamMetrics(t *testing.T) {
+	h := hub.New()
+	srv := httptest.NewServer(StreamMetricsHandler(h))
+	defer srv.Close()
+
+	t.Run("bad request", func(t *testing.T) {
+		for _, query := range []string{"?type=unknown", "?label=host:a", "?buffer=0", "?match=("} {
+			res, err := http.Get(srv.URL + query)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?prefix=Heap", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+		require.Eventually(t, func() bool { return h.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+		value := 1.5
+		h.Publish(repositories.Metric{ID: "Alloc", MType: "gauge", Value: &value})
+		h.Publish(repositories.Metric{ID: "HeapAlloc", MType: "gauge", Value: &value})
+
+		reader := bufio.NewReader(res.Body)
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "event: metric\n", event)
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		var metric repositories.Metric
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &metric))
+		assert.Equal(t, "HeapAlloc", metric.ID)
+		assert.Equal(t, value, *metric.Value)
+
+		// после отключения клиента подписка отменяется
+		cancel()
+		require.Eventually(t, func() bool { return h.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestStreamMetricsHubClosed(t *testing.T) {
+	h := hub.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)
+	res := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StreamMetrics(res, req, h)
+	}()
+	require.Eventually(t, func() bool { return h.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	// при остановке сервера поток завершается без события dropped
+	h.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not closed")
+	}
+	assert.NotContains(t, res.Body.String(), "event: dropped")
+
+	res = httptest.NewRecorder()
+	StreamMetrics(res, req, h)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
+
+func TestStreamMetricsSlowConsumer(t *testing.T) {
+	h := hub.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stream?buffer=1", nil)
+	res := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StreamMetrics(res, req, h)
+	}()
+	require.Eventually(t, func() bool { return h.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	// буфер подписчика заполняется раньше, чем обработчик успевает прочитать события
+	value := 1.0
+	for i := 0; i < 1000000 && h.Subscribers() > 0; i++ {
+		h.Publish(repositories.Metric{ID: "Alloc", MType: "gauge", Value: &value})
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not closed")
+	}
+	assert.Contains(t, res.Body.String(), "event: dropped")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"go.uber.org/zap"
 
@@ -12,22 +13,36 @@ import (
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
 )
 
-var key string
+// Hasher - проверка подписи запросов и подпись ответов сервера секретным ключом.
+type Hasher struct {
+	mu  sync.RWMutex
+	key string
+}
+
+// New - фабричная функция структуры Hasher. Пустой ключ отключает проверку подписи.
+func New(key string) *Hasher {
+	return &Hasher{key: key}
+}
 
 // SetKey - устанавливает секретный ключ для подписи данных.
-func SetKey(k string) {
-	key = k
+func (h *Hasher) SetKey(k string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.key = k
 }
 
 // GetKey - возвращает секретный ключ для подписи данных.
-func GetKey() string {
-	return key
+func (h *Hasher) GetKey() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.key
 }
 
 // HashMiddleware - middleware для проверки подписи и подписи данных, если установлен ключ.
-func HashMiddleware(handler http.Handler) http.HandlerFunc {
+func (h *Hasher) HashMiddleware(handler http.Handler) http.HandlerFunc {
 	logFn := func(res http.ResponseWriter, req *http.Request) {
-		if k := GetKey(); k == "" {
+		key := h.GetKey()
+		if key == "" {
 			handler.ServeHTTP(res, req)
 			return
 		}
@@ -47,20 +62,22 @@ func HashMiddleware(handler http.Handler) http.HandlerFunc {
 		// Проверяю подпись----------------------------------------
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
-			logger.ServerLog.Error("read body into string error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
+			logger.FromContext(req.Context()).Error("read body into string error: ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
 			http.Error(res, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		logger.ServerLog.Debug("geting body from agent ", zap.String("body: ", fmt.Sprintf("%x", body)))
+		logger.FromContext(req.Context()).Debug("geting body from agent ", zap.String("body: ", fmt.Sprintf("%x", body)))
 
 		// Восстанавливаем тело запроса, чтобы другие хендлеры могли его использовать
 		req.Body = io.NopCloser(bytes.NewReader(body))
 
 		// проверка подписи в случае непустого тела запроса
 		if len(body) != 0 {
-			err = repositories.CheckHash(body, reqHash, GetKey())
+			logger.FromContext(req.Context()).Debug("getting body and hash to check", zap.String("body", fmt.Sprintf("%x", body)),
+				zap.String("hash", reqHash))
+			err = repositories.CheckHash(body, reqHash, key)
 			if err != nil {
-				logger.ServerLog.Error("hashs is not equal ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
+				logger.FromContext(req.Context()).Error("hashs is not equal ", zap.String("address", req.URL.String()), zap.String("error: ", error.Error(err)))
 				res.WriteHeader(http.StatusBadRequest)
 				return
 			}
@@ -68,7 +85,7 @@ func HashMiddleware(handler http.Handler) http.HandlerFunc {
 
 		// Подписываю ответ сервера в случае, если задан ключ---------------------------------------------
 		// Устанавливаю мидлварь для получения тела ответа сервера
-		var writer = repositories.NewHashWriter(res, GetKey())
+		var writer = repositories.NewHashWriter(res, key, logger.FromContext(req.Context()))
 		handler.ServeHTTP(writer, req)
 	}
 	return logFn
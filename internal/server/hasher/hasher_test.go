@@ -15,15 +15,15 @@ import (
 )
 
 func TestSetKey(t *testing.T) {
-	key = "secret key"
+	h := New("secret key")
 	newKey := "new secret key"
-	SetKey(newKey)
-	assert.Equal(t, newKey, key)
+	h.SetKey(newKey)
+	assert.Equal(t, newKey, h.key)
 }
 
 func TestGetKey(t *testing.T) {
-	key = "second key"
-	assert.Equal(t, key, GetKey())
+	h := New("second key")
+	assert.Equal(t, "second key", h.GetKey())
 }
 
 func TestHashMiddleware(t *testing.T) {
@@ -128,10 +128,9 @@ func TestHashMiddleware(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			h := New(tt.key)
 			r := chi.NewRouter()
-			r.Post("/test", HashMiddleware(testHandler()))
-
-			SetKey(tt.key)
+			r.Post("/test", h.HashMiddleware(testHandler()))
 
 			request := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(tt.data))
 			for _, h := range tt.header {
@@ -0,0 +1,192 @@
+// Packet hub implement in-process publish/subscribe of accepted metric updates.
+package hub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// DefaultBufferSize - размер буфера подписчика по умолчанию.
+const DefaultBufferSize = 256
+
+// ErrClosed - ошибка подписки на закрытый Hub.
+var ErrClosed = errors.New("hub is closed")
+
+// Hub - рассылает обновления метрик подписчикам. Каждый подписчик имеет ограниченный буфер,
+// и подписчик, не успевающий читать обновления, отключается, чтобы не задерживать запись метрик.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool // Hub закрыт, новые подписки не принимаются
+}
+
+// Subscription - подписка на обновления метрик.
+type Subscription struct {
+	hub     *Hub
+	events  chan repositories.Metric
+	match   func(repositories.Metric, map[string]string) bool
+	dropped bool // подписчик отключён из-за переполнения буфера
+	closed  bool
+}
+
+// New - фабричная функция для создания Hub.
+func New() *Hub {
+	return &Hub{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe - создаёт подписку на обновления метрик, удовлетворяющих фильтру.
+// Учитываются поля фильтра ID, Type, Prefix и Match. При buffer <= 0 используется DefaultBufferSize.
+func (h *Hub) Subscribe(filter repositories.MetricsFilter, buffer int) (*Subscription, error) {
+	match, err := filter.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	if buffer <= 0 {
+		buffer = DefaultBufferSize
+	}
+	sub := &Subscription{
+		hub:    h,
+		events: make(chan repositories.Metric, buffer),
+		match:  match,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close - закрывает каналы событий всех подписчиков и запрещает новые подписки, например при остановке сервера.
+// Повторный вызов безопасен.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscribers {
+		h.remove(sub)
+	}
+}
+
+// Publish - рассылает обновления метрик подписчикам. Метод не блокируется: если буфер подписчика
+// заполнен, подписчик отключается, а его канал событий закрывается.
+func (h *Hub) Publish(metrics ...repositories.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, metric := range metrics {
+		for sub := range h.subscribers {
+			if !sub.match(metric, nil) {
+				continue
+			}
+			select {
+			case sub.events <- metric:
+			default:
+				sub.dropped = true
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// Subscribers - возвращает количество активных подписчиков.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// remove - удаляет подписчика и закрывает его канал событий. Вызывается под блокировкой.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
+
+// Events - возвращает канал обновлений метрик. Канал закрывается после Close подписки или Hub
+// и при отключении медленного подписчика.
+func (s *Subscription) Events() <-chan repositories.Metric {
+	return s.events
+}
+
+// Dropped - сообщает, был ли подписчик отключён из-за переполнения буфера.
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+// Close - отменяет подписку. Повторный вызов безопасен.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Writer - реализация repositories.MetricsWriter, которая после успешной записи метрики в хранилище
+// публикует обновление в Hub. У counter публикуется принятое приращение, а не накопленное значение.
+type Writer struct {
+	repositories.MetricsWriter
+	hub *Hub
+}
+
+// NewWriter - фабричная функция для создания Writer.
+func NewWriter(w repositories.MetricsWriter, h *Hub) *Writer {
+	return &Writer{MetricsWriter: w, hub: h}
+}
+
+// publish - публикует обновление метрики с текущим временем.
+func (w *Writer) publish(metrics ...repositories.Metric) {
+	now := time.Now()
+	for i := range metrics {
+		metrics[i].UpdatedAt = &now
+	}
+	w.hub.Publish(metrics...)
+}
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.MetricsWriter.
+func (w *Writer) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := w.MetricsWriter.AddGauge(ctx, name, value); err != nil {
+		return err
+	}
+	w.publish(repositories.Metric{ID: name, MType: "gauge", Value: &value})
+	return nil
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.MetricsWriter.
+func (w *Writer) AddCounter(ctx context.Context, name string, delta int64) error {
+	if err := w.MetricsWriter.AddCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	w.publish(repositories.Metric{ID: name, MType: "counter", Delta: &delta})
+	return nil
+}
+
+// AddHistogram - реализует метод AddHistogram интерфейса repositories.MetricsWriter.
+func (w *Writer) AddHistogram(ctx context.Context, name string, histogram repositories.Histogram) error {
+	if err := w.MetricsWriter.AddHistogram(ctx, name, histogram); err != nil {
+		return err
+	}
+	w.publish(repositories.Metric{ID: name, MType: "histogram", Histogram: &histogram})
+	return nil
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.MetricsWriter.
+func (w *Writer) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := w.MetricsWriter.AddMetricsFromSlice(ctx, metrics); err != nil {
+		return err
+	}
+	published := make([]repositories.Metric, len(metrics))
+	copy(published, metrics)
+	w.publish(published...)
+	return nil
+}
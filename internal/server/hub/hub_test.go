@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func gauge(name string, value float64) repositories.Metric {
+	return repositories.Metric{ID: name, MType: "gauge", Value: &value}
+}
+
+func TestHubFilter(t *testing.T) {
+	h := New()
+	all, err := h.Subscribe(repositories.MetricsFilter{}, 10)
+	require.NoError(t, err)
+	heap, err := h.Subscribe(repositories.MetricsFilter{Prefix: "Heap", Type: "gauge"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.Subscribers())
+
+	_, err = h.Subscribe(repositories.MetricsFilter{Match: "("}, 10)
+	assert.Error(t, err)
+
+	delta := int64(1)
+	h.Publish(gauge("HeapAlloc", 1), gauge("Alloc", 2), repositories.Metric{ID: "HeapCount", MType: "counter", Delta: &delta})
+
+	assert.Len(t, all.Events(), 3)
+	require.Len(t, heap.Events(), 1)
+	assert.Equal(t, "HeapAlloc", (<-heap.Events()).ID)
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	h := New()
+	slow, err := h.Subscribe(repositories.MetricsFilter{}, 2)
+	require.NoError(t, err)
+	fast, err := h.Subscribe(repositories.MetricsFilter{}, 10)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		h.Publish(gauge("Alloc", float64(i)))
+	}
+
+	assert.True(t, slow.Dropped())
+	assert.False(t, fast.Dropped())
+	assert.Equal(t, 1, h.Subscribers())
+
+	// буферизованные события доступны до закрытия канала
+	var received int
+	for range slow.Events() {
+		received++
+	}
+	assert.Equal(t, 2, received)
+	assert.Len(t, fast.Events(), 3)
+
+	// повторное закрытие подписки безопасно
+	slow.Close()
+	fast.Close()
+	fast.Close()
+	assert.Equal(t, 0, h.Subscribers())
+	h.Publish(gauge("Alloc", 4))
+}
+
+type failingWriter struct {
+	repositories.MetricsWriter
+}
+
+func (failingWriter) AddGauge(context.Context, string, float64) error {
+	return errors.New("write failed")
+}
+
+func TestHubClose(t *testing.T) {
+	h := New()
+	sub, err := h.Subscribe(repositories.MetricsFilter{}, 1)
+	require.NoError(t, err)
+
+	// подписчики отключаются без признака переполнения буфера
+	h.Close()
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.False(t, sub.Dropped())
+	assert.Equal(t, 0, h.Subscribers())
+	sub.Close()
+	h.Close()
+
+	_, err = h.Subscribe(repositories.MetricsFilter{}, 1)
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	h := New()
+	sub, err := h.Subscribe(repositories.MetricsFilter{}, 10)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	stor := storage.NewDefaultMemStorage()
+	w := NewWriter(stor, h)
+	require.NoError(t, w.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, w.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, w.AddMetricsFromSlice(ctx, []repositories.Metric{gauge("Alloc", 5)}))
+
+	require.Len(t, sub.Events(), 3)
+	first, second := <-sub.Events(), <-sub.Events()
+	assert.Equal(t, int64(3), *first.Delta)
+	assert.Equal(t, int64(4), *second.Delta)
+	assert.NotNil(t, second.UpdatedAt)
+	assert.Equal(t, "Alloc", (<-sub.Events()).ID)
+
+	// при ошибке записи обновление не публикуется
+	failing := NewWriter(failingWriter{}, h)
+	assert.Error(t, failing.AddGauge(ctx, "Alloc", 1))
+	assert.Len(t, sub.Events(), 0)
+}
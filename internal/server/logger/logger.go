@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -36,30 +37,50 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
-// Log будет доступен всему коду как синглтон.
-// Никакой код навыка, кроме функции InitLogger, не должен модифицировать эту переменную.
-// По умолчанию установлен no-op-логер, который не выводит никаких сообщений.
-var ServerLog *zap.Logger = zap.NewNop()
+// loggingResponseWriter_Unwrap - возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController
+// мог использовать его методы, например Flush для потоковых ответов
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
 
-// Initialize инициализирует синглтон логера с необходимым уровнем логирования.
-func Initialize(level string) error {
-	// преобразуем текстовый уровень логирования в zap.AtomicLevel
-	lvl, err := zap.ParseAtomicLevel(level)
-	if err != nil {
-		return err
-	}
+// New - создаёт логер сервера, уровень логирования которого можно изменить во время работы через level.
+func New(level zap.AtomicLevel) (*zap.Logger, error) {
 	// создаём новую конфигурацию логера
 	cfg := zap.NewProductionConfig()
-	// устанавливаем уровень
-	cfg.Level = lvl
+	cfg.Level = level
 	// создаём логер на основе конфигурации
 	zl, err := cfg.Build()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return zl.With(zap.String("role", "server")), nil
+}
+
+// ctxKey - ключ логера в контексте.
+type ctxKey struct{}
+
+// WithContext - возвращает копию контекста ctx с логером log.
+func WithContext(ctx context.Context, log *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// FromContext - возвращает логер из контекста ctx, а если он не установлен - no-op-логер, который не выводит
+// никаких сообщений.
+func FromContext(ctx context.Context) *zap.Logger {
+	if log, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return log
+	}
+	return zap.NewNop()
+}
+
+// Middleware - возвращает middleware, которое передаёт логер log обработчикам через контекст запроса.
+func Middleware(log *zap.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(WithContext(r.Context(), log)))
+		}
+		return http.HandlerFunc(fn)
 	}
-	// устанавливаем синглтон
-	ServerLog = zl.With(zap.String("role", "server"))
-	return nil
 }
 
 // RequestLogger — middleware-логер для входящих HTTP-запросов.
@@ -79,7 +100,7 @@ func RequestLogger(h http.Handler) http.HandlerFunc {
 
 		duration := time.Since(start)
 
-		sugar := ServerLog.Sugar()
+		sugar := FromContext(r.Context()).Sugar()
 		sugar.Infoln(
 			"uri", r.RequestURI,
 			"method", r.Method,
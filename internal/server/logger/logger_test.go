@@ -1,66 +1,38 @@
 package logger
 
 import (
-	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func TestInitialize(t *testing.T) {
-	tests := []struct {
-		name        string
-		level       string
-		expectError bool
-	}{
-		{"ValidDebugLevel", "debug", false},
-		{"ValidInfoLevel", "info", false},
-		{"ValidWarnLevel", "warn", false},
-		{"InvalidLevel", "invalid", true},
-	}
+func TestFromContext(t *testing.T) {
+	// без логера в контексте сообщения не выводятся
+	assert.False(t, FromContext(context.Background()).Core().Enabled(zapcore.ErrorLevel))
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Инициализирую логгер
-			err := Initialize(tt.level)
+	log := zap.NewExample()
+	ctx := WithContext(context.Background(), log)
+	assert.Equal(t, log, FromContext(ctx))
 
-			// Проверяю наличие ошибки
-			if tt.expectError {
-				require.Error(t, err)
-			}
-			if !tt.expectError {
-				require.NoError(t, err)
-			}
-
-			// Если ошибок нет, проверяю уровень логирования
-			if !tt.expectError {
-				require.NotEqual(t, nil, ServerLog)
-
-				// получаю текущий уровень логгера
-				level := ServerLog.Core().Enabled(zap.DebugLevel)
-				expectedLevel := tt.level == "debug" // уровень "debug" должен быть доступен только при debug
-				require.Equal(t, expectedLevel, level)
-			}
-		})
-	}
+	var got *zap.Logger
+	handler := Middleware(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, log, got)
 }
 
-func TestInitializeInvalidConfig(t *testing.T) {
-	// Создаю буфер для вывода логов
-	var buf bytes.Buffer
-	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-		zapcore.AddSync(&buf),
-		zap.DebugLevel,
-	)
-	ServerLog = zap.New(core)
-
-	// Инициализация с некорректным уровнем
-	err := Initialize("invalid")
-	require.Error(t, err)
-
-	// Проверяю, что глобальный логгер не был перезаписан
-	require.Equal(t, false, buf.Len() > 0)
+func TestNew(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	log, err := New(level)
+	require.NoError(t, err)
+	assert.False(t, log.Core().Enabled(zapcore.DebugLevel))
+	level.SetLevel(zap.DebugLevel)
+	assert.True(t, log.Core().Enabled(zapcore.DebugLevel))
 }
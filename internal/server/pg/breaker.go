@@ -0,0 +1,96 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// ErrCircuitOpen - операция не выполнялась, так как СУБД недоступна и прерыватель разомкнут.
+var ErrCircuitOpen = fmt.Errorf("database circuit breaker is open: %w", repositories.ErrStorageUnavailable)
+
+// BreakerConfig - настройки прерывателя, который перестаёт обращаться к недоступной СУБД.
+type BreakerConfig struct {
+	Threshold int           // количество неудачных операций подряд, после которого прерыватель размыкается, 0 - прерыватель отключен
+	Cooldown  time.Duration // время, через которое разомкнутый прерыватель пропускает пробную операцию
+}
+
+// DefaultBreakerConfig - настройки прерывателя по умолчанию.
+var DefaultBreakerConfig = BreakerConfig{
+	Threshold: 5,
+	Cooldown:  5 * time.Second,
+}
+
+// breaker - прерыватель обращений к СУБД. Пока прерыватель разомкнут, операции сразу завершаются ошибкой ErrCircuitOpen.
+// По истечении Cooldown пропускается одна пробная операция: при её успехе прерыватель замыкается, иначе остаётся разомкнутым.
+type breaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	failures int       // количество неудачных операций подряд
+	open     bool      // прерыватель разомкнут
+	openedAt time.Time // время последнего размыкания
+	probing  bool      // пробная операция выполняется
+}
+
+// newBreaker - фабричная функция структуры breaker.
+func newBreaker(config BreakerConfig) *breaker {
+	return &breaker{config: config}
+}
+
+// allow - возвращает ErrCircuitOpen, если операцию выполнять не следует.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.config.Cooldown {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// record - учитывает результат операции: ok равен true, если СУБД ответила.
+func (b *breaker) record(ctx context.Context, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		if b.open {
+			logger.FromContext(ctx).Info("database is available, circuit breaker is closed")
+		}
+		b.failures = 0
+		b.open = false
+		return
+	}
+	b.failures++
+	if b.config.Threshold <= 0 || (!b.open && b.failures < b.config.Threshold) {
+		return
+	}
+	if !b.open {
+		logger.FromContext(ctx).Warn("database is unavailable, circuit breaker is open")
+	}
+	b.open = true
+	b.openedAt = time.Now()
+}
+
+// release - завершает операцию, результат которой не говорит о доступности СУБД, например при отмене контекста.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// isOpen - возвращает true, если прерыватель разомкнут.
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
@@ -0,0 +1,62 @@
+package pg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(BreakerConfig{Threshold: 3, Cooldown: 50 * time.Millisecond})
+
+	// прерыватель размыкается только после Threshold неудач подряд
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		b.record(context.Background(), false)
+	}
+	require.NoError(t, b.allow())
+	b.record(context.Background(), true)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.allow())
+		b.record(context.Background(), false)
+	}
+	assert.True(t, b.isOpen())
+	err := b.allow()
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, repositories.ErrStorageUnavailable)
+
+	// по истечении Cooldown пропускается только одна пробная операция
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, b.allow())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// неудачная проба снова размыкает прерыватель на Cooldown
+	b.record(context.Background(), false)
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// отменённая проба не меняет состояние, но позволяет выполнить следующую
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, b.allow())
+	b.release()
+	assert.True(t, b.isOpen())
+	require.NoError(t, b.allow())
+
+	// успешная проба замыкает прерыватель
+	b.record(context.Background(), true)
+	assert.False(t, b.isOpen())
+	assert.NoError(t, b.allow())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(BreakerConfig{})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.allow())
+		b.record(context.Background(), false)
+	}
+	assert.False(t, b.isOpen())
+}
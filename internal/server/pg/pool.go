@@ -0,0 +1,197 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+)
+
+// PoolConfig - настройки пула соединений с СУБД.
+type PoolConfig struct {
+	MaxOpenConns    int           // максимальное количество открытых соединений, 0 - без ограничения
+	MaxIdleConns    int           // максимальное количество простаивающих соединений
+	ConnMaxLifetime time.Duration // максимальное время жизни соединения, 0 - без ограничения
+	ConnMaxIdleTime time.Duration // максимальное время простоя соединения, 0 - без ограничения
+}
+
+// DefaultPoolConfig - настройки пула соединений по умолчанию.
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    20,
+	MaxIdleConns:    10,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+}
+
+// Validate - проверяет корректность настроек пула соединений.
+func (c PoolConfig) Validate() error {
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 || c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("pool settings must not be negative")
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("max idle connections %d is greater than max open connections %d", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	return nil
+}
+
+// Open - создаёт пул соединений с СУБД PostgreSQL с настройками config. Соединения устанавливаются при первом запросе.
+func Open(dsn string, config PoolConfig) (*sql.DB, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	return db, nil
+}
+
+// replica - реплика только для чтения и признак её доступности.
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// NewStoreWithReplica возвращает новый экземпляр PostgreSQL-хранилища, который выполняет методы repositories.MetricsReader
+// на реплике replicaConn. Пока реплика недоступна, чтение выполняется на основной СУБД.
+func NewStoreWithReplica(conn *sql.DB, replicaConn *sql.DB) *Store {
+	r := &replica{db: replicaConn}
+	r.healthy.Store(true)
+	s := NewStore(conn)
+	s.replica = r
+	return s
+}
+
+// ReplicaHealthy - возвращает true, если чтение выполняется на реплике.
+func (s Store) ReplicaHealthy() bool {
+	return s.replica != nil && s.replica.healthy.Load()
+}
+
+// setReplicaHealthy - устанавливает признак доступности реплики и пишет в лог его изменение.
+func (s Store) setReplicaHealthy(ctx context.Context, healthy bool, err error) {
+	if s.replica.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		logger.FromContext(ctx).Info("database replica is available, reading from replica")
+		return
+	}
+	logger.FromContext(ctx).Warn("database replica is unavailable, reading from primary", zap.String("error", error.Error(err)))
+}
+
+// readFrom - выполняет запрос на чтение query на реплике, если она доступна, иначе на основной СУБД по правилам retry.
+// Если запрос на реплике завершился ошибкой соединения, реплика помечается недоступной и запрос повторяется на основной СУБД.
+func readFrom[T any](ctx context.Context, s Store, query func(db *sql.DB) (T, error)) (T, error) {
+	if s.ReplicaHealthy() {
+		result, err := query(s.replica.db)
+		if err == nil || ctx.Err() != nil || !isConnectionError(err) {
+			return result, err
+		}
+		s.setReplicaHealthy(ctx, false, err)
+	}
+	return retry(ctx, s, true, func() (T, error) {
+		return query(s.conn)
+	})
+}
+
+// isConnectionError - возвращает true, если ошибка вызвана недоступностью СУБД, а не самим запросом.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// класс 08 - ошибки соединения, класс 57P - остановка сервера СУБД
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	return false
+}
+
+// MonitorReplica - проверяет доступность реплики с периодом interval до отмены контекста.
+// Недоступная реплика снова используется для чтения после успешной проверки.
+func (s Store) MonitorReplica(ctx context.Context, interval time.Duration) {
+	if s.replica == nil || interval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		s.checkReplica(ctx, interval)
+	}
+}
+
+// checkReplica - проверяет соединение с репликой, ожидая ответа не дольше timeout.
+func (s Store) checkReplica(ctx context.Context, timeout time.Duration) {
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := s.replica.db.PingContext(pingCtx)
+	if ctx.Err() != nil {
+		return
+	}
+	s.setReplicaHealthy(ctx, err == nil, err)
+}
+
+// PoolMetrics - возвращает статистику пулов соединений основной СУБД и реплики и состояние прерывателя в виде метрик сервера.
+func (s Store) PoolMetrics() []selfmetrics.Metric {
+	metrics := poolMetrics("primary", s.conn.Stats())
+	if s.replica != nil {
+		metrics = append(metrics, poolMetrics("replica", s.replica.db.Stats())...)
+		var healthy float64
+		if s.ReplicaHealthy() {
+			healthy = 1
+		}
+		metrics = append(metrics, selfmetrics.Gauge("pg_replica_healthy", healthy, "1 if reads are served by the replica, 0 if by the primary"))
+	}
+	if s.breaker != nil {
+		var open float64
+		if s.breaker.isOpen() {
+			open = 1
+		}
+		metrics = append(metrics, selfmetrics.Gauge("pg_circuit_open", open, "1 if the database is unavailable and operations fail fast"))
+	}
+	return metrics
+}
+
+// poolMetrics - возвращает метрики сервера для статистики пула соединений pool.
+func poolMetrics(pool string, stats sql.DBStats) []selfmetrics.Metric {
+	name := func(stat string) string {
+		return "pg_" + pool + "_" + stat
+	}
+	return []selfmetrics.Metric{
+		selfmetrics.Gauge(name("max_open_connections"), float64(stats.MaxOpenConnections), "maximum number of open connections to the database"),
+		selfmetrics.Gauge(name("open_connections"), float64(stats.OpenConnections), "number of established connections both in use and idle"),
+		selfmetrics.Gauge(name("in_use_connections"), float64(stats.InUse), "number of connections currently in use"),
+		selfmetrics.Gauge(name("idle_connections"), float64(stats.Idle), "number of idle connections"),
+		selfmetrics.Counter(name("wait_count"), stats.WaitCount, "total number of connections waited for"),
+		selfmetrics.Gauge(name("wait_duration_seconds"), stats.WaitDuration.Seconds(), "total time blocked waiting for a new connection"),
+		selfmetrics.Counter(name("max_idle_closed"), stats.MaxIdleClosed, "total number of connections closed due to max idle connections"),
+		selfmetrics.Counter(name("max_idle_time_closed"), stats.MaxIdleTimeClosed, "total number of connections closed due to max connection idle time"),
+		selfmetrics.Counter(name("max_lifetime_closed"), stats.MaxLifetimeClosed, "total number of connections closed due to max connection lifetime"),
+	}
+}
@@ -0,0 +1,179 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableDSN - адрес СУБД, к которой невозможно подключиться.
+const unreachableDSN = "host=127.0.0.1 port=1 user=metrics dbname=metricsdb sslmode=disable connect_timeout=1"
+
+func TestPoolConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PoolConfig
+		wantErr bool
+	}{
+		{name: "default", config: DefaultPoolConfig},
+		{name: "unlimited", config: PoolConfig{}},
+		{name: "negative open connections", config: PoolConfig{MaxOpenConns: -1}, wantErr: true},
+		{name: "negative lifetime", config: PoolConfig{ConnMaxLifetime: -time.Second}, wantErr: true},
+		{name: "idle greater than open", config: PoolConfig{MaxOpenConns: 5, MaxIdleConns: 10}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	db, err := Open(unreachableDSN, PoolConfig{MaxOpenConns: 7, MaxIdleConns: 3})
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 7, db.Stats().MaxOpenConnections)
+
+	_, err = Open(unreachableDSN, PoolConfig{MaxOpenConns: 1, MaxIdleConns: 2})
+	assert.Error(t, err)
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "connection done", err: sql.ErrConnDone, want: true},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: "57P01"}, want: true},
+		{name: "undefined table", err: &pgconn.PgError{Code: "42P01"}, want: false},
+		{name: "no rows", err: sql.ErrNoRows, want: false},
+		{name: "other", err: errors.New("metric type is different"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isConnectionError(tt.err))
+		})
+	}
+}
+
+func TestReadFromFailover(t *testing.T) {
+	primary, err := Open(unreachableDSN, DefaultPoolConfig)
+	require.NoError(t, err)
+	defer primary.Close()
+	replicaDB, err := Open(unreachableDSN, DefaultPoolConfig)
+	require.NoError(t, err)
+	defer replicaDB.Close()
+	ctx := context.Background()
+
+	// без реплики чтение выполняется на основной СУБД
+	s := *NewStore(primary)
+	assert.False(t, s.ReplicaHealthy())
+	got, err := readFrom(ctx, s, func(db *sql.DB) (*sql.DB, error) { return db, nil })
+	require.NoError(t, err)
+	assert.Same(t, primary, got)
+
+	s = *NewStoreWithReplica(primary, replicaDB)
+	got, err = readFrom(ctx, s, func(db *sql.DB) (*sql.DB, error) { return db, nil })
+	require.NoError(t, err)
+	assert.Same(t, replicaDB, got)
+
+	// ошибка запроса не переключает чтение на основную СУБД
+	_, err = readFrom(ctx, s, func(db *sql.DB) (*sql.DB, error) { return db, sql.ErrNoRows })
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	assert.True(t, s.ReplicaHealthy())
+
+	// при ошибке соединения с репликой запрос повторяется на основной СУБД
+	calls := 0
+	got, err = readFrom(ctx, s, func(db *sql.DB) (*sql.DB, error) {
+		calls++
+		if db == replicaDB {
+			return nil, driver.ErrBadConn
+		}
+		return db, nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, primary, got)
+	assert.Equal(t, 2, calls)
+	assert.False(t, s.ReplicaHealthy())
+
+	// пока реплика недоступна, она не используется
+	got, err = readFrom(ctx, s, func(db *sql.DB) (*sql.DB, error) { return db, nil })
+	require.NoError(t, err)
+	assert.Same(t, primary, got)
+}
+
+func TestMonitorReplica(t *testing.T) {
+	primary, err := Open(unreachableDSN, DefaultPoolConfig)
+	require.NoError(t, err)
+	defer primary.Close()
+	replicaDB, err := Open(unreachableDSN, DefaultPoolConfig)
+	require.NoError(t, err)
+	defer replicaDB.Close()
+
+	s := *NewStoreWithReplica(primary, replicaDB)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.MonitorReplica(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return !s.ReplicaHealthy() }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitoring of replica is not stopped after cancel of context")
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	primary, err := Open(unreachableDSN, PoolConfig{MaxOpenConns: 5})
+	require.NoError(t, err)
+	defer primary.Close()
+	replicaDB, err := Open(unreachableDSN, PoolConfig{MaxOpenConns: 3})
+	require.NoError(t, err)
+	defer replicaDB.Close()
+
+	values := func(s Store) map[string]float64 {
+		result := make(map[string]float64)
+		for _, metric := range s.PoolMetrics() {
+			switch metric.MType {
+			case "gauge":
+				result[metric.ID] = *metric.Value
+			case "counter":
+				result[metric.ID] = float64(*metric.Delta)
+			}
+			assert.NotEmpty(t, metric.Meta.Description)
+		}
+		return result
+	}
+
+	got := values(*NewStore(primary))
+	assert.Equal(t, 5.0, got["pg_primary_max_open_connections"])
+	assert.Contains(t, got, "pg_primary_wait_count")
+	assert.NotContains(t, got, "pg_replica_healthy")
+	assert.Equal(t, 0.0, got["pg_circuit_open"])
+
+	got = values(*NewStoreWithReplica(primary, replicaDB))
+	assert.Equal(t, 3.0, got["pg_replica_max_open_connections"])
+	assert.Equal(t, 1.0, got["pg_replica_healthy"])
+}
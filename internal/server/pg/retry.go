@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// RetryPolicy - параметры повторного выполнения операций при временных ошибках СУБД.
+type RetryPolicy struct {
+	Attempts int           // количество попыток, включая первую
+	Base     time.Duration // пауза перед второй попыткой, перед каждой следующей удваивается
+	Max      time.Duration // максимальная пауза между попытками
+}
+
+// DefaultRetryPolicy - параметры повторного выполнения операций по умолчанию.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Base:     100 * time.Millisecond,
+	Max:      time.Second,
+}
+
+// delay - возвращает паузу перед попыткой attempt (начиная с 1) со случайным разбросом до половины паузы,
+// чтобы одновременно упавшие запросы не повторялись одновременно.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Base << (attempt - 1)
+	if d <= 0 || (p.Max > 0 && d > p.Max) {
+		d = p.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// isTransientError - возвращает true, если ошибка временная и операцию можно повторить позже:
+// СУБД недоступна, перегружена или транзакция отменена из-за конфликта с параллельной транзакцией.
+func isTransientError(err error) bool {
+	if isConnectionError(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.SerializationFailure ||
+			pgErr.Code == pgerrcode.DeadlockDetected ||
+			pgErr.Code == pgerrcode.TooManyConnections
+	}
+	return false
+}
+
+// isNotApplied - возвращает true, если по ошибке известно, что изменения не были записаны в СУБД.
+// Ошибка соединения во время фиксации транзакции не позволяет это утверждать, поэтому такие записи не повторяются.
+func isNotApplied(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	// ошибку вернул сервер СУБД, значит транзакция отменена
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr)
+}
+
+// retry - выполняет операцию op на основной СУБД через прерыватель, повторяя её с паузой при временных ошибках.
+// Операции записи (idempotent равен false) повторяются, только если известно, что предыдущая попытка не записала изменения.
+// Если все попытки исчерпаны, возвращается ошибка, обёрнутая в repositories.ErrStorageUnavailable.
+func retry[T any](ctx context.Context, s Store, idempotent bool, op func() (T, error)) (T, error) {
+	var zero T
+	for attempt := 1; ; attempt++ {
+		if s.breaker != nil {
+			if err := s.breaker.allow(); err != nil {
+				return zero, err
+			}
+		}
+		result, err := op()
+		if ctx.Err() != nil {
+			if s.breaker != nil {
+				s.breaker.release()
+			}
+			return result, err
+		}
+		transient := err != nil && isTransientError(err)
+		if s.breaker != nil {
+			s.breaker.record(ctx, !transient)
+		}
+		if !transient {
+			return result, err
+		}
+		if !idempotent && !isNotApplied(err) {
+			return zero, err
+		}
+		if attempt >= s.retryPolicy.Attempts {
+			return zero, fmt.Errorf("%w: %w", repositories.ErrStorageUnavailable, err)
+		}
+
+		logger.FromContext(ctx).Debug("retry database operation", zap.Int("attempt", attempt+1), zap.String("error", error.Error(err)))
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(s.retryPolicy.delay(attempt)):
+		}
+	}
+}
+
+// retryExec - выполняет операцию op, которая возвращает только ошибку, по правилам retry.
+func retryExec(ctx context.Context, s Store, idempotent bool, op func() error) error {
+	_, err := retry(ctx, s, idempotent, func() (struct{}, error) {
+		return struct{}{}, op()
+	})
+	return err
+}
@@ -0,0 +1,162 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// testStore - возвращает хранилище без соединения с СУБД с короткими паузами между попытками.
+func testStore(breakerConfig BreakerConfig) Store {
+	s := Store{}
+	s.SetRetryPolicy(RetryPolicy{Attempts: 3, Base: time.Millisecond, Max: 2 * time.Millisecond})
+	s.SetBreakerConfig(breakerConfig)
+	return s
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, Base: 100 * time.Millisecond, Max: 300 * time.Millisecond}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 3, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+		{attempt: 40, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := p.delay(tt.attempt)
+			assert.GreaterOrEqual(t, d, tt.min)
+			assert.LessOrEqual(t, d, tt.max)
+		}
+	}
+	assert.Zero(t, RetryPolicy{}.delay(1))
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad connection", err: driver.ErrBadConn, want: true},
+		{name: "connection failure", err: &pgconn.PgError{Code: pgerrcode.ConnectionFailure}, want: true},
+		{name: "serialization failure", err: &pgconn.PgError{Code: pgerrcode.SerializationFailure}, want: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: pgerrcode.DeadlockDetected}, want: true},
+		{name: "too many connections", err: &pgconn.PgError{Code: pgerrcode.TooManyConnections}, want: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: pgerrcode.UniqueViolation}, want: false},
+		{name: "no rows", err: sql.ErrNoRows, want: false},
+		{name: "other", err: errors.New("metric type is different"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTransientError(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("transient error is retried", func(t *testing.T) {
+		s := testStore(DefaultBreakerConfig)
+		calls := 0
+		got, err := retry(ctx, s, true, func() (int, error) {
+			calls++
+			if calls < 3 {
+				return 0, &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+			}
+			return 42, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 42, got)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		s := testStore(DefaultBreakerConfig)
+		calls := 0
+		err := retryExec(ctx, s, true, func() error {
+			calls++
+			return sql.ErrNoRows
+		})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		assert.NotErrorIs(t, err, repositories.ErrStorageUnavailable)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("attempts are exhausted", func(t *testing.T) {
+		s := testStore(DefaultBreakerConfig)
+		calls := 0
+		err := retryExec(ctx, s, true, func() error {
+			calls++
+			return driver.ErrBadConn
+		})
+		require.ErrorIs(t, err, repositories.ErrStorageUnavailable)
+		assert.ErrorIs(t, err, driver.ErrBadConn)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("write with unknown outcome is not retried", func(t *testing.T) {
+		s := testStore(DefaultBreakerConfig)
+		calls := 0
+		err := retryExec(ctx, s, false, func() error {
+			calls++
+			return sql.ErrConnDone
+		})
+		require.ErrorIs(t, err, sql.ErrConnDone)
+		assert.Equal(t, 1, calls)
+
+		// ошибку вернул сервер СУБД, значит запись не выполнена и её можно повторить
+		calls = 0
+		err = retryExec(ctx, s, false, func() error {
+			calls++
+			return &pgconn.PgError{Code: pgerrcode.DeadlockDetected}
+		})
+		require.ErrorIs(t, err, repositories.ErrStorageUnavailable)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("open circuit fails fast", func(t *testing.T) {
+		s := testStore(BreakerConfig{Threshold: 2, Cooldown: time.Hour})
+		calls := 0
+		op := func() error {
+			calls++
+			return driver.ErrBadConn
+		}
+		err := retryExec(ctx, s, true, op)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, 2, calls)
+
+		err = retryExec(ctx, s, true, op)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		assert.ErrorIs(t, err, repositories.ErrStorageUnavailable)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("canceled context stops retries", func(t *testing.T) {
+		s := testStore(DefaultBreakerConfig)
+		s.SetRetryPolicy(RetryPolicy{Attempts: 3, Base: time.Hour, Max: time.Hour})
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		calls := 0
+		err := retryExec(ctx, s, true, func() error {
+			calls++
+			return driver.ErrBadConn
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -3,7 +3,11 @@ package pg
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
@@ -11,14 +15,31 @@ import (
 
 // Store реализует интерфейс store.Store и позволяет взаимодействовать с СУБД PostgreSQL.
 // Так же Store реализует интерфейс repositories.ServerRepo, для возможности использования структуры в качестве хранилища метрик.
+// Операции повторяются при временных ошибках СУБД, а пока СУБД недоступна, прерыватель сразу завершает их ошибкой ErrCircuitOpen.
 type Store struct {
 	// Поле conn содержит объект соединения с СУБД
 	conn *sql.DB
+	// Поле replica содержит реплику для чтения метрик, nil, если реплика не используется
+	replica *replica
+	// Поле retryPolicy содержит параметры повторного выполнения операций
+	retryPolicy RetryPolicy
+	// Поле breaker содержит прерыватель обращений к основной СУБД
+	breaker *breaker
 }
 
 // NewStore возвращает новый экземпляр PostgreSQL-хранилища
 func NewStore(conn *sql.DB) *Store {
-	return &Store{conn: conn}
+	return &Store{conn: conn, retryPolicy: DefaultRetryPolicy, breaker: newBreaker(DefaultBreakerConfig)}
+}
+
+// SetRetryPolicy - устанавливает параметры повторного выполнения операций при временных ошибках СУБД.
+func (s *Store) SetRetryPolicy(policy RetryPolicy) {
+	s.retryPolicy = policy
+}
+
+// SetBreakerConfig - устанавливает настройки прерывателя обращений к СУБД.
+func (s *Store) SetBreakerConfig(config BreakerConfig) {
+	s.breaker = newBreaker(config)
 }
 
 // Bootstrap - подготавливает БД к работе, создавая необходимые таблицы и индексы.
@@ -38,9 +59,21 @@ func (s Store) Bootstrap(ctx context.Context) error {
 			id varchar(128) PRIMARY KEY,
 			mtype varchar(128),
 			delta bigint DEFAULT NULL,
-			value double precision DEFAULT NULL
+			value double precision DEFAULT NULL,
+			histogram jsonb DEFAULT NULL,
+			updated_at timestamptz NOT NULL DEFAULT now()
         )
     `)
+	if errExec != nil {
+		return errExec
+	}
+	// добавляю колонку для гистограмм в таблицы, созданные предыдущими версиями сервиса
+	_, errExec = tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram jsonb DEFAULT NULL`)
+	if errExec != nil {
+		return errExec
+	}
+	// добавляю колонку со временем последнего обновления метрики для удаления устаревших метрик
+	_, errExec = tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now()`)
 	if errExec != nil {
 		return errExec
 	}
@@ -49,6 +82,74 @@ func (s Store) Bootstrap(ctx context.Context) error {
 		return errExec
 	}
 
+	// создаю таблицу истории значений метрик
+	_, errExec = tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metric_history (
+			id varchar(128) NOT NULL,
+			ts timestamptz NOT NULL,
+			value double precision NOT NULL
+        )
+    `)
+	if errExec != nil {
+		return errExec
+	}
+	_, errExec = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metric_history_id_ts ON metric_history (id, ts)`)
+	if errExec != nil {
+		return errExec
+	}
+	// индекс для удаления устаревшей истории всех метрик
+	_, errExec = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metric_history_ts ON metric_history (ts)`)
+	if errExec != nil {
+		return errExec
+	}
+
+	// создаю таблицу агрегатов истории значений метрик, resolution - длительность интервала в секундах
+	_, errExec = tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metric_rollups (
+			id varchar(128) NOT NULL,
+			resolution bigint NOT NULL,
+			ts timestamptz NOT NULL,
+			min double precision NOT NULL,
+			max double precision NOT NULL,
+			sum double precision NOT NULL,
+			count bigint NOT NULL,
+			last double precision NOT NULL,
+			delta double precision NOT NULL,
+			PRIMARY KEY (id, resolution, ts)
+        )
+    `)
+	if errExec != nil {
+		return errExec
+	}
+	_, errExec = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metric_rollups_resolution_ts ON metric_rollups (resolution, ts)`)
+	if errExec != nil {
+		return errExec
+	}
+
+	// создаю таблицу реестра метаданных метрик
+	_, errExec = tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metadata (
+			id varchar(128) PRIMARY KEY,
+			mtype varchar(128) NOT NULL,
+			unit varchar(128) NOT NULL DEFAULT '',
+			description text NOT NULL DEFAULT '',
+			allowed_labels jsonb DEFAULT NULL,
+			labels jsonb DEFAULT NULL
+        )
+    `)
+	if errExec != nil {
+		return errExec
+	}
+	// регистрирую в реестре метрики, сохраненные предыдущими версиями сервиса
+	_, errExec = tx.ExecContext(ctx, `
+		INSERT INTO metadata (id, mtype)
+		SELECT id, mtype FROM metrics
+		ON CONFLICT (id) DO NOTHING
+	`)
+	if errExec != nil {
+		return errExec
+	}
+
 	// коммитим транзакцию
 	return tx.Commit()
 }
@@ -56,7 +157,7 @@ func (s Store) Bootstrap(ctx context.Context) error {
 // Disable - очищает БД, удаляя записи из таблиц.
 // Метод необходим для тестирования, чтобы в процессе удалять тестовые записи.
 func (s Store) Disable(ctx context.Context) (err error) {
-	logger.ServerLog.Debug("truncate all data in all tables")
+	logger.FromContext(ctx).Debug("truncate all data in all tables")
 
 	// запускаем транзакцию
 	tx, err := s.conn.BeginTx(ctx, nil)
@@ -69,7 +170,7 @@ func (s Store) Disable(ctx context.Context) (err error) {
 
 	// удаляю все записи в таблице auth
 	_, err = tx.ExecContext(ctx, `
-			TRUNCATE TABLE metrics 
+			TRUNCATE TABLE metrics, metadata, metric_history, metric_rollups
 	`)
 	if err != nil {
 		return err
@@ -81,15 +182,23 @@ func (s Store) Disable(ctx context.Context) (err error) {
 
 // GetMetric -возвращает значение метрики в строчном представлении по имени и типу метрики.
 func (s Store) GetMetric(ctx context.Context, metricType string, metricName string) (string, error) {
+	return readFrom(ctx, s, func(db *sql.DB) (string, error) {
+		return getMetric(ctx, db, metricType, metricName)
+	})
+}
+
+// getMetric - возвращает значение метрики из базы данных db.
+func getMetric(ctx context.Context, db *sql.DB, metricType string, metricName string) (string, error) {
 	query := `
 		SELECT id,
 			   mtype,
 			   delta,
-			   value
+			   value,
+			   histogram
 		FROM metrics
 		WHERE id = $1
 	`
-	stmt, err := s.conn.PrepareContext(ctx, query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return "", fmt.Errorf("prepare context error in DB, %w", err)
 	}
@@ -97,7 +206,8 @@ func (s Store) GetMetric(ctx context.Context, metricType string, metricName stri
 	row := stmt.QueryRowContext(ctx, metricName)
 
 	var metric repositories.Metric
-	err = row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+	var histogram []byte
+	err = row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value, &histogram)
 	if err != nil {
 		return "", err
 	}
@@ -114,63 +224,453 @@ func (s Store) GetMetric(ctx context.Context, metricType string, metricName stri
 			return "", fmt.Errorf("value of counter metric is nil")
 		}
 		return fmt.Sprintf("%d", *metric.Delta), nil
+	} else if metric.MType == "histogram" {
+		if histogram == nil {
+			return "", fmt.Errorf("value of histogram metric is nil")
+		}
+		// jsonb не сохраняет порядок ключей и форматирование, поэтому гистограмма кодируется заново
+		var value repositories.Histogram
+		if err := json.Unmarshal(histogram, &value); err != nil {
+			return "", fmt.Errorf("decode histogram from DB error, %w", err)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
 	}
 	return "", fmt.Errorf("whrong type of metric")
 }
 
+// registerType - проверяет, что тип метрики совпадает с зарегистрированным в реестре метаданных.
+// Метрика, которой нет в реестре, регистрируется с переданным типом в рамках транзакции tx.
+func registerType(ctx context.Context, tx *sql.Tx, nameMetric, mtype string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO metadata (id, mtype)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING
+	`, nameMetric, mtype)
+	if err != nil {
+		return err
+	}
+
+	var registered string
+	if err := tx.QueryRowContext(ctx, `SELECT mtype FROM metadata WHERE id = $1`, nameMetric).Scan(&registered); err != nil {
+		return err
+	}
+	if registered != mtype {
+		return repositories.TypeConflictError(nameMetric, registered, mtype)
+	}
+	return nil
+}
+
 // AddGauge - реализует метод AddGauge интерфейса repositories.ServerRepo.
-func (s Store) AddGauge(ctx context.Context, nameMetric string, value float64) (err error) {
+func (s Store) AddGauge(ctx context.Context, nameMetric string, value float64) error {
+	return retryExec(ctx, s, false, func() error {
+		return s.addGauge(ctx, nameMetric, value)
+	})
+}
+
+// addGauge - выполняет AddGauge за одно обращение к СУБД без повторов.
+func (s Store) addGauge(ctx context.Context, nameMetric string, value float64) (err error) {
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	if err := registerType(ctx, tx, nameMetric, "gauge"); err != nil {
+		return err
+	}
 	queryUpsert := `
 				INSERT INTO metrics (id, mtype, value)
 				VALUES ($1, $2, $3)
 				ON CONFLICT (id) 
-				DO UPDATE SET value = EXCLUDED.value;
+				DO UPDATE SET value = EXCLUDED.value, updated_at = now();
 				`
-	stmt, err := s.conn.PrepareContext(ctx, queryUpsert)
+	stmt, err := tx.PrepareContext(ctx, queryUpsert)
 	if err != nil {
 		return fmt.Errorf("prepare context error in DB, %w", err)
 	}
 	defer stmt.Close()
 	_, err = stmt.ExecContext(ctx, nameMetric, "gauge", value)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := recordHistory(ctx, tx, nameMetric); err != nil {
+		return err
+	}
+	// коммитим транзакцию
+	return tx.Commit()
 }
 
 // AddCounter - реализует метод AddCounter интерфейса repositories.ServerRepo.
-func (s Store) AddCounter(ctx context.Context, nameMetric string, value int64) (err error) {
+func (s Store) AddCounter(ctx context.Context, nameMetric string, value int64) error {
+	return retryExec(ctx, s, false, func() error {
+		return s.addCounter(ctx, nameMetric, value)
+	})
+}
+
+// addCounter - выполняет AddCounter за одно обращение к СУБД без повторов.
+func (s Store) addCounter(ctx context.Context, nameMetric string, value int64) (err error) {
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	if err := registerType(ctx, tx, nameMetric, "counter"); err != nil {
+		return err
+	}
 	queryUpsert := `
 				INSERT INTO metrics (id, mtype, delta)
 				VALUES ($1, $2, $3)
 				ON CONFLICT (id) 
-				DO UPDATE SET delta = metrics.delta + EXCLUDED.delta;
+				DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = now();
 				`
-	stmt, err := s.conn.PrepareContext(ctx, queryUpsert)
+	stmt, err := tx.PrepareContext(ctx, queryUpsert)
 	if err != nil {
 		return fmt.Errorf("prepare context error in DB, %w", err)
 	}
 	defer stmt.Close()
 	_, err = stmt.ExecContext(ctx, nameMetric, "counter", value)
+	if err != nil {
+		return err
+	}
+	if err := recordHistory(ctx, tx, nameMetric); err != nil {
+		return err
+	}
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// AddHistogram - реализует метод AddHistogram интерфейса repositories.ServerRepo.
+func (s Store) AddHistogram(ctx context.Context, nameMetric string, histogram repositories.Histogram) error {
+	return retryExec(ctx, s, false, func() error {
+		return s.addHistogram(ctx, nameMetric, histogram)
+	})
+}
+
+// addHistogram - выполняет AddHistogram за одно обращение к СУБД без повторов.
+func (s Store) addHistogram(ctx context.Context, nameMetric string, histogram repositories.Histogram) error {
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	if err := addHistogram(ctx, tx, nameMetric, histogram); err != nil {
+		return err
+	}
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// addHistogram - объединяет гистограмму с хранимой в БД в рамках транзакции tx.
+// Строка метрики блокируется на время транзакции, чтобы параллельные слияния не теряли наблюдения.
+func addHistogram(ctx context.Context, tx *sql.Tx, nameMetric string, histogram repositories.Histogram) error {
+	if err := histogram.Validate(); err != nil {
+		return err
+	}
+	if err := registerType(ctx, tx, nameMetric, "histogram"); err != nil {
+		return err
+	}
+
+	// создаю пустую гистограмму, чтобы параллельные транзакции блокировали одну и ту же строку,
+	// иначе при первой записи метрики слияния перезаписывают друг друга
+	empty, err := json.Marshal(repositories.NewHistogram(histogram.Bounds))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO metrics (id, mtype, histogram)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING
+	`, nameMetric, "histogram", empty)
+	if err != nil {
+		return err
+	}
+
+	var mtype string
+	var stored []byte
+	row := tx.QueryRowContext(ctx, `SELECT mtype, histogram FROM metrics WHERE id = $1 FOR UPDATE`, nameMetric)
+	if err := row.Scan(&mtype, &stored); err != nil {
+		return err
+	}
+	if mtype != "histogram" {
+		return fmt.Errorf("metric type is different, metric type in database is: %s, metric type in request is: histogram", mtype)
+	}
+	current := repositories.NewHistogram(histogram.Bounds)
+	if stored != nil {
+		if err := json.Unmarshal(stored, &current); err != nil {
+			return fmt.Errorf("decode histogram from DB error, %w", err)
+		}
+	}
+	merged, err := current.Merge(histogram)
+	if err != nil {
+		return fmt.Errorf("merge histogram %s error: %w", nameMetric, err)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	queryUpsert := `
+				INSERT INTO metrics (id, mtype, histogram)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (id) 
+				DO UPDATE SET histogram = EXCLUDED.histogram, updated_at = now();
+				`
+	_, err = tx.ExecContext(ctx, queryUpsert, nameMetric, "histogram", data)
+	if err != nil {
+		return err
+	}
+	return recordHistory(ctx, tx, nameMetric)
+}
+
+// recordHistory - добавляет текущее значение метрики в историю в рамках транзакции tx.
+// Для counter сохраняется накопленная сумма, для histogram - количество наблюдений.
+func recordHistory(ctx context.Context, tx *sql.Tx, nameMetric string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO metric_history (id, ts, value)
+		SELECT id, updated_at, COALESCE(value, delta::double precision, (histogram->>'count')::double precision)
+		FROM metrics
+		WHERE id = $1
+	`, nameMetric)
 	return err
 }
 
+// GetHistory - реализует метод GetHistory интерфейса repositories.HistoryReader.
+func (s Store) GetHistory(ctx context.Context, nameMetric string, from, to time.Time) ([]repositories.Sample, error) {
+	return retry(ctx, s, true, func() ([]repositories.Sample, error) {
+		return s.getHistory(ctx, nameMetric, from, to)
+	})
+}
+
+// getHistory - выполняет GetHistory за одно обращение к СУБД без повторов.
+func (s Store) getHistory(ctx context.Context, nameMetric string, from, to time.Time) ([]repositories.Sample, error) {
+	var exists bool
+	if err := s.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE id = $1)`, nameMetric).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("metric %s not found", nameMetric)
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT ts, value
+		FROM metric_history
+		WHERE id = $1 AND ts BETWEEN $2 AND $3
+		ORDER BY ts
+	`, nameMetric, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]repositories.Sample, 0)
+	for rows.Next() {
+		var sample repositories.Sample
+		if err := rows.Scan(&sample.Time, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// GetRollups - реализует метод GetRollups интерфейса repositories.RollupReader.
+func (s Store) GetRollups(ctx context.Context, nameMetric string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	return retry(ctx, s, true, func() ([]repositories.Rollup, error) {
+		return s.getRollups(ctx, nameMetric, resolution, from, to)
+	})
+}
+
+// getRollups - выполняет GetRollups за одно обращение к СУБД без повторов.
+func (s Store) getRollups(ctx context.Context, nameMetric string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	var exists bool
+	if err := s.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE id = $1)`, nameMetric).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("metric %s not found", nameMetric)
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT ts, min, max, sum, count, last, delta
+		FROM metric_rollups
+		WHERE id = $1 AND resolution = $2 AND ts BETWEEN $3 AND $4
+		ORDER BY ts
+	`, nameMetric, int64(resolution.Seconds()), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := make([]repositories.Rollup, 0)
+	for rows.Next() {
+		var r repositories.Rollup
+		if err := rows.Scan(&r.Time, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last, &r.Delta); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// GetLastRollup - реализует метод GetLastRollup интерфейса repositories.RollupReader.
+func (s Store) GetLastRollup(ctx context.Context, nameMetric string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	var rollup repositories.Rollup
+	var found bool
+	err := retryExec(ctx, s, true, func() error {
+		var err error
+		rollup, found, err = s.getLastRollup(ctx, nameMetric, resolution)
+		return err
+	})
+	return rollup, found, err
+}
+
+// getLastRollup - выполняет GetLastRollup за одно обращение к СУБД без повторов.
+func (s Store) getLastRollup(ctx context.Context, nameMetric string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	var exists bool
+	if err := s.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE id = $1)`, nameMetric).Scan(&exists); err != nil {
+		return repositories.Rollup{}, false, err
+	}
+	if !exists {
+		return repositories.Rollup{}, false, fmt.Errorf("metric %s not found", nameMetric)
+	}
+
+	var r repositories.Rollup
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT ts, min, max, sum, count, last, delta
+		FROM metric_rollups
+		WHERE id = $1 AND resolution = $2
+		ORDER BY ts DESC
+		LIMIT 1
+	`, nameMetric, int64(resolution.Seconds())).Scan(&r.Time, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last, &r.Delta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repositories.Rollup{}, false, nil
+	}
+	if err != nil {
+		return repositories.Rollup{}, false, err
+	}
+	return r, true, nil
+}
+
+// AddRollups - реализует метод AddRollups интерфейса repositories.RollupWriter.
+func (s Store) AddRollups(ctx context.Context, nameMetric string, resolution time.Duration, rollups []repositories.Rollup) error {
+	return retryExec(ctx, s, true, func() error {
+		return s.addRollups(ctx, nameMetric, resolution, rollups)
+	})
+}
+
+// addRollups - выполняет AddRollups за одно обращение к СУБД без повторов.
+func (s Store) addRollups(ctx context.Context, nameMetric string, resolution time.Duration, rollups []repositories.Rollup) error {
+	if resolution < time.Second {
+		return fmt.Errorf("invalid rollup resolution %s", resolution)
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE id = $1)`, nameMetric).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("metric %s not found", nameMetric)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO metric_rollups (id, resolution, ts, min, max, sum, count, last, delta)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id, resolution, ts) DO UPDATE SET
+			min = EXCLUDED.min, max = EXCLUDED.max, sum = EXCLUDED.sum, count = EXCLUDED.count,
+			last = EXCLUDED.last, delta = EXCLUDED.delta
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rollups {
+		if _, err := stmt.ExecContext(ctx, nameMetric, int64(resolution.Seconds()), r.Time, r.Min, r.Max, r.Sum, r.Count, r.Last, r.Delta); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteHistoryBefore - реализует метод DeleteHistoryBefore интерфейса repositories.RollupWriter.
+func (s Store) DeleteHistoryBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	return retry(ctx, s, true, func() (int, error) {
+		return s.deleteHistoryBefore(ctx, resolution, before)
+	})
+}
+
+// deleteHistoryBefore - выполняет DeleteHistoryBefore за одно обращение к СУБД без повторов.
+func (s Store) deleteHistoryBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	var res sql.Result
+	var err error
+	if resolution == 0 {
+		res, err = s.conn.ExecContext(ctx, `DELETE FROM metric_history WHERE ts < $1`, before)
+	} else {
+		res, err = s.conn.ExecContext(ctx, `DELETE FROM metric_rollups WHERE resolution = $1 AND ts < $2`, int64(resolution.Seconds()), before)
+	}
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
+
+// GetHistogram - реализует метод GetHistogram интерфейса repositories.ServerRepo.
+func (s Store) GetHistogram(ctx context.Context, nameMetric string) (repositories.Histogram, error) {
+	value, err := s.GetMetric(ctx, "histogram", nameMetric)
+	if err != nil {
+		return repositories.Histogram{}, err
+	}
+	var histogram repositories.Histogram
+	if err := json.Unmarshal([]byte(value), &histogram); err != nil {
+		return repositories.Histogram{}, fmt.Errorf("decode histogram from DB error, %w", err)
+	}
+	return histogram, nil
+}
+
 // GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.ServerRepo.
 func (s Store) GetAllMetrics(ctx context.Context) (string, error) {
 	metrics, err := s.GetAllMetricsSlice(ctx)
 	if err != nil {
 		return "", err
 	}
-	var result string
-	for _, metric := range metrics {
-		if metric.MType == "gauge" {
-			result += fmt.Sprintf("type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
-		} else {
-			result += fmt.Sprintf("type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
-		}
-	}
-	return result, nil
+	return repositories.FormatMetrics(metrics), nil
 }
 
 // AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.ServerRepo.
 func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	return retryExec(ctx, s, false, func() error {
+		return s.addMetricsFromSlice(ctx, metrics)
+	})
+}
+
+// addMetricsFromSlice - выполняет AddMetricsFromSlice за одно обращение к СУБД без повторов.
+func (s Store) addMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
 	// запускаем транзакцию
 	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
@@ -180,13 +680,29 @@ func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.M
 	defer tx.Rollback()
 
 	for _, metric := range metrics {
+		if !repositories.IsValidMetricType(metric.MType) {
+			return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+		}
+		if err := registerType(ctx, tx, metric.ID, metric.MType); err != nil {
+			return err
+		}
 
-		if metric.MType == "gauge" {
+		if metric.MType == "histogram" {
+			if metric.Histogram == nil {
+				return fmt.Errorf("invalid metric, histogram of histogram metric is nil")
+			}
+			if err := addHistogram(ctx, tx, metric.ID, *metric.Histogram); err != nil {
+				return err
+			}
+		} else if metric.MType == "gauge" {
+			if metric.Value == nil {
+				return fmt.Errorf("invalid metric, value of gauge metric is nil")
+			}
 			queryUpsert := `
 				INSERT INTO metrics (id, mtype, value)
 				VALUES ($1, $2, $3)
 				ON CONFLICT (id) 
-				DO UPDATE SET value = EXCLUDED.value;
+				DO UPDATE SET value = EXCLUDED.value, updated_at = now();
 				`
 			stmt, err := tx.PrepareContext(ctx, queryUpsert)
 			if err != nil {
@@ -197,12 +713,18 @@ func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.M
 			if err != nil {
 				return err
 			}
+			if err := recordHistory(ctx, tx, metric.ID); err != nil {
+				return err
+			}
 		} else {
+			if metric.Delta == nil {
+				return fmt.Errorf("invalid metric, delta of counter metric is nil")
+			}
 			queryUpsert := `
 					INSERT INTO metrics (id, mtype, delta)
 					VALUES ($1, $2, $3)
 					ON CONFLICT (id) 
-					DO UPDATE SET delta = metrics.delta + EXCLUDED.delta;
+					DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = now();
 					`
 			stmt, err := tx.PrepareContext(ctx, queryUpsert)
 			if err != nil {
@@ -213,6 +735,9 @@ func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.M
 			if err != nil {
 				return err
 			}
+			if err := recordHistory(ctx, tx, metric.ID); err != nil {
+				return err
+			}
 		}
 
 	}
@@ -222,9 +747,16 @@ func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.M
 
 // GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.ServerRepo.
 func (s Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	return readFrom(ctx, s, func(db *sql.DB) ([]repositories.Metric, error) {
+		return getAllMetricsSlice(ctx, db)
+	})
+}
+
+// getAllMetricsSlice - возвращает все метрики из базы данных db.
+func getAllMetricsSlice(ctx context.Context, db *sql.DB) ([]repositories.Metric, error) {
 	metrics := make([]repositories.Metric, 0)
 
-	stmt, err := s.conn.PrepareContext(ctx, "SELECT id, mtype, delta, value FROM metrics")
+	stmt, err := db.PrepareContext(ctx, "SELECT id, mtype, delta, value, histogram FROM metrics ORDER BY id")
 	if err != nil {
 		return nil, fmt.Errorf("prepare context error in DB, %w", err)
 	}
@@ -236,8 +768,7 @@ func (s Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, e
 
 	defer rows.Close()
 	for rows.Next() {
-		var metric repositories.Metric
-		err = rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+		metric, err := scanMetric(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -250,3 +781,310 @@ func (s Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, e
 	}
 	return metrics, nil
 }
+
+// filterCondition - формирует условие WHERE для выборки метрик без учёта курсора и лимита.
+// Возвращает текст условия и аргументы запроса. Таблица metrics в запросе должна иметь псевдоним m,
+// а таблица metadata - псевдоним md. Регулярное выражение проверяется средствами PostgreSQL,
+// поэтому в нём следует использовать синтаксис, общий для RE2 и POSIX.
+func filterCondition(filter repositories.MetricsFilter) (string, []any, error) {
+	if err := filter.Validate(); err != nil {
+		return "", nil, err
+	}
+	conditions := []string{"TRUE"}
+	args := make([]any, 0)
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.ID != "" {
+		conditions = append(conditions, "m.id = "+arg(filter.ID))
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "m.mtype = "+arg(filter.Type))
+	}
+	if filter.Prefix != "" {
+		conditions = append(conditions, "starts_with(m.id, "+arg(filter.Prefix)+")")
+	}
+	if filter.Match != "" {
+		conditions = append(conditions, "m.id ~ "+arg(filter.Match))
+	}
+	if len(filter.Labels) > 0 {
+		labels, err := json.Marshal(filter.Labels)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, "md.labels @> "+arg(string(labels))+"::jsonb")
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+// Метрики сортируются по имени в порядке байтов (COLLATE "C"), чтобы порядок совпадал с остальными хранилищами.
+func (s Store) ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	return readFrom(ctx, s, func(db *sql.DB) ([]repositories.Metric, error) {
+		return listMetrics(ctx, db, filter)
+	})
+}
+
+// listMetrics - возвращает метрики, удовлетворяющие условиям выборки, из базы данных db.
+func listMetrics(ctx context.Context, db *sql.DB, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	where, args, err := filterCondition(filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter.AfterID != "" {
+		args = append(args, filter.AfterID)
+		where += fmt.Sprintf(` AND m.id COLLATE "C" > $%d`, len(args))
+	}
+	query := `
+		SELECT m.id, m.mtype, m.delta, m.value, m.histogram, m.updated_at
+		FROM metrics m
+		LEFT JOIN metadata md ON md.id = m.id
+		WHERE ` + where + `
+		ORDER BY m.id COLLATE "C", m.mtype`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make([]repositories.Metric, 0)
+	for rows.Next() {
+		var updated time.Time
+		metric, err := scanMetric(rows, &updated)
+		if err != nil {
+			return nil, err
+		}
+		metric.UpdatedAt = &updated
+		metrics = append(metrics, metric)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// CountMetrics - реализует метод CountMetrics интерфейса repositories.MetricsReader.
+func (s Store) CountMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	where, args, err := filterCondition(filter)
+	if err != nil {
+		return 0, err
+	}
+	return readFrom(ctx, s, func(db *sql.DB) (int, error) {
+		var count int
+		err := db.QueryRowContext(ctx, `
+			SELECT count(*)
+			FROM metrics m
+			LEFT JOIN metadata md ON md.id = m.id
+			WHERE `+where, args...).Scan(&count)
+		if err != nil {
+			return 0, err
+		}
+		return count, nil
+	})
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+func (s Store) DeleteMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	where, args, err := filterCondition(filter)
+	if err != nil {
+		return 0, err
+	}
+	return retry(ctx, s, true, func() (int, error) {
+		return s.deleteMetrics(ctx, where, args)
+	})
+}
+
+// DeleteStaleMetrics - реализует метод DeleteStaleMetrics интерфейса repositories.MetricsDeleter.
+func (s Store) DeleteStaleMetrics(ctx context.Context, before time.Time) (int, error) {
+	return retry(ctx, s, true, func() (int, error) {
+		return s.deleteMetrics(ctx, "m.updated_at < $1", []any{before})
+	})
+}
+
+// deleteMetrics - удаляет метрики, удовлетворяющие условию where, вместе с их метаданными, историей и агрегатами одним запросом.
+// Таблица metrics в условии должна иметь псевдоним m, а таблица metadata - псевдоним md.
+func (s Store) deleteMetrics(ctx context.Context, where string, args []any) (int, error) {
+	var deleted int
+	err := s.conn.QueryRowContext(ctx, `
+		WITH deleted AS (
+			DELETE FROM metrics
+			WHERE id IN (
+				SELECT m.id
+				FROM metrics m
+				LEFT JOIN metadata md ON md.id = m.id
+				WHERE `+where+`
+			)
+			RETURNING id
+		), deleted_metadata AS (
+			DELETE FROM metadata
+			WHERE id IN (SELECT id FROM deleted)
+		), deleted_history AS (
+			DELETE FROM metric_history
+			WHERE id IN (SELECT id FROM deleted)
+		), deleted_rollups AS (
+			DELETE FROM metric_rollups
+			WHERE id IN (SELECT id FROM deleted)
+		)
+		SELECT count(*) FROM deleted`, args...).Scan(&deleted)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// scanMetric - читает метрику из строки результата запроса с колонками id, mtype, delta, value, histogram.
+// Значения дополнительных колонок после histogram записываются в extra.
+func scanMetric(row scanner, extra ...any) (repositories.Metric, error) {
+	var metric repositories.Metric
+	var histogram []byte
+	dest := append([]any{&metric.ID, &metric.MType, &metric.Delta, &metric.Value, &histogram}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return repositories.Metric{}, err
+	}
+	if histogram != nil {
+		metric.Histogram = &repositories.Histogram{}
+		if err := json.Unmarshal(histogram, metric.Histogram); err != nil {
+			return repositories.Metric{}, fmt.Errorf("decode histogram from DB error, %w", err)
+		}
+	}
+	return metric, nil
+}
+
+// GetMetadata - реализует метод GetMetadata интерфейса repositories.MetadataReader.
+func (s Store) GetMetadata(ctx context.Context, nameMetric string) (repositories.Metadata, error) {
+	return retry(ctx, s, true, func() (repositories.Metadata, error) {
+		return s.getMetadata(ctx, nameMetric)
+	})
+}
+
+// getMetadata - выполняет GetMetadata за одно обращение к СУБД без повторов.
+func (s Store) getMetadata(ctx context.Context, nameMetric string) (repositories.Metadata, error) {
+	row := s.conn.QueryRowContext(ctx, `
+		SELECT id, mtype, unit, description, allowed_labels, labels
+		FROM metadata
+		WHERE id = $1
+	`, nameMetric)
+	return scanMetadata(row)
+}
+
+// GetAllMetadata - реализует метод GetAllMetadata интерфейса repositories.MetadataReader.
+func (s Store) GetAllMetadata(ctx context.Context) ([]repositories.Metadata, error) {
+	return retry(ctx, s, true, func() ([]repositories.Metadata, error) {
+		return s.getAllMetadata(ctx)
+	})
+}
+
+// getAllMetadata - выполняет GetAllMetadata за одно обращение к СУБД без повторов.
+func (s Store) getAllMetadata(ctx context.Context) ([]repositories.Metadata, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT id, mtype, unit, description, allowed_labels, labels
+		FROM metadata
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]repositories.Metadata, 0)
+	for rows.Next() {
+		meta, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, meta)
+	}
+	// проверяем на ошибки
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMetadata - реализует метод SetMetadata интерфейса repositories.MetadataWriter.
+// Тип метрики нельзя изменить, если в хранилище уже есть значения метрики другого типа.
+func (s Store) SetMetadata(ctx context.Context, meta repositories.Metadata) error {
+	return retryExec(ctx, s, true, func() error {
+		return s.setMetadata(ctx, meta)
+	})
+}
+
+// setMetadata - выполняет SetMetadata за одно обращение к СУБД без повторов.
+func (s Store) setMetadata(ctx context.Context, meta repositories.Metadata) error {
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	allowedLabels, err := json.Marshal(meta.AllowedLabels)
+	if err != nil {
+		return err
+	}
+	labels, err := json.Marshal(meta.Labels)
+	if err != nil {
+		return err
+	}
+
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	var storedType string
+	err = tx.QueryRowContext(ctx, `SELECT mtype FROM metrics WHERE id = $1 FOR UPDATE`, meta.ID).Scan(&storedType)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && storedType != meta.MType {
+		return repositories.TypeConflictError(meta.ID, storedType, meta.MType)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO metadata (id, mtype, unit, description, allowed_labels, labels)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id)
+		DO UPDATE SET mtype = EXCLUDED.mtype,
+			unit = EXCLUDED.unit,
+			description = EXCLUDED.description,
+			allowed_labels = EXCLUDED.allowed_labels,
+			labels = EXCLUDED.labels
+	`, meta.ID, meta.MType, meta.Unit, meta.Description, allowedLabels, labels)
+	if err != nil {
+		return err
+	}
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// scanner - общий интерфейс sql.Row и sql.Rows для чтения строки результата запроса.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMetadata - читает метаданные метрики из строки результата запроса.
+func scanMetadata(row scanner) (repositories.Metadata, error) {
+	var meta repositories.Metadata
+	var allowedLabels, labels []byte
+	if err := row.Scan(&meta.ID, &meta.MType, &meta.Unit, &meta.Description, &allowedLabels, &labels); err != nil {
+		return repositories.Metadata{}, err
+	}
+	if allowedLabels != nil {
+		if err := json.Unmarshal(allowedLabels, &meta.AllowedLabels); err != nil {
+			return repositories.Metadata{}, fmt.Errorf("decode allowed labels from DB error, %w", err)
+		}
+	}
+	if labels != nil {
+		if err := json.Unmarshal(labels, &meta.Labels); err != nil {
+			return repositories.Metadata{}, fmt.Errorf("decode labels from DB error, %w", err)
+		}
+	}
+	return meta, nil
+}
@@ -7,10 +7,12 @@ import (
 	"math"
 	"strconv"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -226,8 +228,9 @@ func TestGetAllMetrics(t *testing.T) {
 
 	// Проверяю результат
 	var result string
-	result += fmt.Sprintf("type: %s, name: %s, value: %g\n", "gauge", "positive gauge", valueGauge)
+	// метрики упорядочены по имени
 	result += fmt.Sprintf("type: %s, name: %s, value: %d\n", "counter", "positive counter", valueCounter)
+	result += fmt.Sprintf("type: %s, name: %s, value: %g\n", "gauge", "positive gauge", valueGauge)
 	get, err = stor.GetAllMetrics(ctx)
 	require.NoError(t, err)
 	assert.Equal(t, result, get)
@@ -608,5 +611,414 @@ func TestGetAllMetricsSlice(t *testing.T) {
 	// Проверяю наличие метрик в базе
 	resSlice, err := stor.GetAllMetricsSlice(ctx)
 	require.NoError(t, err)
+	// метрики упорядочены по имени
+	repositories.SortMetrics(slice)
 	assert.Equal(t, slice, resSlice)
 }
+
+func TestAddHistogram(t *testing.T) {
+	// Функция для очистки данных в базе
+	cleanBD := func(dsn string) {
+		// создаём соединение с СУБД PostgreSQL
+		conn, err := sql.Open("pgx", dsn)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Проверка соединения с БД
+		ctx := context.Background()
+		err = conn.PingContext(ctx)
+		require.NoError(t, err)
+
+		// создаем экземпляр хранилища pg
+		stor := NewStore(conn)
+		err = stor.Bootstrap(ctx)
+		require.NoError(t, err)
+		err = stor.Disable(ctx)
+		require.NoError(t, err)
+	}
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// Очищаю данные в БД от предыдущих запусков
+	cleanBD(databaseDsn)
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+
+	// Добавляю гистограмму и объединяю её со второй гистограммой
+	{
+		err = stor.AddHistogram(ctx, "pause", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3})
+		require.NoError(t, err)
+		err = stor.AddHistogram(ctx, "pause", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5})
+		require.NoError(t, err)
+
+		got, err := stor.GetHistogram(ctx, "pause")
+		require.NoError(t, err)
+		assert.Equal(t, repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, got)
+	}
+	// Гистограмму с другими границами бакетов объединить нельзя
+	{
+		err = stor.AddHistogram(ctx, "pause", repositories.Histogram{Bounds: []float64{1, 3}, Counts: []uint64{0, 0, 0}})
+		require.ErrorIs(t, err, repositories.ErrHistogramBoundsMismatch)
+	}
+	// Гистограммы из батча объединяются с хранимыми
+	{
+		err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "pause", MType: "histogram", Histogram: &repositories.Histogram{
+			Bounds: []float64{1, 2}, Counts: []uint64{2, 0, 0}, Sum: 1, Count: 2}}})
+		require.NoError(t, err)
+
+		metrics, err := stor.GetAllMetricsSlice(ctx)
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		require.NotNil(t, metrics[0].Histogram)
+		assert.Equal(t, uint64(10), metrics[0].Histogram.Count)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	// Функция для очистки данных в базе
+	cleanBD := func(dsn string) {
+		// создаём соединение с СУБД PostgreSQL
+		conn, err := sql.Open("pgx", dsn)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Проверка соединения с БД
+		ctx := context.Background()
+		err = conn.PingContext(ctx)
+		require.NoError(t, err)
+
+		// создаем экземпляр хранилища pg
+		stor := NewStore(conn)
+		err = stor.Bootstrap(ctx)
+		require.NoError(t, err)
+		err = stor.Disable(ctx)
+		require.NoError(t, err)
+	}
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// Очищаю данные в БД от предыдущих запусков
+	cleanBD(databaseDsn)
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+
+	// Метрика регистрируется в реестре при первой записи
+	{
+		err = stor.AddGauge(ctx, "Alloc", 1.5)
+		require.NoError(t, err)
+
+		meta, err := stor.GetMetadata(ctx, "Alloc")
+		require.NoError(t, err)
+		assert.Equal(t, repositories.Metadata{ID: "Alloc", MType: "gauge"}, meta)
+	}
+	// Запись метрики другого типа возвращает ошибку конфликта
+	{
+		err = stor.AddCounter(ctx, "Alloc", 3)
+		require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+		delta := int64(3)
+		err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "Alloc", MType: "counter", Delta: &delta}})
+		require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	}
+	// Изменение метаданных
+	{
+		meta := repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects",
+			AllowedLabels: []string{"host"}, Labels: map[string]string{"host": "agent"}}
+		err = stor.SetMetadata(ctx, meta)
+		require.NoError(t, err)
+
+		got, err := stor.GetMetadata(ctx, "Alloc")
+		require.NoError(t, err)
+		assert.Equal(t, meta, got)
+
+		err = stor.SetMetadata(ctx, repositories.Metadata{ID: "Alloc", MType: "counter"})
+		require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+		err = stor.SetMetadata(ctx, repositories.Metadata{ID: "Latency", MType: "histogram", Unit: "seconds"})
+		require.NoError(t, err)
+
+		all, err := stor.GetAllMetadata(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []repositories.Metadata{meta, {ID: "Latency", MType: "histogram", Unit: "seconds"}}, all)
+	}
+	// Отсутствующая метрика
+	{
+		_, err = stor.GetMetadata(ctx, "unknown")
+		require.Error(t, err)
+	}
+}
+
+func TestListMetrics(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg и очищаю данные от предыдущих запусков
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+	err = stor.Disable(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, stor.AddGauge(ctx, "HeapIdle", 2))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "HeapIdle", MType: "gauge", Labels: map[string]string{"host": "agent"}}))
+
+	ids := func(metrics []repositories.Metric) []string {
+		result := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			result = append(result, metric.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		filter    repositories.MetricsFilter
+		want      []string
+		wantCount int
+	}{
+		{name: "all sorted", filter: repositories.MetricsFilter{}, want: []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}, wantCount: 4},
+		{name: "type", filter: repositories.MetricsFilter{Type: "counter"}, want: []string{"PollCount"}, wantCount: 1},
+		{name: "prefix", filter: repositories.MetricsFilter{Prefix: "Heap"}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 2},
+		{name: "match", filter: repositories.MetricsFilter{Match: "Alloc$"}, want: []string{"Alloc", "HeapAlloc"}, wantCount: 2},
+		{name: "labels", filter: repositories.MetricsFilter{Labels: map[string]string{"host": "agent"}}, want: []string{"HeapIdle"}, wantCount: 1},
+		{name: "cursor and limit", filter: repositories.MetricsFilter{AfterID: "Alloc", Limit: 2}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := stor.ListMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(metrics))
+
+			count, err := stor.CountMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg и очищаю данные от предыдущих запусков
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+	err = stor.Disable(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, stor.AddGauge(ctx, "HeapIdle", 2))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	// Удаление одной метрики вместе с метаданными
+	{
+		deleted, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+		require.Error(t, err)
+		_, err = stor.GetMetadata(ctx, "Alloc")
+		require.Error(t, err)
+	}
+	// Удаление метрик по шаблону имени
+	{
+		deleted, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{Match: "^Heap"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+	}
+	// Удаление устаревших метрик
+	{
+		deleted, err := stor.DeleteStaleMetrics(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+
+		deleted, err = stor.DeleteStaleMetrics(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		metrics, err := stor.GetAllMetricsSlice(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, metrics)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg и очищаю данные от предыдущих запусков
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+	err = stor.Disable(ctx)
+	require.NoError(t, err)
+
+	from := time.Now().Add(-time.Minute)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	delta := int64(5)
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+	to := time.Now().Add(time.Minute)
+
+	samples, err := stor.GetHistory(ctx, "PollCount", from, to)
+	require.NoError(t, err)
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	assert.Equal(t, []float64{3, 7, 12}, values)
+
+	_, err = stor.GetHistory(ctx, "unknown", from, to)
+	require.Error(t, err)
+
+	// время последнего обновления возвращается при выборке метрик
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{ID: "PollCount"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	require.NotNil(t, metrics[0].UpdatedAt)
+}
+
+func TestRollups(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// создаем экземпляр хранилища pg и очищаю данные от предыдущих запусков
+	stor := NewStore(conn)
+	err = stor.Bootstrap(ctx)
+	require.NoError(t, err)
+	err = stor.Disable(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0, Min: 1, Max: 1, Sum: 1, Count: 1, Last: 1},
+		{Time: t0.Add(time.Minute), Min: 2, Max: 2, Sum: 2, Count: 1, Last: 2, Delta: 1},
+	}))
+	// агрегат с тем же началом интервала заменяется
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Min: 2, Max: 5, Sum: 7, Count: 2, Last: 5, Delta: 4},
+	}))
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Hour, []repositories.Rollup{{Time: t0, Min: 1, Max: 5, Sum: 8, Count: 3, Last: 5, Delta: 4}}))
+	assert.Error(t, stor.AddRollups(ctx, "unknown", time.Minute, []repositories.Rollup{{Time: t0}}))
+
+	rollups, err := stor.GetRollups(ctx, "PollCount", time.Minute, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.True(t, rollups[1].Time.Equal(t0.Add(time.Minute)))
+	assert.Equal(t, int64(2), rollups[1].Count)
+	assert.Equal(t, 4.0, rollups[1].Delta)
+
+	last, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 5.0, last.Last)
+
+	deleted, err := stor.DeleteHistoryBefore(ctx, time.Minute, t0.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = stor.DeleteHistoryBefore(ctx, 0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// агрегаты удаляются вместе с метрикой
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "PollCount"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	_, ok, err = stor.GetLastRollup(ctx, "PollCount", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestConformance(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	// создаём соединение с СУБД PostgreSQL
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Проверка соединения с БД
+	ctx := context.Background()
+	err = conn.PingContext(ctx)
+	require.NoError(t, err)
+
+	// каждый тест набора начинается с пустой базы
+	storagetest.Run(t, func(t *testing.T) repositories.IStorage {
+		stor := NewStore(conn)
+		require.NoError(t, stor.Bootstrap(ctx))
+		require.NoError(t, stor.Disable(ctx))
+		return stor
+	})
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NameLabel - имя псевдометки, которой соответствует имя метрики в условиях отбора.
+const NameLabel = "__name__"
+
+// Expr - узел разобранного выражения запроса.
+type Expr interface {
+	// String - возвращает выражение в каноническом виде.
+	String() string
+}
+
+// MatchOp - оператор сравнения метки в условии отбора.
+type MatchOp string
+
+const (
+	MatchEqual     MatchOp = "="  // значение метки равно строке
+	MatchNotEqual  MatchOp = "!=" // значение метки не равно строке
+	MatchRegexp    MatchOp = "=~" // значение метки полностью соответствует регулярному выражению
+	MatchNotRegexp MatchOp = "!~" // значение метки не соответствует регулярному выражению
+)
+
+// LabelMatcher - условие отбора метрик по значению метки. Отсутствующая метка считается пустой строкой.
+type LabelMatcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp
+}
+
+// newLabelMatcher - создаёт условие отбора и компилирует регулярное выражение для операторов =~ и !~.
+func newLabelMatcher(name string, op MatchOp, value string) (LabelMatcher, error) {
+	m := LabelMatcher{Name: name, Op: op, Value: value}
+	if op == MatchRegexp || op == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("invalid regular expression for label %s: %w", name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches - проверяет значение метки.
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// String - возвращает условие в каноническом виде.
+func (m LabelMatcher) String() string {
+	return m.Name + string(m.Op) + strconv.Quote(m.Value)
+}
+
+// VectorSelector - выбор метрик по имени и меткам, например HeapAlloc{host="a"}.
+// Возвращает текущие значения метрик.
+type VectorSelector struct {
+	Name     string // имя метрики, пустое если метрики выбираются только по условиям
+	Matchers []LabelMatcher
+}
+
+// String - возвращает выражение в каноническом виде.
+func (s *VectorSelector) String() string {
+	if len(s.Matchers) == 0 {
+		return s.Name
+	}
+	matchers := make([]string, len(s.Matchers))
+	for i, m := range s.Matchers {
+		matchers[i] = m.String()
+	}
+	return s.Name + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// RangeFunction - функция над значениями метрик за период, например rate(PollCount[5m]).
+type RangeFunction struct {
+	Func     string
+	Selector *VectorSelector
+	Range    time.Duration
+}
+
+// String - возвращает выражение в каноническом виде.
+func (f *RangeFunction) String() string {
+	return fmt.Sprintf("%s(%s[%s])", f.Func, f.Selector, formatDuration(f.Range))
+}
+
+// Aggregation - агрегация значений нескольких метрик, например sum by(host)(rate(PollCount[5m])).
+type Aggregation struct {
+	Op       string
+	Grouping []string // метки, по которым группируются метрики
+	Expr     Expr
+}
+
+// String - возвращает выражение в каноническом виде.
+func (a *Aggregation) String() string {
+	if len(a.Grouping) == 0 {
+		return fmt.Sprintf("%s(%s)", a.Op, a.Expr)
+	}
+	return fmt.Sprintf("%s by(%s)(%s)", a.Op, strings.Join(a.Grouping, ","), a.Expr)
+}
+
+// parseDuration - разбирает длительность периода. Кроме единиц time.ParseDuration поддерживаются дни (d) и недели (w).
+func parseDuration(value string) (time.Duration, error) {
+	var period time.Duration
+	switch {
+	case strings.HasSuffix(value, "d") || strings.HasSuffix(value, "w"):
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+		if strings.HasSuffix(value, "w") {
+			period *= 7
+		}
+	default:
+		var err error
+		if period, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+	}
+	if period <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", value)
+	}
+	return period, nil
+}
+
+// formatDuration - возвращает длительность в виде, который принимает parseDuration.
+func formatDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	s := d.String()
+	// 5m0s -> 5m, 1h0m0s -> 1h
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,405 @@
+// Packet query implement parser and evaluator of aggregation queries over stored metrics and their history,
+// for example rate(PollCount[5m]) or sum by(host)(avg_over_time(Alloc[10m])).
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+)
+
+// Storage - хранилище, по которому вычисляются запросы.
+type Storage interface {
+	ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error)
+	GetAllMetadata(ctx context.Context) ([]repositories.Metadata, error)
+	rollup.Reader
+}
+
+// Series - значение одного ряда результата запроса.
+type Series struct {
+	Metric string            `json:"metric,omitempty"` // имя метрики, пустое у результата агрегации
+	Labels map[string]string `json:"labels,omitempty"` // метки метрики или метки группировки у результата агрегации
+	Value  float64           `json:"value"`
+}
+
+// rangeFunctions - функции над историей метрики за период. Возвращают false, если значений недостаточно для вычисления.
+// История передаётся агрегатами уровня, выбранного по времени хранения уровней, исходные значения - агрегатами из одного значения.
+var rangeFunctions = map[string]func(rollups []repositories.Rollup) (float64, bool){
+	// rate - среднее приращение counter в секунду между первым и последним значением за период
+	"rate": func(rollups []repositories.Rollup) (float64, bool) {
+		if len(rollups) < 2 {
+			return 0, false
+		}
+		seconds := rollups[len(rollups)-1].Time.Sub(rollups[0].Time).Seconds()
+		if seconds <= 0 {
+			return 0, false
+		}
+		return counterIncrease(rollups) / seconds, true
+	},
+	// increase - приращение counter за период с учётом сброса счётчика
+	"increase": func(rollups []repositories.Rollup) (float64, bool) {
+		if len(rollups) < 2 {
+			return 0, false
+		}
+		return counterIncrease(rollups), true
+	},
+	// delta - разница между последним и первым значением gauge за период
+	"delta": func(rollups []repositories.Rollup) (float64, bool) {
+		if len(rollups) < 2 {
+			return 0, false
+		}
+		return rollups[len(rollups)-1].Last - rollups[0].Last, true
+	},
+	"avg_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		var sum float64
+		var count int64
+		for _, r := range rollups {
+			sum += r.Sum
+			count += r.Count
+		}
+		return sum / float64(count), count > 0
+	},
+	"sum_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		var sum float64
+		for _, r := range rollups {
+			sum += r.Sum
+		}
+		return sum, len(rollups) > 0
+	},
+	"min_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		return reduceRollups(rollups, func(r repositories.Rollup) float64 { return r.Min }, math.Min)
+	},
+	"max_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		return reduceRollups(rollups, func(r repositories.Rollup) float64 { return r.Max }, math.Max)
+	},
+	"count_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		var count int64
+		for _, r := range rollups {
+			count += r.Count
+		}
+		return float64(count), count > 0
+	},
+	"last_over_time": func(rollups []repositories.Rollup) (float64, bool) {
+		if len(rollups) == 0 {
+			return 0, false
+		}
+		return rollups[len(rollups)-1].Last, true
+	},
+}
+
+// aggregations - функции агрегации значений нескольких рядов.
+var aggregations = map[string]func(values []float64) float64{
+	"sum": func(values []float64) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	},
+	"avg": func(values []float64) float64 {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	},
+	"min": func(values []float64) float64 {
+		result := values[0]
+		for _, v := range values[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	},
+	"max": func(values []float64) float64 {
+		result := values[0]
+		for _, v := range values[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	},
+	"count": func(values []float64) float64 {
+		return float64(len(values))
+	},
+}
+
+// counterIncrease - вычисляет приращение counter от первого до последнего значения.
+// Приращение первого агрегата относится к времени до начала периода и не учитывается.
+func counterIncrease(rollups []repositories.Rollup) float64 {
+	var increase float64
+	for _, r := range rollups[1:] {
+		increase += r.Delta
+	}
+	return increase
+}
+
+// reduceRollups - сворачивает значения field агрегатов функцией fn.
+func reduceRollups(rollups []repositories.Rollup, field func(repositories.Rollup) float64, fn func(a, b float64) float64) (float64, bool) {
+	if len(rollups) == 0 {
+		return 0, false
+	}
+	result := field(rollups[0])
+	for _, r := range rollups[1:] {
+		result = fn(result, field(r))
+	}
+	return result, true
+}
+
+// evaluator - вычисляет разобранное выражение по хранилищу.
+type evaluator struct {
+	ctx    context.Context
+	stor   Storage
+	policy rollup.Policy // время хранения уровней истории, по которому выбирается уровень для функций над периодом
+	at     time.Time
+	labels map[string]map[string]string // метки метрик из реестра метаданных, загружаются при первом обращении
+}
+
+// Query - разбирает и вычисляет выражение запроса.
+func Query(ctx context.Context, stor Storage, policy rollup.Policy, input string, at time.Time) ([]Series, error) {
+	expr, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return Eval(ctx, stor, policy, expr, at)
+}
+
+// Eval - вычисляет выражение. Выбор метрик возвращает их текущие значения (у histogram - количество наблюдений),
+// функции над периодом вычисляются по истории значений за [at-период, at] на уровне истории, который выбирается
+// по времени хранения уровней policy: чем раньше начало периода, тем больше длительность интервала агрегатов.
+// Ряды, для которых значение не удалось вычислить, в результат не попадают. Результат отсортирован по имени и меткам.
+func Eval(ctx context.Context, stor Storage, policy rollup.Policy, expr Expr, at time.Time) ([]Series, error) {
+	e := &evaluator{ctx: ctx, stor: stor, policy: policy, at: at}
+	result, err := e.eval(expr)
+	if err != nil {
+		return nil, err
+	}
+	filtered := result[:0]
+	for _, s := range result {
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			filtered = append(filtered, s)
+		}
+	}
+	sortSeries(filtered)
+	return filtered, nil
+}
+
+// eval - вычисляет узел выражения.
+func (e *evaluator) eval(expr Expr) ([]Series, error) {
+	switch expr := expr.(type) {
+	case *VectorSelector:
+		return e.evalSelector(expr)
+	case *RangeFunction:
+		return e.evalFunction(expr)
+	case *Aggregation:
+		return e.evalAggregation(expr)
+	}
+	return nil, fmt.Errorf("unsupported expression %s", expr)
+}
+
+// metricLabels - возвращает метки метрики из реестра метаданных.
+func (e *evaluator) metricLabels(name string) (map[string]string, error) {
+	if e.labels == nil {
+		metadata, err := e.stor.GetAllMetadata(e.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get metadata: %w", err)
+		}
+		e.labels = make(map[string]map[string]string, len(metadata))
+		for _, meta := range metadata {
+			e.labels[meta.ID] = meta.Labels
+		}
+	}
+	return e.labels[name], nil
+}
+
+// selectMetrics - выбирает метрики, удовлетворяющие условиям отбора, вместе с их метками.
+// Условия на имя метрики по возможности передаются хранилищу, остальные проверяются после выборки.
+func (e *evaluator) selectMetrics(selector *VectorSelector) ([]repositories.Metric, []map[string]string, error) {
+	filter := repositories.MetricsFilter{ID: selector.Name}
+	for _, m := range selector.Matchers {
+		if m.Name != NameLabel {
+			continue
+		}
+		switch {
+		case m.Op == MatchEqual && filter.ID == "":
+			filter.ID = m.Value
+		case m.Op == MatchRegexp && filter.Match == "":
+			filter.Match = "^(?:" + m.Value + ")$"
+		}
+	}
+
+	metrics, err := e.stor.ListMetrics(e.ctx, filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list metrics: %w", err)
+	}
+
+	selected := metrics[:0]
+	var labels []map[string]string
+	for _, metric := range metrics {
+		metricLabels, err := e.metricLabels(metric.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		matched := true
+		for _, m := range selector.Matchers {
+			value := metricLabels[m.Name]
+			if m.Name == NameLabel {
+				value = metric.ID
+			}
+			if !m.Matches(value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			selected = append(selected, metric)
+			labels = append(labels, metricLabels)
+		}
+	}
+	return selected, labels, nil
+}
+
+// evalSelector - возвращает текущие значения выбранных метрик.
+func (e *evaluator) evalSelector(selector *VectorSelector) ([]Series, error) {
+	metrics, labels, err := e.selectMetrics(selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Series, 0, len(metrics))
+	for i, metric := range metrics {
+		var value float64
+		switch {
+		case metric.Value != nil:
+			value = *metric.Value
+		case metric.Delta != nil:
+			value = float64(*metric.Delta)
+		case metric.Histogram != nil:
+			value = float64(metric.Histogram.Count)
+		default:
+			continue
+		}
+		result = append(result, Series{Metric: metric.ID, Labels: copyLabels(labels[i]), Value: value})
+	}
+	return result, nil
+}
+
+// evalFunction - вычисляет функцию по истории значений выбранных метрик.
+func (e *evaluator) evalFunction(fn *RangeFunction) ([]Series, error) {
+	apply, ok := rangeFunctions[fn.Func]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", fn.Func)
+	}
+	metrics, labels, err := e.selectMetrics(fn.Selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Series, 0, len(metrics))
+	for i, metric := range metrics {
+		_, rollups, err := rollup.ReadAuto(e.ctx, e.stor, e.policy, metric.ID, e.at.Add(-fn.Range), e.at)
+		if err != nil {
+			return nil, fmt.Errorf("get history of metric %s: %w", metric.ID, err)
+		}
+		value, ok := apply(rollups)
+		if !ok {
+			continue
+		}
+		result = append(result, Series{Metric: metric.ID, Labels: copyLabels(labels[i]), Value: value})
+	}
+	return result, nil
+}
+
+// evalAggregation - агрегирует значения рядов, сгруппированных по меткам. Отсутствующая метка считается пустой строкой.
+// При группировке по __name__ ряды группируются по имени метрики.
+func (e *evaluator) evalAggregation(agg *Aggregation) ([]Series, error) {
+	apply, ok := aggregations[agg.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %s", agg.Op)
+	}
+	input, err := e.eval(agg.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		series Series
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, s := range input {
+		key := make([]string, len(agg.Grouping))
+		grouped := Series{}
+		for i, label := range agg.Grouping {
+			value := s.Labels[label]
+			if label == NameLabel {
+				value = s.Metric
+				grouped.Metric = value
+			} else if value != "" {
+				if grouped.Labels == nil {
+					grouped.Labels = make(map[string]string)
+				}
+				grouped.Labels[label] = value
+			}
+			key[i] = value
+		}
+		k := strings.Join(key, "\xff")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{series: grouped}
+			groups[k] = g
+			order = append(order, k)
+		}
+		g.values = append(g.values, s.Value)
+	}
+
+	result := make([]Series, 0, len(groups))
+	for _, k := range order {
+		g := groups[k]
+		g.series.Value = apply(g.values)
+		result = append(result, g.series)
+	}
+	return result, nil
+}
+
+// copyLabels - копирует метки, чтобы результат запроса не ссылался на данные хранилища.
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// labelsKey - возвращает метки в каноническом виде для сортировки.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+// sortSeries - сортирует ряды по имени метрики и меткам.
+func sortSeries(series []Series) {
+	sort.SliceStable(series, func(i, j int) bool {
+		if series[i].Metric != series[j].Metric {
+			return series[i].Metric < series[j].Metric
+		}
+		return labelsKey(series[i].Labels) < labelsKey(series[j].Labels)
+	})
+}
@@ -0,0 +1,273 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/rollup"
+)
+
+// stubStorage - хранилище с заранее заданными метриками и историей значений.
+type stubStorage struct {
+	metrics  []repositories.Metric
+	history  map[string][]repositories.Sample
+	rollups  map[string][]repositories.Rollup // минутные агрегаты
+	metadata []repositories.Metadata
+	err      error
+}
+
+func (s *stubStorage) ListMetrics(_ context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	match, err := filter.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	var result []repositories.Metric
+	for _, metric := range s.metrics {
+		if match(metric, nil) {
+			result = append(result, metric)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubStorage) GetHistory(_ context.Context, name string, from, to time.Time) ([]repositories.Sample, error) {
+	samples, ok := s.history[name]
+	if !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	var result []repositories.Sample
+	for _, sample := range samples {
+		if !sample.Time.Before(from) && !sample.Time.After(to) {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubStorage) GetRollups(_ context.Context, name string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	var result []repositories.Rollup
+	if resolution != rollup.Minute {
+		return result, nil
+	}
+	for _, r := range s.rollups[name] {
+		if !r.Time.Before(from) && !r.Time.After(to) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubStorage) GetLastRollup(_ context.Context, name string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	rollups := s.rollups[name]
+	if resolution != rollup.Minute || len(rollups) == 0 {
+		return repositories.Rollup{}, false, nil
+	}
+	return rollups[len(rollups)-1], true, nil
+}
+
+func (s *stubStorage) GetAllMetadata(context.Context) ([]repositories.Metadata, error) {
+	return s.metadata, nil
+}
+
+func newStubStorage(now time.Time) *stubStorage {
+	gauge := func(v float64) *float64 { return &v }
+	counter := func(v int64) *int64 { return &v }
+	// samples - значения метрики с интервалом в минуту, последнее значение записано в момент now
+	samples := func(values ...float64) []repositories.Sample {
+		result := make([]repositories.Sample, len(values))
+		for i, v := range values {
+			result[i] = repositories.Sample{Time: now.Add(-time.Duration(len(values)-1-i) * time.Minute), Value: v}
+		}
+		return result
+	}
+	return &stubStorage{
+		metrics: []repositories.Metric{
+			{ID: "Alloc.a", MType: "gauge", Value: gauge(30)},
+			{ID: "Alloc.b", MType: "gauge", Value: gauge(10)},
+			{ID: "Alloc.c", MType: "gauge", Value: gauge(5)},
+			{ID: "Latency", MType: "histogram", Histogram: &repositories.Histogram{Count: 7}},
+			{ID: "Requests.a", MType: "counter", Delta: counter(60)},
+			{ID: "Requests.b", MType: "counter", Delta: counter(5)},
+		},
+		history: map[string][]repositories.Sample{
+			"Alloc.a": samples(10, 20, 30),
+			"Alloc.b": samples(10),
+			"Alloc.c": {},
+			"Latency": samples(7),
+			// счётчик сбрасывался между вторым и третьим значением
+			"Requests.a": samples(0, 30, 60, 20, 60),
+			"Requests.b": samples(5),
+		},
+		metadata: []repositories.Metadata{
+			{ID: "Alloc.a", MType: "gauge", Labels: map[string]string{"host": "a", "env": "prod"}},
+			{ID: "Alloc.b", MType: "gauge", Labels: map[string]string{"host": "b", "env": "prod"}},
+			{ID: "Alloc.c", MType: "gauge", Labels: map[string]string{"host": "c", "env": "dev"}},
+			{ID: "Requests.a", MType: "counter", Labels: map[string]string{"host": "a"}},
+		},
+	}
+}
+
+func TestEval(t *testing.T) {
+	// без ограничения времени хранения функции вычисляются по исходным значениям
+	policy := rollup.Policy{}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stor := newStubStorage(now)
+	prod := map[string]string{"host": "a", "env": "prod"}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []Series
+	}{
+		{
+			name:  "selector",
+			query: "Alloc.b",
+			want:  []Series{{Metric: "Alloc.b", Labels: map[string]string{"host": "b", "env": "prod"}, Value: 10}},
+		},
+		{
+			name:  "selector by labels",
+			query: `{__name__=~"Alloc.*",env="prod",host!="b"}`,
+			want:  []Series{{Metric: "Alloc.a", Labels: prod, Value: 30}},
+		},
+		{
+			name:  "missing label is empty",
+			query: `{__name__=~"Requests.*",host=""}`,
+			want:  []Series{{Metric: "Requests.b", Value: 5}},
+		},
+		{
+			name:  "histogram count",
+			query: "Latency",
+			want:  []Series{{Metric: "Latency", Value: 7}},
+		},
+		{
+			name:  "rate with counter reset",
+			query: "rate(Requests.a[10m])",
+			// 30 + 30 + 20 (сброс) + 40 = 120 за 4 минуты
+			want: []Series{{Metric: "Requests.a", Labels: map[string]string{"host": "a"}, Value: 0.5}},
+		},
+		{
+			name:  "increase over part of history",
+			query: "increase(Requests.a[2m])",
+			want:  []Series{{Metric: "Requests.a", Labels: map[string]string{"host": "a"}, Value: 60}},
+		},
+		{
+			name:  "rate needs two samples",
+			query: `rate({__name__=~"Requests.*"}[10m])`,
+			want:  []Series{{Metric: "Requests.a", Labels: map[string]string{"host": "a"}, Value: 0.5}},
+		},
+		{
+			name:  "avg over time",
+			query: `avg_over_time({__name__=~"Alloc.*"}[10m])`,
+			want: []Series{
+				{Metric: "Alloc.a", Labels: prod, Value: 20},
+				{Metric: "Alloc.b", Labels: map[string]string{"host": "b", "env": "prod"}, Value: 10},
+			},
+		},
+		{name: "min over time", query: "min_over_time(Alloc.a[10m])", want: []Series{{Metric: "Alloc.a", Labels: prod, Value: 10}}},
+		{name: "max over time", query: "max_over_time(Alloc.a[1m])", want: []Series{{Metric: "Alloc.a", Labels: prod, Value: 30}}},
+		{name: "count over time", query: "count_over_time(Alloc.a[1m])", want: []Series{{Metric: "Alloc.a", Labels: prod, Value: 2}}},
+		{name: "delta", query: "delta(Alloc.a[1h])", want: []Series{{Metric: "Alloc.a", Labels: prod, Value: 20}}},
+		{name: "max", query: `max({__name__=~"Alloc.*"})`, want: []Series{{Value: 30}}},
+		{name: "min", query: `min({__name__=~"Alloc.*"})`, want: []Series{{Value: 5}}},
+		{
+			name:  "sum by label",
+			query: `sum by(env)({__name__=~"Alloc.*"})`,
+			want: []Series{
+				{Labels: map[string]string{"env": "dev"}, Value: 5},
+				{Labels: map[string]string{"env": "prod"}, Value: 40},
+			},
+		},
+		{
+			name:  "count by name",
+			query: `count by(__name__)(count_over_time({__name__=~".*"}[1h]))`,
+			want: []Series{
+				{Metric: "Alloc.a", Value: 1},
+				{Metric: "Alloc.b", Value: 1},
+				{Metric: "Latency", Value: 1},
+				{Metric: "Requests.a", Value: 1},
+				{Metric: "Requests.b", Value: 1},
+			},
+		},
+		{name: "nested aggregation", query: `max(sum by(env)({__name__=~"Alloc.*"}))`, want: []Series{{Value: 40}}},
+		{name: "no metrics", query: "unknown", want: []Series{}},
+		{name: "aggregation of empty vector", query: "sum(unknown)", want: []Series{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Query(context.Background(), stor, policy, tt.query, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEvalRollupTier(t *testing.T) {
+	policy := rollup.Policy{Raw: time.Hour, Minute: 24 * time.Hour}
+
+	now := time.Now()
+	start := now.Add(-150 * time.Minute).Truncate(time.Minute)
+	stor := newStubStorage(now)
+	stor.history["Requests.a"] = nil
+	stor.rollups = map[string][]repositories.Rollup{
+		"Requests.a": {
+			{Time: start, Min: 10, Max: 20, Sum: 30, Count: 2, Last: 20, Delta: 10},
+			{Time: start.Add(time.Minute), Min: 5, Max: 50, Sum: 55, Count: 2, Last: 50, Delta: 45},
+			{Time: start.Add(2 * time.Minute), Min: 50, Max: 80, Sum: 130, Count: 2, Last: 80, Delta: 30},
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{query: "increase(Requests.a[3h])", want: 75},
+		{query: "rate(Requests.a[3h])", want: 75.0 / 120},
+		{query: "min_over_time(Requests.a[3h])", want: 5},
+		{query: "max_over_time(Requests.a[3h])", want: 80},
+		{query: "avg_over_time(Requests.a[3h])", want: 215.0 / 6},
+		{query: "count_over_time(Requests.a[3h])", want: 6},
+		{query: "last_over_time(Requests.a[3h])", want: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Query(context.Background(), stor, policy, tt.query, now)
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			assert.InDelta(t, tt.want, got[0].Value, 1e-9)
+		})
+	}
+
+	// за последний час используются исходные значения, которых в этот период нет
+	got, err := Query(context.Background(), stor, policy, "count_over_time(Requests.a[30m])", now)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestEvalErrors(t *testing.T) {
+	now := time.Now()
+
+	_, err := Query(context.Background(), newStubStorage(now), rollup.DefaultPolicy, "rate(PollCount[", now)
+	assert.ErrorContains(t, err, "parse error")
+
+	stor := newStubStorage(now)
+	stor.err = errors.New("storage is unavailable")
+	_, err = Query(context.Background(), stor, rollup.DefaultPolicy, "sum(Alloc.a)", now)
+	assert.ErrorIs(t, err, stor.err)
+
+	// метрика удалена между выборкой и чтением истории
+	stor = newStubStorage(now)
+	delete(stor.history, "Alloc.a")
+	_, err = Query(context.Background(), stor, rollup.DefaultPolicy, "rate(Alloc.a[5m])", now)
+	assert.ErrorContains(t, err, "get history of metric Alloc.a")
+}
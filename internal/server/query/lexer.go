@@ -0,0 +1,85 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind - вид лексемы выражения запроса.
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota // конец выражения
+	tokenIdent                   // идентификатор: имя метрики, функции, метки или длительность
+	tokenString                  // строка в двойных кавычках
+	tokenPunct                   // знак пунктуации или оператор сравнения меток
+)
+
+// token - лексема выражения запроса.
+type token struct {
+	kind tokenKind
+	text string // текст лексемы, у строки - значение без кавычек
+	pos  int    // позиция начала лексемы в выражении
+}
+
+// String - возвращает описание лексемы для сообщений об ошибках.
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// isIdentRune - проверяет, может ли символ входить в идентификатор.
+func isIdentRune(r byte) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' || r == '.'
+}
+
+// lex - разбивает выражение запроса на лексемы.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentRune(c):
+			start := i
+			for i < len(input) && isIdentRune(input[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[start:i], pos: start})
+		case c == '"':
+			start := i
+			i++
+			for i < len(input) && input[i] != '"' {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(input) {
+				return nil, fmt.Errorf("parse error at position %d: unterminated string", start)
+			}
+			i++
+			value, err := strconv.Unquote(input[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("parse error at position %d: invalid string %s", start, input[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: start})
+		case strings.HasPrefix(input[i:], "!=") || strings.HasPrefix(input[i:], "=~") || strings.HasPrefix(input[i:], "!~"):
+			tokens = append(tokens, token{kind: tokenPunct, text: input[i : i+2], pos: i})
+			i += 2
+		case strings.IndexByte("(){}[],=", c) >= 0:
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("parse error at position %d: unexpected character %q", i, c)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
@@ -0,0 +1,235 @@
+package query
+
+import (
+	"fmt"
+)
+
+// parser - рекурсивный нисходящий разборщик выражения запроса.
+//
+// Грамматика:
+//
+//	expr        = aggregation | function | selector
+//	aggregation = aggrOp [grouping] "(" expr ")" [grouping]
+//	grouping    = "by" "(" [label {"," label}] ")"
+//	function    = funcName "(" selector "[" duration "]" ")"
+//	selector    = name ["{" [matcher {"," matcher}] "}"] | "{" matcher {"," matcher} "}"
+//	matcher     = label ("=" | "!=" | "=~" | "!~") string
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse - разбирает выражение запроса.
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return expr, nil
+}
+
+// peek - возвращает текущую лексему.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// peekAt - возвращает лексему со смещением offset от текущей.
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+// next - возвращает текущую лексему и переходит к следующей.
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// errorf - формирует ошибку разбора с позицией лексемы.
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("parse error at position %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+// expect - проверяет, что текущая лексема - знак пунктуации text, и переходит к следующей.
+func (p *parser) expect(text string) error {
+	tok := p.next()
+	if tok.kind != tokenPunct || tok.text != text {
+		return p.errorf(tok, "expected %q, got %s", text, tok)
+	}
+	return nil
+}
+
+// isPunct - проверяет, что лексема - знак пунктуации text.
+func isPunct(tok token, text string) bool {
+	return tok.kind == tokenPunct && tok.text == text
+}
+
+// parseExpr - разбирает выражение.
+func (p *parser) parseExpr() (Expr, error) {
+	tok := p.peek()
+	if tok.kind == tokenIdent {
+		following := p.peekAt(1)
+		if _, ok := aggregations[tok.text]; ok && (isPunct(following, "(") || following.kind == tokenIdent && following.text == "by") {
+			return p.parseAggregation()
+		}
+		if _, ok := rangeFunctions[tok.text]; ok && isPunct(following, "(") {
+			return p.parseFunction()
+		}
+	}
+	return p.parseSelector()
+}
+
+// parseAggregation - разбирает агрегацию.
+func (p *parser) parseAggregation() (Expr, error) {
+	agg := &Aggregation{Op: p.next().text}
+	if tok := p.peek(); tok.kind == tokenIdent && tok.text == "by" {
+		grouping, err := p.parseGrouping()
+		if err != nil {
+			return nil, err
+		}
+		agg.Grouping = grouping
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	agg.Expr = expr
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind == tokenIdent && tok.text == "by" {
+		if agg.Grouping != nil {
+			return nil, p.errorf(tok, "grouping is already specified")
+		}
+		grouping, err := p.parseGrouping()
+		if err != nil {
+			return nil, err
+		}
+		agg.Grouping = grouping
+	}
+	return agg, nil
+}
+
+// parseGrouping - разбирает список меток группировки by(...).
+func (p *parser) parseGrouping() ([]string, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	grouping := []string{}
+	for !isPunct(p.peek(), ")") {
+		if len(grouping) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		tok := p.next()
+		if tok.kind != tokenIdent {
+			return nil, p.errorf(tok, "expected label name, got %s", tok)
+		}
+		grouping = append(grouping, tok.text)
+	}
+	p.next()
+	return grouping, nil
+}
+
+// parseFunction - разбирает функцию над значениями метрик за период.
+func (p *parser) parseFunction() (Expr, error) {
+	fn := &RangeFunction{Func: p.next().text}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	selector, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	fn.Selector = selector
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return nil, p.errorf(tok, "expected duration, got %s", tok)
+	}
+	if fn.Range, err = parseDuration(tok.text); err != nil {
+		return nil, p.errorf(tok, "%s", err)
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+// parseSelector - разбирает выбор метрик по имени и меткам.
+func (p *parser) parseSelector() (*VectorSelector, error) {
+	selector := &VectorSelector{}
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenIdent:
+		selector.Name = p.next().text
+		if !isPunct(p.peek(), "{") {
+			return selector, nil
+		}
+	case !isPunct(tok, "{"):
+		return nil, p.errorf(tok, "expected metric name or label matchers, got %s", tok)
+	}
+
+	p.next()
+	for !isPunct(p.peek(), "}") {
+		if len(selector.Matchers) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		matcher, err := p.parseMatcher()
+		if err != nil {
+			return nil, err
+		}
+		selector.Matchers = append(selector.Matchers, matcher)
+	}
+	end := p.next()
+	if selector.Name == "" && len(selector.Matchers) == 0 {
+		return nil, p.errorf(end, "selector must contain metric name or at least one label matcher")
+	}
+	return selector, nil
+}
+
+// parseMatcher - разбирает условие отбора по метке.
+func (p *parser) parseMatcher() (LabelMatcher, error) {
+	name := p.next()
+	if name.kind != tokenIdent {
+		return LabelMatcher{}, p.errorf(name, "expected label name, got %s", name)
+	}
+	op := p.next()
+	if op.kind != tokenPunct || op.text != "=" && op.text != "!=" && op.text != "=~" && op.text != "!~" {
+		return LabelMatcher{}, p.errorf(op, "expected label match operator, got %s", op)
+	}
+	value := p.next()
+	if value.kind != tokenString {
+		return LabelMatcher{}, p.errorf(value, "expected string, got %s", value)
+	}
+	matcher, err := newLabelMatcher(name.text, MatchOp(op.text), value.text)
+	if err != nil {
+		return matcher, p.errorf(value, "%s", err)
+	}
+	return matcher, nil
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "selector", input: "PollCount", want: "PollCount"},
+		{name: "selector with matchers", input: `Alloc{ host = "a", env!~"dev|test" }`, want: `Alloc{host="a",env!~"dev|test"}`},
+		{name: "matchers only", input: `{__name__=~"Heap.*"}`, want: `{__name__=~"Heap.*"}`},
+		{name: "rate", input: "rate(PollCount[5m])", want: "rate(PollCount[5m])"},
+		{name: "days", input: "max_over_time(Alloc[1d])", want: "max_over_time(Alloc[1d])"},
+		{name: "complex duration", input: "increase(PollCount[1h30m])", want: "increase(PollCount[1h30m])"},
+		{name: "aggregation", input: "max(Alloc)", want: "max(Alloc)"},
+		{name: "grouping before", input: "sum by (host, env) (rate(PollCount[5m]))", want: "sum by(host,env)(rate(PollCount[5m]))"},
+		{name: "grouping after", input: "avg(avg_over_time(Alloc[10m])) by (host)", want: "avg by(host)(avg_over_time(Alloc[10m]))"},
+		{name: "nested aggregation", input: "max(sum by(host)(Alloc))", want: "max(sum by(host)(Alloc))"},
+		{name: "metric named as function", input: "rate", want: "rate"},
+		{name: "dotted name", input: "cpu.usage", want: "cpu.usage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.String())
+
+			// каноническое представление разбирается в то же выражение
+			again, err := Parse(expr.String())
+			require.NoError(t, err)
+			assert.Equal(t, expr.String(), again.String())
+		})
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	expr, err := Parse(`sum by(host)(rate(PollCount{env="prod"}[2m]))`)
+	require.NoError(t, err)
+	agg, ok := expr.(*Aggregation)
+	require.True(t, ok)
+	assert.Equal(t, "sum", agg.Op)
+	assert.Equal(t, []string{"host"}, agg.Grouping)
+
+	fn, ok := agg.Expr.(*RangeFunction)
+	require.True(t, ok)
+	assert.Equal(t, "rate", fn.Func)
+	assert.Equal(t, 2*time.Minute, fn.Range)
+	assert.Equal(t, "PollCount", fn.Selector.Name)
+	require.Len(t, fn.Selector.Matchers, 1)
+	assert.Equal(t, MatchEqual, fn.Selector.Matchers[0].Op)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "empty", input: "", wantErr: "expected metric name"},
+		{name: "range without function", input: "PollCount[5m]", wantErr: `unexpected "["`},
+		{name: "function without range", input: "rate(PollCount)", wantErr: `expected "["`},
+		{name: "invalid duration", input: "rate(PollCount[5x])", wantErr: "invalid duration"},
+		{name: "negative duration", input: "rate(PollCount[0s])", wantErr: "must be positive"},
+		{name: "unclosed aggregation", input: "sum(Alloc", wantErr: `expected ")"`},
+		{name: "double grouping", input: "sum by(a)(Alloc) by(b)", wantErr: "grouping is already specified"},
+		{name: "empty selector", input: "{}", wantErr: "at least one label matcher"},
+		{name: "matcher without string", input: "Alloc{host=a}", wantErr: "expected string"},
+		{name: "invalid regexp", input: `Alloc{host=~"("}`, wantErr: "invalid regular expression"},
+		{name: "unterminated string", input: `Alloc{host="a}`, wantErr: "unterminated string"},
+		{name: "unexpected character", input: "Alloc + 1", wantErr: "unexpected character"},
+		{name: "trailing tokens", input: "Alloc Alloc", wantErr: "position 6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Packet ratelimit implement middlewares for limiting rate of requests per agent and number of concurrent write requests.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/selfmetrics"
+)
+
+// idleBucketTTL - время, после которого неиспользуемые корзины токенов удаляются.
+const idleBucketTTL = 10 * time.Minute
+
+// maxAgentsPerIP - максимальное количество отдельных корзин агентов на один IP-адрес. Идентификатор агента
+// не аутентифицирован, поэтому запросы с остальными идентификаторами расходуют общую корзину IP-адреса,
+// чтобы сменой идентификатора нельзя было обойти ограничение и неограниченно увеличить количество корзин.
+const maxAgentsPerIP = 64
+
+// bucket - корзина токенов одного агента.
+type bucket struct {
+	tokens float64   // количество доступных запросов
+	last   time.Time // время последнего пополнения
+	ip     string    // IP-адрес, к которому относится корзина агента, пустая строка - корзина не относится к агенту
+}
+
+// Limiter - ограничитель частоты запросов по алгоритму token bucket, отдельный для каждого ключа.
+// Корзина каждого ключа пополняется на rate запросов в секунду и вмещает не больше burst запросов.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	agents    map[string]int // количество корзин агентов по IP-адресу
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter - фабричная функция структуры Limiter. burst меньше 1 увеличивается до 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		buckets: make(map[string]*bucket),
+		agents:  make(map[string]int),
+		now:     time.Now,
+	}
+}
+
+// Allow - расходует запрос из корзины ключа key. Если корзина пуста, возвращает false и время до появления запроса в корзине.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	return l.allow(now, key, "")
+}
+
+// AllowClient - расходует запрос из корзины агента id с IP-адреса ip. Если идентификатор не передан или у IP-адреса
+// уже maxAgentsPerIP корзин агентов, расходуется общая корзина IP-адреса. Возвращает ключ израсходованной корзины.
+func (l *Limiter) AllowClient(ip, id string) (bool, time.Duration, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	key := "ip:" + ip
+	if id != "" {
+		agentKey := key + "/id:" + id
+		if _, ok := l.buckets[agentKey]; ok || l.agents[ip] < maxAgentsPerIP {
+			ok, wait := l.allow(now, agentKey, ip)
+			return ok, wait, agentKey
+		}
+	}
+	ok, wait := l.allow(now, key, "")
+	return ok, wait, key
+}
+
+// allow - расходует запрос из корзины ключа key, создавая её при необходимости. ip - IP-адрес корзины агента.
+// Вызывается под блокировкой l.mu.
+func (l *Limiter) allow(now time.Time, key, ip string) (bool, time.Duration) {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now, ip: ip}
+		l.buckets[key] = b
+		if ip != "" {
+			l.agents[ip]++
+		}
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep - не чаще раза в idleBucketTTL удаляет корзины ключей, от которых давно не было запросов. Вызывается под блокировкой l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) < idleBucketTTL {
+			continue
+		}
+		delete(l.buckets, key)
+		if b.ip != "" {
+			if l.agents[b.ip]--; l.agents[b.ip] == 0 {
+				delete(l.agents, b.ip)
+			}
+		}
+	}
+}
+
+// Limits - ограничения частоты запросов от агентов и количества одновременных запросов на запись одного сервера.
+type Limits struct {
+	limiter   atomic.Pointer[Limiter]
+	writeSlot atomic.Pointer[chan struct{}]
+
+	rejectedRequests atomic.Int64
+	rejectedWrites   atomic.Int64
+}
+
+// New - фабричная функция структуры Limits без ограничений.
+func New() *Limits {
+	return &Limits{}
+}
+
+// SetRateLimit - устанавливает ограничение частоты запросов от одного агента: rate запросов в секунду с допустимым всплеском burst.
+// Значение rate 0 снимает ограничение.
+func (ls *Limits) SetRateLimit(rate float64, burst int) {
+	if rate <= 0 {
+		ls.limiter.Store(nil)
+		return
+	}
+	ls.limiter.Store(NewLimiter(rate, burst))
+}
+
+// SetMaxConcurrentWrites - устанавливает максимальное количество одновременно обрабатываемых запросов на запись, 0 - без ограничения.
+func (ls *Limits) SetMaxConcurrentWrites(n int) {
+	if n <= 0 {
+		ls.writeSlot.Store(nil)
+		return
+	}
+	slots := make(chan struct{}, n)
+	ls.writeSlot.Store(&slots)
+}
+
+// ClientIP - возвращает IP-адрес клиента запроса req.
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Middleware - middleware, которое отвечает 429 Too Many Requests с заголовком Retry-After,
+// если агент превысил допустимую частоту запросов.
+func (ls *Limits) Middleware(handler http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		l := ls.limiter.Load()
+		if l == nil {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		ok, wait, key := l.AllowClient(ClientIP(req), req.Header.Get(repositories.AgentIDHeader))
+		if !ok {
+			ls.rejectedRequests.Add(1)
+			logger.FromContext(req.Context()).Debug("request rate limit is exceeded", zap.String("client", key), zap.Duration("retry_after", wait))
+			res.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(res, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// WriteMiddleware - middleware, которое отвечает 503 Service Unavailable с заголовком Retry-After,
+// если сервер уже обрабатывает максимальное количество запросов на запись.
+func (ls *Limits) WriteMiddleware(handler http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		slots := ls.writeSlot.Load()
+		if slots == nil {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		select {
+		case *slots <- struct{}{}:
+			defer func() { <-*slots }()
+			handler.ServeHTTP(res, req)
+		default:
+			ls.rejectedWrites.Add(1)
+			logger.FromContext(req.Context()).Debug("concurrent writes limit is exceeded", zap.String("address", req.URL.String()))
+			res.Header().Set("Retry-After", "1")
+			http.Error(res, "server is busy", http.StatusServiceUnavailable)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// retryAfter - возвращает значение заголовка Retry-After в целых секундах, но не меньше одной секунды.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// Metrics - возвращает количество отклонённых запросов в виде метрик сервера.
+func (ls *Limits) Metrics() []selfmetrics.Metric {
+	return []selfmetrics.Metric{
+		selfmetrics.Counter("ratelimit_rejected_requests", ls.rejectedRequests.Load(), "total number of requests rejected due to request rate limit"),
+		selfmetrics.Counter("ratelimit_rejected_writes", ls.rejectedWrites.Load(), "total number of write requests rejected due to concurrent writes limit"),
+	}
+}
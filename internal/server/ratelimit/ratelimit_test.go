@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	// всплеск ограничен размером корзины
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("agent")
+		require.True(t, ok)
+	}
+	ok, wait := l.Allow("agent")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// корзины разных агентов независимы
+	ok, _ = l.Allow("other")
+	assert.True(t, ok)
+
+	// корзина пополняется со скоростью rate
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent")
+	assert.False(t, ok)
+
+	// корзина не вмещает больше burst запросов
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("agent")
+		require.True(t, ok)
+	}
+	ok, _ = l.Allow("agent")
+	assert.False(t, ok)
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 1)
+	l.now = func() time.Time { return now }
+
+	l.Allow("first")
+	now = now.Add(idleBucketTTL)
+	l.Allow("second")
+	assert.NotContains(t, l.buckets, "first")
+	assert.Contains(t, l.buckets, "second")
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.RemoteAddr = "10.0.0.7:53412"
+	assert.Equal(t, "10.0.0.7", ClientIP(req))
+}
+
+func TestLimiterAllowClient(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 1)
+	l.now = func() time.Time { return now }
+
+	// агенты за одним IP-адресом получают отдельные корзины
+	ok, _, key := l.AllowClient("10.0.0.7", "host-1")
+	assert.True(t, ok)
+	assert.Equal(t, "ip:10.0.0.7/id:host-1", key)
+	ok, _, _ = l.AllowClient("10.0.0.7", "host-1")
+	assert.False(t, ok)
+	ok, _, _ = l.AllowClient("10.0.0.7", "host-2")
+	assert.True(t, ok)
+	ok, _, key = l.AllowClient("10.0.0.7", "")
+	assert.True(t, ok)
+	assert.Equal(t, "ip:10.0.0.7", key)
+
+	// сменой идентификатора нельзя получить больше maxAgentsPerIP корзин
+	for i := 2; i < maxAgentsPerIP; i++ {
+		ok, _, _ = l.AllowClient("10.0.0.7", fmt.Sprintf("host-%d", i+1))
+		require.True(t, ok)
+	}
+	ok, _, key = l.AllowClient("10.0.0.7", "spoofed")
+	assert.False(t, ok)
+	assert.Equal(t, "ip:10.0.0.7", key)
+	assert.Len(t, l.buckets, maxAgentsPerIP+1)
+	// ограничение не затрагивает другие IP-адреса
+	ok, _, _ = l.AllowClient("10.0.0.8", "spoofed")
+	assert.True(t, ok)
+
+	// удалённые корзины освобождают место для новых агентов
+	now = now.Add(idleBucketTTL)
+	ok, _, key = l.AllowClient("10.0.0.7", "spoofed")
+	assert.True(t, ok)
+	assert.Equal(t, "ip:10.0.0.7/id:spoofed", key)
+	assert.Equal(t, map[string]int{"10.0.0.7": 1}, l.agents)
+}
+
+func TestMiddleware(t *testing.T) {
+	ls := New()
+	handler := ls.Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	do := func(agent string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.Header.Set(repositories.AgentIDHeader, agent)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// без ограничения запросы не отклоняются
+	for i := 0; i < 10; i++ {
+		res := do("agent")
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	ls.SetRateLimit(0.5, 2)
+	for i := 0; i < 2; i++ {
+		res := do("agent")
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	res := do("agent")
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+	assert.Equal(t, int64(1), ls.rejectedRequests.Load())
+
+	res = do("other")
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestWriteMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ls := New()
+	handler := ls.WriteMiddleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		res.WriteHeader(http.StatusOK)
+	}))
+	do := func() *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+		return w.Result()
+	}
+
+	ls.SetMaxConcurrentWrites(1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res := do()
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}()
+	<-started
+
+	// пока первый запрос обрабатывается, второй отклоняется
+	res := do()
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	close(release)
+	wg.Wait()
+
+	// после завершения первого запроса место освобождается
+	go func() { <-started }()
+	res = do()
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestMetrics(t *testing.T) {
+	ls := New()
+	ls.rejectedWrites.Add(2)
+	metrics := ls.Metrics()
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "ratelimit_rejected_requests", metrics[0].ID)
+	assert.Equal(t, "ratelimit_rejected_writes", metrics[1].ID)
+	assert.Equal(t, int64(2), *metrics[1].Delta)
+}
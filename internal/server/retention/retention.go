@@ -0,0 +1,61 @@
+// Packet retention implement removing of metrics which were not updated for a long time.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+const (
+	minCheckInterval = time.Second // минимальный интервал проверки устаревших метрик
+	maxCheckInterval = time.Minute // максимальный интервал проверки устаревших метрик
+)
+
+// Expire - удаляет метрики, которые не обновлялись дольше ttl, и возвращает их количество.
+func Expire(ctx context.Context, stor repositories.MetricsDeleter, ttl time.Duration) (int, error) {
+	return stor.DeleteStaleMetrics(ctx, time.Now().Add(-ttl))
+}
+
+// CheckInterval - возвращает интервал проверки устаревших метрик для заданного ttl.
+// Метрика удаляется не позже чем через ttl плюс десятую часть ttl после последнего обновления.
+func CheckInterval(ttl time.Duration) time.Duration {
+	interval := ttl / 10
+	if interval < minCheckInterval {
+		return minCheckInterval
+	}
+	if interval > maxCheckInterval {
+		return maxCheckInterval
+	}
+	return interval
+}
+
+// Run - периодически удаляет устаревшие метрики до отмены контекста. При ttl <= 0 метрики не удаляются.
+func Run(ctx context.Context, stor repositories.MetricsDeleter, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	logger.FromContext(ctx).Debug("starting expiring of stale metrics", zap.Duration("ttl", ttl))
+
+	ticker := time.NewTicker(CheckInterval(ttl))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := Expire(ctx, stor, ttl)
+			if err != nil {
+				logger.FromContext(ctx).Error("expire stale metrics error", zap.String("error", error.Error(err)))
+				continue
+			}
+			if deleted > 0 {
+				logger.FromContext(ctx).Info("stale metrics expired", zap.Int("count", deleted))
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestCheckInterval(t *testing.T) {
+	assert.Equal(t, time.Second, CheckInterval(time.Second))
+	assert.Equal(t, 30*time.Second, CheckInterval(5*time.Minute))
+	assert.Equal(t, time.Minute, CheckInterval(24*time.Hour))
+}
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+
+	// метрика обновлялась недавно
+	deleted, err := Expire(ctx, stor, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+
+	// отрицательный ttl делает устаревшими все метрики
+	deleted, err = Expire(ctx, stor, -time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stor := storage.NewDefaultMemStorage()
+
+	// при нулевом ttl функция сразу завершается
+	Run(ctx, stor, 0)
+
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, stor, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run is not stopped after context cancel")
+	}
+}
@@ -0,0 +1,353 @@
+// Packet rollup implement downsampling of metric history into rollup tiers (raw, 1m, 1h),
+// background compaction with per-tier retention and reading of history from the appropriate tier.
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Длительности интервалов уровней истории.
+const (
+	Raw    time.Duration = 0           // исходные значения метрик
+	Minute time.Duration = time.Minute // агрегаты за минуту
+	Hour   time.Duration = time.Hour   // агрегаты за час
+)
+
+// CompactInterval - интервал запуска сжатия истории.
+const CompactInterval = time.Minute
+
+// resolutions - уровни истории в порядке увеличения длительности интервала.
+var resolutions = []time.Duration{Raw, Minute, Hour}
+
+// Policy - время хранения каждого уровня истории, 0 - без ограничения.
+type Policy struct {
+	Raw    time.Duration // время хранения исходных значений
+	Minute time.Duration // время хранения минутных агрегатов
+	Hour   time.Duration // время хранения часовых агрегатов
+}
+
+// DefaultPolicy - время хранения уровней истории по умолчанию.
+var DefaultPolicy = Policy{
+	Raw:    24 * time.Hour,
+	Minute: 7 * 24 * time.Hour,
+	Hour:   365 * 24 * time.Hour,
+}
+
+// Retention - время хранения уровней истории сервера, которое можно изменить во время работы.
+type Retention struct {
+	mu     sync.RWMutex
+	policy Policy
+}
+
+// NewRetention - фабричная функция структуры Retention.
+func NewRetention(p Policy) *Retention {
+	return &Retention{policy: p}
+}
+
+// SetPolicy - устанавливает время хранения уровней истории.
+func (r *Retention) SetPolicy(p Policy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = p
+}
+
+// GetPolicy - возвращает время хранения уровней истории.
+func (r *Retention) GetPolicy() Policy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policy
+}
+
+// Retention - возвращает время хранения уровня истории с длительностью интервала resolution.
+func (p Policy) Retention(resolution time.Duration) time.Duration {
+	switch resolution {
+	case Raw:
+		return p.Raw
+	case Minute:
+		return p.Minute
+	case Hour:
+		return p.Hour
+	}
+	return 0
+}
+
+// Validate - проверяет время хранения уровней. Значения уровня должны храниться дольше интервала следующего уровня,
+// иначе они будут удалены до того, как попадут в агрегат.
+func (p Policy) Validate() error {
+	for i, resolution := range resolutions {
+		retention := p.Retention(resolution)
+		if retention < 0 {
+			return fmt.Errorf("retention of %s tier must not be negative, got %s", FormatResolution(resolution), retention)
+		}
+		if retention == 0 || i == len(resolutions)-1 {
+			continue
+		}
+		if next := resolutions[i+1]; retention < 2*next {
+			return fmt.Errorf("retention of %s tier must be at least %s, got %s", FormatResolution(resolution), 2*next, retention)
+		}
+	}
+	return nil
+}
+
+// Select - выбирает уровень истории с наименьшей длительностью интервала, который ещё хранит значения за момент from.
+func (p Policy) Select(from, now time.Time) time.Duration {
+	for _, resolution := range resolutions {
+		retention := p.Retention(resolution)
+		if retention == 0 || !from.Before(now.Add(-retention)) {
+			return resolution
+		}
+	}
+	return resolutions[len(resolutions)-1]
+}
+
+// ParseResolution - разбирает название уровня истории: raw, 1m или 1h.
+func ParseResolution(value string) (time.Duration, error) {
+	for _, resolution := range resolutions {
+		if value == FormatResolution(resolution) {
+			return resolution, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown resolution %s, expected raw, 1m or 1h", value)
+}
+
+// FormatResolution - возвращает название уровня истории.
+func FormatResolution(resolution time.Duration) string {
+	switch resolution {
+	case Raw:
+		return "raw"
+	case Minute:
+		return "1m"
+	case Hour:
+		return "1h"
+	}
+	return resolution.String()
+}
+
+// finer - возвращает уровень, из которого строятся агрегаты уровня resolution.
+func finer(resolution time.Duration) time.Duration {
+	if resolution == Hour {
+		return Minute
+	}
+	return Raw
+}
+
+// FromSamples - представляет исходные значения метрики агрегатами из одного значения.
+// Delta считается от предыдущего значения, для первого значения - от prev, если он задан.
+func FromSamples(samples []repositories.Sample, prev *float64) []repositories.Rollup {
+	rollups := make([]repositories.Rollup, len(samples))
+	for i, s := range samples {
+		var delta float64
+		switch {
+		case i > 0:
+			delta = counterDelta(samples[i-1].Value, s.Value)
+		case prev != nil:
+			delta = counterDelta(*prev, s.Value)
+		}
+		rollups[i] = repositories.Rollup{Time: s.Time, Min: s.Value, Max: s.Value, Sum: s.Value, Count: 1, Last: s.Value, Delta: delta}
+	}
+	return rollups
+}
+
+// counterDelta - возвращает приращение счётчика. Уменьшение значения считается сбросом счётчика.
+func counterDelta(prev, value float64) float64 {
+	if value < prev {
+		return value
+	}
+	return value - prev
+}
+
+// Downsample - объединяет упорядоченные по времени агрегаты в агрегаты с длительностью интервала resolution.
+func Downsample(source []repositories.Rollup, resolution time.Duration) []repositories.Rollup {
+	var result []repositories.Rollup
+	for _, r := range source {
+		bucket := r.Time.Truncate(resolution)
+		if n := len(result); n > 0 && result[n-1].Time.Equal(bucket) {
+			last := &result[n-1]
+			last.Min = min(last.Min, r.Min)
+			last.Max = max(last.Max, r.Max)
+			last.Sum += r.Sum
+			last.Count += r.Count
+			last.Last = r.Last
+			last.Delta += r.Delta
+			continue
+		}
+		r.Time = bucket
+		result = append(result, r)
+	}
+	return result
+}
+
+// Reader - хранилище истории значений метрик и их агрегатов.
+type Reader interface {
+	repositories.HistoryReader
+	repositories.RollupReader
+}
+
+// Read - возвращает историю метрики за период [from, to] на уровне resolution.
+// Интервалы, которые ещё не сжаты в агрегаты уровня, вычисляются из более подробного уровня.
+func Read(ctx context.Context, stor Reader, name string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	return read(ctx, stor, name, resolution, from, to, nil)
+}
+
+// ReadAuto - возвращает историю метрики за период [from, to] на уровне, выбранном по времени хранения уровней p.
+func ReadAuto(ctx context.Context, stor Reader, p Policy, name string, from, to time.Time) (time.Duration, []repositories.Rollup, error) {
+	resolution := p.Select(from, time.Now())
+	rollups, err := Read(ctx, stor, name, resolution, from, to)
+	return resolution, rollups, err
+}
+
+// read - возвращает историю метрики на уровне resolution. prev - последнее значение счётчика перед from, если известно.
+func read(ctx context.Context, stor Reader, name string, resolution time.Duration, from, to time.Time, prev *float64) ([]repositories.Rollup, error) {
+	if resolution == Raw {
+		samples, err := stor.GetHistory(ctx, name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		return FromSamples(samples, prev), nil
+	}
+
+	// интервал, в который попадает from, возвращается целиком
+	rollups, err := stor.GetRollups(ctx, name, resolution, from.Truncate(resolution), to)
+	if err != nil {
+		return nil, err
+	}
+	tailFrom := from
+	if n := len(rollups); n > 0 {
+		tailFrom = rollups[n-1].Time.Add(resolution)
+		prev = &rollups[n-1].Last
+	}
+	if tailFrom.After(to) {
+		return rollups, nil
+	}
+	tail, err := read(ctx, stor, name, finer(resolution), tailFrom, to, prev)
+	if err != nil {
+		return nil, err
+	}
+	return append(rollups, Downsample(tail, resolution)...), nil
+}
+
+// Storage - хранилище, историю метрик которого сжимает Compact.
+type Storage interface {
+	ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error)
+	Reader
+	repositories.RollupWriter
+}
+
+// Compact - строит агрегаты завершившихся к моменту now интервалов из более подробного уровня истории
+// и удаляет значения и агрегаты старше времени хранения их уровня.
+// Возвращает количество добавленных агрегатов и удалённых значений и агрегатов.
+func Compact(ctx context.Context, stor Storage, p Policy, now time.Time) (int, int, error) {
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("list metrics: %w", err)
+	}
+
+	var errs []error
+	added := 0
+	for _, metric := range metrics {
+		for _, resolution := range resolutions[1:] {
+			n, err := compactMetric(ctx, stor, metric.ID, resolution, now)
+			if err != nil {
+				// метрика могла быть удалена во время сжатия, остальные метрики сжимаются
+				errs = append(errs, fmt.Errorf("compact %s tier of metric %s: %w", FormatResolution(resolution), metric.ID, err))
+				break
+			}
+			added += n
+		}
+	}
+
+	deleted := 0
+	for _, resolution := range resolutions {
+		retention := p.Retention(resolution)
+		if retention == 0 {
+			continue
+		}
+		n, err := stor.DeleteHistoryBefore(ctx, resolution, now.Add(-retention))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete %s tier history: %w", FormatResolution(resolution), err))
+			continue
+		}
+		deleted += n
+	}
+	return added, deleted, errors.Join(errs...)
+}
+
+// compactMetric - строит агрегаты метрики уровня resolution, начиная с интервала после последнего сохранённого агрегата.
+func compactMetric(ctx context.Context, stor Storage, name string, resolution time.Duration, now time.Time) (int, error) {
+	end := now.Truncate(resolution)
+	source := finer(resolution)
+
+	last, ok, err := stor.GetLastRollup(ctx, name, resolution)
+	if err != nil {
+		return 0, err
+	}
+	var from time.Time
+	var prev *float64
+	if ok {
+		from = last.Time.Add(resolution)
+		prev = &last.Last
+	}
+	if !from.Before(end) {
+		return 0, nil
+	}
+
+	var values []repositories.Rollup
+	if source == Raw {
+		samples, err := stor.GetHistory(ctx, name, from, end)
+		if err != nil {
+			return 0, err
+		}
+		values = FromSamples(samples, prev)
+	} else {
+		values, err = stor.GetRollups(ctx, name, source, from, end)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// в агрегаты попадают только завершившиеся интервалы
+	closed := values[:0]
+	for _, v := range values {
+		if v.Time.Before(end) {
+			closed = append(closed, v)
+		}
+	}
+
+	rollups := Downsample(closed, resolution)
+	if len(rollups) == 0 {
+		return 0, nil
+	}
+	return len(rollups), stor.AddRollups(ctx, name, resolution, rollups)
+}
+
+// Run - периодически сжимает историю метрик до отмены контекста. Время хранения уровней берётся из retention при каждом сжатии.
+func Run(ctx context.Context, stor Storage, retention *Retention) {
+	p := retention.GetPolicy()
+	logger.FromContext(ctx).Debug("starting compaction of metrics history",
+		zap.Duration("raw_retention", p.Raw), zap.Duration("rollup_1m_retention", p.Minute), zap.Duration("rollup_1h_retention", p.Hour))
+
+	ticker := time.NewTicker(CompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			added, deleted, err := Compact(ctx, stor, retention.GetPolicy(), time.Now())
+			if err != nil {
+				logger.FromContext(ctx).Error("compact metrics history error", zap.String("error", error.Error(err)))
+			}
+			if added > 0 || deleted > 0 {
+				logger.FromContext(ctx).Debug("metrics history compacted", zap.Int("added", added), zap.Int("deleted", deleted))
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// stubStorage - хранилище истории с заданным временем значений.
+type stubStorage struct {
+	history map[string][]repositories.Sample
+	rollups map[time.Duration]map[string][]repositories.Rollup
+}
+
+func newStubStorage() *stubStorage {
+	return &stubStorage{
+		history: make(map[string][]repositories.Sample),
+		rollups: make(map[time.Duration]map[string][]repositories.Rollup),
+	}
+}
+
+func (s *stubStorage) ListMetrics(context.Context, repositories.MetricsFilter) ([]repositories.Metric, error) {
+	var metrics []repositories.Metric
+	for name := range s.history {
+		metrics = append(metrics, repositories.Metric{ID: name, MType: "counter"})
+	}
+	repositories.SortMetrics(metrics)
+	return metrics, nil
+}
+
+func (s *stubStorage) GetHistory(_ context.Context, name string, from, to time.Time) ([]repositories.Sample, error) {
+	samples, ok := s.history[name]
+	if !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	result := make([]repositories.Sample, 0)
+	for _, sample := range samples {
+		if !sample.Time.Before(from) && !sample.Time.After(to) {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubStorage) GetRollups(_ context.Context, name string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	if _, ok := s.history[name]; !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	result := make([]repositories.Rollup, 0)
+	for _, r := range s.rollups[resolution][name] {
+		if !r.Time.Before(from) && !r.Time.After(to) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubStorage) GetLastRollup(_ context.Context, name string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	if _, ok := s.history[name]; !ok {
+		return repositories.Rollup{}, false, fmt.Errorf("metric %s not found", name)
+	}
+	rollups := s.rollups[resolution][name]
+	if len(rollups) == 0 {
+		return repositories.Rollup{}, false, nil
+	}
+	return rollups[len(rollups)-1], true, nil
+}
+
+func (s *stubStorage) AddRollups(_ context.Context, name string, resolution time.Duration, rollups []repositories.Rollup) error {
+	if s.rollups[resolution] == nil {
+		s.rollups[resolution] = make(map[string][]repositories.Rollup)
+	}
+	stored := s.rollups[resolution][name]
+	for _, r := range rollups {
+		replaced := false
+		for i := range stored {
+			if stored[i].Time.Equal(r.Time) {
+				stored[i], replaced = r, true
+			}
+		}
+		if !replaced {
+			stored = append(stored, r)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Time.Before(stored[j].Time) })
+	s.rollups[resolution][name] = stored
+	return nil
+}
+
+func (s *stubStorage) DeleteHistoryBefore(_ context.Context, resolution time.Duration, before time.Time) (int, error) {
+	deleted := 0
+	if resolution == Raw {
+		for name, samples := range s.history {
+			kept := make([]repositories.Sample, 0, len(samples))
+			for _, sample := range samples {
+				if sample.Time.Before(before) {
+					deleted++
+					continue
+				}
+				kept = append(kept, sample)
+			}
+			s.history[name] = kept
+		}
+		return deleted, nil
+	}
+	for name, rollups := range s.rollups[resolution] {
+		kept := make([]repositories.Rollup, 0, len(rollups))
+		for _, r := range rollups {
+			if r.Time.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		s.rollups[resolution][name] = kept
+	}
+	return deleted, nil
+}
+
+// add - добавляет значения метрики с интервалом step, начиная с момента start.
+func (s *stubStorage) add(name string, start time.Time, step time.Duration, values ...float64) {
+	for i, v := range values {
+		s.history[name] = append(s.history[name], repositories.Sample{Time: start.Add(time.Duration(i) * step), Value: v})
+	}
+}
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFromSamplesAndDownsample(t *testing.T) {
+	samples := []repositories.Sample{
+		{Time: t0, Value: 10},
+		{Time: t0.Add(30 * time.Second), Value: 20},
+		{Time: t0.Add(60 * time.Second), Value: 5}, // сброс счётчика
+		{Time: t0.Add(90 * time.Second), Value: 15},
+	}
+	prev := 4.0
+	raw := FromSamples(samples, &prev)
+	require.Len(t, raw, 4)
+	assert.Equal(t, []float64{6, 10, 5, 10}, []float64{raw[0].Delta, raw[1].Delta, raw[2].Delta, raw[3].Delta})
+	assert.Equal(t, 0.0, FromSamples(samples, nil)[0].Delta)
+
+	minutes := Downsample(raw, Minute)
+	assert.Equal(t, []repositories.Rollup{
+		{Time: t0, Min: 10, Max: 20, Sum: 30, Count: 2, Last: 20, Delta: 16},
+		{Time: t0.Add(time.Minute), Min: 5, Max: 15, Sum: 20, Count: 2, Last: 15, Delta: 15},
+	}, minutes)
+	assert.Equal(t, 15.0, minutes[0].Avg())
+
+	hours := Downsample(minutes, Hour)
+	assert.Equal(t, []repositories.Rollup{{Time: t0, Min: 5, Max: 20, Sum: 50, Count: 4, Last: 15, Delta: 31}}, hours)
+	assert.Empty(t, Downsample(nil, Hour))
+}
+
+func TestPolicy(t *testing.T) {
+	assert.NoError(t, DefaultPolicy.Validate())
+	assert.NoError(t, Policy{}.Validate())
+	assert.Error(t, Policy{Raw: time.Minute}.Validate())
+	assert.Error(t, Policy{Minute: time.Hour}.Validate())
+	assert.Error(t, Policy{Hour: -time.Hour}.Validate())
+
+	p := Policy{Raw: time.Hour, Minute: 24 * time.Hour}
+	now := t0
+	assert.Equal(t, Raw, p.Select(now.Add(-30*time.Minute), now))
+	assert.Equal(t, Raw, p.Select(now.Add(-time.Hour), now))
+	assert.Equal(t, Minute, p.Select(now.Add(-2*time.Hour), now))
+	assert.Equal(t, Hour, p.Select(now.Add(-48*time.Hour), now))
+	assert.Equal(t, Raw, Policy{}.Select(now.Add(-48*time.Hour), now))
+	assert.Equal(t, Hour, Policy{Raw: time.Hour, Minute: 3 * time.Hour, Hour: 24 * time.Hour}.Select(now.Add(-48*time.Hour), now))
+
+	for _, name := range []string{"raw", "1m", "1h"} {
+		resolution, err := ParseResolution(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, FormatResolution(resolution))
+	}
+	_, err := ParseResolution("5m")
+	assert.Error(t, err)
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	stor := newStubStorage()
+	// значение счётчика каждые 20 секунд в течение трёх минут
+	stor.add("PollCount", t0, 20*time.Second, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	p := Policy{Raw: 10 * time.Minute, Minute: 3 * time.Hour}
+
+	added, deleted, err := Compact(ctx, stor, p, t0.Add(2*time.Minute+30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 0, deleted)
+	assert.Equal(t, []repositories.Rollup{
+		{Time: t0, Min: 1, Max: 3, Sum: 6, Count: 3, Last: 3, Delta: 2},
+		{Time: t0.Add(time.Minute), Min: 4, Max: 6, Sum: 15, Count: 3, Last: 6, Delta: 3},
+	}, stor.rollups[Minute]["PollCount"])
+
+	// повторное сжатие не меняет агрегаты
+	added, _, err = Compact(ctx, stor, p, t0.Add(2*time.Minute+40*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+
+	// продолжение сжатия учитывает приращение от последнего агрегата, завершившийся час сжимается в часовой агрегат,
+	// а устаревшие исходные значения удаляются
+	stor.add("PollCount", t0.Add(40*time.Minute), time.Minute, 20)
+	added, deleted, err = Compact(ctx, stor, p, t0.Add(61*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+	assert.Equal(t, 10, deleted)
+	minutes := stor.rollups[Minute]["PollCount"]
+	require.Len(t, minutes, 4)
+	assert.Equal(t, repositories.Rollup{Time: t0.Add(2 * time.Minute), Min: 7, Max: 9, Sum: 24, Count: 3, Last: 9, Delta: 3}, minutes[2])
+	assert.Equal(t, repositories.Rollup{Time: t0.Add(40 * time.Minute), Min: 20, Max: 20, Sum: 20, Count: 1, Last: 20, Delta: 11}, minutes[3])
+	assert.Equal(t, []repositories.Rollup{{Time: t0, Min: 1, Max: 20, Sum: 65, Count: 10, Last: 20, Delta: 19}}, stor.rollups[Hour]["PollCount"])
+	assert.Empty(t, stor.history["PollCount"])
+
+	// агрегаты старше времени хранения уровня удаляются
+	_, deleted, err = Compact(ctx, stor, p, t0.Add(4*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+	assert.Empty(t, stor.rollups[Minute]["PollCount"])
+	assert.Len(t, stor.rollups[Hour]["PollCount"], 1)
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	stor := newStubStorage()
+	stor.add("PollCount", t0, 30*time.Second, 1, 2, 3, 4, 5, 6)
+	_, _, err := Compact(ctx, stor, Policy{}, t0.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, stor.rollups[Minute]["PollCount"], 2)
+
+	// последний интервал ещё не сжат и вычисляется из исходных значений
+	rollups, err := Read(ctx, stor, "PollCount", Minute, t0.Add(30*time.Second), t0.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{
+		{Time: t0, Min: 1, Max: 2, Sum: 3, Count: 2, Last: 2, Delta: 1},
+		{Time: t0.Add(time.Minute), Min: 3, Max: 4, Sum: 7, Count: 2, Last: 4, Delta: 2},
+		{Time: t0.Add(2 * time.Minute), Min: 5, Max: 6, Sum: 11, Count: 2, Last: 6, Delta: 2},
+	}, rollups)
+
+	// часовой уровень собирается из минутных агрегатов и исходных значений
+	rollups, err = Read(ctx, stor, "PollCount", Hour, t0, t0.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{{Time: t0, Min: 1, Max: 6, Sum: 21, Count: 6, Last: 6, Delta: 5}}, rollups)
+
+	raw, err := Read(ctx, stor, "PollCount", Raw, t0, t0.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, raw, 3)
+
+	_, err = Read(ctx, stor, "unknown", Minute, t0, t0.Add(time.Minute))
+	assert.Error(t, err)
+}
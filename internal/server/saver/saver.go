@@ -6,61 +6,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"time"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
 )
 
-// Global variable -------------------------------------------------
-var (
-	storeInterval   time.Duration
-	fileStoragePath string
-	restore         bool
-)
-
-// SetStoreInterval - устанавливает переменну storeInterval.
-func SetStoreInterval(interval time.Duration) {
-	storeInterval = interval
-}
-
-// GetStoreInterval - возвращает переменну storeInterval.
-func GetStoreInterval() time.Duration {
-	return storeInterval
-}
-
-// SetFilestoragePath - устанавливает переменну fileStoragePath.
-func SetFilestoragePath(path string) {
-	fileStoragePath = path
-}
-
-// GetFilestoragePath - возвращает переменну fileStoragePath.
-func GetFilestoragePath() string {
-	return fileStoragePath
-}
-
-// SetRestore - устанавливает переменну restore.
-func SetRestore(r bool) {
-	restore = r
-}
-
-// GetRestore - возвращает переменну restore.
-func GetRestore() bool {
-	return restore
-}
-
-// end Global variable -------------------------------------------------
-
 // FileWriter - интерфейс записи метрик.
 type FileWriter interface {
-	WriteMetrics(repositories.MetricsReader) error // Метод записи.
+	WriteMetrics(context.Context, repositories.MetricsReader) error   // Метод записи.
+	WriteMetadata(context.Context, repositories.MetadataReader) error // Метод записи реестра метаданных.
 }
 
 // FileReader - интерфейс чтения метрик.
 type FileReader interface {
-	ReadMetrics() ([]repositories.Metric, error) // Метод чтения.
+	ReadMetrics() ([]repositories.Metric, error)    // Метод чтения.
+	ReadMetadata() ([]repositories.Metadata, error) // Метод чтения реестра метаданных.
+}
+
+// MetadataFileName - возвращает имя файла, в котором хранится реестр метаданных метрик из файла filename.
+func MetadataFileName(filename string) string {
+	return filename + ".metadata"
 }
 
 // SaverWriter --------------------------------------------------------------------------------------------------
@@ -94,21 +62,23 @@ func (storage *Writer) Close() error {
 	return storage.file.Close()
 }
 
-// WriteMetrics - сохраняю метрики из сервера в файл, причем предыдущее содержимое файла удаляю
-func (storage *Writer) WriteMetrics(metrics repositories.MetricsReader) error {
-	metricsSlice, err := metrics.GetAllMetricsSlice(context.Background())
+// WriteMetrics - сохраняю метрики из сервера в файл, причем предыдущее содержимое файла удаляю.
+// Если контекст отменён до начала записи, содержимое файла не изменяется.
+func (storage *Writer) WriteMetrics(ctx context.Context, metrics repositories.MetricsReader) error {
+	metricsSlice, err := metrics.GetAllMetricsSlice(ctx)
 	if err != nil {
 		return err
 	}
-	if len(metricsSlice) == 0 {
-		return nil
-	}
+	// пустой слайс тоже записывается, чтобы удаление метрик из хранилища сохранялось в файле
 
 	var metricsJSON bytes.Buffer
 	enc := json.NewEncoder(&metricsJSON)
 	if err := enc.Encode(metricsSlice); err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// Закрываем текущий writer и файл
 	if err := storage.Close(); err != nil {
@@ -135,10 +105,32 @@ func (storage *Writer) WriteMetrics(metrics repositories.MetricsReader) error {
 		return err
 	}
 
-	logger.ServerLog.Info("write metrics to file")
+	logger.FromContext(ctx).Info("write metrics to file")
 	return nil
 }
 
+// WriteMetadata - сохраняю реестр метаданных метрик в отдельный файл рядом с файлом метрик.
+func (storage *Writer) WriteMetadata(ctx context.Context, metadata repositories.MetadataReader) error {
+	metadataSlice, err := metadata.GetAllMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(metadataSlice)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// записываю во временный файл и переименовываю его, чтобы не оставить реестр в частично записанном состоянии
+	tmpName := MetadataFileName(storage.filename) + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, MetadataFileName(storage.filename))
+}
+
 // Reader --------------------------------------------------------------------------------------------------
 
 // Reader - реализация интерфейса FileReader.
@@ -187,16 +179,46 @@ func (saver *Reader) ReadMetrics() ([]repositories.Metric, error) {
 	return metrics, nil
 }
 
-// AddMetricsFromFile - функция для загрузки метрик из файла в сервер.
-func AddMetricsFromFile(stor repositories.MetricsWriter, reader FileReader) error {
-	if GetRestore() {
-		metrics, err := reader.ReadMetrics()
-		if err != nil {
-			return err
+// ReadMetadata - метод для чтения реестра метаданных метрик из файла.
+// Отсутствие файла не является ошибкой: реестр мог ещё не сохраняться.
+func (saver *Reader) ReadMetadata() ([]repositories.Metadata, error) {
+	data, err := os.ReadFile(MetadataFileName(saver.file.Name()))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
 		}
-		if err := stor.AddMetricsFromSlice(context.Background(), metrics); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	metadata := make([]repositories.Metadata, 0)
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// AddMetadataFromFile - функция для загрузки реестра метаданных метрик из файла в сервер.
+func AddMetadataFromFile(ctx context.Context, stor repositories.MetadataWriter, reader FileReader) error {
+	metadata, err := reader.ReadMetadata()
+	if err != nil {
+		return err
+	}
+	for _, meta := range metadata {
+		if err := stor.SetMetadata(ctx, meta); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// AddMetricsFromFile - функция для загрузки метрик из файла в сервер.
+func AddMetricsFromFile(ctx context.Context, stor repositories.MetricsWriter, reader FileReader) error {
+	metrics, err := reader.ReadMetrics()
+	if err != nil {
+		return err
+	}
+	return stor.AddMetricsFromSlice(ctx, metrics)
+}
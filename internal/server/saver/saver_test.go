@@ -1,44 +1,141 @@
 package saver
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
 )
 
-func TestSetStoreInterval(t *testing.T) {
-	storeInterval = 12
-	newStoreInterval := 23
-	SetStoreInterval(time.Duration(newStoreInterval))
-	assert.Equal(t, time.Duration(newStoreInterval), storeInterval)
+func TestMetadataFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+	ctx := context.Background()
+
+	// файла с метаданными ещё нет
+	reader, err := NewReader(filename)
+	require.NoError(t, err)
+	metadata, err := reader.ReadMetadata()
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+
+	source := storage.NewDefaultMemStorage()
+	require.NoError(t, source.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, source.SetMetadata(ctx, repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes"}))
+
+	writer, err := NewWriter(filename)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetadata(ctx, source))
+	require.NoError(t, writer.Close())
+
+	// загружаю реестр метаданных в новое хранилище
+	target := storage.NewDefaultMemStorage()
+	require.NoError(t, AddMetadataFromFile(ctx, target, reader))
+
+	got, err := target.GetMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes"}, got)
 }
 
-func TestGetStoreInterval(t *testing.T) {
-	storeInterval = 46
-	assert.Equal(t, storeInterval, GetStoreInterval())
+func TestWriteDeletedMetrics(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+	ctx := context.Background()
+
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+
+	writer, err := NewWriter(filename)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetrics(ctx, stor))
+
+	// удаление последней метрики тоже сохраняется в файл
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetrics(ctx, stor))
+	require.NoError(t, writer.Close())
+
+	reader, err := NewReader(filename)
+	require.NoError(t, err)
+	metrics, err := reader.ReadMetrics()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
 }
 
-func TestSetFilestoragePath(t *testing.T) {
-	fileStoragePath = "/init/path"
-	newStoragePath := "/new/storage/path"
-	SetFilestoragePath(newStoragePath)
-	assert.Equal(t, newStoragePath, fileStoragePath)
+// slowStorage - хранилище, которое отвечает с задержкой delay или при отмене контекста запроса.
+type slowStorage struct {
+	repositories.IStorage
+	delay time.Duration
 }
 
-func TestGetFilestoragePath(t *testing.T) {
-	fileStoragePath = "/secong/storage/path"
-	assert.Equal(t, fileStoragePath, GetFilestoragePath())
+// wait - ожидает задержку хранилища или отмену контекста.
+func (s slowStorage) wait(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func TestSetRestore(t *testing.T) {
-	restore = true
-	newRestoreValue := false
-	SetRestore(newRestoreValue)
-	assert.Equal(t, newRestoreValue, restore)
+func (s slowStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.IStorage.GetAllMetricsSlice(ctx)
 }
 
-func TestGetRestore(t *testing.T) {
-	restore = true
-	assert.Equal(t, true, restore)
+func (s slowStorage) GetAllMetadata(ctx context.Context) ([]repositories.Metadata, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.IStorage.GetAllMetadata(ctx)
+}
+
+func (s slowStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.IStorage.AddMetricsFromSlice(ctx, metrics)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+	slow := slowStorage{IStorage: stor, delay: time.Second}
+
+	writer, err := NewWriter(filename)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetrics(context.Background(), stor))
+
+	// хранилище не успевает ответить, и файл остаётся без изменений
+	require.NoError(t, stor.AddGauge(context.Background(), "HeapAlloc", 2))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = writer.WriteMetrics(ctx, slow)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	err = writer.WriteMetadata(ctx, slow)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), slow.delay)
+	require.NoError(t, writer.Close())
+
+	reader, err := NewReader(filename)
+	require.NoError(t, err)
+	metrics, err := reader.ReadMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "Alloc", metrics[0].ID)
+
+	// загрузка метрик из файла тоже прерывается по истечении времени
+	reader, err = NewReader(filename)
+	require.NoError(t, err)
+	err = AddMetricsFromFile(ctx, slowStorage{IStorage: storage.NewDefaultMemStorage(), delay: time.Second}, reader)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
 }
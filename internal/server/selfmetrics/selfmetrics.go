@@ -0,0 +1,83 @@
+// Packet selfmetrics implement registry of metrics describing state of the server itself.
+package selfmetrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Metric - метрика сервера вместе с её метаданными.
+type Metric struct {
+	repositories.Metric
+	Meta repositories.Metadata
+}
+
+// Collector - функция, возвращающая текущие значения метрик одного компонента сервера.
+type Collector func() []Metric
+
+// Registry - реестр сборщиков метрик компонентов одного сервера.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry - фабричная функция структуры Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register - регистрирует сборщик метрик компонента name. Повторная регистрация заменяет сборщик.
+func (r *Registry) Register(name string, collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[name] = collector
+}
+
+// Unregister - удаляет сборщик метрик компонента name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.collectors, name)
+}
+
+// Collect - возвращает метрики всех зарегистрированных компонентов, отсортированные по имени. Пустой реестр nil
+// не содержит метрик.
+func (r *Registry) Collect() []Metric {
+	if r == nil {
+		return []Metric{}
+	}
+	r.mu.Lock()
+	registered := make([]Collector, 0, len(r.collectors))
+	for _, collector := range r.collectors {
+		registered = append(registered, collector)
+	}
+	r.mu.Unlock()
+
+	// сборщики вызываются без блокировки, чтобы медленный сборщик не мешал регистрации
+	result := make([]Metric, 0)
+	for _, collector := range registered {
+		result = append(result, collector()...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Gauge - возвращает метрику сервера типа gauge.
+func Gauge(name string, value float64, description string) Metric {
+	return Metric{
+		Metric: repositories.Metric{ID: name, MType: "gauge", Value: &value},
+		Meta:   repositories.Metadata{ID: name, MType: "gauge", Description: description},
+	}
+}
+
+// Counter - возвращает метрику сервера типа counter.
+func Counter(name string, value int64, description string) Metric {
+	return Metric{
+		Metric: repositories.Metric{ID: name, MType: "counter", Delta: &value},
+		Meta:   repositories.Metadata{ID: name, MType: "counter", Description: description},
+	}
+}
@@ -0,0 +1,38 @@
+package selfmetrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	r := NewRegistry()
+	r.Register("second", func() []Metric {
+		return []Metric{Counter("b_total", 3, "second component")}
+	})
+	r.Register("first", func() []Metric {
+		return []Metric{Gauge("c_value", 1.5, ""), Gauge("a_value", 2, "first component")}
+	})
+
+	metrics := r.Collect()
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "a_value", metrics[0].ID)
+	assert.Equal(t, 2.0, *metrics[0].Value)
+	assert.Equal(t, "first component", metrics[0].Meta.Description)
+	assert.Equal(t, "b_total", metrics[1].ID)
+	assert.Equal(t, "counter", metrics[1].MType)
+	assert.Equal(t, int64(3), *metrics[1].Delta)
+	assert.Equal(t, "c_value", metrics[2].ID)
+
+	// повторная регистрация заменяет сборщик
+	r.Register("second", func() []Metric { return nil })
+	assert.Len(t, r.Collect(), 2)
+
+	r.Unregister("first")
+	assert.Empty(t, r.Collect())
+
+	var empty *Registry
+	assert.Empty(t, empty.Collect())
+}
@@ -3,162 +3,782 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/maphash"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
 // Хранилище метрик ------------------------------------------------------------------------------------
 
+// shardCount - количество шардов хранилища. Метрики распределяются по шардам по хешу имени,
+// поэтому запись разных метрик блокирует только свои шарды.
+const shardCount = 64
+
+// historySize - максимальное количество значений в истории одной метрики.
+const historySize = 720
+
 // MemStorage - реализует интерфейс repositories.ServerRepo, для возможности использования структуры в качестве хранилища метрик.
+// Метрики хранятся в шардах, каждый со своей блокировкой RWMutex. Полный обход хранилища читает неизменяемые снимки шардов
+// без блокировки, снимок шарда сбрасывается при записи и пересоздаётся при следующем чтении.
 type MemStorage struct {
-	sync.Mutex
-	gauges   map[string]float64
-	counters map[string]int64
+	seed   maphash.Seed
+	shards [shardCount]shard
+}
+
+// shard - часть хранилища с метриками, имена которых попадают в шард по хешу.
+type shard struct {
+	sync.RWMutex
+	entries  map[string]*entry
+	snapshot atomic.Pointer[[]snapshotMetric] // снимок значений метрик шарда, nil после записи
+}
+
+// entry - данные одной метрики. Запись существует, пока у метрики есть метаданные или значение.
+type entry struct {
+	meta      repositories.Metadata
+	mtype     string // тип хранимого значения, пустая строка, если у метрики есть только метаданные
+	gauge     float64
+	counter   int64
+	histogram repositories.Histogram
+	updated   time.Time                               // время последнего обновления метрики
+	history   []repositories.Sample                   // история значений метрики, не более historySize значений
+	rollups   map[time.Duration][]repositories.Rollup // агрегаты истории по длительности интервала
+}
+
+// snapshotMetric - значение метрики в снимке шарда вместе с метками из реестра метаданных.
+type snapshotMetric struct {
+	metric repositories.Metric
+	labels map[string]string
 }
 
 // NewDefaultMemStorage - фабричная функция для создания структуры MemStorage с параметрами по умолчанию.
 func NewDefaultMemStorage() *MemStorage {
-	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
+	storage := &MemStorage{seed: maphash.MakeSeed()}
+	for i := range storage.shards {
+		storage.shards[i].entries = make(map[string]*entry)
 	}
+	return storage
 }
 
 // NewDefaultMemStorage - фабричная функция для создания структуры MemStorage с принятыми параметрами.
 func NewMemStorage(gaugesArg map[string]float64, countersArg map[string]int64) *MemStorage {
-	if gaugesArg == nil {
-		gaugesArg = make(map[string]float64)
+	storage := NewDefaultMemStorage()
+	// регистрирую в реестре типы переданных метрик
+	now := time.Now()
+	for name, value := range gaugesArg {
+		storage.shard(name).entries[name] = &entry{
+			meta:    repositories.Metadata{ID: name, MType: "gauge"},
+			mtype:   "gauge",
+			gauge:   value,
+			updated: now,
+		}
+	}
+	for name, value := range countersArg {
+		storage.shard(name).entries[name] = &entry{
+			meta:    repositories.Metadata{ID: name, MType: "counter"},
+			mtype:   "counter",
+			counter: value,
+			updated: now,
+		}
+	}
+	return storage
+}
+
+// shardIndex - возвращает номер шарда метрики.
+func (storage *MemStorage) shardIndex(name string) int {
+	return int(maphash.String(storage.seed, name) % shardCount)
+}
+
+// shard - возвращает шард метрики.
+func (storage *MemStorage) shard(name string) *shard {
+	return &storage.shards[storage.shardIndex(name)]
+}
+
+// metric - возвращает хранимое значение метрики.
+func (e *entry) metric(name string) repositories.Metric {
+	metric := repositories.Metric{ID: name, MType: e.mtype}
+	switch e.mtype {
+	case "gauge":
+		value := e.gauge
+		metric.Value = &value
+	case "counter":
+		delta := e.counter
+		metric.Delta = &delta
+	case "histogram":
+		histogram := e.histogram
+		metric.Histogram = &histogram
+	}
+	return metric
+}
+
+// registerType - проверяет, что тип метрики совпадает с зарегистрированным в реестре метаданных.
+// Метрика, которой нет в реестре, регистрируется с переданным типом. Вызывается под блокировкой шарда.
+func (s *shard) registerType(name, mtype string) (*entry, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		e = &entry{meta: repositories.Metadata{ID: name, MType: mtype}}
+		s.entries[name] = e
+		return e, nil
+	}
+	if e.meta.MType != mtype {
+		return nil, repositories.TypeConflictError(name, e.meta.MType, mtype)
+	}
+	return e, nil
+}
+
+// stored - возвращает метрику, у которой есть хранимое значение. Вызывается под блокировкой шарда.
+func (s *shard) stored(name string) (*entry, bool) {
+	e, ok := s.entries[name]
+	if !ok || e.mtype == "" {
+		return nil, false
+	}
+	return e, true
+}
+
+// invalidate - сбрасывает снимок шарда после записи. Вызывается под блокировкой шарда на запись.
+func (s *shard) invalidate() {
+	s.snapshot.Store(nil)
+}
+
+// metrics - возвращает снимок значений метрик шарда. Снимок не изменяется после создания,
+// поэтому при отсутствии записей в шард чтение обходится без блокировки.
+func (s *shard) metrics() []snapshotMetric {
+	if snapshot := s.snapshot.Load(); snapshot != nil {
+		return *snapshot
+	}
+	s.RLock()
+	defer s.RUnlock()
+
+	snapshot := make([]snapshotMetric, 0, len(s.entries))
+	for name, e := range s.entries {
+		if e.mtype == "" {
+			continue
+		}
+		metric := e.metric(name)
+		updated := e.updated
+		metric.UpdatedAt = &updated
+		snapshot = append(snapshot, snapshotMetric{metric: metric, labels: e.meta.Labels})
+	}
+	// снимок сохраняется под блокировкой на чтение, поэтому запись в шард не может произойти между созданием и сохранением
+	s.snapshot.Store(&snapshot)
+	return snapshot
+}
+
+// touch - запоминает время обновления метрики и добавляет новое значение в историю.
+// Вызывается под блокировкой шарда.
+func (e *entry) touch(value float64) {
+	now := time.Now()
+	e.updated = now
+	samples := append(e.history, repositories.Sample{Time: now, Value: value})
+	if len(samples) > historySize {
+		// при следующих добавлениях append перенесёт хвост в новый массив, поэтому память не растёт
+		samples = samples[len(samples)-historySize:]
+	}
+	e.history = samples
+}
+
+// GetHistory - реализует метод GetHistory интерфейса repositories.HistoryReader.
+func (storage *MemStorage) GetHistory(ctx context.Context, name string, from, to time.Time) ([]repositories.Sample, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := storage.shard(name)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.stored(name)
+	if !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	result := make([]repositories.Sample, 0)
+	for _, sample := range e.history {
+		if !sample.Time.Before(from) && !sample.Time.After(to) {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+// GetRollups - реализует метод GetRollups интерфейса repositories.RollupReader.
+func (storage *MemStorage) GetRollups(ctx context.Context, name string, resolution time.Duration, from, to time.Time) ([]repositories.Rollup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := storage.shard(name)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.stored(name)
+	if !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
 	}
-	if countersArg == nil {
-		countersArg = make(map[string]int64)
+	result := make([]repositories.Rollup, 0)
+	for _, rollup := range e.rollups[resolution] {
+		if !rollup.Time.Before(from) && !rollup.Time.After(to) {
+			result = append(result, rollup)
+		}
+	}
+	return result, nil
+}
+
+// GetLastRollup - реализует метод GetLastRollup интерфейса repositories.RollupReader.
+func (storage *MemStorage) GetLastRollup(ctx context.Context, name string, resolution time.Duration) (repositories.Rollup, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return repositories.Rollup{}, false, err
+	}
+	s := storage.shard(name)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.stored(name)
+	if !ok {
+		return repositories.Rollup{}, false, fmt.Errorf("metric %s not found", name)
 	}
-	return &MemStorage{
-		gauges:   gaugesArg,
-		counters: countersArg,
+	rollups := e.rollups[resolution]
+	if len(rollups) == 0 {
+		return repositories.Rollup{}, false, nil
 	}
+	return rollups[len(rollups)-1], true, nil
+}
+
+// AddRollups - реализует метод AddRollups интерфейса repositories.RollupWriter.
+func (storage *MemStorage) AddRollups(ctx context.Context, name string, resolution time.Duration, rollups []repositories.Rollup) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if resolution <= 0 {
+		return fmt.Errorf("invalid rollup resolution %s", resolution)
+	}
+	s := storage.shard(name)
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.stored(name)
+	if !ok {
+		return fmt.Errorf("metric %s not found", name)
+	}
+	if e.rollups == nil {
+		e.rollups = make(map[time.Duration][]repositories.Rollup)
+	}
+
+	// объединяю агрегаты по началу интервала, новые агрегаты заменяют хранимые
+	byTime := make(map[time.Time]repositories.Rollup)
+	for _, rollup := range e.rollups[resolution] {
+		byTime[rollup.Time] = rollup
+	}
+	for _, rollup := range rollups {
+		byTime[rollup.Time] = rollup
+	}
+	merged := make([]repositories.Rollup, 0, len(byTime))
+	for _, rollup := range byTime {
+		merged = append(merged, rollup)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+	e.rollups[resolution] = merged
+	return nil
+}
+
+// DeleteHistoryBefore - реализует метод DeleteHistoryBefore интерфейса repositories.RollupWriter.
+func (storage *MemStorage) DeleteHistoryBefore(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i := range storage.shards {
+		s := &storage.shards[i]
+		s.Lock()
+		for _, e := range s.entries {
+			if resolution == 0 {
+				samples := e.history
+				start := sort.Search(len(samples), func(i int) bool {
+					return !samples[i].Time.Before(before)
+				})
+				deleted += start
+				e.history = samples[start:]
+				continue
+			}
+			rollups := e.rollups[resolution]
+			start := sort.Search(len(rollups), func(i int) bool {
+				return !rollups[i].Time.Before(before)
+			})
+			deleted += start
+			if start > 0 {
+				e.rollups[resolution] = rollups[start:]
+			}
+		}
+		s.Unlock()
+	}
+	return deleted, nil
 }
 
 // AddGauge - реализует метод AddGauge интерфейса repositories.ServerRepo.
 func (storage *MemStorage) AddGauge(ctx context.Context, name string, guage float64) error {
-	storage.Mutex.Lock()
-	defer storage.Mutex.Unlock()
-	storage.gauges[name] = guage
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := storage.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	return s.addGauge(name, guage)
+}
+
+// addGauge - записывает значение gauge. Вызывается под блокировкой шарда.
+func (s *shard) addGauge(name string, guage float64) error {
+	e, err := s.registerType(name, "gauge")
+	if err != nil {
+		return err
+	}
+	e.mtype = "gauge"
+	e.gauge = guage
+	e.touch(guage)
+	s.invalidate()
 	return nil
 }
 
 // AddCounter - реализует метод AddCounter интерфейса repositories.ServerRepo.
 func (storage *MemStorage) AddCounter(ctx context.Context, name string, counter int64) error {
-	storage.Mutex.Lock()
-	defer storage.Mutex.Unlock()
-	storage.counters[name] += counter
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := storage.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	return s.addCounter(name, counter)
+}
+
+// addCounter - прибавляет значение к counter. Вызывается под блокировкой шарда.
+func (s *shard) addCounter(name string, counter int64) error {
+	e, err := s.registerType(name, "counter")
+	if err != nil {
+		return err
+	}
+	e.mtype = "counter"
+	e.counter += counter
+	e.touch(float64(e.counter))
+	s.invalidate()
+	return nil
+}
+
+// AddHistogram - реализует метод AddHistogram интерфейса repositories.ServerRepo.
+func (storage *MemStorage) AddHistogram(ctx context.Context, name string, histogram repositories.Histogram) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := storage.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	return s.addHistogram(name, histogram)
+}
+
+// mergeHistogram - возвращает результат объединения гистограммы с хранимой гистограммой метрики.
+// Вызывается под блокировкой шарда.
+func (s *shard) mergeHistogram(name string, histogram repositories.Histogram) (repositories.Histogram, error) {
+	if err := histogram.Validate(); err != nil {
+		return repositories.Histogram{}, err
+	}
+	stored := repositories.NewHistogram(histogram.Bounds)
+	if e, ok := s.stored(name); ok && e.mtype == "histogram" {
+		stored = e.histogram
+	}
+	merged, err := stored.Merge(histogram)
+	if err != nil {
+		return repositories.Histogram{}, fmt.Errorf("merge histogram %s error: %w", name, err)
+	}
+	return merged, nil
+}
+
+// addHistogram - объединяет гистограмму с хранимой. Вызывается под блокировкой шарда.
+func (s *shard) addHistogram(name string, histogram repositories.Histogram) error {
+	merged, err := s.mergeHistogram(name, histogram)
+	if err != nil {
+		return err
+	}
+	e, err := s.registerType(name, "histogram")
+	if err != nil {
+		return err
+	}
+	e.mtype = "histogram"
+	e.histogram = merged
+	e.touch(float64(merged.Count))
+	s.invalidate()
 	return nil
 }
 
+// GetHistogram - реализует метод GetHistogram интерфейса repositories.ServerRepo.
+func (storage *MemStorage) GetHistogram(ctx context.Context, name string) (repositories.Histogram, error) {
+	if err := ctx.Err(); err != nil {
+		return repositories.Histogram{}, err
+	}
+	s := storage.shard(name)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.stored(name)
+	if !ok || e.mtype != "histogram" {
+		return repositories.Histogram{}, fmt.Errorf("metric %s of type histogram not found", name)
+	}
+	return e.histogram, nil
+}
+
 // GetMetric - реализует метод GetMetric интерфейса repositories.ServerRepo.
 func (storage *MemStorage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
-	storage.Mutex.Lock()
-	defer storage.Mutex.Unlock()
-
-	if metricType == "gauge" {
-		val, ok := storage.gauges[name]
-		if !ok {
-			return "", fmt.Errorf("metric %s of type gauge not found", name)
-		}
-		return fmt.Sprintf("%g", val), nil
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if metricType != "gauge" && metricType != "counter" && metricType != "histogram" {
+		return "", fmt.Errorf("whrong type of metric")
 	}
+	s := storage.shard(name)
+	s.RLock()
+	e, ok := s.stored(name)
+	if !ok || e.mtype != metricType {
+		s.RUnlock()
+		return "", fmt.Errorf("metric %s of type %s not found", name, metricType)
+	}
+	metric := e.metric(name)
+	s.RUnlock()
 
-	if metricType == "counter" {
-		val, ok := storage.counters[name]
-		if !ok {
-			return "", fmt.Errorf("metric %s of type counter not found", name)
-		}
-		return fmt.Sprintf("%d", val), nil
+	switch metricType {
+	case "gauge":
+		return fmt.Sprintf("%g", *metric.Value), nil
+	case "counter":
+		return fmt.Sprintf("%d", *metric.Delta), nil
 	}
-	return "", fmt.Errorf("whrong type of metric")
+	data, err := json.Marshal(metric.Histogram)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.ServerRepo.
 func (storage *MemStorage) GetAllMetrics(ctx context.Context) (string, error) {
-	storage.Mutex.Lock()
-	defer storage.Mutex.Unlock()
+	metrics, err := storage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return "", err
+	}
+	return repositories.FormatMetrics(metrics), nil
+}
 
-	var result string
-	for name, val := range storage.gauges {
-		result += fmt.Sprintf("%s: %g\n", name, val)
+// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.ServerRepo.
+func (storage *MemStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	metrics := make([]repositories.Metric, 0)
+	for i := range storage.shards {
+		for _, snapshot := range storage.shards[i].metrics() {
+			metric := copyMetric(snapshot.metric)
+			metric.UpdatedAt = nil
+			metrics = append(metrics, metric)
+		}
+	}
+	repositories.SortMetrics(metrics)
+	return metrics, nil
+}
+
+// copyMetric - возвращает копию метрики из снимка, чтобы изменение результата не затрагивало снимок.
+func copyMetric(metric repositories.Metric) repositories.Metric {
+	if metric.Value != nil {
+		value := *metric.Value
+		metric.Value = &value
+	}
+	if metric.Delta != nil {
+		delta := *metric.Delta
+		metric.Delta = &delta
+	}
+	if metric.Histogram != nil {
+		histogram := *metric.Histogram
+		histogram.Counts = append([]uint64(nil), histogram.Counts...)
+		metric.Histogram = &histogram
 	}
+	if metric.UpdatedAt != nil {
+		updated := *metric.UpdatedAt
+		metric.UpdatedAt = &updated
+	}
+	return metric
+}
 
-	for name, val := range storage.counters {
-		result += fmt.Sprintf("%s: %d\n", name, val)
+// filterMetrics - возвращает отсортированные по имени метрики, удовлетворяющие условиям выборки
+// без учёта курсора и лимита. Метрики читаются из снимков шардов.
+func (storage *MemStorage) filterMetrics(filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	match, err := filter.Matcher()
+	if err != nil {
+		return nil, err
 	}
+	result := make([]repositories.Metric, 0)
+	for i := range storage.shards {
+		for _, snapshot := range storage.shards[i].metrics() {
+			if match(snapshot.metric, snapshot.labels) {
+				result = append(result, copyMetric(snapshot.metric))
+			}
+		}
+	}
+	repositories.SortMetrics(result)
 	return result, nil
 }
 
-// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.ServerRepo.
-func (storage *MemStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
-	storage.Mutex.Lock()
-	defer storage.Mutex.Unlock()
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+func (storage *MemStorage) ListMetrics(ctx context.Context, filter repositories.MetricsFilter) ([]repositories.Metric, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	metrics, err := storage.filterMetrics(filter)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(metrics), nil
+}
 
-	result := make([]repositories.Metric, 0)
-	for name, value := range storage.gauges {
-		metric := repositories.Metric{
-			ID:    name,
-			MType: "gauge",
-			Value: &value,
+// CountMetrics - реализует метод CountMetrics интерфейса repositories.MetricsReader.
+func (storage *MemStorage) CountMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	metrics, err := storage.filterMetrics(filter)
+	if err != nil {
+		return 0, err
+	}
+	return len(metrics), nil
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+// Шарды обрабатываются по очереди, условия выборки проверяются под блокировкой шарда.
+func (storage *MemStorage) DeleteMetrics(ctx context.Context, filter repositories.MetricsFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	match, err := filter.Matcher()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i := range storage.shards {
+		s := &storage.shards[i]
+		s.Lock()
+		for name, e := range s.entries {
+			if e.mtype != "" && match(e.metric(name), e.meta.Labels) {
+				delete(s.entries, name)
+				deleted++
+			}
 		}
-		result = append(result, metric)
+		s.invalidate()
+		s.Unlock()
+	}
+	return deleted, nil
+}
+
+// DeleteStaleMetrics - реализует метод DeleteStaleMetrics интерфейса repositories.MetricsDeleter.
+func (storage *MemStorage) DeleteStaleMetrics(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
-	for name, delta := range storage.counters {
-		metric := repositories.Metric{
-			ID:    name,
-			MType: "counter",
-			Delta: &delta,
+	deleted := 0
+	for i := range storage.shards {
+		s := &storage.shards[i]
+		s.Lock()
+		for name, e := range s.entries {
+			if !e.updated.IsZero() && e.updated.Before(before) {
+				delete(s.entries, name)
+				deleted++
+			}
 		}
-		result = append(result, metric)
+		s.invalidate()
+		s.Unlock()
 	}
-	return result, nil
+	return deleted, nil
 }
 
 // AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.ServerRepo.
+// Шарды метрик батча блокируются в порядке возрастания номера, поэтому одновременные батчи не взаимоблокируются,
+// а при ошибке не записывается ни одна метрика.
 func (storage *MemStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if metrics == nil {
 		return nil
 	}
+	var locked [shardCount]bool
+	for _, metric := range metrics {
+		locked[storage.shardIndex(metric.ID)] = true
+	}
+	for i := range storage.shards {
+		if locked[i] {
+			storage.shards[i].Lock()
+			defer storage.shards[i].Unlock()
+		}
+	}
+
+	// проверяю все метрики до записи, чтобы некорректная метрика не приводила к частичной записи батча
+	if err := storage.checkMetrics(metrics); err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		s := storage.shard(metric.ID)
+		var err error
+		switch metric.MType {
+		case "gauge":
+			err = s.addGauge(metric.ID, *metric.Value)
+		case "counter":
+			err = s.addCounter(metric.ID, *metric.Delta)
+		case "histogram":
+			err = s.addHistogram(metric.ID, *metric.Histogram)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// checkMetrics - проверяет, что метрики батча корректны, их типы не конфликтуют с реестром метаданных и между собой,
+// а гистограммы объединяются с хранимыми. Вызывается под блокировкой шардов метрик батча.
+func (storage *MemStorage) checkMetrics(metrics []repositories.Metric) error {
+	types := make(map[string]string, len(metrics))
+	histograms := make(map[string]repositories.Histogram)
 	for _, metric := range metrics {
-		if metric.MType == "gauge" {
+		switch metric.MType {
+		case "gauge":
 			if metric.Value == nil {
 				return fmt.Errorf("invalid metric, value of gauge metric is nil")
 			}
-			err := storage.AddGauge(ctx, metric.ID, *metric.Value)
-			if err != nil {
-				return fmt.Errorf("add gauge error: %f", err)
-			}
-		} else if metric.MType == "counter" {
+		case "counter":
 			if metric.Delta == nil {
 				return fmt.Errorf("invalid metric, delta of counter metric is nil")
 			}
-			err := storage.AddCounter(ctx, metric.ID, *metric.Delta)
-			if err != nil {
-				return fmt.Errorf("add counter error: %f", err)
+		case "histogram":
+			if metric.Histogram == nil {
+				return fmt.Errorf("invalid metric, histogram of histogram metric is nil")
 			}
-		} else {
+		default:
 			return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
 		}
+
+		s := storage.shard(metric.ID)
+		registered, ok := types[metric.ID]
+		if !ok {
+			registered = metric.MType
+			if e, found := s.entries[metric.ID]; found {
+				registered = e.meta.MType
+			}
+			types[metric.ID] = registered
+		}
+		if registered != metric.MType {
+			return repositories.TypeConflictError(metric.ID, registered, metric.MType)
+		}
+
+		if metric.MType == "histogram" {
+			if err := metric.Histogram.Validate(); err != nil {
+				return err
+			}
+			// гистограмма может встречаться в батче несколько раз, поэтому объединяю с уже проверенными
+			stored, ok := histograms[metric.ID]
+			if !ok {
+				var e *entry
+				if e, ok = s.stored(metric.ID); ok {
+					stored = e.histogram
+				}
+			}
+			if !ok {
+				stored = repositories.NewHistogram(metric.Histogram.Bounds)
+			}
+			merged, err := stored.Merge(*metric.Histogram)
+			if err != nil {
+				return fmt.Errorf("merge histogram %s error: %w", metric.ID, err)
+			}
+			histograms[metric.ID] = merged
+		}
+	}
+	return nil
+}
+
+// GetMetadata - реализует метод GetMetadata интерфейса repositories.MetadataReader.
+func (storage *MemStorage) GetMetadata(ctx context.Context, name string) (repositories.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return repositories.Metadata{}, err
+	}
+	s := storage.shard(name)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return repositories.Metadata{}, fmt.Errorf("metadata of metric %s not found", name)
+	}
+	return e.meta, nil
+}
+
+// GetAllMetadata - реализует метод GetAllMetadata интерфейса repositories.MetadataReader.
+func (storage *MemStorage) GetAllMetadata(ctx context.Context) ([]repositories.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]repositories.Metadata, 0)
+	for i := range storage.shards {
+		s := &storage.shards[i]
+		s.RLock()
+		for _, e := range s.entries {
+			result = append(result, e.meta)
+		}
+		s.RUnlock()
 	}
+	repositories.SortMetadata(result)
+	return result, nil
+}
+
+// SetMetadata - реализует метод SetMetadata интерфейса repositories.MetadataWriter.
+// Тип метрики нельзя изменить, если в хранилище уже есть значения метрики другого типа.
+func (storage *MemStorage) SetMetadata(ctx context.Context, meta repositories.Metadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+
+	s := storage.shard(meta.ID)
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.entries[meta.ID]
+	if !ok {
+		s.entries[meta.ID] = &entry{meta: meta}
+		return nil
+	}
+	if e.mtype != "" && e.mtype != meta.MType {
+		return repositories.TypeConflictError(meta.ID, e.mtype, meta.MType)
+	}
+	e.meta = meta
+	// метки метрики входят в снимок шарда
+	s.invalidate()
 	return nil
 }
 
 // MemStorage_Bootstrap - реализует метод Bootstrap интерфейса repositories.ServerRepo.
 func (storage *MemStorage) Bootstrap(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Clean - очищает хранилище от данных.
 func (storage *MemStorage) Clean(ctx context.Context) {
-	storage.counters = map[string]int64{}
-	storage.gauges = map[string]float64{}
+	for i := range storage.shards {
+		s := &storage.shards[i]
+		s.Lock()
+		s.entries = make(map[string]*entry)
+		s.invalidate()
+		s.Unlock()
+	}
 }
 
 // Хранилище метрик -----------------------------------------------------------------------------------------
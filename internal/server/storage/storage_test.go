@@ -4,21 +4,64 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
 )
 
+func TestMemStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.IStorage {
+		return NewDefaultMemStorage()
+	})
+}
+
+// values - значения метрик типа gauge и counter в хранилище.
+type values struct {
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+// storedValues - возвращает значения метрик типа gauge и counter, хранимые в шардах хранилища.
+func storedValues(stor *MemStorage) values {
+	result := values{gauges: map[string]float64{}, counters: map[string]int64{}}
+	for i := range stor.shards {
+		for name, e := range stor.shards[i].entries {
+			switch e.mtype {
+			case "gauge":
+				result.gauges[name] = e.gauge
+			case "counter":
+				result.counters[name] = e.counter
+			}
+		}
+	}
+	return result
+}
+
+// setUpdated - устанавливает время последнего обновления метрики.
+func setUpdated(stor *MemStorage, name string, updated time.Time) {
+	s := stor.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	s.entries[name].updated = updated
+	s.invalidate()
+}
+
 func TestNewDefaultMemStorage(t *testing.T) {
 
 	tests := []struct {
 		name string
-		want *MemStorage
+		want values
 	}{
 		{
 			name: "Default test #1",
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{},
 				counters: map[string]int64{},
 			},
@@ -26,11 +69,11 @@ func TestNewDefaultMemStorage(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewDefaultMemStorage(); !reflect.DeepEqual(got.counters, tt.want.counters) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", got.counters, tt.want.counters)
+			if got := NewDefaultMemStorage(); !reflect.DeepEqual(storedValues(got).counters, tt.want.counters) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(got).counters, tt.want.counters)
 			}
-			if got := NewDefaultMemStorage(); !reflect.DeepEqual(got.gauges, tt.want.gauges) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", got.gauges, tt.want.gauges)
+			if got := NewDefaultMemStorage(); !reflect.DeepEqual(storedValues(got).gauges, tt.want.gauges) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(got).gauges, tt.want.gauges)
 			}
 		})
 	}
@@ -45,7 +88,7 @@ func TestNewMemStorage(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want *MemStorage
+		want values
 	}{
 		{
 			name: "Args function is nil",
@@ -53,7 +96,7 @@ func TestNewMemStorage(t *testing.T) {
 				gaugesArg:   nil,
 				countersArg: nil,
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{},
 				counters: map[string]int64{},
 			},
@@ -64,7 +107,7 @@ func TestNewMemStorage(t *testing.T) {
 				gaugesArg:   map[string]float64{"gauge1": 1.14},
 				countersArg: map[string]int64{"counter1": 5},
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{"gauge1": 1.14},
 				counters: map[string]int64{"counter1": 5},
 			},
@@ -75,7 +118,7 @@ func TestNewMemStorage(t *testing.T) {
 				gaugesArg:   nil,
 				countersArg: map[string]int64{"counter1": 5},
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{},
 				counters: map[string]int64{"counter1": 5},
 			},
@@ -86,7 +129,7 @@ func TestNewMemStorage(t *testing.T) {
 				gaugesArg:   map[string]float64{"gauge1": 1.14},
 				countersArg: nil,
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{"gauge1": 1.14},
 				counters: map[string]int64{},
 			},
@@ -94,11 +137,11 @@ func TestNewMemStorage(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewMemStorage(tt.args.gaugesArg, tt.args.countersArg); !reflect.DeepEqual(got.counters, tt.want.counters) {
-				t.Errorf("NewMemStorage() = %v, want %v", got.counters, tt.want.counters)
+			if got := NewMemStorage(tt.args.gaugesArg, tt.args.countersArg); !reflect.DeepEqual(storedValues(got).counters, tt.want.counters) {
+				t.Errorf("NewMemStorage() = %v, want %v", storedValues(got).counters, tt.want.counters)
 			}
-			if got := NewMemStorage(tt.args.gaugesArg, tt.args.countersArg); !reflect.DeepEqual(got.gauges, tt.want.gauges) {
-				t.Errorf("NewMemStorage() = %v, want %v", got.gauges, tt.want.gauges)
+			if got := NewMemStorage(tt.args.gaugesArg, tt.args.countersArg); !reflect.DeepEqual(storedValues(got).gauges, tt.want.gauges) {
+				t.Errorf("NewMemStorage() = %v, want %v", storedValues(got).gauges, tt.want.gauges)
 			}
 		})
 	}
@@ -113,19 +156,16 @@ func TestMemStorageAddGauge(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want *MemStorage
+		want values
 	}{
 		{
 			name: "Add test #1",
 			args: args{
-				stor: &MemStorage{
-					gauges:   map[string]float64{"gauge1": 1.14},
-					counters: map[string]int64{"counter1": 5},
-				},
+				stor:  NewMemStorage(map[string]float64{"gauge1": 1.14}, map[string]int64{"counter1": 5}),
 				name:  "gauge2",
 				value: 3.14,
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{"gauge1": 1.14, "gauge2": 3.14},
 				counters: map[string]int64{"counter1": 5},
 			},
@@ -135,11 +175,11 @@ func TestMemStorageAddGauge(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.args.stor.AddGauge(context.Background(), tt.args.name, tt.args.value)
 			require.NoError(t, err)
-			if !reflect.DeepEqual(tt.args.stor.counters, tt.want.counters) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", tt.args.stor.counters, tt.want.counters)
+			if !reflect.DeepEqual(storedValues(tt.args.stor).counters, tt.want.counters) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(tt.args.stor).counters, tt.want.counters)
 			}
-			if !reflect.DeepEqual(tt.args.stor.gauges, tt.want.gauges) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", tt.args.stor.gauges, tt.want.gauges)
+			if !reflect.DeepEqual(storedValues(tt.args.stor).gauges, tt.want.gauges) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(tt.args.stor).gauges, tt.want.gauges)
 			}
 		})
 	}
@@ -154,19 +194,16 @@ func TestMemStorageAddCounter(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want *MemStorage
+		want values
 	}{
 		{
 			name: "Add test #1",
 			args: args{
-				stor: &MemStorage{
-					gauges:   map[string]float64{"gauge1": 1.14},
-					counters: map[string]int64{"counter1": 5},
-				},
+				stor:  NewMemStorage(map[string]float64{"gauge1": 1.14}, map[string]int64{"counter1": 5}),
 				name:  "counter2",
 				value: 6,
 			},
-			want: &MemStorage{
+			want: values{
 				gauges:   map[string]float64{"gauge1": 1.14},
 				counters: map[string]int64{"counter1": 5, "counter2": 6},
 			},
@@ -176,11 +213,11 @@ func TestMemStorageAddCounter(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.args.stor.AddCounter(context.Background(), tt.args.name, tt.args.value)
 			require.NoError(t, err)
-			if !reflect.DeepEqual(tt.args.stor.counters, tt.want.counters) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", tt.args.stor.counters, tt.want.counters)
+			if !reflect.DeepEqual(storedValues(tt.args.stor).counters, tt.want.counters) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(tt.args.stor).counters, tt.want.counters)
 			}
-			if !reflect.DeepEqual(tt.args.stor.gauges, tt.want.gauges) {
-				t.Errorf("NewDefaultMemStorage() = %v, want %v", tt.args.stor.gauges, tt.want.gauges)
+			if !reflect.DeepEqual(storedValues(tt.args.stor).gauges, tt.want.gauges) {
+				t.Errorf("NewDefaultMemStorage() = %v, want %v", storedValues(tt.args.stor).gauges, tt.want.gauges)
 			}
 		})
 	}
@@ -270,10 +307,7 @@ func TestMemStorageGetMetric(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			storage := &MemStorage{
-				gauges:   tt.fields.gauges,
-				counters: tt.fields.counters,
-			}
+			storage := NewMemStorage(tt.fields.gauges, tt.fields.counters)
 			got, err := storage.GetMetric(context.Background(), tt.args.metricType, tt.args.name)
 			if !tt.wantErr {
 				assert.NoError(t, err)
@@ -299,15 +333,20 @@ func TestMemStorageGetAllMetrics(t *testing.T) {
 				gauges:   map[string]float64{"gauge1": 17.77},
 				counters: map[string]int64{},
 			},
-			want: "gauge1: 17.77\n",
+			want: "type: gauge, name: gauge1, value: 17.77\n",
+		},
+		{
+			name: "Correct get metrics #2",
+			fields: fields{
+				gauges:   map[string]float64{"gauge1": 17.77, "Alloc": 2},
+				counters: map[string]int64{"PollCount": 5},
+			},
+			want: "type: gauge, name: Alloc, value: 2\ntype: counter, name: PollCount, value: 5\ntype: gauge, name: gauge1, value: 17.77\n",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			storage := &MemStorage{
-				gauges:   tt.fields.gauges,
-				counters: tt.fields.counters,
-			}
+			storage := NewMemStorage(tt.fields.gauges, tt.fields.counters)
 			res, err := storage.GetAllMetrics(context.Background())
 			require.NoError(t, err)
 			assert.Equal(t, tt.want, res)
@@ -337,3 +376,446 @@ func TestMemStorage_Clean(t *testing.T) {
 	_, err = stor.GetMetric(ctx, "gauge", "first gauge")
 	require.Error(t, err)
 }
+
+func TestMemStorageAddHistogram(t *testing.T) {
+	stor := NewDefaultMemStorage()
+	ctx := context.Background()
+
+	err := stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 10, Count: 3})
+	require.NoError(t, err)
+	err = stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 4, 1}, Sum: 12.5, Count: 5})
+	require.NoError(t, err)
+
+	got, err := stor.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, repositories.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 4, 3}, Sum: 22.5, Count: 8}, got)
+
+	value, err := stor.GetMetric(ctx, "histogram", "latency")
+	require.NoError(t, err)
+	assert.Equal(t, `{"bounds":[1,2],"counts":[1,4,3],"sum":22.5,"count":8}`, value)
+
+	// гистограмму с другими границами бакетов объединить нельзя
+	err = stor.AddHistogram(ctx, "latency", repositories.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{0, 0, 0}})
+	require.ErrorIs(t, err, repositories.ErrHistogramBoundsMismatch)
+
+	// некорректная гистограмма
+	err = stor.AddHistogram(ctx, "broken", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1})
+	require.Error(t, err)
+
+	_, err = stor.GetHistogram(ctx, "unknown")
+	require.Error(t, err)
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "histogram", metrics[0].MType)
+	assert.Equal(t, &got, metrics[0].Histogram)
+
+	// гистограммы из слайса метрик объединяются с хранимыми
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "latency", MType: "histogram", Histogram: &repositories.Histogram{
+		Bounds: []float64{1, 2}, Counts: []uint64{2, 0, 0}, Sum: 1, Count: 2}}})
+	require.NoError(t, err)
+	got, err = stor.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), got.Count)
+}
+
+func TestMemStorageTypeConflict(t *testing.T) {
+	stor := NewDefaultMemStorage()
+	ctx := context.Background()
+
+	err := stor.AddGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+
+	// метрика зарегистрирована как gauge
+	err = stor.AddCounter(ctx, "Alloc", 3)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	err = stor.AddHistogram(ctx, "Alloc", repositories.NewHistogram([]float64{1}))
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// батч с конфликтом типов не записывается частично
+	delta := int64(5)
+	value := 2.5
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "counter", Delta: &delta},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+	_, err = stor.GetMetric(ctx, "counter", "PollCount")
+	require.Error(t, err)
+
+	// тип нельзя изменить и внутри одного батча
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "HeapAlloc", MType: "gauge", Value: &value},
+		{ID: "HeapAlloc", MType: "counter", Delta: &delta},
+	})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+}
+
+func TestMemStorageMetadata(t *testing.T) {
+	stor := NewMemStorage(map[string]float64{"Alloc": 1}, map[string]int64{"PollCount": 2})
+	ctx := context.Background()
+
+	// метрики, переданные при создании хранилища, регистрируются в реестре
+	all, err := stor.GetAllMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Metadata{
+		{ID: "Alloc", MType: "gauge"},
+		{ID: "PollCount", MType: "counter"},
+	}, all)
+
+	meta := repositories.Metadata{ID: "Alloc", MType: "gauge", Unit: "bytes", Description: "allocated heap objects"}
+	require.NoError(t, stor.SetMetadata(ctx, meta))
+	got, err := stor.GetMetadata(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, meta, got)
+
+	// тип метрики, для которой уже есть значения, изменить нельзя
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "PollCount", MType: "gauge"})
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// метаданные можно зарегистрировать заранее, и тогда они ограничивают тип метрики
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "Latency", MType: "histogram"}))
+	err = stor.AddGauge(ctx, "Latency", 1)
+	require.ErrorIs(t, err, repositories.ErrMetricTypeConflict)
+
+	// некорректные метаданные
+	err = stor.SetMetadata(ctx, repositories.Metadata{ID: "Alloc", MType: "unknown"})
+	require.Error(t, err)
+
+	_, err = stor.GetMetadata(ctx, "unknown")
+	require.Error(t, err)
+
+	stor.Clean(ctx)
+	all, err = stor.GetAllMetadata(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestMemStorageListMetrics(t *testing.T) {
+	stor := NewMemStorage(map[string]float64{"HeapAlloc": 1, "HeapIdle": 2, "Alloc": 3}, map[string]int64{"PollCount": 4})
+	ctx := context.Background()
+	require.NoError(t, stor.SetMetadata(ctx, repositories.Metadata{ID: "HeapIdle", MType: "gauge", Labels: map[string]string{"host": "agent"}}))
+
+	ids := func(metrics []repositories.Metric) []string {
+		result := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			result = append(result, metric.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		filter    repositories.MetricsFilter
+		want      []string
+		wantCount int
+	}{
+		{name: "all sorted", filter: repositories.MetricsFilter{}, want: []string{"Alloc", "HeapAlloc", "HeapIdle", "PollCount"}, wantCount: 4},
+		{name: "type", filter: repositories.MetricsFilter{Type: "counter"}, want: []string{"PollCount"}, wantCount: 1},
+		{name: "prefix", filter: repositories.MetricsFilter{Prefix: "Heap"}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 2},
+		{name: "match", filter: repositories.MetricsFilter{Match: "Alloc$"}, want: []string{"Alloc", "HeapAlloc"}, wantCount: 2},
+		{name: "labels", filter: repositories.MetricsFilter{Labels: map[string]string{"host": "agent"}}, want: []string{"HeapIdle"}, wantCount: 1},
+		{name: "cursor and limit", filter: repositories.MetricsFilter{AfterID: "Alloc", Limit: 2}, want: []string{"HeapAlloc", "HeapIdle"}, wantCount: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := stor.ListMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(metrics))
+
+			count, err := stor.CountMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+
+	_, err := stor.ListMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+	_, err = stor.CountMetrics(ctx, repositories.MetricsFilter{Type: "unknown"})
+	require.Error(t, err)
+}
+
+func TestMemStorageDeleteMetrics(t *testing.T) {
+	stor := NewMemStorage(map[string]float64{"HeapAlloc": 1, "Alloc": 3}, map[string]int64{"PollCount": 4})
+	ctx := context.Background()
+	require.NoError(t, stor.AddHistogram(ctx, "HeapPause", repositories.NewHistogram([]float64{1})))
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.Error(t, err)
+	_, err = stor.GetMetadata(ctx, "Alloc")
+	require.Error(t, err)
+
+	// после удаления имя метрики можно использовать с другим типом
+	require.NoError(t, stor.AddCounter(ctx, "Alloc", 1))
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Prefix: "Heap"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{Match: "("})
+	require.Error(t, err)
+
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "Alloc", metrics[0].ID)
+	assert.Equal(t, "PollCount", metrics[1].ID)
+}
+
+func TestMemStorageDeleteStaleMetrics(t *testing.T) {
+	stor := NewDefaultMemStorage()
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+
+	// делаю метрику устаревшей
+	setUpdated(stor, "Alloc", time.Now().Add(-time.Hour))
+
+	deleted, err := stor.DeleteStaleMetrics(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = stor.GetMetric(ctx, "gauge", "Alloc")
+	require.Error(t, err)
+
+	// обновление метрики продлевает время её жизни
+	setUpdated(stor, "PollCount", time.Now().Add(-time.Hour))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	deleted, err = stor.DeleteStaleMetrics(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
+
+func TestMemStorageHistory(t *testing.T) {
+	stor := NewDefaultMemStorage()
+	ctx := context.Background()
+	from := time.Now()
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 2.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+	require.NoError(t, stor.AddHistogram(ctx, "Pause", repositories.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2}))
+
+	values := func(samples []repositories.Sample) []float64 {
+		result := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			result = append(result, sample.Value)
+		}
+		return result
+	}
+	to := time.Now()
+
+	samples, err := stor.GetHistory(ctx, "Alloc", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2.5}, values(samples))
+
+	// для counter сохраняется накопленная сумма
+	samples, err = stor.GetHistory(ctx, "PollCount", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 7}, values(samples))
+
+	// для histogram сохраняется количество наблюдений
+	samples, err = stor.GetHistory(ctx, "Pause", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2}, values(samples))
+
+	// значения вне периода не возвращаются
+	samples, err = stor.GetHistory(ctx, "Alloc", to.Add(time.Second), to.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	_, err = stor.GetHistory(ctx, "unknown", from, to)
+	require.Error(t, err)
+
+	// размер истории ограничен
+	for i := 0; i < historySize+10; i++ {
+		require.NoError(t, stor.AddGauge(ctx, "Alloc", float64(i)))
+	}
+	samples, err = stor.GetHistory(ctx, "Alloc", from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, historySize)
+	assert.Equal(t, float64(historySize+9), samples[len(samples)-1].Value)
+
+	// время последнего обновления возвращается при выборке метрик
+	metrics, err := stor.ListMetrics(ctx, repositories.MetricsFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	require.NotNil(t, metrics[0].UpdatedAt)
+	assert.Equal(t, samples[len(samples)-1].Time, *metrics[0].UpdatedAt)
+}
+
+func TestMemStorageRollups(t *testing.T) {
+	stor := NewDefaultMemStorage()
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Last: 2, Count: 1},
+		{Time: t0, Last: 1, Count: 1},
+	}))
+	// агрегат с тем же началом интервала заменяется
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Minute, []repositories.Rollup{
+		{Time: t0.Add(time.Minute), Last: 5, Count: 2},
+		{Time: t0.Add(2 * time.Minute), Last: 6, Count: 1},
+	}))
+	require.NoError(t, stor.AddRollups(ctx, "PollCount", time.Hour, []repositories.Rollup{{Time: t0, Last: 6, Count: 4}}))
+	assert.Error(t, stor.AddRollups(ctx, "unknown", time.Minute, []repositories.Rollup{{Time: t0}}))
+	assert.Error(t, stor.AddRollups(ctx, "PollCount", 0, []repositories.Rollup{{Time: t0}}))
+
+	rollups, err := stor.GetRollups(ctx, "PollCount", time.Minute, t0.Add(time.Minute), t0.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Rollup{{Time: t0.Add(time.Minute), Last: 5, Count: 2}, {Time: t0.Add(2 * time.Minute), Last: 6, Count: 1}}, rollups)
+	last, ok, err := stor.GetLastRollup(ctx, "PollCount", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 6.0, last.Last)
+	_, err = stor.GetRollups(ctx, "unknown", time.Minute, t0, t0)
+	assert.Error(t, err)
+
+	// удаляются только агрегаты заданного уровня
+	deleted, err := stor.DeleteHistoryBefore(ctx, time.Minute, t0.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	rollups, err = stor.GetRollups(ctx, "PollCount", time.Hour, t0, t0)
+	require.NoError(t, err)
+	assert.Len(t, rollups, 1)
+
+	deleted, err = stor.DeleteHistoryBefore(ctx, 0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	samples, err := stor.GetHistory(ctx, "PollCount", t0, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// агрегаты удаляются вместе с метрикой
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricsFilter{ID: "PollCount"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	_, ok, err = stor.GetLastRollup(ctx, "PollCount", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// benchStorage - методы хранилища, нагружаемые в бенчмарках.
+type benchStorage interface {
+	AddGauge(context.Context, string, float64) error
+	AddCounter(context.Context, string, int64) error
+	GetMetric(context.Context, string, string) (string, error)
+	GetAllMetrics(context.Context) (string, error)
+}
+
+// mutexStorage - хранилище, которое выполняет все операции под одной блокировкой,
+// как до разделения хранилища на шарды. Используется для сравнения в бенчмарках.
+type mutexStorage struct {
+	sync.Mutex
+	*MemStorage
+}
+
+func (s *mutexStorage) AddGauge(ctx context.Context, name string, value float64) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.MemStorage.AddGauge(ctx, name, value)
+}
+
+func (s *mutexStorage) AddCounter(ctx context.Context, name string, value int64) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.MemStorage.AddCounter(ctx, name, value)
+}
+
+func (s *mutexStorage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.MemStorage.GetMetric(ctx, metricType, name)
+}
+
+func (s *mutexStorage) GetAllMetrics(ctx context.Context) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.MemStorage.GetAllMetrics(ctx)
+}
+
+// benchMetricsNumber - количество метрик в хранилище в бенчмарках, примерно как у сотни агентов.
+const benchMetricsNumber = 3000
+
+// newBenchStorages - возвращает заполненные метриками хранилища для сравнения в бенчмарках.
+func newBenchStorages(b *testing.B) map[string]benchStorage {
+	storages := map[string]benchStorage{
+		"sharded":      NewDefaultMemStorage(),
+		"single mutex": &mutexStorage{MemStorage: NewDefaultMemStorage()},
+	}
+	ctx := context.Background()
+	for _, stor := range storages {
+		for i := 0; i < benchMetricsNumber; i++ {
+			require.NoError(b, stor.AddGauge(ctx, fmt.Sprintf("gauge%d", i), float64(i)))
+			require.NoError(b, stor.AddCounter(ctx, fmt.Sprintf("counter%d", i), int64(i)))
+		}
+	}
+	return storages
+}
+
+// runParallel - запускает бенчмарк op для каждого хранилища. Каждая горутина получает свой номер операции.
+func runParallel(b *testing.B, op func(stor benchStorage, i int) error) {
+	for name, stor := range newBenchStorages(b) {
+		b.Run(name, func(b *testing.B) {
+			var seq atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(seq.Add(1)) * 7919
+				for pb.Next() {
+					i++
+					if err := op(stor, i); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkMemStorageAddCounterParallel(b *testing.B) {
+	ctx := context.Background()
+	runParallel(b, func(stor benchStorage, i int) error {
+		return stor.AddCounter(ctx, fmt.Sprintf("counter%d", i%benchMetricsNumber), 1)
+	})
+}
+
+func BenchmarkMemStorageGetMetricParallel(b *testing.B) {
+	ctx := context.Background()
+	runParallel(b, func(stor benchStorage, i int) error {
+		_, err := stor.GetMetric(ctx, "gauge", fmt.Sprintf("gauge%d", i%benchMetricsNumber))
+		return err
+	})
+}
+
+// BenchmarkMemStorageMixedParallel - агенты отправляют метрики, одновременно с этим часть запросов читает метрики.
+func BenchmarkMemStorageMixedParallel(b *testing.B) {
+	ctx := context.Background()
+	runParallel(b, func(stor benchStorage, i int) error {
+		name := fmt.Sprintf("gauge%d", i%benchMetricsNumber)
+		// на тысячу операций приходится одно чтение всех метрик и сто чтений одной метрики
+		switch n := i % 1000; {
+		case n == 0:
+			_, err := stor.GetAllMetrics(ctx)
+			return err
+		case n <= 100:
+			_, err := stor.GetMetric(ctx, "gauge", name)
+			return err
+		}
+		return stor.AddGauge(ctx, name, float64(i))
+	})
+}
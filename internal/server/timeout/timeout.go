@@ -0,0 +1,50 @@
+// Packet timeout implement middleware for limiting time of request processing.
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter - ограничение времени обработки запроса.
+type Limiter struct {
+	mu      sync.RWMutex
+	timeout time.Duration
+}
+
+// New - фабричная функция структуры Limiter, 0 - без ограничения.
+func New(t time.Duration) *Limiter {
+	return &Limiter{timeout: t}
+}
+
+// SetTimeout - устанавливает максимальное время обработки запроса, 0 - без ограничения.
+func (l *Limiter) SetTimeout(t time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeout = t
+}
+
+// GetTimeout - возвращает максимальное время обработки запроса.
+func (l *Limiter) GetTimeout() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.timeout
+}
+
+// Middleware - middleware, которое устанавливает в контекст запроса срок окончания обработки.
+// Хранилища прерывают операции по истечении срока, после чего обработчик отвечает 504 Gateway Timeout.
+func (l *Limiter) Middleware(handler http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		t := l.GetTimeout()
+		if t <= 0 {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), t)
+		defer cancel()
+		handler.ServeHTTP(res, req.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,36 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTimeout(t *testing.T) {
+	l := New(time.Second)
+	assert.Equal(t, time.Second, l.GetTimeout())
+	l.SetTimeout(0)
+	assert.Equal(t, time.Duration(0), l.GetTimeout())
+}
+
+func TestMiddleware(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	l := New(0)
+	handler := l.Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		deadline, hasDeadline = req.Context().Deadline()
+	}))
+
+	// без ограничения срок обработки не устанавливается
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, hasDeadline)
+
+	l.SetTimeout(time.Minute)
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, hasDeadline)
+	assert.WithinDuration(t, start.Add(time.Minute), deadline, time.Second)
+}
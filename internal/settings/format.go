@@ -0,0 +1,94 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Форматы файла конфигурации, которые определяются по расширению файла.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// formatOf - возвращает формат файла конфигурации по расширению файла.
+func formatOf(path string) (string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unsupported format of configuration file %q, expected .json, .yaml, .yml or .toml", ext)
+	}
+}
+
+// decodeFile - разбирает содержимое файла конфигурации в значения параметров в виде JSON, чтобы параметры
+// всех форматов разбирались одинаково, например длительности "10s" как repositories.Duration.
+func decodeFile(format string, data []byte) (map[string]json.RawMessage, error) {
+	var raw map[string]json.RawMessage
+	if format == FormatJSON {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	var values map[string]any
+	var err error
+	if format == FormatYAML {
+		err = yaml.Unmarshal(data, &values)
+	} else {
+		err = toml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw = make(map[string]json.RawMessage, len(values))
+	for key, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", key, err)
+		}
+		raw[key] = data
+	}
+	return raw, nil
+}
+
+// reference - ссылка на переменную окружения в файле конфигурации: ${NAME} или ${NAME:-default}.
+// Ссылка, перед которой стоит ещё один символ $, не подставляется: $${NAME} заменяется на ${NAME}.
+var reference = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate - подставляет в содержимое файла конфигурации значения переменных окружения. Если переменная
+// не задана или пуста, подставляется значение по умолчанию, а при его отсутствии возвращается ошибка.
+func interpolate(data []byte) ([]byte, error) {
+	var missing []string
+	result := reference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		m := reference.FindSubmatch(ref)
+		if len(m[1]) > 0 {
+			return ref[1:]
+		}
+		if v := os.Getenv(string(m[2])); v != "" {
+			return []byte(v)
+		}
+		if len(m[3]) > 0 {
+			return m[4]
+		}
+		missing = append(missing, string(m[2]))
+		return ref
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables are not set: %s", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
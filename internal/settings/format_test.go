@@ -0,0 +1,102 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{
+			name: "json",
+			file: "config.json",
+			data: `{"address": ":7000", "restore": false, "workers": 3, "rate": 1.5, "timeout": "5s", "interval": "1m"}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			data: "address: \":7000\"\nrestore: false\nworkers: 3\nrate: 1.5\ntimeout: 5s\ninterval: 1m\n",
+		},
+		{
+			name: "yml",
+			file: "config.yml",
+			data: "address: \":7000\"\nrestore: false\nworkers: 3\nrate: 1.5\ntimeout: 5s\ninterval: 60\n",
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			data: "address = \":7000\"\nrestore = false\nworkers = 3\nrate = 1.5\ntimeout = \"5s\"\ninterval = \"1m\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+
+			var c testConfig
+			l := newTestLoader(&c)
+			require.NoError(t, l.Load([]string{"-c", path}))
+			assert.Equal(t, ":7000", c.address)
+			assert.False(t, c.restore)
+			assert.Equal(t, 3, c.workers)
+			assert.Equal(t, 1.5, c.rate)
+			assert.Equal(t, 5*time.Second, c.timeout)
+			assert.Equal(t, 60, c.interval)
+			assert.Equal(t, "", c.key) // незаданный параметр остаётся по умолчанию
+		})
+	}
+}
+
+func TestLoadFormatErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	var c testConfig
+	l := newTestLoader(&c)
+	err := l.Load([]string{"-c", write("config.yaml", "address: :7000\nunknown: 1\ntimeout: 5\n")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown parameter "unknown"`)
+	assert.Contains(t, err.Error(), `"timeout"`)
+
+	assert.Error(t, l.Load([]string{"-c", write("broken.toml", "address = ")}))
+	assert.Error(t, l.Load([]string{"-c", write("broken.yaml", "address: [")}))
+	assert.ErrorContains(t, l.Load([]string{"-c", write("config.ini", "address=:7000")}), "unsupported format")
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_HOST", "db.local")
+	t.Setenv("TEST_EMPTY", "")
+
+	data, err := interpolate([]byte(`dsn: "host=${TEST_HOST} port=${TEST_PORT:-5432} user=${TEST_EMPTY:-metrics} password=$${TEST_HOST} pa$$"`))
+	require.NoError(t, err)
+	assert.Equal(t, `dsn: "host=db.local port=5432 user=metrics password=${TEST_HOST} pa$$"`, string(data))
+
+	_, err = interpolate([]byte(`address: ${TEST_MISSING_ADDRESS}, key: ${TEST_MISSING_KEY}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TEST_MISSING_ADDRESS, TEST_MISSING_KEY")
+}
+
+func TestLoadInterpolation(t *testing.T) {
+	t.Setenv("TEST_PORT", "7000")
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte("address = \":${TEST_PORT}\"\nkey = \"${TEST_SECRET:-none}\"\n"), 0o600))
+
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"-c", path}))
+	assert.Equal(t, ":7000", c.address)
+	assert.Equal(t, "none", c.key)
+}
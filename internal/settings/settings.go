@@ -0,0 +1,422 @@
+// Packet settings implement loading of typed launch parameters from defaults, configuration file in JSON, YAML or TOML
+// format, environment variables and command line flags with precedence defaults < file < environment < flags.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Source - источник значения параметра запуска.
+type Source int
+
+// Источники значений параметров запуска в порядке возрастания приоритета.
+const (
+	SourceDefault Source = iota // значение по умолчанию
+	SourceFile                  // файл конфигурации
+	SourceEnv                   // переменная окружения
+	SourceFlag                  // флаг командной строки
+)
+
+// String - возвращает название источника значения параметра.
+func (s Source) String() string {
+	switch s {
+	case SourceFile:
+		return "file"
+	case SourceEnv:
+		return "env"
+	case SourceFlag:
+		return "flag"
+	}
+	return "default"
+}
+
+// Redacted - значение секретного параметра при выводе конфигурации.
+const Redacted = "REDACTED"
+
+// Param - параметр запуска, значение которого задаётся в файле конфигурации, переменной окружения или флагом.
+type Param struct {
+	key    string // имя параметра в файле конфигурации
+	env    string // имя переменной окружения, пустое - параметр не задаётся переменной окружения
+	flag   string // имя флага, пустое - параметр не задаётся флагом
+	usage  string // описание параметра для справки по флагам
+	secret bool   // значение параметра скрывается при выводе конфигурации
+	source Source // источник текущего значения
+
+	reset   func()                      // устанавливает значение по умолчанию
+	parse   func(s string) (any, error) // разбирает значение из переменной окружения или флага
+	decode  func(raw []byte) (any, error)
+	set     func(v any)
+	get     func() any
+	encode  func() any // значение в формате файла конфигурации
+	display func() string
+	isBool  bool
+}
+
+// Secret - помечает параметр как секретный, его значение скрывается при выводе конфигурации.
+func (p *Param) Secret() *Param {
+	p.secret = true
+	return p
+}
+
+// Key - возвращает имя параметра в файле конфигурации.
+func (p *Param) Key() string {
+	return p.key
+}
+
+// Source - возвращает источник текущего значения параметра.
+func (p *Param) Source() Source {
+	return p.source
+}
+
+// Loader - загружает параметры запуска одного приложения.
+type Loader struct {
+	name       string
+	params     []*Param
+	byKey      map[string]*Param
+	configFile *string  // путь к файлу конфигурации
+	configEnv  string   // переменная окружения с путём к файлу конфигурации
+	configFlag string   // флаг с путём к файлу конфигурации
+	print      bool     // запрошен вывод конфигурации флагом -print-config
+	args       []string // аргументы, оставшиеся после флагов
+}
+
+// NewLoader - фабричная функция структуры Loader, name - имя приложения для справки по флагам.
+func NewLoader(name string) *Loader {
+	return &Loader{name: name, byKey: make(map[string]*Param)}
+}
+
+// ConfigFile - регистрирует путь к файлу конфигурации, который задаётся переменной окружения env или флагом flagName.
+func (l *Loader) ConfigFile(p *string, env, flagName string) {
+	l.configFile, l.configEnv, l.configFlag = p, env, flagName
+}
+
+// add - регистрирует параметр типа T с функциями разбора значения из строки и из JSON.
+func add[T any](l *Loader, p *T, def T, key, env, flagName, usage string,
+	parse func(string) (T, error), encode func(T) any) *Param {
+	param := &Param{key: key, env: env, flag: flagName, usage: usage}
+	param.reset = func() {
+		*p = def
+		param.source = SourceDefault
+	}
+	param.parse = func(s string) (any, error) { return parse(s) }
+	param.decode = func(raw []byte) (any, error) {
+		var v T
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+	param.set = func(v any) { *p = v.(T) }
+	param.get = func() any { return *p }
+	param.encode = func() any { return encode(*p) }
+	param.display = func() string { return fmt.Sprint(encode(def)) }
+	*p = def
+	l.params = append(l.params, param)
+	l.byKey[key] = param
+	return param
+}
+
+// identity - возвращает значение без преобразования.
+func identity[T any](v T) any { return v }
+
+// String - регистрирует строковый параметр.
+func (l *Loader) String(p *string, def, key, env, flagName, usage string) *Param {
+	return add(l, p, def, key, env, flagName, usage, func(s string) (string, error) { return s, nil }, identity[string])
+}
+
+// Bool - регистрирует логический параметр.
+func (l *Loader) Bool(p *bool, def bool, key, env, flagName, usage string) *Param {
+	param := add(l, p, def, key, env, flagName, usage, strconv.ParseBool, identity[bool])
+	param.isBool = true
+	return param
+}
+
+// Int - регистрирует целочисленный параметр.
+func (l *Loader) Int(p *int, def int, key, env, flagName, usage string) *Param {
+	return add(l, p, def, key, env, flagName, usage, strconv.Atoi, identity[int])
+}
+
+// Float64 - регистрирует вещественный параметр.
+func (l *Loader) Float64(p *float64, def float64, key, env, flagName, usage string) *Param {
+	return add(l, p, def, key, env, flagName, usage, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }, identity[float64])
+}
+
+// Duration - регистрирует параметр длительности, которая задаётся строкой, например "10s".
+func (l *Loader) Duration(p *time.Duration, def time.Duration, key, env, flagName, usage string) *Param {
+	param := add(l, p, def, key, env, flagName, usage, time.ParseDuration, func(d time.Duration) any { return d.String() })
+	param.decode = func(raw []byte) (any, error) {
+		var d repositories.Duration
+		err := json.Unmarshal(raw, &d)
+		return d.Duration, err
+	}
+	return param
+}
+
+// Seconds - регистрирует интервал в целых секундах. В файле конфигурации интервал задаётся длительностью, например "10s",
+// в переменной окружения и флаге - числом секунд или длительностью.
+func (l *Loader) Seconds(p *int, def int, key, env, flagName, usage string) *Param {
+	param := add(l, p, def, key, env, flagName, usage, parseSeconds, func(n int) any { return (time.Duration(n) * time.Second).String() })
+	param.decode = func(raw []byte) (any, error) {
+		var n int
+		if err := json.Unmarshal(raw, &n); err == nil {
+			return n, nil
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be duration string or number of seconds")
+		}
+		return parseSeconds(s)
+	}
+	return param
+}
+
+// parseSeconds - разбирает интервал из числа секунд или длительности.
+func parseSeconds(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("must be duration or number of seconds")
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("must be whole number of seconds, got %s", d)
+	}
+	return int(d / time.Second), nil
+}
+
+// flagValue - реализация flag.Value, которая проверяет значение флага и запоминает его для применения после файла
+// конфигурации и переменных окружения.
+type flagValue struct {
+	param *Param
+	raw   string
+}
+
+// String - возвращает значение по умолчанию для справки по флагам.
+func (f *flagValue) String() string {
+	if f == nil || f.param == nil {
+		return ""
+	}
+	return f.param.display()
+}
+
+// Set - проверяет и запоминает значение флага.
+func (f *flagValue) Set(s string) error {
+	if _, err := f.param.parse(s); err != nil {
+		return err
+	}
+	f.raw = s
+	return nil
+}
+
+// IsBoolFlag - позволяет задавать логические флаги без значения.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.param.isBool
+}
+
+// Load - загружает параметры запуска из значений по умолчанию, файла конфигурации, переменных окружения и флагов args.
+// Каждый следующий источник переопределяет только заданные в нём параметры. Возвращает все найденные ошибки.
+func (l *Loader) Load(args []string) error {
+	for _, p := range l.params {
+		p.reset()
+	}
+	l.print = false
+	l.args = nil
+
+	fs := flag.NewFlagSet(l.name, flag.ContinueOnError)
+	values := make(map[string]*flagValue)
+	for _, p := range l.params {
+		if p.flag == "" {
+			continue
+		}
+		v := &flagValue{param: p}
+		values[p.flag] = v
+		fs.Var(v, p.flag, p.usage)
+	}
+	var configFlag string
+	if l.configFile != nil && l.configFlag != "" {
+		fs.StringVar(&configFlag, l.configFlag, "", "name of configuration file in JSON, YAML or TOML format")
+	}
+	fs.BoolVar(&l.print, "print-config", false, "print effective configuration with secrets redacted and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	l.args = fs.Args()
+
+	var errs []error
+	if l.configFile != nil {
+		*l.configFile = ""
+		if env := os.Getenv(l.configEnv); l.configEnv != "" && env != "" {
+			*l.configFile = env
+		}
+		if configFlag != "" {
+			*l.configFile = configFlag
+		}
+		if *l.configFile != "" {
+			errs = append(errs, l.loadFile(*l.configFile)...)
+		}
+	}
+
+	for _, p := range l.params {
+		if p.env == "" {
+			continue
+		}
+		env := os.Getenv(p.env)
+		if env == "" {
+			continue
+		}
+		v, err := p.parse(env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %s: %w", p.env, err))
+			continue
+		}
+		p.set(v)
+		p.source = SourceEnv
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := values[f.Name]
+		if !ok {
+			return
+		}
+		parsed, _ := v.param.parse(v.raw)
+		v.param.set(parsed)
+		v.param.source = SourceFlag
+	})
+	return errors.Join(errs...)
+}
+
+// loadFile - загружает параметры, заданные в файле конфигурации в формате JSON, YAML или TOML. Формат определяется
+// по расширению файла, перед разбором в файл подставляются значения переменных окружения. Незаданные в файле
+// параметры не меняются.
+func (l *Loader) loadFile(path string) []error {
+	format, err := formatOf(path)
+	if err != nil {
+		return []error{err}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("open configuration file error: %w", err)}
+	}
+	data, err = interpolate(data)
+	if err != nil {
+		return []error{fmt.Errorf("configuration file %s: %w", path, err)}
+	}
+	raw, err := decodeFile(format, data)
+	if err != nil {
+		return []error{fmt.Errorf("parse configuration file %s error: %w", path, err)}
+	}
+
+	var errs []error
+	for _, key := range sortedKeys(raw) {
+		p, ok := l.byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("configuration file %s: unknown parameter %q", path, key))
+			continue
+		}
+		v, err := p.decode(raw[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("configuration file %s: parameter %q: %w", path, key, err))
+			continue
+		}
+		p.set(v)
+		p.source = SourceFile
+	}
+	return errs
+}
+
+// sortedKeys - возвращает ключи параметров файла конфигурации в порядке возрастания, чтобы ошибки выводились стабильно.
+func sortedKeys(raw map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PrintRequested - проверяет, запрошен ли флагом -print-config вывод конфигурации.
+func (l *Loader) PrintRequested() bool {
+	return l.print
+}
+
+// Args - возвращает аргументы командной строки, оставшиеся после флагов при последней загрузке.
+func (l *Loader) Args() []string {
+	return l.args
+}
+
+// Params - возвращает зарегистрированные параметры в порядке регистрации.
+func (l *Loader) Params() []*Param {
+	return l.params
+}
+
+// Print - выводит действующую конфигурацию в формате JSON-файла конфигурации. Значения заданных секретных параметров заменяются на Redacted.
+func (l *Loader) Print(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, p := range l.params {
+		v := p.encode()
+		if p.secret && p.get() != "" {
+			v = Redacted
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if i == len(l.params)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&buf, "    %q: %s%s\n", p.key, data, sep)
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Values - возвращает текущие значения параметров по их именам в файле конфигурации.
+func (l *Loader) Values() map[string]any {
+	values := make(map[string]any, len(l.params))
+	for _, p := range l.params {
+		values[p.key] = p.get()
+	}
+	return values
+}
+
+// Restore - возвращает параметру key значение v, полученное из Values.
+func (l *Loader) Restore(key string, v any) {
+	if p, ok := l.byKey[key]; ok {
+		p.set(v)
+	}
+}
+
+// Problems - собирает ошибки проверки параметров запуска, чтобы сообщить обо всех некорректных параметрах сразу.
+type Problems []error
+
+// Check - добавляет ошибку с описанием format, если условие ok не выполнено.
+func (p *Problems) Check(ok bool, format string, args ...any) {
+	if !ok {
+		*p = append(*p, fmt.Errorf(format, args...))
+	}
+}
+
+// Add - добавляет ошибку err с префиксом prefix, если она не nil.
+func (p *Problems) Add(prefix string, err error) {
+	if err != nil {
+		*p = append(*p, fmt.Errorf("%s: %w", prefix, err))
+	}
+}
+
+// Err - возвращает все собранные ошибки или nil.
+func (p Problems) Err() error {
+	return errors.Join(p...)
+}
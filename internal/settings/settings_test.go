@@ -0,0 +1,201 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig - параметры запуска тестового приложения.
+type testConfig struct {
+	configFile string
+	address    string
+	restore    bool
+	workers    int
+	rate       float64
+	timeout    time.Duration
+	interval   int
+	key        string
+}
+
+func newTestLoader(c *testConfig) *Loader {
+	l := NewLoader("test")
+	l.ConfigFile(&c.configFile, "TEST_CONFIG", "c")
+	l.String(&c.address, ":8080", "address", "TEST_ADDRESS", "a", "address")
+	l.Bool(&c.restore, true, "restore", "TEST_RESTORE", "r", "restore")
+	l.Int(&c.workers, 1, "workers", "TEST_WORKERS", "w", "workers")
+	l.Float64(&c.rate, 0, "rate", "TEST_RATE", "rate", "rate")
+	l.Duration(&c.timeout, 10*time.Second, "timeout", "TEST_TIMEOUT", "timeout", "timeout")
+	l.Seconds(&c.interval, 300, "interval", "TEST_INTERVAL", "i", "interval")
+	l.String(&c.key, "", "key", "TEST_KEY", "k", "key").Secret()
+	return l
+}
+
+func writeFile(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load(nil))
+	assert.Equal(t, testConfig{address: ":8080", restore: true, workers: 1, timeout: 10 * time.Second, interval: 300}, c)
+	for _, p := range l.Params() {
+		assert.Equal(t, SourceDefault, p.Source())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	// файл задаёт часть параметров, остальные остаются по умолчанию
+	path := writeFile(t, `{"address": ":7000", "restore": false, "workers": 3, "interval": "60s", "timeout": "5s"}`)
+	t.Setenv("TEST_ADDRESS", ":8000")
+	t.Setenv("TEST_WORKERS", "4")
+	t.Setenv("TEST_CONFIG", path)
+
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"-a", ":9000", "-i", "120"}))
+
+	assert.Equal(t, path, c.configFile)
+	assert.Equal(t, ":9000", c.address) // флаг переопределяет переменную окружения и файл
+	assert.Equal(t, 4, c.workers)       // переменная окружения переопределяет файл
+	assert.Equal(t, 120, c.interval)    // флаг переопределяет файл
+	assert.False(t, c.restore)          // файл переопределяет значение по умолчанию
+	assert.Equal(t, 5*time.Second, c.timeout)
+	assert.Equal(t, 0.0, c.rate) // незаданный параметр остаётся по умолчанию
+
+	sources := make(map[string]Source)
+	for _, p := range l.Params() {
+		sources[p.Key()] = p.Source()
+	}
+	assert.Equal(t, map[string]Source{"address": SourceFlag, "restore": SourceFile, "workers": SourceEnv, "rate": SourceDefault,
+		"timeout": SourceFile, "interval": SourceFlag, "key": SourceDefault}, sources)
+
+	// флаг пути к файлу конфигурации переопределяет переменную окружения
+	other := writeFile(t, `{"workers": 8}`)
+	t.Setenv("TEST_WORKERS", "")
+	require.NoError(t, l.Load([]string{"-c", other}))
+	assert.Equal(t, other, c.configFile)
+	assert.Equal(t, 8, c.workers)
+	assert.Equal(t, ":8000", c.address)
+	assert.True(t, c.restore)
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeFile(t, `{"address": 80, "workers": "many", "unknown": true, "interval": "1.5s"}`)
+	t.Setenv("TEST_RATE", "fast")
+
+	var c testConfig
+	l := newTestLoader(&c)
+	err := l.Load([]string{"-c", path})
+	require.Error(t, err)
+	// сообщаются все некорректные параметры сразу
+	for _, want := range []string{`"address"`, `"workers"`, `unknown parameter "unknown"`, `"interval"`, "TEST_RATE"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	assert.Error(t, l.Load([]string{"-w", "many"}))
+	assert.Error(t, l.Load([]string{"-c", filepath.Join(t.TempDir(), "missing.json")}))
+	assert.Error(t, l.Load([]string{"-c", writeFile(t, `{`)}))
+}
+
+func TestSeconds(t *testing.T) {
+	path := writeFile(t, `{"interval": 30}`)
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"-c", path}))
+	assert.Equal(t, 30, c.interval)
+
+	require.NoError(t, l.Load([]string{"-i", "2m"}))
+	assert.Equal(t, 120, c.interval)
+
+	t.Setenv("TEST_INTERVAL", "15")
+	require.NoError(t, l.Load(nil))
+	assert.Equal(t, 15, c.interval)
+}
+
+func TestBoolFlag(t *testing.T) {
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"-r=false"}))
+	assert.False(t, c.restore)
+	require.NoError(t, l.Load([]string{"-r"}))
+	assert.True(t, c.restore)
+}
+
+func TestArgs(t *testing.T) {
+	var c testConfig
+	l := newTestLoader(&c)
+	// разбор флагов завершается на первом аргументе, который не является флагом
+	require.NoError(t, l.Load([]string{"-a", ":9000", "get", "-w", "2"}))
+	assert.Equal(t, ":9000", c.address)
+	assert.Equal(t, 1, c.workers)
+	assert.Equal(t, []string{"get", "-w", "2"}, l.Args())
+
+	require.NoError(t, l.Load(nil))
+	assert.Empty(t, l.Args())
+}
+
+func TestPrint(t *testing.T) {
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"--print-config", "-k", "secret", "-i", "90"}))
+	assert.True(t, l.PrintRequested())
+
+	var buf bytes.Buffer
+	require.NoError(t, l.Print(&buf))
+	assert.NotContains(t, buf.String(), "secret")
+
+	var printed map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &printed))
+	assert.Equal(t, map[string]any{"address": ":8080", "restore": true, "workers": 1.0, "rate": 0.0, "timeout": "10s",
+		"interval": "1m30s", "key": Redacted}, printed)
+
+	// выведенная конфигурация загружается как файл конфигурации
+	var loaded testConfig
+	require.NoError(t, newTestLoader(&loaded).Load([]string{"-c", writeFile(t, buf.String())}))
+	assert.Equal(t, 90, loaded.interval)
+	assert.Equal(t, Redacted, loaded.key)
+
+	// пустой секрет не скрывается
+	require.NoError(t, l.Load(nil))
+	assert.False(t, l.PrintRequested())
+	buf.Reset()
+	require.NoError(t, l.Print(&buf))
+	assert.Contains(t, buf.String(), `"key": ""`)
+}
+
+func TestValuesRestore(t *testing.T) {
+	var c testConfig
+	l := newTestLoader(&c)
+	require.NoError(t, l.Load([]string{"-a", ":9000"}))
+	values := l.Values()
+
+	require.NoError(t, l.Load(nil))
+	assert.Equal(t, ":8080", c.address)
+	l.Restore("address", values["address"])
+	assert.Equal(t, ":9000", c.address)
+}
+
+func TestProblems(t *testing.T) {
+	var problems Problems
+	assert.NoError(t, problems.Err())
+
+	problems.Check(true, "not reported")
+	problems.Check(false, "workers must be positive, got %d", 0)
+	problems.Add("retry policy", nil)
+	problems.Add("retry policy", assert.AnError)
+	err := problems.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "workers must be positive, got 0")
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NotContains(t, err.Error(), "not reported")
+}
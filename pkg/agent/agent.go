@@ -0,0 +1,67 @@
+// Packet agent implement metrics agent, which can be embedded into another Go application. The agent collects runtime
+// and system metrics together with metrics of the host application and pushes them to the metrics server.
+package agent
+
+import (
+	"context"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
+)
+
+// Recorder - принимает значения метрик приложения.
+type Recorder interface {
+	// SetGauge - устанавливает значение метрики типа "gauge".
+	SetGauge(name string, value float64) error
+	// AddCounter - увеличивает метрику типа "counter" на delta.
+	AddCounter(name string, delta int64) error
+}
+
+// Collector - сборщик метрик приложения. Агент вызывает его при каждом сборе метрик, сборщик передаёт
+// значения метрик в r.
+type Collector func(r Recorder)
+
+// Agent - агент сбора метрик, встроенный в приложение.
+type Agent struct {
+	agent *app.Agent
+}
+
+// New - создаёт агента с параметрами opts. Незаданные параметры имеют те же значения по умолчанию, что и
+// у отдельно запускаемого агента.
+func New(opts ...Option) (*Agent, error) {
+	o := options{cfg: app.DefaultConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	agent, err := app.New(o.cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{agent: agent}
+	for _, collector := range o.collectors {
+		a.AddCollector(collector)
+	}
+	return a, nil
+}
+
+// Run - собирает метрики и отправляет их на сервер, пока не отменён контекст ctx. После отмены контекста
+// дожидается завершения начатых отправок.
+func (a *Agent) Run(ctx context.Context) error {
+	return a.agent.Run(ctx)
+}
+
+// AddCollector - добавляет сборщик метрик приложения, который агент вызывает при каждом сборе метрик.
+func (a *Agent) AddCollector(collector Collector) {
+	a.agent.Metrics().AddCollector(func() { collector(a) })
+}
+
+// SetGauge - устанавливает значение метрики приложения типа "gauge". Значение отправляется на сервер при каждой
+// отправке метрик, пока не будет изменено. Имена метрик, которые собирает сам агент, использовать нельзя.
+func (a *Agent) SetGauge(name string, value float64) error {
+	return a.agent.Metrics().SetGauge(name, value)
+}
+
+// AddCounter - увеличивает метрику приложения типа "counter" на delta. Накопленное значение сбрасывается после
+// успешной отправки на сервер, сервер суммирует полученные значения.
+func (a *Agent) AddCounter(name string, delta int64) error {
+	return a.agent.Metrics().AddCounter(name, delta)
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	serverapp "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestNewInvalidOptions(t *testing.T) {
+	_, err := New(WithReportInterval(-time.Second), WithLogLevel("loud"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "report_interval")
+	assert.Contains(t, err.Error(), "log_level")
+}
+
+func TestRun(t *testing.T) {
+	serverCfg := serverapp.DefaultConfig()
+	serverCfg.Key = "secret"
+	stor := storage.NewDefaultMemStorage()
+	srv, err := serverapp.New(serverCfg, stor)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	a, err := New(
+		WithAddress(strings.TrimPrefix(ts.URL, "http://")),
+		WithKey("secret"),
+		WithPollInterval(10*time.Millisecond),
+		WithReportInterval(10*time.Millisecond),
+		WithConfigPollInterval(0),
+		WithCollector(func(r Recorder) {
+			assert.NoError(t, r.SetGauge("QueueLength", 3))
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, a.AddCounter("Requests", 2))
+	// имена метрик, которые собирает сам агент, недоступны приложению
+	assert.Error(t, a.SetGauge("Alloc", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	// метрики приложения доставляются на сервер вместе с метриками агента
+	value := func(mType, name string) string {
+		v, err := stor.GetMetric(context.Background(), mType, name)
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+	require.Eventually(t, func() bool {
+		return value("gauge", "QueueLength") == "3" && value("counter", "Requests") == "2" && value("counter", "PollCount") != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent is not stopped after context cancel")
+	}
+	// счётчик приложения отправлен один раз
+	assert.Equal(t, "2", value("counter", "Requests"))
+}
@@ -0,0 +1,39 @@
+package agent_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/pkg/agent"
+)
+
+func Example() {
+	a, err := agent.New(
+		agent.WithAddress("localhost:8080"),
+		agent.WithKey("secret"),
+		agent.WithReportInterval(5*time.Second),
+		// метрики приложения собираются вместе с метриками агента
+		agent.WithCollector(func(r agent.Recorder) {
+			_ = r.SetGauge("Goroutines", float64(runtime.NumGoroutine()))
+		}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// агент работает, пока приложение не получит сигнал прерывания
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		if err := a.Run(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	// события приложения учитываются счётчиком
+	_ = a.AddCounter("HandledRequests", 1)
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/app"
+)
+
+// options - параметры, из которых создаётся агент.
+type options struct {
+	cfg        app.Config
+	collectors []Collector
+}
+
+// Option - параметр агента, передаваемый в New.
+type Option func(*options)
+
+// WithAddress - устанавливает адрес и порт сервера метрик, например "localhost:8080".
+func WithAddress(address string) Option {
+	return func(o *options) { o.cfg.Address = address }
+}
+
+// WithKey - устанавливает ключ, которым подписываются отправляемые данные и проверяются ответы сервера.
+func WithKey(key string) Option {
+	return func(o *options) { o.cfg.Key = key }
+}
+
+// WithCryptoKey - устанавливает путь к публичному ключу сервера, которым шифруются отправляемые данные.
+func WithCryptoKey(path string) Option {
+	return func(o *options) { o.cfg.CryptoKey = path }
+}
+
+// WithPollInterval - устанавливает интервал между сбором метрик.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) { o.cfg.PollInterval = interval }
+}
+
+// WithReportInterval - устанавливает интервал между отправками метрик на сервер.
+func WithReportInterval(interval time.Duration) Option {
+	return func(o *options) { o.cfg.ReportInterval = interval }
+}
+
+// WithRateLimit - устанавливает количество одновременных отправок метрик на сервер, 0 - без ограничения.
+func WithRateLimit(limit int) Option {
+	return func(o *options) { o.cfg.RateLimit = limit }
+}
+
+// WithLogLevel - устанавливает уровень логирования агента, например "debug" или "error".
+func WithLogLevel(level string) Option {
+	return func(o *options) { o.cfg.LogLevel = level }
+}
+
+// WithAgentID - устанавливает идентификатор агента, по которому сервер ограничивает частоту запросов.
+func WithAgentID(id string) Option {
+	return func(o *options) { o.cfg.AgentID = id }
+}
+
+// WithAgentGroup - устанавливает группу агента, по которой сервер выбирает настройки агента.
+func WithAgentGroup(group string) Option {
+	return func(o *options) { o.cfg.AgentGroup = group }
+}
+
+// WithConfigPollInterval - устанавливает интервал запроса настроек агента с сервера, 0 - настройки
+// запрашиваются только при запуске и при изменении их версии в ответах сервера.
+func WithConfigPollInterval(interval time.Duration) Option {
+	return func(o *options) { o.cfg.ConfigPollInterval = interval }
+}
+
+// WithCollector - добавляет сборщик метрик приложения, который агент вызывает при каждом сборе метрик.
+func WithCollector(collector Collector) Option {
+	return func(o *options) { o.collectors = append(o.collectors, collector) }
+}
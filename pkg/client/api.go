@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Query - вычисляет выражение запроса к метрикам expr, например `rate(requests[5m])`. Функции над периодом
+// вычисляются на момент at, нулевое значение - текущий момент сервера.
+func (c *Client) Query(ctx context.Context, expr string, at time.Time) (QueryResult, error) {
+	query := url.Values{"query": {expr}}
+	if !at.IsZero() {
+		query.Set("time", at.Format(time.RFC3339))
+	}
+	var result QueryResult
+	err := c.decode(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/query",
+		query:  query,
+	}, &result)
+	return result, err
+}
+
+// AllMetadata - возвращает описания всех зарегистрированных метрик.
+func (c *Client) AllMetadata(ctx context.Context) ([]Metadata, error) {
+	var result []Metadata
+	err := c.decode(ctx, request{method: http.MethodGet, path: "/api/v1/metadata"}, &result)
+	return result, err
+}
+
+// Metadata - возвращает описание метрики с именем name.
+func (c *Client) Metadata(ctx context.Context, name string) (Metadata, error) {
+	var result Metadata
+	err := c.decode(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/metadata/" + url.PathEscape(name),
+	}, &result)
+	return result, err
+}
+
+// UpdateMetadata - регистрирует или изменяет описание метрики meta и возвращает его в том виде, в котором
+// его сохранил сервер. Тип уже зарегистрированной метрики можно не указывать. Требует токена администратора.
+func (c *Client) UpdateMetadata(ctx context.Context, meta Metadata) (Metadata, error) {
+	var result Metadata
+	err := c.decode(ctx, request{
+		method: http.MethodPut,
+		path:   "/api/v1/metadata/" + url.PathEscape(meta.ID),
+		body:   meta,
+		admin:  true,
+	}, &result)
+	return result, err
+}
+
+// AgentConfig - возвращает настройки агента группы group, заданные на сервере. Идентификатор агента
+// задаётся параметром клиента WithAgentID.
+func (c *Client) AgentConfig(ctx context.Context, group string) (AgentConfig, error) {
+	header := map[string]string{}
+	if group != "" {
+		header[repositories.AgentGroupHeader] = group
+	}
+	var result AgentConfig
+	err := c.decode(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/agent/config",
+		header: header,
+		signed: true,
+	}, &result)
+	return result, err
+}
@@ -0,0 +1,217 @@
+// Packet client implement client of the metrics server API. The client signs, compresses and encrypts requests
+// the same way as the metrics agent, verifies signatures of the server answers and retries failed requests.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+)
+
+// Client - клиент API сервера метрик. Методы клиента можно вызывать одновременно из нескольких горутин.
+type Client struct {
+	address    string
+	http       *resty.Client
+	key        string
+	crypto     *encryption.Cryptographer
+	adminToken string
+	agentID    string
+	retry      RetryPolicy
+	log        *zap.Logger
+}
+
+// New - создаёт клиента сервера метрик с адресом address, например "localhost:8080" или "https://metrics.example.com".
+// Если схема в адресе не указана, используется http.
+func New(address string, opts ...Option) (*Client, error) {
+	o := options{
+		timeout: DefaultTimeout,
+		retry:   DefaultRetryPolicy,
+		log:     zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.retry.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retry policy: %w", err)
+	}
+	if o.cryptoKey != "" {
+		if _, err := encryption.ParsePublicKey(o.cryptoKey); err != nil {
+			return nil, fmt.Errorf("read public key error: %w", err)
+		}
+	}
+	httpClient := resty.New()
+	if o.httpClient != nil {
+		httpClient = resty.NewWithClient(o.httpClient)
+	}
+	httpClient.SetTimeout(o.timeout)
+
+	return &Client{
+		address:    normalizeAddress(address),
+		http:       httpClient,
+		key:        o.key,
+		crypto:     encryption.Initialize(o.cryptoKey, ""),
+		adminToken: o.adminToken,
+		agentID:    o.agentID,
+		retry:      o.retry,
+		log:        o.log,
+	}, nil
+}
+
+// normalizeAddress - добавляет к адресу сервера схему http, если она не указана, и убирает завершающий "/".
+func normalizeAddress(address string) string {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	return strings.TrimSuffix(address, "/")
+}
+
+// request - запрос к серверу метрик.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header map[string]string
+	body   any // тело запроса, сериализуется в json; nil - запрос без тела
+
+	signed   bool // запрос подписывается, сжимается и шифруется, подпись ответа проверяется
+	unsigned bool // сервер не подписывает ответ на подписанный запрос
+	admin    bool // запрос требует токена администратора
+}
+
+// do - выполняет запрос req, повторяя его при временных ошибках согласно политике повторов клиента.
+func (c *Client) do(ctx context.Context, req request) (*resty.Response, error) {
+	body, err := encodeBody(req.body)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		retry, wait := c.retry.Classify(err)
+		if !retry || attempt >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = c.retry.Backoff(attempt)
+		}
+		c.log.Debug("retry request to metrics server", zap.String("path", req.path), zap.Int("attempt", attempt),
+			zap.Duration("wait", wait), zap.String("error", error.Error(err)))
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// encodeBody - сериализует тело запроса в json.
+func encodeBody(body any) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("encode request body error: %w", err)
+	}
+	return data, nil
+}
+
+// send - однократно выполняет запрос req с телом body. Ответ со статусом, отличным от 200, возвращается
+// вместе с ошибкой *StatusError.
+func (c *Client) send(ctx context.Context, req request, body []byte) (*resty.Response, error) {
+	r := c.http.R().
+		SetContext(ctx).
+		SetHeader("Accept-Encoding", "gzip").
+		SetQueryParamsFromValues(req.query).
+		SetHeaders(req.header)
+	if c.agentID != "" {
+		r.SetHeader(repositories.AgentIDHeader, c.agentID)
+	}
+	if req.admin && c.adminToken != "" {
+		r.SetHeader("Authorization", "Bearer "+c.adminToken)
+	}
+	if req.signed {
+		if err := c.sign(r, body); err != nil {
+			return nil, err
+		}
+	} else if body != nil {
+		r.SetHeader("Content-Type", "application/json").SetBody(body)
+	}
+
+	resp, err := r.Execute(req.method, c.address+req.path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return resp, checker.NewStatusError(resp.StatusCode(), resp.Header().Get("Retry-After"), strings.TrimSpace(resp.String()))
+	}
+	// сервер подписывает ответ, только если задан ключ
+	if req.signed && !req.unsigned {
+		if err := hasher.VerifyHashMiddleware(c.key, c.log)(c.http, resp); err != nil {
+			return resp, fmt.Errorf("verify answer of server error: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// sign - подписывает тело запроса body ключом клиента, сжимает его и шифрует публичным ключом сервера так же,
+// как это делает агент. Подпись вычисляется от несжатого тела.
+func (c *Client) sign(r *resty.Request, body []byte) error {
+	if c.key != "" {
+		hash, err := repositories.CalkHash(body, c.key)
+		if err != nil {
+			return fmt.Errorf("calc hash error: %w", err)
+		}
+		r.SetHeader("HashSHA256", hash)
+	}
+	if body == nil {
+		return nil
+	}
+	data, err := compress.Compress(body)
+	if err != nil {
+		return fmt.Errorf("compress request body error: %w", err)
+	}
+	if c.crypto.PublicKeyIsSet() {
+		data, err = c.crypto.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("encrypt request body error: %w", err)
+		}
+	}
+	r.SetHeader("Content-Type", "application/json").
+		SetHeader("Content-Encoding", "gzip").
+		SetBody(data)
+	return nil
+}
+
+// decode - выполняет запрос req и десериализует json ответа сервера в result.
+func (c *Client) decode(ctx context.Context, req request, result any) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resp.Body(), result); err != nil {
+		return fmt.Errorf("decode answer of server error: %w", err)
+	}
+	return nil
+}
+
+// text - выполняет запрос req и возвращает тело ответа сервера в виде строки.
+func (c *Client) text(ctx context.Context, req request) (string, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.String(), nil
+}
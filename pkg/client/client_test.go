@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	serverapp "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
+)
+
+// newServer - запускает сервер метрик с параметрами, изменёнными функцией configure.
+func newServer(t *testing.T, configure func(cfg *serverapp.Config)) *httptest.Server {
+	cfg := serverapp.DefaultConfig()
+	configure(&cfg)
+	srv, err := serverapp.New(cfg, storage.NewDefaultMemStorage())
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", normalizeAddress("localhost:8080"))
+	assert.Equal(t, "https://metrics.example.com", normalizeAddress("https://metrics.example.com/"))
+}
+
+func TestClient(t *testing.T) {
+	keys := t.TempDir()
+	require.NoError(t, encryption.GenerateKeys(keys))
+	ts := newServer(t, func(cfg *serverapp.Config) {
+		cfg.Key = "secret"
+		cfg.CryptoKey = filepath.Join(keys, "private_key.pem")
+		cfg.AdminToken = "admin"
+	})
+	c, err := New(ts.URL, WithKey("secret"), WithCryptoKey(filepath.Join(keys, "public_key.pem")),
+		WithAdminToken("admin"), WithoutRetries())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// запись метрик подписывается и шифруется
+	m, err := c.UpdateMetric(ctx, Counter("requests", 5))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta)
+	require.NoError(t, c.UpdateBatch(ctx, []Metric{Counter("requests", 2), Gauge("load", 0.5), Gauge("mem", 100)}))
+
+	m, err = c.GetMetric(ctx, CounterType, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *m.Delta)
+	value, err := c.Value(ctx, GaugeType, "load")
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", value)
+
+	// отсутствующая метрика
+	_, err = c.GetMetric(ctx, GaugeType, "unknown")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+
+	// список метрик запрашивается страницами
+	page, err := c.ListMetrics(ctx, ListOptions{Selector: Selector{Type: GaugeType}, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Len(t, page.Metrics, 1)
+	assert.NotEmpty(t, page.NextCursor)
+	all, err := c.AllMetrics(ctx, Selector{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	meta, err := c.UpdateMetadata(ctx, Metadata{ID: "load", MType: GaugeType, Unit: "percent"})
+	require.NoError(t, err)
+	assert.Equal(t, "percent", meta.Unit)
+	meta, err = c.Metadata(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, "percent", meta.Unit)
+	metas, err := c.AllMetadata(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, metas)
+
+	result, err := c.Query(ctx, "load", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, result.Result, 1)
+	assert.Equal(t, 0.5, result.Result[0].Value)
+
+	history, err := c.History(ctx, "load", HistoryOptions{Range: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, "load", history.ID)
+	assert.NotEmpty(t, history.Samples)
+
+	text, err := c.Prometheus(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, text, "requests")
+	html, err := c.Plain(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, html, "load")
+
+	_, err = c.AgentConfig(ctx, "")
+	require.NoError(t, err)
+
+	// удаление метрик требует токена администратора
+	anonymous, err := New(ts.URL, WithKey("secret"), WithoutRetries())
+	require.NoError(t, err)
+	_, err = anonymous.DeleteMetric(ctx, "load")
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+	deleted, err := c.DeleteMetric(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = c.DeleteMetrics(ctx, Selector{Prefix: "re"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// сервер без базы данных не проходит проверку /ping
+	err = c.Ping(ctx)
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+}
+
+func TestUpdate(t *testing.T) {
+	ts := newServer(t, func(cfg *serverapp.Config) { cfg.Key = "secret" })
+	c, err := New(ts.URL, WithKey("secret"), WithoutRetries())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.Update(ctx, CounterType, "requests", "3"))
+	value, err := c.Value(ctx, CounterType, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	err = c.Update(ctx, CounterType, "requests", "three")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+
+	// запрос, подписанный другим ключом, отклоняется сервером
+	other, err := New(ts.URL, WithKey("other"), WithoutRetries())
+	require.NoError(t, err)
+	_, err = other.UpdateMetric(ctx, Gauge("load", 1))
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+}
+
+func TestVerifyAnswer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("HashSHA256", "00")
+		_, _ = res.Write([]byte(`{"id":"load","type":"gauge","value":1}`))
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, WithKey("secret"), WithoutRetries())
+	require.NoError(t, err)
+	_, err = c.GetMetric(context.Background(), GaugeType, "load")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "verify answer of server")
+
+	// подпись ответов проверяется только с ключом
+	c, err = New(ts.URL, WithoutRetries())
+	require.NoError(t, err)
+	_, err = c.GetMetric(context.Background(), GaugeType, "load")
+	require.NoError(t, err)
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(res, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		if req.URL.Path == "/value/gauge/bad" {
+			http.Error(res, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = res.Write([]byte("1"))
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, Base: time.Millisecond, Max: time.Millisecond}
+	c, err := New(ts.URL, WithRetryPolicy(policy))
+	require.NoError(t, err)
+
+	// временная ошибка сервера повторяется
+	value, err := c.Value(context.Background(), GaugeType, "load")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// постоянная ошибка не повторяется
+	_, err = c.Value(context.Background(), GaugeType, "bad")
+	require.Error(t, err)
+	assert.Equal(t, int32(4), calls.Load())
+
+	_, err = New(ts.URL, WithRetryPolicy(RetryPolicy{}))
+	require.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	ts := newServer(t, func(cfg *serverapp.Config) {})
+	c, err := New(ts.URL, WithoutRetries())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan Metric, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Stream(ctx, Selector{Prefix: "stream"}, func(m Metric) error {
+			received <- m
+			return errors.New("stop")
+		})
+	}()
+
+	// подписка появляется не сразу, поэтому обновление отправляется до его получения
+	require.Eventually(t, func() bool {
+		require.NoError(t, c.UpdateBatch(context.Background(), []Metric{Gauge("other", 1), Gauge("stream_load", 2)}))
+		select {
+		case m := <-received:
+			assert.Equal(t, "stream_load", m.ID)
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.EqualError(t, <-done, "stop")
+}
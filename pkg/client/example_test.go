@@ -0,0 +1,126 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"time"
+
+	serverapp "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/app"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/pkg/client"
+)
+
+// startServer - запускает сервер метрик, который подписывает данные ключом key.
+func startServer(key string) *httptest.Server {
+	cfg := serverapp.DefaultConfig()
+	cfg.Key = key
+	cfg.LogLevel = "error"
+	srv, err := serverapp.New(cfg, storage.NewDefaultMemStorage())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return httptest.NewServer(srv.Handler())
+}
+
+func ExampleNew() {
+	ts := startServer("secret")
+	defer ts.Close()
+
+	// запросы подписываются ключом, подписи ответов сервера проверяются
+	c, err := client.New(ts.URL, client.WithKey("secret"), client.WithTimeout(time.Second))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := c.UpdateMetric(context.Background(), client.Gauge("Alloc", 233184))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(m.ID, *m.Value)
+
+	// Output:
+	// Alloc 233184
+}
+
+func ExampleClient_UpdateBatch() {
+	ts := startServer("secret")
+	defer ts.Close()
+
+	c, err := client.New(ts.URL, client.WithKey("secret"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// сервер суммирует значения метрик типа "counter"
+	batch := []client.Metric{client.Counter("PollCount", 2), client.Counter("PollCount", 3), client.Gauge("RandomValue", 0.5)}
+	if err := c.UpdateBatch(ctx, batch); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	value, err := c.Value(ctx, client.CounterType, "PollCount")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(value)
+
+	// Output:
+	// 5
+}
+
+func ExampleClient_AllMetrics() {
+	ts := startServer("")
+	defer ts.Close()
+
+	c, err := client.New(ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.UpdateBatch(ctx, []client.Metric{
+		client.Gauge("http.latency", 0.25),
+		client.Gauge("http.size", 512),
+		client.Counter("PollCount", 1),
+	}); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// метрики отбираются по префиксу имени, все страницы списка запрашиваются автоматически
+	metrics, err := c.AllMetrics(ctx, client.Selector{Prefix: "http."})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, m := range metrics {
+		fmt.Println(m.ID, *m.Value)
+	}
+
+	// Output:
+	// http.latency 0.25
+	// http.size 512
+}
+
+func ExampleClient_Stream() {
+	c, err := client.New("localhost:8080")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// обновления метрик выводятся, пока не отменён контекст
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = c.Stream(ctx, client.Selector{Type: client.GaugeType}, func(m client.Metric) error {
+		fmt.Println(m.ID, *m.Value)
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
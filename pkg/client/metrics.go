@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Update - обновляет метрику типа mType с именем name значением value в текстовом формате, например
+// Update(ctx, "counter", "requests", "5"). Если на сервере включено шифрование, используйте UpdateMetric.
+func (c *Client) Update(ctx context.Context, mType, name, value string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/update/" + url.PathEscape(mType) + "/" + url.PathEscape(name) + "/" + url.PathEscape(value),
+		signed: true,
+		// ответ на обновление метрики в текстовом формате сервер не подписывает
+		unsigned: true,
+	})
+	return err
+}
+
+// UpdateMetric - обновляет метрику m и возвращает её в том виде, в котором её принял сервер.
+func (c *Client) UpdateMetric(ctx context.Context, m Metric) (Metric, error) {
+	var result Metric
+	err := c.decode(ctx, request{
+		method: http.MethodPost,
+		path:   "/update/",
+		body:   m,
+		signed: true,
+	}, &result)
+	return result, err
+}
+
+// UpdateBatch - обновляет метрики metrics одним запросом.
+func (c *Client) UpdateBatch(ctx context.Context, metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	var result []Metric
+	return c.decode(ctx, request{
+		method: http.MethodPost,
+		path:   "/updates/",
+		body:   metrics,
+		signed: true,
+	}, &result)
+}
+
+// Value - возвращает значение метрики типа mType с именем name в текстовом формате.
+func (c *Client) Value(ctx context.Context, mType, name string) (string, error) {
+	return c.text(ctx, request{
+		method: http.MethodGet,
+		path:   "/value/" + url.PathEscape(mType) + "/" + url.PathEscape(name),
+	})
+}
+
+// GetMetric - возвращает метрику типа mType с именем name.
+func (c *Client) GetMetric(ctx context.Context, mType, name string) (Metric, error) {
+	var result Metric
+	err := c.decode(ctx, request{
+		method: http.MethodPost,
+		path:   "/value/",
+		body:   Metric{ID: name, MType: mType},
+		signed: true,
+	}, &result)
+	return result, err
+}
+
+// Quantile - возвращает квантиль q от 0 до 1 метрики типа "histogram" с именем name.
+func (c *Client) Quantile(ctx context.Context, name string, q float64) (float64, error) {
+	value, err := c.text(ctx, request{
+		method: http.MethodGet,
+		path:   "/quantile/" + url.PathEscape(name) + "/" + strconv.FormatFloat(q, 'f', -1, 64),
+	})
+	if err != nil {
+		return 0, err
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse quantile error: %w", err)
+	}
+	return result, nil
+}
+
+// ListMetrics - возвращает страницу списка метрик, отобранных по условиям opts.
+func (c *Client) ListMetrics(ctx context.Context, opts ListOptions) (MetricsList, error) {
+	query := opts.Selector.values()
+	if opts.Limit != 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	var result MetricsList
+	err := c.decode(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/metrics",
+		query:  query,
+	}, &result)
+	return result, err
+}
+
+// AllMetrics - возвращает все метрики, отобранные по условиям selector, запрашивая список страницами.
+func (c *Client) AllMetrics(ctx context.Context, selector Selector) ([]Metric, error) {
+	opts := ListOptions{Selector: selector}
+	var result []Metric
+	for {
+		page, err := c.ListMetrics(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, page.Metrics...)
+		if page.NextCursor == "" {
+			return result, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// DeleteMetric - удаляет метрику с именем name всех типов и возвращает количество удалённых метрик.
+// Требует токена администратора.
+func (c *Client) DeleteMetric(ctx context.Context, name string) (int, error) {
+	var result deleteResult
+	err := c.decode(ctx, request{
+		method: http.MethodDelete,
+		path:   "/api/v1/metrics/" + url.PathEscape(name),
+		admin:  true,
+	}, &result)
+	return result.Deleted, err
+}
+
+// DeleteMetrics - удаляет метрики, отобранные по условиям selector, и возвращает количество удалённых метрик.
+// Должно быть задано хотя бы одно условие. Требует токена администратора.
+func (c *Client) DeleteMetrics(ctx context.Context, selector Selector) (int, error) {
+	var result deleteResult
+	err := c.decode(ctx, request{
+		method: http.MethodDelete,
+		path:   "/api/v1/metrics",
+		query:  selector.values(),
+		admin:  true,
+	}, &result)
+	return result.Deleted, err
+}
+
+// History - возвращает историю значений метрики с именем name.
+func (c *Client) History(ctx context.Context, name string, opts HistoryOptions) (MetricHistory, error) {
+	var result MetricHistory
+	err := c.decode(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/metrics/" + url.PathEscape(name) + "/history",
+		query:  opts.values(),
+	}, &result)
+	return result, err
+}
+
+// Plain - возвращает html страницу со значениями всех метрик.
+func (c *Client) Plain(ctx context.Context) (string, error) {
+	return c.text(ctx, request{method: http.MethodGet, path: "/plain"})
+}
+
+// Prometheus - возвращает все метрики в текстовом формате Prometheus.
+func (c *Client) Prometheus(ctx context.Context) (string, error) {
+	return c.text(ctx, request{method: http.MethodGet, path: "/metrics"})
+}
+
+// Ping - проверяет доступность сервера и его хранилища.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/ping"})
+	return err
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout - время ожидания ответа сервера на один запрос по умолчанию.
+const DefaultTimeout = 5 * time.Second
+
+// options - параметры, из которых создаётся клиент.
+type options struct {
+	key        string
+	cryptoKey  string
+	adminToken string
+	agentID    string
+	timeout    time.Duration
+	retry      RetryPolicy
+	httpClient *http.Client
+	log        *zap.Logger
+}
+
+// Option - параметр клиента, передаваемый в New.
+type Option func(*options)
+
+// WithKey - устанавливает ключ, которым подписываются запросы и проверяются подписи ответов сервера.
+func WithKey(key string) Option {
+	return func(o *options) { o.key = key }
+}
+
+// WithCryptoKey - устанавливает путь к публичному ключу сервера, которым шифруются тела запросов.
+func WithCryptoKey(path string) Option {
+	return func(o *options) { o.cryptoKey = path }
+}
+
+// WithAdminToken - устанавливает токен доступа к административным запросам, например удалению метрик.
+func WithAdminToken(token string) Option {
+	return func(o *options) { o.adminToken = token }
+}
+
+// WithAgentID - устанавливает идентификатор, который передаётся серверу в заголовке каждого запроса. По нему
+// сервер ограничивает частоту запросов и выбирает настройки агента.
+func WithAgentID(id string) Option {
+	return func(o *options) { o.agentID = id }
+}
+
+// WithTimeout - устанавливает время ожидания ответа сервера на один запрос, 0 - без ограничения.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithRetryPolicy - устанавливает параметры повтора запросов при временных ошибках. По умолчанию используются
+// те же параметры, что и у агента.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = policy }
+}
+
+// WithoutRetries - отключает повтор запросов.
+func WithoutRetries() Option {
+	return func(o *options) { o.retry = RetryPolicy{MaxAttempts: 1} }
+}
+
+// WithHTTPClient - устанавливает http клиент, через который выполняются запросы, например с настроенным TLS.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.httpClient = client }
+}
+
+// WithLogger - устанавливает логер клиента. По умолчанию клиент ничего не логирует.
+func WithLogger(log *zap.Logger) Option {
+	return func(o *options) { o.log = log }
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrStreamDropped - сервер закрыл поток обновлений, так как клиент не успевал их читать.
+var ErrStreamDropped = errors.New("stream is dropped by server: client is too slow")
+
+// Stream - подписывается на обновления метрик, отобранных по условиям selector, и вызывает handle для каждого
+// обновления. Отбор по меткам потоком не поддерживается. Возвращает ошибку handle, ErrStreamDropped, если сервер
+// закрыл поток из-за медленного клиента, или nil после отмены контекста ctx и закрытия потока сервером.
+// Запрос потока не повторяется и не ограничен временем ожидания.
+func (c *Client) Stream(ctx context.Context, selector Selector, handle func(Metric) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+"/api/v1/stream?"+selector.values().Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.agentID != "" {
+		req.Header.Set(repositories.AgentIDHeader, c.agentID)
+	}
+
+	// время ожидания ответа ограничивает и чтение тела, поэтому поток читается без него
+	httpClient := *c.http.GetClient()
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return checker.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"), strings.TrimSpace(string(body)))
+	}
+	return readEvents(ctx, bufio.NewScanner(resp.Body), handle)
+}
+
+// readEvents - читает события потока из body и передаёт обновления метрик в handle.
+func readEvents(ctx context.Context, body *bufio.Scanner, handle func(Metric) error) error {
+	var event, data string
+	for body.Scan() {
+		line := body.Text()
+		switch {
+		case line == "":
+			// пустая строка завершает событие
+			if err := dispatchEvent(event, data, handle); err != nil {
+				return err
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, ":"):
+			// комментарий, сервер поддерживает соединение
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := body.Err(); err != nil {
+		return fmt.Errorf("read stream error: %w", err)
+	}
+	return nil
+}
+
+// dispatchEvent - обрабатывает событие потока event с данными data.
+func dispatchEvent(event, data string, handle func(Metric) error) error {
+	switch event {
+	case "metric":
+		var m Metric
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return fmt.Errorf("decode stream event error: %w", err)
+		}
+		return handle(m)
+	case "dropped":
+		return ErrStreamDropped
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/worker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Типы метрик, которые поддерживает сервер.
+const (
+	GaugeType     = "gauge"
+	CounterType   = "counter"
+	HistogramType = "histogram"
+)
+
+type (
+	// Metric - метрика в формате API сервера.
+	Metric = repositories.Metric
+	// Histogram - значение метрики типа "histogram".
+	Histogram = repositories.Histogram
+	// Metadata - описание метрики.
+	Metadata = repositories.Metadata
+	// Sample - значение метрики в истории.
+	Sample = repositories.Sample
+	// Rollup - агрегат значений метрики за интервал истории.
+	Rollup = repositories.Rollup
+	// AgentConfig - настройки агента, заданные на сервере.
+	AgentConfig = repositories.AgentConfig
+	// StatusError - ошибка, которую возвращают методы клиента, если сервер ответил статусом, отличным от 200.
+	StatusError = checker.StatusError
+	// RetryPolicy - параметры повтора запросов при временных ошибках.
+	RetryPolicy = worker.RetryPolicy
+)
+
+// DefaultRetryPolicy - параметры повтора запросов по умолчанию.
+var DefaultRetryPolicy = worker.DefaultRetryPolicy
+
+// Gauge - создаёт метрику типа "gauge" со значением value.
+func Gauge(name string, value float64) Metric {
+	return builder.Gauge(name, value)
+}
+
+// Counter - создаёт метрику типа "counter" с приращением delta.
+func Counter(name string, delta int64) Metric {
+	return builder.Counter(name, delta)
+}
+
+// Selector - условия отбора метрик. Пустые условия не применяются.
+type Selector struct {
+	Name   string            // точное имя метрики
+	Type   string            // тип метрики
+	Prefix string            // префикс имени метрики
+	Match  string            // шаблон имени метрики в формате path.Match
+	Labels map[string]string // метки, которые должны быть у метрики
+}
+
+// values - возвращает условия отбора в виде параметров запроса.
+func (s Selector) values() url.Values {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("name", s.Name)
+	set("type", s.Type)
+	set("prefix", s.Prefix)
+	set("match", s.Match)
+	for key, value := range s.Labels {
+		query.Add("label", key+":"+value)
+	}
+	return query
+}
+
+// ListOptions - параметры запроса списка метрик.
+type ListOptions struct {
+	Selector
+	Limit  int    // количество метрик на странице, 0 - значение сервера по умолчанию
+	Cursor string // курсор страницы из MetricsList.NextCursor, пустой - первая страница
+}
+
+// MetricsList - страница списка метрик.
+type MetricsList struct {
+	Metrics    []Metric `json:"metrics"`               // метрики на текущей странице
+	Total      int      `json:"total"`                 // количество метрик, удовлетворяющих условиям отбора
+	NextCursor string   `json:"next_cursor,omitempty"` // курсор следующей страницы, пустой на последней странице
+}
+
+// HistoryOptions - параметры запроса истории метрики. Период задаётся либо границами From и To, либо
+// длительностью Range до текущего момента. Если период не задан, используется период сервера по умолчанию.
+type HistoryOptions struct {
+	From       time.Time
+	To         time.Time
+	Range      time.Duration
+	Resolution string // уровень истории: raw, 1m, 1h или auto
+}
+
+// values - возвращает параметры истории в виде параметров запроса.
+func (o HistoryOptions) values() url.Values {
+	query := url.Values{}
+	if !o.From.IsZero() {
+		query.Set("from", o.From.Format(time.RFC3339))
+	}
+	if !o.To.IsZero() {
+		query.Set("to", o.To.Format(time.RFC3339))
+	}
+	if o.Range != 0 {
+		query.Set("range", o.Range.String())
+	}
+	if o.Resolution != "" {
+		query.Set("resolution", o.Resolution)
+	}
+	return query
+}
+
+// MetricHistory - история значений метрики.
+type MetricHistory struct {
+	ID         string    `json:"id"`                // имя метрики
+	From       time.Time `json:"from"`              // начало периода
+	To         time.Time `json:"to"`                // конец периода
+	Resolution string    `json:"resolution"`        // уровень истории: raw, 1m или 1h
+	Samples    []Sample  `json:"samples"`           // значения метрики в порядке возрастания времени
+	Rollups    []Rollup  `json:"rollups,omitempty"` // агрегаты метрики, если уровень истории не raw
+}
+
+// Series - ряд результата запроса.
+type Series struct {
+	Metric string            `json:"metric,omitempty"` // имя метрики, пустое у результата агрегации
+	Labels map[string]string `json:"labels,omitempty"` // метки метрики или метки группировки у результата агрегации
+	Value  float64           `json:"value"`
+}
+
+// QueryResult - результат запроса к метрикам.
+type QueryResult struct {
+	Query  string    `json:"query"`  // выражение запроса в каноническом виде
+	Time   time.Time `json:"time"`   // момент, на который вычислены функции над периодом
+	Result []Series  `json:"result"` // ряды результата, отсортированные по имени метрики и меткам
+}
+
+// deleteResult - ответ сервера на удаление метрик.
+type deleteResult struct {
+	Deleted int `json:"deleted"`
+}